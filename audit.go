@@ -0,0 +1,192 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"context"
+	"time"
+)
+
+// AuditOutcome is the outcome of an audited operation.
+type AuditOutcome string
+
+const (
+	// AuditOutcomeSuccess is the outcome of the operations which succeeded.
+	AuditOutcomeSuccess AuditOutcome = "success"
+	// AuditOutcomeFailure is the outcome of the operations which failed, some of the objects of a DeleteBatch
+	// may have been deleted.
+	AuditOutcomeFailure AuditOutcome = "failure"
+)
+
+// AuditEvent describes a destructive operation, see CloudStorageOption.AuditFunc.
+type AuditEvent struct {
+	// Operation is the name of the CloudStorage method, e.g. "Delete".
+	Operation string
+	// Keys are the keys of the operation, the destination and then the source for Copy and Move.
+	Keys []string
+	// Version is the version deleted by DeleteVersion.
+	Version string
+	// Overwrite is set when the destination of Copy or Move existed before the operation.
+	Overwrite bool
+	Bucket    string
+	Outcome   AuditOutcome
+	// Err is the error of the operation, nil when it succeeded.
+	Err error
+	// Time is the time the operation ended at.
+	Time time.Time
+	// Actor is the actor of the context of the operation, see WithActor.
+	Actor string
+}
+
+type actorKey struct{}
+
+// WithActor returns a context whose operations are audited as done by the actor, e.g. "service:gdpr-worker".
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func actorFrom(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+
+	return actor
+}
+
+// auditingCloudStorage calls the AuditFunc after the destructive operations: Delete, DeleteBatch,
+// DeleteVersion, Move which deletes its source, and Copy when it overwrites its destination, which is checked
+// beforehand.
+type auditingCloudStorage struct {
+	CloudStorage
+
+	auditFunc  func(event AuditEvent)
+	logger     Logger
+	bucketName string
+}
+
+var _ CloudStorage = (*auditingCloudStorage)(nil)
+
+func newAuditingCloudStorage(inner CloudStorage, options storageOptions, bucketName string) CloudStorage {
+	return &auditingCloudStorage{
+		CloudStorage: inner,
+		auditFunc:    options.auditFunc,
+		logger:       options.logger,
+		bucketName:   bucketName,
+	}
+}
+
+// options returns the settings of the wrapped storage.
+func (ts *auditingCloudStorage) options() storageOptions {
+	return storageOptionsOf(ts.CloudStorage)
+}
+
+// bucketLocation is the one of the wrapped storage, so that CopyObjectBetween still copies by the provider.
+func (ts *auditingCloudStorage) bucketLocation() string {
+	locator, ok := ts.CloudStorage.(bucketLocator)
+	if !ok {
+		return ""
+	}
+
+	return locator.bucketLocation()
+}
+
+// audit calls the AuditFunc, whose panics are logged instead of failing the operation.
+func (ts *auditingCloudStorage) audit(ctx context.Context, event AuditEvent, err error) {
+	event.Bucket = ts.bucketName
+	event.Outcome = AuditOutcomeSuccess
+	event.Err = err
+	event.Time = time.Now()
+	event.Actor = actorFrom(ctx)
+
+	if err != nil {
+		event.Outcome = AuditOutcomeFailure
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			ts.logger.Errorf("unable to audit %s of %v in bucket '%s': %v", event.Operation, event.Keys,
+				ts.bucketName, r)
+		}
+	}()
+
+	ts.auditFunc(event)
+}
+
+// overwrites reports whether the destination of Copy or Move exists. It's assumed to exist when it can't
+// be checked, the failed operations are audited anyway.
+func (ts *auditingCloudStorage) overwrites(ctx context.Context, dstKey string) bool {
+	exists, err := ts.CloudStorage.Exists(ctx, dstKey)
+
+	return exists || err != nil
+}
+
+func (ts *auditingCloudStorage) Delete(
+	ctx context.Context,
+	key string,
+) error {
+	err := ts.CloudStorage.Delete(ctx, key)
+	ts.audit(ctx, AuditEvent{Operation: "Delete", Keys: []string{key}}, err)
+
+	return err
+}
+
+func (ts *auditingCloudStorage) DeleteBatch(
+	ctx context.Context,
+	keys []string,
+) error {
+	err := ts.CloudStorage.DeleteBatch(ctx, keys)
+	ts.audit(ctx, AuditEvent{Operation: "DeleteBatch", Keys: keys}, err)
+
+	return err
+}
+
+func (ts *auditingCloudStorage) DeleteVersion(
+	ctx context.Context,
+	key string,
+	version string,
+) error {
+	err := ts.CloudStorage.DeleteVersion(ctx, key, version)
+	ts.audit(ctx, AuditEvent{Operation: "DeleteVersion", Keys: []string{key}, Version: version}, err)
+
+	return err
+}
+
+func (ts *auditingCloudStorage) Copy(
+	ctx context.Context,
+	dstKey string,
+	srcKey string,
+) error {
+	if !ts.overwrites(ctx, dstKey) {
+		return ts.CloudStorage.Copy(ctx, dstKey, srcKey)
+	}
+
+	err := ts.CloudStorage.Copy(ctx, dstKey, srcKey)
+	ts.audit(ctx, AuditEvent{Operation: "Copy", Keys: []string{dstKey, srcKey}, Overwrite: true}, err)
+
+	return err
+}
+
+func (ts *auditingCloudStorage) Move(
+	ctx context.Context,
+	dstKey string,
+	srcKey string,
+) error {
+	overwrite := ts.overwrites(ctx, dstKey)
+
+	err := ts.CloudStorage.Move(ctx, dstKey, srcKey)
+	ts.audit(ctx, AuditEvent{Operation: "Move", Keys: []string{dstKey, srcKey}, Overwrite: overwrite}, err)
+
+	return err
+}
@@ -17,52 +17,94 @@
 package commonblobgo
 
 import (
+	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/md5" //nolint:gosec
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
 	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/service/cloudfront/sign"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"gocloud.dev/blob"
 	"gocloud.dev/blob/s3blob"
 )
 
+const (
+	// awsMaxCopyObjectSize is the biggest object that S3 can copy with a single CopyObject call
+	awsMaxCopyObjectSize = 5 * 1024 * 1024 * 1024
+	// awsCopyPartSize keeps the biggest possible object (5 TB) under the limit of 10000 parts
+	awsCopyPartSize = 512 * 1024 * 1024
+	// awsAbortTimeout bounds the abort of a failed multipart upload, which runs even when the context is done
+	awsAbortTimeout = 30 * time.Second
+	// awsMaxDeleteObjects is the biggest number of keys accepted by a single DeleteObjects call
+	awsMaxDeleteObjects = 1000
+	// awsMinPartSize is the smallest part of the multipart uploads, except for the last one
+	awsMinPartSize = 5 * 1024 * 1024
+	// awsMaxMetadataSize is the limit of the user-defined metadata, keys and values included
+	awsMaxMetadataSize = 2 * 1024
+	// awsMaxTags, awsMaxTagKeyLength and awsMaxTagValueLength are the limits of the object tags
+	awsMaxTags           = 10
+	awsMaxTagKeyLength   = 128
+	awsMaxTagValueLength = 256
+	// awsListPageSize is the biggest number of objects of a listing page
+	awsListPageSize = 1000
+	// awsListAttributesConcurrency is the default number of HEAD requests in flight when listing with the attributes
+	awsListAttributesConcurrency = 16
+	// awsRestoreInProgress is the error code of a restore requested again before the previous one finished
+	awsRestoreInProgress = "RestoreAlreadyInProgress"
+)
+
 type AWSCloudStorage struct {
+	storageOptions
+	closeState
+
+	client          *s3.S3
+	session         *session.Session
 	bucket          *blob.Bucket
 	bucketName      string
-	bucketCloseFunc func()
+	sseKMSKeyID     string
+	bucketCloseFunc func() error
 }
 
-func newAWSCloudStorage(
-	ctx context.Context,
+var _ CloudStorage = (*AWSCloudStorage)(nil)
+
+func newAWSSession(
 	s3Endpoint string,
 	s3Region string,
-	bucketName string,
-	accelerateEndpoint *bool,
+	accelerate bool,
 	tokenDuration time.Duration,
 	tokenExpiryWindow time.Duration,
-) (*AWSCloudStorage, error) {
-	// create vanilla AWS client
-	var awsConfig aws.Config
-
-	if s3Endpoint != "" {
-		awsConfig = aws.Config{
-			Endpoint:         aws.String(s3Endpoint),
-			Region:           aws.String(s3Region),
-			S3ForcePathStyle: aws.Bool(true),
-		}
-	} else {
-		awsConfig = aws.Config{
-			Region: aws.String(s3Region),
-		}
-		if accelerateEndpoint != nil {
-			awsConfig.S3UseAccelerate = accelerateEndpoint
-		}
+	maxRetries int,
+	debugger *httpDebugger,
+) (*session.Session, error) {
+	awsConfig, err := newAWSConfig(s3Endpoint, s3Region, accelerate, maxRetries)
+	if err != nil {
+		return nil, err
 	}
 
-	awsSession, err := session.NewSessionWithOptions(session.Options{
+	return newProviderAWSSession(session.Options{
 		Config: awsConfig,
 		CredentialsProviderOptions: &session.CredentialsProviderOptions{
 			WebIdentityRoleProviderOptions: func(wirp *stscreds.WebIdentityRoleProvider) {
@@ -70,26 +112,81 @@ func newAWSCloudStorage(
 				wirp.Duration = tokenDuration
 			},
 		},
-	},
-	)
+	}, debugger)
+}
+
+// newProviderAWSSession creates the session with the transport of the providers. The SDK only loads the CA bundle
+// of AWS_CA_BUNDLE into an *http.Transport, so the transport is wrapped once the session is created.
+func newProviderAWSSession(opts session.Options, debugger *httpDebugger) (*session.Session, error) {
+	opts.Config.HTTPClient = &http.Client{}
 
+	awsSession, err := session.NewSessionWithOptions(opts)
 	if err != nil {
 		return nil, err
 	}
 
-	bucket, err := s3blob.OpenBucket(ctx, awsSession, bucketName, nil)
+	httpClient := awsSession.Config.HTTPClient
+	httpClient.Transport = newProviderTransport(httpClient.Transport, debugger)
+
+	return awsSession, nil
+}
+
+// newAWSConfig addresses the buckets path-style on a custom endpoint, and virtual-hosted otherwise, as S3 Transfer
+// Acceleration requires. With acceleration, the requests, the signed URLs and the public URLs of the client use the
+// s3-accelerate.amazonaws.com endpoint, and a custom endpoint is rejected.
+// The retries of the SDK are disabled when the storages retry the transient errors themselves, with positive
+// maxRetries, so that the retries don't multiply.
+func newAWSConfig(s3Endpoint, s3Region string, accelerate bool, maxRetries int) (aws.Config, error) {
+	var config aws.Config
+
+	if s3Endpoint != "" {
+		if accelerate {
+			return aws.Config{}, newTypedError(ErrInvalidArgument,
+				fmt.Errorf("S3 Transfer Acceleration can't be used with the custom endpoint %s", s3Endpoint))
+		}
+
+		config = aws.Config{
+			Endpoint:         aws.String(s3Endpoint),
+			Region:           aws.String(s3Region),
+			S3ForcePathStyle: aws.Bool(true),
+		}
+	} else {
+		config = aws.Config{
+			Region:           aws.String(s3Region),
+			S3UseAccelerate:  aws.Bool(accelerate),
+			S3ForcePathStyle: aws.Bool(false),
+		}
+	}
+
+	if maxRetries > 0 {
+		config.MaxRetries = aws.Int(0)
+	}
+
+	return config, nil
+}
+
+func newAWSCloudStorage(
+	ctx context.Context,
+	awsSession *session.Session,
+	bucketName string,
+	sseKMSKeyID string,
+	storageOpts storageOptions,
+) (*AWSCloudStorage, error) {
+	bucket, err := s3blob.OpenBucket(ctx, withAWSChecksumMode(awsSession), bucketName, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	logrus.Infof("AWSCloudStorage created")
+	storageOpts.logger.Infof("AWSCloudStorage created")
 
 	return &AWSCloudStorage{
-		bucketName: bucketName,
-		bucket:     bucket,
-		bucketCloseFunc: func() {
-			bucket.Close()
-		},
+		client:          s3.New(awsSession),
+		session:         awsSession,
+		bucketName:      bucketName,
+		bucket:          bucket,
+		sseKMSKeyID:     sseKMSKeyID,
+		storageOptions:  storageOpts,
+		bucketCloseFunc: bucket.Close,
 	}, nil
 }
 
@@ -101,7 +198,7 @@ func (ts *AWSCloudStorage) List(
 		Prefix: prefix,
 	})
 
-	return newListIterator(func() (*ListObject, error) {
+	return newReplayableListIterator(func(ctx context.Context) (*ListObject, error) {
 		attrs, err := iter.Next(ctx)
 		if err != nil {
 			return nil, err
@@ -109,7 +206,7 @@ func (ts *AWSCloudStorage) List(
 
 		return &ListObject{
 			Key:     attrs.Key,
-			ModTime: attrs.ModTime,
+			ModTime: attrs.ModTime.UTC(),
 			Size:    attrs.Size,
 			MD5:     attrs.MD5,
 		}, nil
@@ -120,12 +217,13 @@ func (ts *AWSCloudStorage) ListWithOptions(
 	ctx context.Context,
 	listOptions *ListOptions,
 ) *ListIterator {
-	iter := ts.bucket.List(&blob.ListOptions{
-		Prefix:    listOptions.Prefix,
-		Delimiter: listOptions.Delimiter,
-	})
+	iter := ts.bucket.List(newBlobListOptions(listOptions))
+
+	if listOptions.IncludeAttributes {
+		return applyListOptions(listAWSObjectsWithAttributes(ctx, ts.client, ts.bucketName, iter, listOptions), listOptions)
+	}
 
-	return newListIterator(func() (*ListObject, error) {
+	return applyListOptions(newReplayableListIterator(func(ctx context.Context) (*ListObject, error) {
 		attrs, err := iter.Next(ctx)
 		if err != nil {
 			return nil, err
@@ -133,26 +231,45 @@ func (ts *AWSCloudStorage) ListWithOptions(
 
 		return &ListObject{
 			Key:     attrs.Key,
-			ModTime: attrs.ModTime,
+			ModTime: attrs.ModTime.UTC(),
 			Size:    attrs.Size,
 			MD5:     attrs.MD5,
 			IsDir:   attrs.IsDir,
 		}, nil
-	})
+	}), listOptions)
 }
 
 func (ts *AWSCloudStorage) Get(
 	ctx context.Context,
 	key string,
 ) ([]byte, error) {
-	return ts.bucket.ReadAll(ctx, key)
+	return readAllAndClose(ts.GetReader(ctx, key))
+}
+
+func (ts *AWSCloudStorage) GetIfModified(
+	ctx context.Context,
+	key string,
+	etag string,
+	modSince time.Time,
+) ([]byte, *Attributes, bool, error) {
+	return getAWSObjectIfModified(ctx, ts.client, ts.bucketName, key, etag, modSince, !ts.disableDecompression)
+}
+
+// GetWithAttributes reads the attributes from the headers of the GET response.
+func (ts *AWSCloudStorage) GetWithAttributes(
+	ctx context.Context,
+	key string,
+) ([]byte, *Attributes, error) {
+	body, attrs, _, err := getAWSObjectIfModified(ctx, ts.client, ts.bucketName, key, "", time.Time{}, !ts.disableDecompression)
+
+	return body, attrs, err
 }
 
 func (ts *AWSCloudStorage) GetReader(
 	ctx context.Context,
 	key string,
 ) (io.ReadCloser, error) {
-	return ts.bucket.NewReader(ctx, key, nil)
+	return newBlobReader(ctx, ts.bucket, key, !ts.disableDecompression)
 }
 
 func (ts *AWSCloudStorage) GetRangeReader(
@@ -161,14 +278,57 @@ func (ts *AWSCloudStorage) GetRangeReader(
 	offset,
 	length int64,
 ) (io.ReadCloser, error) {
-	return ts.bucket.NewRangeReader(ctx, key, offset, length, nil)
+	return newRangeReader(ctx, ts.bucket, key, offset, length)
 }
 
 func (ts *AWSCloudStorage) GetWriter(
 	ctx context.Context,
 	key string,
 ) (io.WriteCloser, error) {
-	return ts.bucket.NewWriter(ctx, key, nil)
+	return ts.GetWriterWithOptions(ctx, key, nil)
+}
+
+func (ts *AWSCloudStorage) GetWriterWithOptions(
+	ctx context.Context,
+	key string,
+	opts *WriteOptions,
+) (io.WriteCloser, error) {
+	opts = ts.uploadOptions(opts)
+
+	if err := opts.validateConditions(); err != nil {
+		return nil, err
+	}
+
+	if err := validateAWSMetadata(opts); err != nil {
+		return nil, err
+	}
+
+	if err := validateAWSPartSize(int64(opts.BufferSize)); err != nil {
+		return nil, err
+	}
+
+	// the checksum of the whole object can't be sent with the parts of a multipart upload
+	if opts != nil && opts.ChecksumAlgorithm != "" {
+		return nil, newTypedError(ErrNotSupported, fmt.Errorf("checksum algorithms of streamed writes on S3"))
+	}
+
+	compress := opts != nil && opts.Compress
+	if compress {
+		opts = compressedOptions(opts)
+	}
+
+	return newUploadWriter(ctx, opts, func(ctx context.Context) (io.WriteCloser, error) {
+		writer, err := ts.bucket.NewWriter(ctx, key, newAWSWriterOptions(opts, ts.sseKMSKeyID, ts.verifiesChecksum(opts)))
+		if err != nil {
+			return nil, err
+		}
+
+		if compress {
+			return newGzipWriteCloser(&typedErrorWriter{writer}), nil
+		}
+
+		return &typedErrorWriter{writer}, nil
+	})
 }
 
 func (ts *AWSCloudStorage) CreateBucket(
@@ -176,12 +336,100 @@ func (ts *AWSCloudStorage) CreateBucket(
 	bucketPrefix string,
 	expirationTimeDays int64,
 ) error {
-	// not supported for prod
-	return nil
+	return ts.CreateBucketWithOptions(ctx, &CreateBucketOptions{Prefix: bucketPrefix, ExpirationDays: expirationTimeDays})
+}
+
+func (ts *AWSCloudStorage) CreateBucketWithOptions(
+	ctx context.Context,
+	opts *CreateBucketOptions,
+) error {
+	if !ts.allowBucketCreation {
+		ts.log().Warnf("CreateBucket of '%s' is ignored, the bucket creation isn't allowed", ts.bucketName)
+
+		return nil
+	}
+
+	return createAWSBucket(ctx, ts.client, ts.bucketName, opts, ts.log())
+}
+
+func (ts *AWSCloudStorage) SetLifecycle(
+	ctx context.Context,
+	rules []LifecycleRule,
+	opts *LifecycleOptions,
+) error {
+	return setAWSLifecycle(ctx, ts.client, ts.bucketName, rules, opts)
+}
+
+func (ts *AWSCloudStorage) GetLifecycle(
+	ctx context.Context,
+) ([]LifecycleRule, error) {
+	return getAWSLifecycle(ctx, ts.client, ts.bucketName)
+}
+
+func (ts *AWSCloudStorage) SetVersioning(
+	ctx context.Context,
+	enabled bool,
+) error {
+	return setAWSVersioning(ctx, ts.client, ts.bucketName, enabled)
+}
+
+func (ts *AWSCloudStorage) GetVersioning(
+	ctx context.Context,
+) (bool, error) {
+	state, err := ts.GetVersioningState(ctx)
+
+	return state == VersioningEnabled, err
+}
+
+func (ts *AWSCloudStorage) GetVersioningState(
+	ctx context.Context,
+) (VersioningState, error) {
+	return getAWSVersioningState(ctx, ts.client, ts.bucketName)
+}
+
+func (ts *AWSCloudStorage) SetCORS(
+	ctx context.Context,
+	rules []CORSRule,
+) error {
+	return setAWSCORS(ctx, ts.client, ts.bucketName, rules)
+}
+
+func (ts *AWSCloudStorage) GetCORS(
+	ctx context.Context,
+) ([]CORSRule, error) {
+	return getAWSCORS(ctx, ts.client, ts.bucketName)
+}
+
+func (ts *AWSCloudStorage) SetPublicAccessBlock(
+	ctx context.Context,
+	blocked bool,
+) error {
+	return setAWSPublicAccessBlock(ctx, ts.client, ts.bucketName, blocked)
+}
+
+func (ts *AWSCloudStorage) GetPublicAccessBlock(
+	ctx context.Context,
+) (bool, error) {
+	block, err := ts.GetPublicAccessBlockDetails(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return block.Blocked(), nil
 }
 
-func (ts *AWSCloudStorage) Close() {
-	ts.bucketCloseFunc()
+func (ts *AWSCloudStorage) GetPublicAccessBlockDetails(
+	ctx context.Context,
+) (*PublicAccessBlock, error) {
+	return getAWSPublicAccessBlock(ctx, ts.client, ts.bucketName)
+}
+
+func (ts *AWSCloudStorage) Close() error {
+	if !ts.markClosed() {
+		return nil
+	}
+
+	return ts.bucketCloseFunc()
 }
 
 func (ts *AWSCloudStorage) GetSignedURL(
@@ -189,6 +437,23 @@ func (ts *AWSCloudStorage) GetSignedURL(
 	key string,
 	opts *SignedURLOption,
 ) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	if host := signedURLHost(opts, ts.storageOptions); host != "" {
+		return signCloudFrontURL(ts.cloudFrontSigner, host, key, opts)
+	}
+
+	if opts.AllowedSourceIP != "" {
+		return "", newTypedError(ErrNotSupported,
+			fmt.Errorf("source IP restrictions of S3 presigned URLs, they require the CloudFront signed URLs of a host override"))
+	}
+
+	if (opts.Method == http.MethodPut && ts.sseKMSKeyID != "") || opts.hasResponseOverrides() || len(opts.SignedHeaders) > 0 {
+		return presignAWSRequest(ctx, ts.client, ts.bucketName, key, opts, ts.sseKMSKeyID)
+	}
+
 	options := &blob.SignedURLOptions{
 		Expiry:                   opts.Expiry,
 		Method:                   opts.Method,
@@ -196,7 +461,62 @@ func (ts *AWSCloudStorage) GetSignedURL(
 		EnforceAbsentContentType: opts.EnforceAbsentContentType,
 	}
 
-	return ts.bucket.SignedURL(context.Background(), key, options)
+	return ts.bucket.SignedURL(ctx, key, options)
+}
+
+func (ts *AWSCloudStorage) GetSignedPostPolicy(
+	ctx context.Context,
+	keyPrefix string,
+	opts *PostPolicyOptions,
+) (*PostPolicy, error) {
+	return newAWSPostPolicy(ctx, ts.client, ts.bucketName, keyPrefix, opts, ts.sseKMSKeyID)
+}
+
+func (ts *AWSCloudStorage) GetPublicURL(
+	key string,
+) (string, error) {
+	return awsPublicURL(ts.client, ts.bucketName, key)
+}
+
+// As sets i, a **s3.S3 or a **session.Session, to the S3 client or to the AWS session of the storage, shared
+// with the other buckets of the factory. The other types aren't supported.
+func (ts *AWSCloudStorage) As(i interface{}) bool {
+	return asAWSClients(i, ts.client, ts.session)
+}
+
+func (ts *AWSCloudStorage) StartMultipartUpload(
+	ctx context.Context,
+	key string,
+	opts *WriteOptions,
+) (string, error) {
+	return startAWSMultipartUpload(ctx, ts.client, ts.bucketName, key, opts, ts.sseKMSKeyID)
+}
+
+func (ts *AWSCloudStorage) SignUploadPartURL(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	partNumber int,
+	expiry time.Duration,
+) (string, error) {
+	return signAWSUploadPartURL(ctx, ts.client, ts.bucketName, key, uploadID, partNumber, expiry)
+}
+
+func (ts *AWSCloudStorage) CompleteMultipartUpload(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	parts []CompletedPart,
+) error {
+	return completeAWSMultipartUpload(ctx, ts.client, ts.bucketName, key, uploadID, parts)
+}
+
+func (ts *AWSCloudStorage) AbortMultipartUpload(
+	ctx context.Context,
+	key string,
+	uploadID string,
+) error {
+	return abortAWSMultipartUpload(ctx, ts.client, ts.bucketName, key, uploadID)
 }
 
 func (ts *AWSCloudStorage) Write(
@@ -205,50 +525,2333 @@ func (ts *AWSCloudStorage) Write(
 	body []byte,
 	contentType *string,
 ) error {
-	options := &blob.WriterOptions{}
+	options := &WriteOptions{}
 	if contentType != nil {
 		options.ContentType = *contentType
 	}
 
-	return ts.bucket.WriteAll(ctx, key, body, options)
+	return ts.WriteWithOptions(ctx, key, body, options)
+}
+
+func (ts *AWSCloudStorage) WriteWithOptions(
+	ctx context.Context,
+	key string,
+	body []byte,
+	opts *WriteOptions,
+) error {
+	if err := opts.validateConditions(); err != nil {
+		return err
+	}
+
+	if err := validateAWSMetadata(opts); err != nil {
+		return err
+	}
+
+	body, opts, err := compressBody(body, opts)
+	if err != nil {
+		return err
+	}
+
+	options := newAWSWriterOptions(opts, ts.sseKMSKeyID, ts.verifiesChecksum(opts))
+
+	// the whole body is in memory anyway, so that S3 can check its MD5
+	if !ts.awsDisableContentMD5 {
+		options.ContentMD5 = md5Sum(body)
+	}
+
+	if err := withAWSChecksum(options, opts, body); err != nil {
+		return err
+	}
+
+	return objectError(ts.bucket.WriteAll(ctx, key, body, options))
 }
 
 func (ts *AWSCloudStorage) Delete(
 	ctx context.Context,
 	key string,
 ) error {
-	return ts.bucket.Delete(ctx, key)
+	return objectError(ts.bucket.Delete(ctx, key))
+}
+
+func (ts *AWSCloudStorage) DeleteBatch(
+	ctx context.Context,
+	keys []string,
+) error {
+	return deleteAWSObjects(ctx, ts.client, ts.bucketName, keys)
 }
 
 func (ts *AWSCloudStorage) Attributes(
 	ctx context.Context,
 	key string,
 ) (*Attributes, error) {
-	attrs, err := ts.bucket.Attributes(ctx, key)
+	return getBlobAttributes(ctx, ts.bucket, key)
+}
+
+// GetSize shares the HEAD request of Attributes.
+func (ts *AWSCloudStorage) GetSize(
+	ctx context.Context,
+	key string,
+) (int64, error) {
+	attrs, err := getBlobAttributes(ctx, ts.bucket, key)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	return &Attributes{
-		CacheControl:       attrs.CacheControl,
-		ContentDisposition: attrs.ContentDisposition,
-		ContentEncoding:    attrs.ContentEncoding,
-		ContentLanguage:    attrs.ContentLanguage,
-		ContentType:        attrs.ContentType,
-		Metadata:           attrs.Metadata,
-		ModTime:            attrs.ModTime,
-		Size:               attrs.Size,
-		MD5:                attrs.MD5,
-	}, nil
+	return attrs.Size, nil
+}
+
+func (ts *AWSCloudStorage) VerifyDownload(
+	ctx context.Context,
+	key string,
+) error {
+	return verifyDownload(ctx, ts, key, func() (io.ReadCloser, error) {
+		return newBlobReader(ctx, ts.bucket, key, false)
+	})
+}
+
+func (ts *AWSCloudStorage) SetTags(
+	ctx context.Context,
+	key string,
+	tags map[string]string,
+) error {
+	return setAWSTags(ctx, ts.client, ts.bucketName, key, tags)
+}
+
+func (ts *AWSCloudStorage) GetTags(
+	ctx context.Context,
+	key string,
+) (map[string]string, error) {
+	return getAWSTags(ctx, ts.client, ts.bucketName, key)
+}
+
+func (ts *AWSCloudStorage) SetStorageClass(
+	ctx context.Context,
+	key string,
+	class string,
+) error {
+	return setAWSStorageClass(ctx, ts.client, ts.bucketName, key, class, ts.log())
 }
 
 func (ts *AWSCloudStorage) Exists(
 	ctx context.Context,
 	key string,
 ) (bool, error) {
-	return ts.bucket.Exists(ctx, key)
+	return existsAWSObject(ctx, ts.client, ts.bucketName, key)
+}
+
+func (ts *AWSCloudStorage) bucketLocation() string {
+	return "aws/" + ts.bucketName
 }
 
 func (ts *AWSCloudStorage) Copy(ctx context.Context, dstKey, srcKey string) error {
-	return ts.bucket.Copy(ctx, dstKey, srcKey, nil)
+	return copyAWSObject(ctx, ts.client, ts.bucket, ts.bucketName, dstKey, srcKey, ts.sseKMSKeyID, ts.log())
+}
+
+func (ts *AWSCloudStorage) Move(ctx context.Context, dstKey, srcKey string) error {
+	// the source is kept when the copy failed
+	if err := ts.Copy(ctx, dstKey, srcKey); err != nil {
+		return err
+	}
+
+	if dstKey == srcKey {
+		return nil
+	}
+
+	return ts.Delete(ctx, srcKey)
+}
+
+func (ts *AWSCloudStorage) Ping(ctx context.Context) error {
+	_, err := ts.client.HeadBucketWithContext(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(ts.bucketName),
+	})
+
+	return awsBucketError(err)
+}
+
+func (ts *AWSCloudStorage) ListVersions(
+	ctx context.Context,
+	prefix string,
+) *VersionIterator {
+	return listAWSVersions(ctx, ts.client, ts.bucketName, prefix)
+}
+
+func (ts *AWSCloudStorage) GetVersion(
+	ctx context.Context,
+	key string,
+	version string,
+) ([]byte, error) {
+	return getAWSVersion(ctx, ts.client, ts.bucketName, key, version)
+}
+
+func (ts *AWSCloudStorage) DeleteVersion(
+	ctx context.Context,
+	key string,
+	version string,
+) error {
+	return deleteAWSVersion(ctx, ts.client, ts.bucketName, key, version)
+}
+
+func (ts *AWSCloudStorage) SetObjectRetention(
+	ctx context.Context,
+	key string,
+	until time.Time,
+	mode string,
+) error {
+	return setAWSObjectRetention(ctx, ts.client, ts.bucketName, key, until, mode)
+}
+
+func (ts *AWSCloudStorage) GetObjectRetention(
+	ctx context.Context,
+	key string,
+) (*ObjectRetention, error) {
+	return getAWSObjectRetention(ctx, ts.client, ts.bucketName, key)
+}
+
+func (ts *AWSCloudStorage) Restore(
+	ctx context.Context,
+	key string,
+	days int,
+	tier string,
+) error {
+	return restoreAWSObject(ctx, ts.client, ts.bucketName, key, days, tier)
+}
+
+func (ts *AWSCloudStorage) RestoreStatus(
+	ctx context.Context,
+	key string,
+) (RestoreState, error) {
+	return getAWSRestoreState(ctx, ts.client, ts.bucketName, key)
+}
+
+func (ts *AWSCloudStorage) Append(
+	ctx context.Context,
+	key string,
+	data []byte,
+) error {
+	return appendAWSObject(ctx, ts.client, ts.bucketName, key, data, ts.sseKMSKeyID, ts.log())
+}
+
+func (ts *AWSCloudStorage) UpdateAttributes(
+	ctx context.Context,
+	key string,
+	update AttributeUpdate,
+) (*Attributes, error) {
+	return updateAWSAttributes(ctx, ts.client, ts.bucketName, key, update, ts.log())
+}
+
+// copyAWSObject makes a server-side copy of the object, objects bigger than 5 GB are copied part by part.
+func copyAWSObject(
+	ctx context.Context,
+	client *s3.S3,
+	bucket *blob.Bucket,
+	bucketName string,
+	dstKey string,
+	srcKey string,
+	sseKMSKeyID string,
+	logger Logger,
+) error {
+	attrs, err := bucket.Attributes(ctx, srcKey)
+	if err != nil {
+		return objectError(err)
+	}
+
+	if dstKey == srcKey {
+		// S3 rejects copying an object onto itself without changes, the content is already in place
+		return nil
+	}
+
+	if attrs.Size <= awsMaxCopyObjectSize {
+		return objectError(bucket.Copy(ctx, dstKey, srcKey, newAWSCopyOptions(sseKMSKeyID)))
+	}
+
+	return copyAWSObjectMultipart(ctx, client, bucketName, dstKey, srcKey, attrs, sseKMSKeyID, logger)
+}
+
+func copyAWSObjectMultipart(
+	ctx context.Context,
+	client *s3.S3,
+	bucketName string,
+	dstKey string,
+	srcKey string,
+	attrs *blob.Attributes,
+	sseKMSKeyID string,
+	logger Logger,
+) error {
+	input := &s3.CreateMultipartUploadInput{
+		Bucket:             aws.String(bucketName),
+		Key:                aws.String(dstKey),
+		CacheControl:       awsOptionalString(attrs.CacheControl),
+		ContentDisposition: awsOptionalString(attrs.ContentDisposition),
+		ContentEncoding:    awsOptionalString(attrs.ContentEncoding),
+		ContentLanguage:    awsOptionalString(attrs.ContentLanguage),
+		ContentType:        awsOptionalString(attrs.ContentType),
+		Metadata:           aws.StringMap(attrs.Metadata),
+	}
+
+	if sseKMSKeyID != "" {
+		input.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAwsKms)
+		input.SSEKMSKeyId = aws.String(sseKMSKeyID)
+	}
+
+	return copyAWSObjectWithParts(ctx, client, input, srcKey, attrs.Size, nil, "copy", logger)
+}
+
+// copyAWSObjectWithParts copies the source object into the object of the input with a multipart upload, for the
+// objects too big for CopyObject. The upload is aborted on failure.
+func copyAWSObjectWithParts(
+	ctx context.Context,
+	client *s3.S3,
+	input *s3.CreateMultipartUploadInput,
+	srcKey string,
+	srcSize int64,
+	srcETag *string,
+	op string,
+	logger Logger,
+) error {
+	bucketName, dstKey := aws.StringValue(input.Bucket), aws.StringValue(input.Key)
+
+	upload, err := client.CreateMultipartUploadWithContext(ctx, input)
+	if err != nil {
+		return objectError(err)
+	}
+
+	abort := func() {
+		abortFailedAWSMultipartUpload(client, bucketName, dstKey, upload.UploadId, op, logger)
+	}
+
+	parts, err := copyAWSParts(ctx, client, bucketName, dstKey, srcKey, srcSize, srcETag, upload.UploadId)
+	if err != nil {
+		abort()
+
+		return objectError(err)
+	}
+
+	_, err = client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucketName),
+		Key:             aws.String(dstKey),
+		UploadId:        upload.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		abort()
+
+		return objectError(err)
+	}
+
+	return nil
+}
+
+// abortFailedAWSMultipartUpload removes the parts of the failed upload, with a context of its own since the one of
+// the operation may be the cause of the failure, e.g. canceled or past its deadline.
+func abortFailedAWSMultipartUpload(client *s3.S3, bucketName, key string, uploadID *string, op string, logger Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), awsAbortTimeout)
+	defer cancel()
+
+	_, err := client.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(bucketName),
+		Key:      aws.String(key),
+		UploadId: uploadID,
+	})
+	if err != nil {
+		logger.Errorf("unable to abort multipart %s of '%s': %v", op, key, err)
+	}
+}
+
+// copyAWSParts copies the source object into the parts of a multipart upload, starting with the part number 1.
+func copyAWSParts(
+	ctx context.Context,
+	client *s3.S3,
+	bucketName string,
+	dstKey string,
+	srcKey string,
+	srcSize int64,
+	srcETag *string,
+	uploadID *string,
+) ([]*s3.CompletedPart, error) {
+	var parts []*s3.CompletedPart
+
+	for partNumber, offset := int64(1), int64(0); offset < srcSize; partNumber++ {
+		end := offset + awsCopyPartSize - 1
+		if end >= srcSize-awsMinPartSize {
+			// the remainder is merged into this part, so that a part can be appended after the copy
+			end = srcSize - 1
+		}
+
+		part, err := client.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+			Bucket:            aws.String(bucketName),
+			Key:               aws.String(dstKey),
+			CopySource:        aws.String(awsCopySource(bucketName, srcKey)),
+			CopySourceIfMatch: srcETag,
+			CopySourceRange:   aws.String(fmt.Sprintf("bytes=%d-%d", offset, end)),
+			PartNumber:        aws.Int64(partNumber),
+			UploadId:          uploadID,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		parts = append(parts, &s3.CompletedPart{
+			ETag:       part.CopyPartResult.ETag,
+			PartNumber: aws.Int64(partNumber),
+		})
+
+		offset = end + 1
+	}
+
+	return parts, nil
+}
+
+// awsCopySource builds the URL-encoded "bucket/key" value expected by the S3 copy calls.
+func awsCopySource(bucketName, key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	return bucketName + "/" + strings.Join(segments, "/")
+}
+
+// awsOptionalString doesn't send empty headers to S3.
+func awsOptionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+
+	return aws.String(value)
+}
+
+// deleteAWSObjects deletes the objects with DeleteObjects calls, S3 counts the objects which don't exist as deleted.
+func deleteAWSObjects(ctx context.Context, client *s3.S3, bucketName string, keys []string) error {
+	failures := make(map[string]error)
+
+	for start := 0; start < len(keys); start += awsMaxDeleteObjects {
+		end := start + awsMaxDeleteObjects
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		objects := make([]*s3.ObjectIdentifier, 0, end-start)
+		for _, key := range keys[start:end] {
+			objects = append(objects, &s3.ObjectIdentifier{Key: aws.String(key)})
+		}
+
+		output, err := client.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucketName),
+			Delete: &s3.Delete{
+				Objects: objects,
+				Quiet:   aws.Bool(true),
+			},
+		})
+		if err != nil {
+			for _, key := range keys[start:end] {
+				failures[key] = err
+			}
+
+			continue
+		}
+
+		for _, deleteErr := range output.Errors {
+			failures[aws.StringValue(deleteErr.Key)] = fmt.Errorf("%s: %s",
+				aws.StringValue(deleteErr.Code), aws.StringValue(deleteErr.Message))
+		}
+	}
+
+	if len(failures) > 0 {
+		return &BatchError{Errors: failures}
+	}
+
+	return nil
+}
+
+// validateAWSMetadata fails before sending the request, instead of getting a 400 from S3.
+func validateAWSMetadata(opts *WriteOptions) error {
+	if opts == nil {
+		return nil
+	}
+
+	size := 0
+	for key, value := range opts.Metadata {
+		size += len(key) + len(value)
+	}
+
+	if size > awsMaxMetadataSize {
+		return newTypedError(ErrMetadataTooLarge,
+			fmt.Errorf("metadata is %d bytes, S3 allows at most %d bytes", size, awsMaxMetadataSize))
+	}
+
+	return nil
+}
+
+// validateAWSPartSize fails before the upload starts, instead of getting a 400 from S3 for the first part.
+func validateAWSPartSize(partSize int64) error {
+	if partSize != 0 && partSize < awsMinPartSize {
+		return newTypedError(ErrInvalidArgument,
+			fmt.Errorf("upload part size is %d bytes, S3 requires at least %d bytes", partSize, awsMinPartSize))
+	}
+
+	return nil
+}
+
+// validateAWSTags fails before sending the request, instead of getting a 400 from S3.
+func validateAWSTags(tags map[string]string) error {
+	if len(tags) > awsMaxTags {
+		return newTypedError(ErrInvalidArgument,
+			fmt.Errorf("%d tags, S3 allows at most %d tags per object", len(tags), awsMaxTags))
+	}
+
+	for key, value := range tags {
+		if key == "" {
+			return newTypedError(ErrInvalidArgument, fmt.Errorf("tag key must not be empty"))
+		}
+
+		if utf8.RuneCountInString(key) > awsMaxTagKeyLength {
+			return newTypedError(ErrInvalidArgument,
+				fmt.Errorf("tag key '%s' is longer than %d characters", key, awsMaxTagKeyLength))
+		}
+
+		if utf8.RuneCountInString(value) > awsMaxTagValueLength {
+			return newTypedError(ErrInvalidArgument,
+				fmt.Errorf("value of tag '%s' is longer than %d characters", key, awsMaxTagValueLength))
+		}
+	}
+
+	return nil
+}
+
+func setAWSTags(ctx context.Context, client *s3.S3, bucketName, key string, tags map[string]string) error {
+	if err := validateAWSTags(tags); err != nil {
+		return err
+	}
+
+	tagSet := make([]*s3.Tag, 0, len(tags))
+	for tagKey, tagValue := range tags {
+		tagSet = append(tagSet, &s3.Tag{
+			Key:   aws.String(tagKey),
+			Value: aws.String(tagValue),
+		})
+	}
+
+	_, err := client.PutObjectTaggingWithContext(ctx, &s3.PutObjectTaggingInput{
+		Bucket:  aws.String(bucketName),
+		Key:     aws.String(key),
+		Tagging: &s3.Tagging{TagSet: tagSet},
+	})
+
+	return objectError(err)
+}
+
+func getAWSTags(ctx context.Context, client *s3.S3, bucketName, key string) (map[string]string, error) {
+	output, err := client.GetObjectTaggingWithContext(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, objectError(err)
+	}
+
+	tags := make(map[string]string, len(output.TagSet))
+	for _, tag := range output.TagSet {
+		tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+
+	return tags, nil
+}
+
+// setAWSStorageClass copies the object onto itself with the new storage class, keeping its content and metadata.
+// The objects too big for CopyObject are copied with a multipart upload, which fails if the object changes meanwhile.
+func setAWSStorageClass(ctx context.Context, client *s3.S3, bucketName, key, class string, logger Logger) error {
+	head, err := client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return objectError(err)
+	}
+
+	if awsStorageClass(head.StorageClass) == class {
+		return nil
+	}
+
+	if aws.Int64Value(head.ContentLength) > awsMaxCopyObjectSize {
+		return copyAWSObjectWithParts(ctx, client, &s3.CreateMultipartUploadInput{
+			Bucket:               aws.String(bucketName),
+			Key:                  aws.String(key),
+			CacheControl:         head.CacheControl,
+			ContentDisposition:   head.ContentDisposition,
+			ContentEncoding:      head.ContentEncoding,
+			ContentLanguage:      head.ContentLanguage,
+			ContentType:          head.ContentType,
+			Metadata:             head.Metadata,
+			ServerSideEncryption: head.ServerSideEncryption,
+			SSEKMSKeyId:          head.SSEKMSKeyId,
+			StorageClass:         aws.String(class),
+		}, key, aws.Int64Value(head.ContentLength), head.ETag, "storage class change", logger)
+	}
+
+	// the encryption isn't copied, it's set again to keep the KMS key of the object
+	_, err = client.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+		Bucket:               aws.String(bucketName),
+		Key:                  aws.String(key),
+		CopySource:           aws.String(awsCopySource(bucketName, key)),
+		MetadataDirective:    aws.String(s3.MetadataDirectiveCopy),
+		StorageClass:         aws.String(class),
+		ServerSideEncryption: head.ServerSideEncryption,
+		SSEKMSKeyId:          head.SSEKMSKeyId,
+	})
+
+	return objectError(err)
+}
+
+// newAWSWriterOptions adds the S3-specific options, the KMS key of the write takes precedence over the default one.
+// With verifyChecksum, the Content-MD5 of each upload request is sent, so that S3 rejects a corrupted part.
+func newAWSWriterOptions(opts *WriteOptions, sseKMSKeyID string, verifyChecksum bool) *blob.WriterOptions {
+	options := newWriterOptions(opts)
+
+	if opts != nil && opts.AWSSSEKMSKeyID != "" {
+		sseKMSKeyID = opts.AWSSSEKMSKeyID
+	}
+
+	// the SDK version doesn't have the conditional write fields, the headers are added to the upload requests
+	conditionalHeaders := make(map[string]string)
+
+	if opts.hasConditions() {
+		if opts.IfNotExists {
+			conditionalHeaders["If-None-Match"] = "*"
+		}
+
+		if opts.IfMatchETag != "" {
+			conditionalHeaders["If-Match"] = opts.IfMatchETag
+		}
+	}
+
+	var requestOptions []request.Option
+
+	if len(conditionalHeaders) > 0 {
+		requestOptions = append(requestOptions, request.WithSetRequestHeaders(conditionalHeaders))
+	}
+
+	if verifyChecksum {
+		requestOptions = append(requestOptions, withAWSContentMD5)
+	}
+
+	concurrency := 0
+	if opts != nil {
+		concurrency = opts.UploadConcurrency
+	}
+
+	if sseKMSKeyID == "" && len(requestOptions) == 0 && concurrency == 0 {
+		return options
+	}
+
+	options.BeforeWrite = func(asFunc func(interface{}) bool) error {
+		var input *s3manager.UploadInput
+		if sseKMSKeyID != "" && asFunc(&input) {
+			input.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAwsKms)
+			input.SSEKMSKeyId = aws.String(sseKMSKeyID)
+		}
+
+		var uploader *s3manager.Uploader
+		if asFunc(&uploader) {
+			uploader.RequestOptions = append(uploader.RequestOptions, requestOptions...)
+
+			if concurrency > 0 {
+				uploader.Concurrency = concurrency
+			}
+		}
+
+		return nil
+	}
+
+	return options
+}
+
+// withAWSChecksum sends the checksum of the body with the ChecksumAlgorithm of the write.
+// The body is uploaded with a single PutObject, since the checksum is of the whole object.
+func withAWSChecksum(options *blob.WriterOptions, opts *WriteOptions, body []byte) error {
+	if opts == nil || opts.ChecksumAlgorithm == "" {
+		return nil
+	}
+
+	var checksumCRC32C, checksumSHA256 *string
+
+	switch opts.ChecksumAlgorithm {
+	case ChecksumCRC32C:
+		checksumCRC32C = aws.String(base64.StdEncoding.EncodeToString(crc32cBytes(crc32.Checksum(body, crc32cTable))))
+	case ChecksumSHA256:
+		sum := sha256.Sum256(body)
+		checksumSHA256 = aws.String(base64.StdEncoding.EncodeToString(sum[:]))
+	default:
+		return newTypedError(ErrInvalidArgument, fmt.Errorf("unknown checksum algorithm '%s'", opts.ChecksumAlgorithm))
+	}
+
+	beforeWrite := options.BeforeWrite
+
+	options.BeforeWrite = func(asFunc func(interface{}) bool) error {
+		if beforeWrite != nil {
+			if err := beforeWrite(asFunc); err != nil {
+				return err
+			}
+		}
+
+		var input *s3manager.UploadInput
+		if asFunc(&input) {
+			input.ChecksumCRC32C = checksumCRC32C
+			input.ChecksumSHA256 = checksumSHA256
+		}
+
+		var uploader *s3manager.Uploader
+		if asFunc(&uploader) && int64(len(body)) >= uploader.PartSize {
+			uploader.PartSize = int64(len(body)) + 1
+		}
+
+		return nil
+	}
+
+	return nil
+}
+
+// withAWSChecksumMode returns a copy of the session which asks S3 for the checksums of the objects,
+// since HeadObject doesn't return them otherwise.
+func withAWSChecksumMode(awsSession *session.Session) *session.Session {
+	checksumSession := awsSession.Copy()
+
+	// the input is changed before it's marshaled
+	checksumSession.Handlers.Build.PushFront(func(r *request.Request) {
+		if input, ok := r.Params.(*s3.HeadObjectInput); ok && input.ChecksumMode == nil {
+			input.ChecksumMode = aws.String(s3.ChecksumModeEnabled)
+		}
+	})
+
+	return checksumSession
+}
+
+// awsChecksums decodes the checksums returned by HeadObject. The checksums of the multipart uploads,
+// which are checksums of the part checksums, are left out.
+func awsChecksums(head *s3.HeadObjectOutput) (checksumCRC32C uint32, hasCRC32C bool, checksumSHA256 []byte) {
+	if decoded, err := base64.StdEncoding.DecodeString(aws.StringValue(head.ChecksumCRC32C)); err == nil && len(decoded) == crc32.Size {
+		checksumCRC32C = binary.BigEndian.Uint32(decoded)
+		hasCRC32C = true
+	}
+
+	if decoded, err := base64.StdEncoding.DecodeString(aws.StringValue(head.ChecksumSHA256)); err == nil && len(decoded) == sha256.Size {
+		checksumSHA256 = decoded
+	}
+
+	return checksumCRC32C, hasCRC32C, checksumSHA256
+}
+
+// withAWSContentMD5 sends the Content-MD5 of the body of the request, if it's not already set.
+func withAWSContentMD5(r *request.Request) {
+	r.Handlers.Build.PushBack(func(r *request.Request) {
+		body := r.GetBody()
+		if body == nil || r.HTTPRequest.Header.Get("Content-MD5") != "" {
+			return
+		}
+
+		start, err := body.Seek(0, io.SeekCurrent)
+		if err != nil {
+			r.Error = err
+
+			return
+		}
+
+		hash := md5.New() //nolint:gosec
+		if _, err := io.Copy(hash, body); err != nil {
+			r.Error = err
+
+			return
+		}
+
+		if _, err := body.Seek(start, io.SeekStart); err != nil {
+			r.Error = err
+
+			return
+		}
+
+		r.HTTPRequest.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(hash.Sum(nil)))
+	})
+}
+
+func newAWSCopyOptions(sseKMSKeyID string) *blob.CopyOptions {
+	if sseKMSKeyID == "" {
+		return nil
+	}
+
+	return &blob.CopyOptions{
+		BeforeCopy: func(asFunc func(interface{}) bool) error {
+			var input *s3.CopyObjectInput
+			if asFunc(&input) {
+				input.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAwsKms)
+				input.SSEKMSKeyId = aws.String(sseKMSKeyID)
+			}
+
+			return nil
+		},
+	}
+}
+
+// presignAWSRequest presigns the request of the method with the SDK, for the options that the gocloud signed URLs
+// don't support. The encryption headers of the PUT URLs are signed, so the uploads are encrypted with the KMS key,
+// and the uploader has to send the same x-amz-server-side-encryption headers.
+func presignAWSRequest(
+	ctx context.Context,
+	client *s3.S3, bucketName, key string, opts *SignedURLOption, sseKMSKeyID string) (string, error) {
+	if err := opts.validateResponseOverrides(); err != nil {
+		return "", err
+	}
+
+	var req *request.Request
+
+	switch opts.Method {
+	case "", http.MethodGet:
+		req, _ = client.GetObjectRequest(&s3.GetObjectInput{
+			Bucket:                     aws.String(bucketName),
+			Key:                        aws.String(key),
+			ResponseCacheControl:       awsOptionalString(opts.ResponseCacheControl),
+			ResponseContentDisposition: awsOptionalString(opts.ResponseContentDisposition),
+			ResponseContentType:        awsOptionalString(opts.ResponseContentType),
+		})
+	case http.MethodPut:
+		input := &s3.PutObjectInput{
+			Bucket:      aws.String(bucketName),
+			Key:         aws.String(key),
+			ContentType: awsOptionalString(opts.ContentType),
+		}
+
+		if sseKMSKeyID != "" {
+			input.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAwsKms)
+			input.SSEKMSKeyId = aws.String(sseKMSKeyID)
+		}
+
+		req, _ = client.PutObjectRequest(input)
+	case http.MethodDelete:
+		req, _ = client.DeleteObjectRequest(&s3.DeleteObjectInput{
+			Bucket: aws.String(bucketName),
+			Key:    aws.String(key),
+		})
+	default:
+		return "", newTypedError(ErrInvalidArgument, fmt.Errorf("unsupported signed URL method '%s'", opts.Method))
+	}
+
+	// the credentials are retrieved with the context of the request
+	req.SetContext(ctx)
+
+	// the headers set before presigning are signed, the client has to send them
+	for name, value := range opts.SignedHeaders {
+		req.HTTPRequest.Header.Set(name, value)
+	}
+
+	return req.Presign(opts.Expiry)
+}
+
+// createAWSBucket creates the bucket in the region of the options or of the client, with the expiration rule.
+// The bucket already owned by the account is updated, unless it's in another region.
+func createAWSBucket(
+	ctx context.Context,
+	client *s3.S3,
+	bucketName string,
+	opts *CreateBucketOptions,
+	logger Logger,
+) error {
+	if opts == nil {
+		opts = &CreateBucketOptions{}
+	}
+
+	if opts.StorageClass != "" {
+		return newTypedError(ErrNotSupported, fmt.Errorf("default storage class of S3 buckets"))
+	}
+
+	retentionDays, err := awsDefaultRetentionDays(opts)
+	if err != nil {
+		return err
+	}
+
+	region := opts.Region
+	if region == "" {
+		region = aws.StringValue(client.Config.Region)
+	}
+
+	input := &s3.CreateBucketInput{Bucket: aws.String(bucketName)}
+
+	// us-east-1 is the default location, which S3 rejects as location constraint
+	if region != "" && region != "us-east-1" {
+		input.CreateBucketConfiguration = &s3.CreateBucketConfiguration{LocationConstraint: aws.String(region)}
+	}
+
+	if opts.UniformAccess {
+		input.ObjectOwnership = aws.String(s3.ObjectOwnershipBucketOwnerEnforced)
+	}
+
+	if opts.ObjectLock {
+		input.ObjectLockEnabledForBucket = aws.Bool(true)
+	}
+
+	_, err = client.CreateBucketWithContext(ctx, input)
+	if err != nil {
+		if err := checkExistingAWSBucket(ctx, client, bucketName, region, err); err != nil {
+			return err
+		}
+	}
+
+	if opts.BlockPublicAccess {
+		if err := setAWSPublicAccessBlock(ctx, client, bucketName, true); err != nil {
+			return fmt.Errorf("unable to block the public access of bucket '%s': %w", bucketName, err)
+		}
+	}
+
+	if retentionDays > 0 {
+		_, err = client.PutObjectLockConfigurationWithContext(ctx, &s3.PutObjectLockConfigurationInput{
+			Bucket: aws.String(bucketName),
+			ObjectLockConfiguration: &s3.ObjectLockConfiguration{
+				ObjectLockEnabled: aws.String(s3.ObjectLockEnabledEnabled),
+				Rule: &s3.ObjectLockRule{
+					DefaultRetention: &s3.DefaultRetention{
+						Mode: aws.String(s3.ObjectLockRetentionModeCompliance),
+						Days: aws.Int64(retentionDays),
+					},
+				},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("unable to set the default retention of bucket '%s': %w", bucketName, awsBucketError(err))
+		}
+	}
+
+	if opts.ExpirationDays <= 0 {
+		return nil
+	}
+
+	_, err = client.PutBucketLifecycleConfigurationWithContext(ctx, &s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 aws.String(bucketName),
+		LifecycleConfiguration: newAWSExpirationLifecycle(opts.Prefix, opts.ExpirationDays),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to set the lifecycle of bucket '%s': %w", bucketName, awsBucketError(err))
+	}
+
+	logger.Infof("bucket '%s' created", bucketName)
+
+	return nil
+}
+
+// awsDefaultRetentionDays returns the default retention of the Object Lock of the bucket, S3 only takes whole days.
+func awsDefaultRetentionDays(opts *CreateBucketOptions) (int64, error) {
+	if opts.RetentionPeriod == 0 {
+		return 0, nil
+	}
+
+	if !opts.ObjectLock {
+		return 0, newTypedError(ErrInvalidArgument, fmt.Errorf("the retention period of S3 buckets requires the object lock"))
+	}
+
+	const day = 24 * time.Hour
+	if opts.RetentionPeriod < 0 || opts.RetentionPeriod%day != 0 {
+		return 0, newTypedError(ErrInvalidArgument,
+			fmt.Errorf("the retention period of S3 buckets must be whole days, got %v", opts.RetentionPeriod))
+	}
+
+	return int64(opts.RetentionPeriod / day), nil
+}
+
+// checkExistingAWSBucket accepts the creation error of a bucket of the account in the region. The bucket
+// of another account isn't readable, and localstack answers BucketAlreadyExists for the buckets of the account.
+func checkExistingAWSBucket(ctx context.Context, client *s3.S3, bucketName, region string, createErr error) error {
+	var awsErr awserr.Error
+	if !errors.As(createErr, &awsErr) {
+		return fmt.Errorf("unable to create bucket '%s': %w", bucketName, awsBucketError(createErr))
+	}
+
+	switch awsErr.Code() {
+	case s3.ErrCodeBucketAlreadyOwnedByYou, s3.ErrCodeBucketAlreadyExists, "IllegalLocationConstraintException":
+	default:
+		return fmt.Errorf("unable to create bucket '%s': %w", bucketName, awsBucketError(createErr))
+	}
+
+	location, err := client.GetBucketLocationWithContext(ctx, &s3.GetBucketLocationInput{Bucket: aws.String(bucketName)})
+	if err != nil {
+		return fmt.Errorf("unable to create bucket '%s': %w", bucketName, awsBucketError(createErr))
+	}
+
+	existingRegion := s3.NormalizeBucketLocation(aws.StringValue(location.LocationConstraint))
+	if region != "" && existingRegion != region {
+		return newTypedError(ErrBucketRegionMismatch,
+			fmt.Errorf("bucket '%s' exists in %s instead of %s: %w", bucketName, existingRegion, region, createErr))
+	}
+
+	return nil
+}
+
+// newAWSExpirationLifecycle expires the objects under the prefix, and their noncurrent versions, after the days.
+func newAWSExpirationLifecycle(bucketPrefix string, expirationTimeDays int64) *s3.BucketLifecycleConfiguration {
+	return &s3.BucketLifecycleConfiguration{
+		Rules: []*s3.LifecycleRule{
+			{
+				ID: aws.String("Delete request user data"),
+				Filter: &s3.LifecycleRuleFilter{
+					Prefix: aws.String(strings.TrimSuffix(bucketPrefix, "/")),
+				},
+				Expiration: &s3.LifecycleExpiration{
+					Days: aws.Int64(expirationTimeDays),
+				},
+				NoncurrentVersionExpiration: &s3.NoncurrentVersionExpiration{
+					NoncurrentDays: aws.Int64(expirationTimeDays),
+				},
+				Status: aws.String(s3.ExpirationStatusEnabled),
+			},
+		},
+	}
+}
+
+// setAWSLifecycle replaces the lifecycle configuration of the bucket, S3 has no call updating a single rule.
+// The existing rules of other prefixes are kept unless ReplaceAll is set.
+func setAWSLifecycle(ctx context.Context, client *s3.S3, bucketName string, rules []LifecycleRule, opts *LifecycleOptions) error {
+	if err := validateLifecycleRules(rules); err != nil {
+		return err
+	}
+
+	var awsRules []*s3.LifecycleRule
+
+	if opts == nil || !opts.ReplaceAll {
+		existing, err := getAWSLifecycleRules(ctx, client, bucketName)
+		if err != nil {
+			return err
+		}
+
+		replaced := replacedLifecyclePrefixes(rules)
+
+		for _, rule := range existing {
+			if !replaced[awsLifecycleRulePrefix(rule)] {
+				awsRules = append(awsRules, rule)
+			}
+		}
+	}
+
+	for _, rule := range rules {
+		awsRules = append(awsRules, newAWSLifecycleRule(rule))
+	}
+
+	// S3 rejects a configuration without rules
+	if len(awsRules) == 0 {
+		_, err := client.DeleteBucketLifecycleWithContext(ctx, &s3.DeleteBucketLifecycleInput{Bucket: aws.String(bucketName)})
+
+		return awsBucketError(err)
+	}
+
+	_, err := client.PutBucketLifecycleConfigurationWithContext(ctx, &s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 aws.String(bucketName),
+		LifecycleConfiguration: &s3.BucketLifecycleConfiguration{Rules: awsRules},
+	})
+
+	return awsBucketError(err)
+}
+
+// getAWSLifecycleRules returns the rules of the bucket, none when it has no lifecycle configuration.
+func getAWSLifecycleRules(ctx context.Context, client *s3.S3, bucketName string) ([]*s3.LifecycleRule, error) {
+	output, err := client.GetBucketLifecycleConfigurationWithContext(ctx, &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(bucketName),
+	})
+
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) && awsErr.Code() == "NoSuchLifecycleConfiguration" {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, awsBucketError(err)
+	}
+
+	return output.Rules, nil
+}
+
+// getAWSLifecycle returns the enabled rules of the bucket, the tag filters and the other actions are ignored.
+func getAWSLifecycle(ctx context.Context, client *s3.S3, bucketName string) ([]LifecycleRule, error) {
+	awsRules, err := getAWSLifecycleRules(ctx, client, bucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make([]LifecycleRule, 0, len(awsRules))
+
+	for _, awsRule := range awsRules {
+		if aws.StringValue(awsRule.Status) != s3.ExpirationStatusEnabled {
+			continue
+		}
+
+		rule := LifecycleRule{
+			ID:     aws.StringValue(awsRule.ID),
+			Prefix: awsLifecycleRulePrefix(awsRule),
+		}
+
+		if awsRule.Expiration != nil {
+			rule.ExpirationDays = aws.Int64Value(awsRule.Expiration.Days)
+		}
+
+		if awsRule.NoncurrentVersionExpiration != nil {
+			rule.NoncurrentVersionExpirationDays = aws.Int64Value(awsRule.NoncurrentVersionExpiration.NoncurrentDays)
+		}
+
+		if len(awsRule.Transitions) > 0 {
+			rule.TransitionDays = aws.Int64Value(awsRule.Transitions[0].Days)
+			rule.TransitionStorageClass = aws.StringValue(awsRule.Transitions[0].StorageClass)
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func newAWSLifecycleRule(rule LifecycleRule) *s3.LifecycleRule {
+	id := rule.ID
+	if id == "" {
+		id = "Prefix " + rule.Prefix
+	}
+
+	awsRule := &s3.LifecycleRule{
+		ID:     aws.String(id),
+		Filter: &s3.LifecycleRuleFilter{Prefix: aws.String(rule.Prefix)},
+		Status: aws.String(s3.ExpirationStatusEnabled),
+	}
+
+	if rule.ExpirationDays > 0 {
+		awsRule.Expiration = &s3.LifecycleExpiration{Days: aws.Int64(rule.ExpirationDays)}
+	}
+
+	if rule.NoncurrentVersionExpirationDays > 0 {
+		awsRule.NoncurrentVersionExpiration = &s3.NoncurrentVersionExpiration{
+			NoncurrentDays: aws.Int64(rule.NoncurrentVersionExpirationDays),
+		}
+	}
+
+	if rule.TransitionStorageClass != "" {
+		awsRule.Transitions = []*s3.Transition{{
+			Days:         aws.Int64(rule.TransitionDays),
+			StorageClass: aws.String(rule.TransitionStorageClass),
+		}}
+	}
+
+	return awsRule
+}
+
+// awsLifecycleRulePrefix returns the prefix of the rule, which is in the filter or, for the legacy rules, in the rule.
+func awsLifecycleRulePrefix(rule *s3.LifecycleRule) string {
+	switch {
+	case rule.Filter != nil && rule.Filter.And != nil:
+		return aws.StringValue(rule.Filter.And.Prefix)
+	case rule.Filter != nil:
+		return aws.StringValue(rule.Filter.Prefix)
+	default:
+		return aws.StringValue(rule.Prefix)
+	}
+}
+
+// setAWSVersioning enables the versioning of the bucket, or suspends it since S3 can't disable it.
+func setAWSVersioning(ctx context.Context, client *s3.S3, bucketName string, enabled bool) error {
+	status := s3.BucketVersioningStatusSuspended
+	if enabled {
+		status = s3.BucketVersioningStatusEnabled
+	}
+
+	_, err := client.PutBucketVersioningWithContext(ctx, &s3.PutBucketVersioningInput{
+		Bucket:                  aws.String(bucketName),
+		VersioningConfiguration: &s3.VersioningConfiguration{Status: aws.String(status)},
+	})
+
+	return awsBucketError(err)
+}
+
+func getAWSVersioningState(ctx context.Context, client *s3.S3, bucketName string) (VersioningState, error) {
+	output, err := client.GetBucketVersioningWithContext(ctx, &s3.GetBucketVersioningInput{Bucket: aws.String(bucketName)})
+	if err != nil {
+		return "", awsBucketError(err)
+	}
+
+	switch aws.StringValue(output.Status) {
+	case s3.BucketVersioningStatusEnabled:
+		return VersioningEnabled, nil
+	case s3.BucketVersioningStatusSuspended:
+		return VersioningSuspended, nil
+	default:
+		return VersioningUnversioned, nil
+	}
+}
+
+// setAWSCORS replaces the CORS configuration of the bucket, which is deleted when there is no rule.
+// The response headers are both the allowed headers of the requests and the exposed headers of the responses,
+// like on GCS.
+func setAWSCORS(ctx context.Context, client *s3.S3, bucketName string, rules []CORSRule) error {
+	if err := validateCORSRules(rules); err != nil {
+		return err
+	}
+
+	if len(rules) == 0 {
+		_, err := client.DeleteBucketCorsWithContext(ctx, &s3.DeleteBucketCorsInput{Bucket: aws.String(bucketName)})
+
+		return awsBucketError(err)
+	}
+
+	awsRules := make([]*s3.CORSRule, 0, len(rules))
+
+	for _, rule := range rules {
+		awsRule := &s3.CORSRule{
+			AllowedOrigins: aws.StringSlice(rule.Origins),
+			AllowedMethods: aws.StringSlice(rule.Methods),
+		}
+
+		if len(rule.ResponseHeaders) > 0 {
+			awsRule.AllowedHeaders = aws.StringSlice(rule.ResponseHeaders)
+			awsRule.ExposeHeaders = aws.StringSlice(rule.ResponseHeaders)
+		}
+
+		if rule.MaxAge > 0 {
+			awsRule.MaxAgeSeconds = aws.Int64(int64(rule.MaxAge / time.Second))
+		}
+
+		awsRules = append(awsRules, awsRule)
+	}
+
+	_, err := client.PutBucketCorsWithContext(ctx, &s3.PutBucketCorsInput{
+		Bucket:            aws.String(bucketName),
+		CORSConfiguration: &s3.CORSConfiguration{CORSRules: awsRules},
+	})
+
+	return awsBucketError(err)
+}
+
+// getAWSCORS returns the CORS rules of the bucket, none when it has no CORS configuration.
+func getAWSCORS(ctx context.Context, client *s3.S3, bucketName string) ([]CORSRule, error) {
+	output, err := client.GetBucketCorsWithContext(ctx, &s3.GetBucketCorsInput{Bucket: aws.String(bucketName)})
+
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) && awsErr.Code() == "NoSuchCORSConfiguration" {
+		return []CORSRule{}, nil
+	}
+
+	if err != nil {
+		return nil, awsBucketError(err)
+	}
+
+	rules := make([]CORSRule, 0, len(output.CORSRules))
+
+	for _, awsRule := range output.CORSRules {
+		responseHeaders := awsRule.ExposeHeaders
+		if len(responseHeaders) == 0 {
+			responseHeaders = awsRule.AllowedHeaders
+		}
+
+		rules = append(rules, CORSRule{
+			Origins:         aws.StringValueSlice(awsRule.AllowedOrigins),
+			Methods:         aws.StringValueSlice(awsRule.AllowedMethods),
+			ResponseHeaders: aws.StringValueSlice(responseHeaders),
+			MaxAge:          time.Duration(aws.Int64Value(awsRule.MaxAgeSeconds)) * time.Second,
+		})
+	}
+
+	return rules, nil
+}
+
+// setAWSPublicAccessBlock enables or disables the four settings of the public access block of the bucket.
+func setAWSPublicAccessBlock(ctx context.Context, client *s3.S3, bucketName string, blocked bool) error {
+	_, err := client.PutPublicAccessBlockWithContext(ctx, &s3.PutPublicAccessBlockInput{
+		Bucket: aws.String(bucketName),
+		PublicAccessBlockConfiguration: &s3.PublicAccessBlockConfiguration{
+			BlockPublicAcls:       aws.Bool(blocked),
+			IgnorePublicAcls:      aws.Bool(blocked),
+			BlockPublicPolicy:     aws.Bool(blocked),
+			RestrictPublicBuckets: aws.Bool(blocked),
+		},
+	})
+
+	return awsBucketError(err)
+}
+
+// getAWSPublicAccessBlock returns the public access block of the bucket, none is set without configuration.
+func getAWSPublicAccessBlock(ctx context.Context, client *s3.S3, bucketName string) (*PublicAccessBlock, error) {
+	output, err := client.GetPublicAccessBlockWithContext(ctx, &s3.GetPublicAccessBlockInput{Bucket: aws.String(bucketName)})
+
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) && awsErr.Code() == "NoSuchPublicAccessBlockConfiguration" {
+		return &PublicAccessBlock{}, nil
+	}
+
+	if err != nil {
+		return nil, awsBucketError(err)
+	}
+
+	configuration := output.PublicAccessBlockConfiguration
+	if configuration == nil {
+		return &PublicAccessBlock{}, nil
+	}
+
+	return &PublicAccessBlock{
+		BlockPublicACLs:       aws.BoolValue(configuration.BlockPublicAcls),
+		IgnorePublicACLs:      aws.BoolValue(configuration.IgnorePublicAcls),
+		BlockPublicPolicy:     aws.BoolValue(configuration.BlockPublicPolicy),
+		RestrictPublicBuckets: aws.BoolValue(configuration.RestrictPublicBuckets),
+	}, nil
+}
+
+// setAWSObjectRetention sets the retention of the current version of the object, the bucket must have been created
+// with the object lock. The retention of COMPLIANCE mode can only be extended.
+func setAWSObjectRetention(
+	ctx context.Context,
+	client *s3.S3,
+	bucketName, key string,
+	until time.Time,
+	mode string,
+) error {
+	if mode != RetentionModeGovernance && mode != RetentionModeCompliance {
+		return newTypedError(ErrInvalidArgument, fmt.Errorf("unknown retention mode '%s'", mode))
+	}
+
+	if !until.After(time.Now()) {
+		return newTypedError(ErrInvalidArgument, fmt.Errorf("retention date %v is in the past", until))
+	}
+
+	_, err := client.PutObjectRetentionWithContext(ctx, &s3.PutObjectRetentionInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+		Retention: &s3.ObjectLockRetention{
+			Mode:            aws.String(mode),
+			RetainUntilDate: aws.Time(until),
+		},
+	})
+
+	return objectError(err)
+}
+
+// getAWSObjectRetention returns the retention of the current version of the object, empty when it has none.
+func getAWSObjectRetention(ctx context.Context, client *s3.S3, bucketName, key string) (*ObjectRetention, error) {
+	output, err := client.GetObjectRetentionWithContext(ctx, &s3.GetObjectRetentionInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && awsErr.Code() == "NoSuchObjectLockConfiguration" {
+			return &ObjectRetention{}, nil
+		}
+
+		return nil, objectError(err)
+	}
+
+	if output.Retention == nil {
+		return &ObjectRetention{}, nil
+	}
+
+	return &ObjectRetention{
+		Mode:        aws.StringValue(output.Retention.Mode),
+		RetainUntil: aws.TimeValue(output.Retention.RetainUntilDate),
+	}, nil
+}
+
+// existsAWSObject checks the object with a HEAD request, only the 404 means that the object doesn't exist.
+// The other failures, such as a 403 or a timeout, are returned instead of being taken as a missing object.
+func existsAWSObject(ctx context.Context, client *s3.S3, bucketName, key string) (bool, error) {
+	_, err := client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	})
+	if err == nil {
+		return true, nil
+	}
+
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) && reqErr.StatusCode() == http.StatusNotFound {
+		return false, nil
+	}
+
+	return false, objectError(err)
+}
+
+// awsMaxPartNumber is the number of parts of the S3 multipart uploads.
+const awsMaxPartNumber = 10000
+
+// startAWSMultipartUpload creates the multipart upload of the parts uploaded by the clients with presigned URLs.
+// The content is uploaded as is, so it can't be compressed by this package.
+func startAWSMultipartUpload(
+	ctx context.Context,
+	client *s3.S3,
+	bucketName string,
+	key string,
+	opts *WriteOptions,
+	sseKMSKeyID string,
+) (string, error) {
+	if opts == nil {
+		opts = &WriteOptions{}
+	}
+
+	if opts.Compress {
+		return "", newTypedError(ErrInvalidArgument, fmt.Errorf("the parts of the multipart uploads can't be compressed"))
+	}
+
+	if opts.AWSSSEKMSKeyID != "" {
+		sseKMSKeyID = opts.AWSSSEKMSKeyID
+	}
+
+	writerOptions := newWriterOptions(opts)
+
+	input := &s3.CreateMultipartUploadInput{
+		Bucket:             aws.String(bucketName),
+		Key:                aws.String(key),
+		CacheControl:       awsOptionalString(opts.CacheControl),
+		ContentDisposition: awsOptionalString(opts.ContentDisposition),
+		ContentEncoding:    awsOptionalString(opts.ContentEncoding),
+		ContentLanguage:    awsOptionalString(opts.ContentLanguage),
+		ContentType:        awsOptionalString(opts.ContentType),
+		Metadata:           aws.StringMap(writerOptions.Metadata),
+	}
+
+	if sseKMSKeyID != "" {
+		input.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAwsKms)
+		input.SSEKMSKeyId = aws.String(sseKMSKeyID)
+	}
+
+	upload, err := client.CreateMultipartUploadWithContext(ctx, input)
+	if err != nil {
+		return "", objectError(err)
+	}
+
+	return aws.StringValue(upload.UploadId), nil
+}
+
+// signAWSUploadPartURL presigns the PUT of a part, the parts except the last one must be at least 5 MB.
+func signAWSUploadPartURL(
+	ctx context.Context,
+	client *s3.S3,
+	bucketName string,
+	key string,
+	uploadID string,
+	partNumber int,
+	expiry time.Duration,
+) (string, error) {
+	if uploadID == "" {
+		return "", newTypedError(ErrInvalidArgument, fmt.Errorf("the upload ID is required"))
+	}
+
+	if partNumber < 1 || partNumber > awsMaxPartNumber {
+		return "", newTypedError(ErrInvalidArgument,
+			fmt.Errorf("the part number must be between 1 and %d, got %d", awsMaxPartNumber, partNumber))
+	}
+
+	if expiry <= 0 {
+		return "", newTypedError(ErrInvalidArgument, fmt.Errorf("the expiry of the signed URL must be positive"))
+	}
+
+	req, _ := client.UploadPartRequest(&s3.UploadPartInput{
+		Bucket:     aws.String(bucketName),
+		Key:        aws.String(key),
+		UploadId:   aws.String(uploadID),
+		PartNumber: aws.Int64(int64(partNumber)),
+	})
+
+	// the credentials are retrieved with the context of the request
+	req.SetContext(ctx)
+
+	return req.Presign(expiry)
+}
+
+// completeAWSMultipartUpload creates the object from the parts, which S3 requires in ascending order.
+func completeAWSMultipartUpload(
+	ctx context.Context,
+	client *s3.S3,
+	bucketName string,
+	key string,
+	uploadID string,
+	parts []CompletedPart,
+) error {
+	if uploadID == "" || len(parts) == 0 {
+		return newTypedError(ErrInvalidArgument, fmt.Errorf("the upload ID and the parts are required"))
+	}
+
+	sortedParts := make([]CompletedPart, len(parts))
+	copy(sortedParts, parts)
+	sort.Slice(sortedParts, func(i, j int) bool { return sortedParts[i].PartNumber < sortedParts[j].PartNumber })
+
+	completedParts := make([]*s3.CompletedPart, 0, len(sortedParts))
+	for _, part := range sortedParts {
+		completedParts = append(completedParts, &s3.CompletedPart{
+			PartNumber: aws.Int64(int64(part.PartNumber)),
+			ETag:       aws.String(part.ETag),
+		})
+	}
+
+	_, err := client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucketName),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completedParts},
+	})
+
+	return objectError(err)
+}
+
+// abortAWSMultipartUpload removes the uploaded parts, which are billed until the upload is completed or aborted.
+func abortAWSMultipartUpload(ctx context.Context, client *s3.S3, bucketName, key, uploadID string) error {
+	if uploadID == "" {
+		return newTypedError(ErrInvalidArgument, fmt.Errorf("the upload ID is required"))
+	}
+
+	_, err := client.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(bucketName),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+
+	return objectError(err)
+}
+
+// awsPublicURL builds the URL of the object like the requests of the client, path-style or virtual-hosted
+// on the configured endpoint, without sending any request.
+func awsPublicURL(client *s3.S3, bucketName, key string) (string, error) {
+	if key == "" {
+		return "", newTypedError(ErrInvalidArgument, fmt.Errorf("empty key"))
+	}
+
+	req, _ := client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	})
+	if err := req.Build(); err != nil {
+		return "", err
+	}
+
+	return req.HTTPRequest.URL.String(), nil
+}
+
+// newCloudFrontSigner parses the CloudFront key pair, nil is returned when it's not configured.
+func newCloudFrontSigner(keyID, privateKey string) (*sign.URLSigner, error) {
+	if keyID == "" && privateKey == "" {
+		return nil, nil
+	}
+
+	if keyID == "" || privateKey == "" {
+		return nil, newTypedError(ErrInvalidArgument,
+			fmt.Errorf("both the CloudFront key ID and private key are required"))
+	}
+
+	key, err := sign.LoadPEMPrivKey(strings.NewReader(privateKey))
+	if err != nil {
+		return nil, newTypedError(ErrInvalidArgument, fmt.Errorf("unable to parse the CloudFront private key: %w", err))
+	}
+
+	return sign.NewURLSigner(keyID, key), nil
+}
+
+// signCloudFrontURL signs the URL of the object on the CloudFront distribution with its key pair,
+// since the presigned S3 URLs are only valid on the S3 endpoint. The allowed source IP is signed with a custom policy.
+func signCloudFrontURL(signer *sign.URLSigner, host, key string, opts *SignedURLOption) (string, error) {
+	if signer == nil {
+		return "", newTypedError(ErrInvalidArgument,
+			fmt.Errorf("the CloudFront key pair is required to sign the URLs of %s", host))
+	}
+
+	if opts.Method != "" && opts.Method != http.MethodGet {
+		return "", newTypedError(ErrInvalidArgument,
+			fmt.Errorf("CloudFront signed URLs only support GET, not %s", opts.Method))
+	}
+
+	if opts.hasResponseOverrides() {
+		return "", newTypedError(ErrInvalidArgument,
+			fmt.Errorf("response header overrides are not supported by CloudFront signed URLs"))
+	}
+
+	if len(opts.SignedHeaders) > 0 {
+		return "", newTypedError(ErrNotSupported, fmt.Errorf("signed headers of CloudFront signed URLs"))
+	}
+
+	objectURL := url.URL{Scheme: "https", Host: host, Path: "/" + key}
+	expires := time.Now().Add(opts.Expiry)
+
+	if opts.AllowedSourceIP == "" {
+		return signer.Sign(objectURL.String(), expires)
+	}
+
+	// the source IP is only part of the custom policies
+	sourceIP, err := cloudFrontSourceIP(opts.AllowedSourceIP)
+	if err != nil {
+		return "", err
+	}
+
+	return signer.SignWithPolicy(objectURL.String(), &sign.Policy{
+		Statements: []sign.Statement{{
+			Resource: objectURL.String(),
+			Condition: sign.Condition{
+				DateLessThan: sign.NewAWSEpochTime(expires),
+				IPAddress:    &sign.IPAddress{SourceIP: sourceIP},
+			},
+		}},
+	})
+}
+
+// cloudFrontSourceIP returns the CIDR of the allowed source IP, a single address is converted to a /32 or /128 range.
+func cloudFrontSourceIP(sourceIP string) (string, error) {
+	if _, _, err := net.ParseCIDR(sourceIP); err == nil {
+		return sourceIP, nil
+	}
+
+	ip := net.ParseIP(sourceIP)
+	if ip == nil {
+		return "", newTypedError(ErrInvalidArgument, fmt.Errorf("invalid allowed source IP '%s'", sourceIP))
+	}
+
+	if ip.To4() != nil {
+		return ip.String() + "/32", nil
+	}
+
+	return ip.String() + "/128", nil
+}
+
+// newAWSPostPolicy signs the policy with the signature V4 of the session credentials.
+// The objects uploaded with the form are encrypted with the KMS key when it's set.
+func newAWSPostPolicy(
+	ctx context.Context,
+	client *s3.S3,
+	bucketName string,
+	keyPrefix string,
+	opts *PostPolicyOptions,
+	sseKMSKeyID string,
+) (*PostPolicy, error) {
+	if err := validatePostPolicyOptions(opts); err != nil {
+		return nil, err
+	}
+
+	creds, err := client.Config.Credentials.GetWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// the form is sent to the bucket URL, virtual-hosted or path-style as configured
+	req, _ := client.ListObjectsV2Request(&s3.ListObjectsV2Input{Bucket: aws.String(bucketName)})
+	if err := req.Build(); err != nil {
+		return nil, err
+	}
+
+	bucketURL := *req.HTTPRequest.URL
+	bucketURL.RawQuery = ""
+
+	now := time.Now().UTC()
+	date := now.Format("20060102")
+	region := aws.StringValue(client.Config.Region)
+
+	signatureFields := map[string]string{
+		"x-amz-algorithm":  "AWS4-HMAC-SHA256",
+		"x-amz-credential": fmt.Sprintf("%s/%s/%s/s3/aws4_request", creds.AccessKeyID, date, region),
+		"x-amz-date":       now.Format("20060102T150405Z"),
+	}
+
+	if creds.SessionToken != "" {
+		signatureFields["x-amz-security-token"] = creds.SessionToken
+	}
+
+	if sseKMSKeyID != "" {
+		signatureFields["x-amz-server-side-encryption"] = s3.ServerSideEncryptionAwsKms
+		signatureFields["x-amz-server-side-encryption-aws-kms-key-id"] = sseKMSKeyID
+	}
+
+	fields, conditions := newPostPolicyConditions(bucketName, keyPrefix, opts)
+	conditions = addPostPolicyFields(fields, conditions, signatureFields)
+
+	policy, err := encodePostPolicy(now.Add(opts.Expiry), conditions)
+	if err != nil {
+		return nil, err
+	}
+
+	signingKey := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+
+	fields["policy"] = policy
+	fields["x-amz-signature"] = hex.EncodeToString(hmacSHA256(signingKey, policy))
+
+	return &PostPolicy{URL: bucketURL.String(), Fields: fields}, nil
+}
+
+func hmacSHA256(key []byte, content string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(content))
+
+	return mac.Sum(nil)
+}
+
+// getAWSObjectIfModified sends the conditional headers with the GetObject call, S3 answers 304 when nothing changed.
+// The gzip encoded body is decompressed unless decompress is false.
+func getAWSObjectIfModified(
+	ctx context.Context,
+	client *s3.S3,
+	bucketName string,
+	key string,
+	etag string,
+	modSince time.Time,
+	decompress bool,
+) ([]byte, *Attributes, bool, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	}
+
+	if etag != "" {
+		input.IfNoneMatch = aws.String(etag)
+	}
+
+	if !modSince.IsZero() {
+		input.IfModifiedSince = aws.Time(modSince)
+	}
+
+	output, err := client.GetObjectWithContext(ctx, input)
+	if err != nil {
+		var reqErr awserr.RequestFailure
+		if !errors.As(err, &reqErr) || reqErr.StatusCode() != http.StatusNotModified {
+			return nil, nil, false, objectError(err)
+		}
+
+		// the 304 response doesn't carry the attributes
+		head, err := client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(bucketName),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return nil, nil, false, objectError(err)
+		}
+
+		return nil, newAWSAttributes(head), true, nil
+	}
+
+	defer output.Body.Close()
+
+	body, err := ioutil.ReadAll(output.Body)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	if decompress {
+		if body, err = decompressBody(body, aws.StringValue(output.ContentEncoding)); err != nil {
+			return nil, nil, false, err
+		}
+	}
+
+	return body, newAWSAttributes(&s3.HeadObjectOutput{
+		CacheControl:       output.CacheControl,
+		ContentDisposition: output.ContentDisposition,
+		ContentEncoding:    output.ContentEncoding,
+		ContentLanguage:    output.ContentLanguage,
+		ContentLength:      output.ContentLength,
+		ContentType:        output.ContentType,
+		ETag:               output.ETag,
+		LastModified:       output.LastModified,
+		Metadata:           output.Metadata,
+		StorageClass:       output.StorageClass,
+	}), false, nil
+}
+
+func newAWSAttributes(head *s3.HeadObjectOutput) *Attributes {
+	metadata := make(map[string]string, len(head.Metadata))
+	for key, value := range head.Metadata {
+		metadata[strings.ToLower(key)] = aws.StringValue(value)
+	}
+
+	return normalizeAttributes(&Attributes{
+		CacheControl:       aws.StringValue(head.CacheControl),
+		ContentDisposition: aws.StringValue(head.ContentDisposition),
+		ContentEncoding:    aws.StringValue(head.ContentEncoding),
+		ContentLanguage:    aws.StringValue(head.ContentLanguage),
+		ContentType:        aws.StringValue(head.ContentType),
+		Metadata:           metadata,
+		ModTime:            aws.TimeValue(head.LastModified),
+		Size:               aws.Int64Value(head.ContentLength),
+		ETag:               aws.StringValue(head.ETag),
+		StorageClass:       awsStorageClass(head.StorageClass),
+	})
+}
+
+// awsStorageClass returns STANDARD for the objects without storage class, S3 doesn't return the STANDARD one.
+func awsStorageClass(class *string) string {
+	if class == nil || *class == "" {
+		return s3.StorageClassStandard
+	}
+
+	return *class
+}
+
+// listAWSVersions lists the versions and the delete markers page by page.
+func listAWSVersions(ctx context.Context, client *s3.S3, bucketName, prefix string) *VersionIterator {
+	var (
+		versions []*ObjectVersion
+		isLast   bool
+	)
+
+	input := &s3.ListObjectVersionsInput{
+		Bucket: aws.String(bucketName),
+		Prefix: aws.String(prefix),
+	}
+
+	return newVersionIterator(func(ctx context.Context) (*ObjectVersion, error) {
+		for len(versions) == 0 {
+			if isLast {
+				return nil, io.EOF
+			}
+
+			output, err := client.ListObjectVersionsWithContext(ctx, input)
+			if err != nil {
+				return nil, objectError(err)
+			}
+
+			for _, version := range output.Versions {
+				versions = append(versions, &ObjectVersion{
+					Key:      aws.StringValue(version.Key),
+					Version:  aws.StringValue(version.VersionId),
+					ModTime:  aws.TimeValue(version.LastModified).UTC(),
+					Size:     aws.Int64Value(version.Size),
+					IsLatest: aws.BoolValue(version.IsLatest),
+				})
+			}
+
+			for _, marker := range output.DeleteMarkers {
+				versions = append(versions, &ObjectVersion{
+					Key:            aws.StringValue(marker.Key),
+					Version:        aws.StringValue(marker.VersionId),
+					ModTime:        aws.TimeValue(marker.LastModified).UTC(),
+					IsLatest:       aws.BoolValue(marker.IsLatest),
+					IsDeleteMarker: true,
+				})
+			}
+
+			isLast = !aws.BoolValue(output.IsTruncated)
+			input.KeyMarker = output.NextKeyMarker
+			input.VersionIdMarker = output.NextVersionIdMarker
+		}
+
+		version := versions[0]
+		versions = versions[1:]
+
+		return version, nil
+	})
+}
+
+func getAWSVersion(ctx context.Context, client *s3.S3, bucketName, key, version string) ([]byte, error) {
+	output, err := client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket:    aws.String(bucketName),
+		Key:       aws.String(key),
+		VersionId: aws.String(version),
+	})
+	if err != nil {
+		return nil, objectError(err)
+	}
+
+	defer output.Body.Close()
+
+	return ioutil.ReadAll(output.Body)
+}
+
+func deleteAWSVersion(ctx context.Context, client *s3.S3, bucketName, key, version string) error {
+	_, err := client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket:    aws.String(bucketName),
+		Key:       aws.String(key),
+		VersionId: aws.String(version),
+	})
+
+	return objectError(err)
+}
+
+// restoreAWSObject requests a temporary copy of an archived object, the objects which are not archived are left as is.
+func restoreAWSObject(ctx context.Context, client *s3.S3, bucketName, key string, days int, tier string) error {
+	if days < 1 {
+		return newTypedError(ErrInvalidArgument, fmt.Errorf("restore days must be positive, got %d", days))
+	}
+
+	state, err := getAWSRestoreState(ctx, client, bucketName, key)
+	if err != nil {
+		return err
+	}
+
+	if !state.Archived {
+		return nil
+	}
+
+	restoreRequest := &s3.RestoreRequest{
+		Days: aws.Int64(int64(days)),
+	}
+	if tier != "" {
+		restoreRequest.GlacierJobParameters = &s3.GlacierJobParameters{
+			Tier: aws.String(tier),
+		}
+	}
+
+	_, err = client.RestoreObjectWithContext(ctx, &s3.RestoreObjectInput{
+		Bucket:         aws.String(bucketName),
+		Key:            aws.String(key),
+		RestoreRequest: restoreRequest,
+	})
+
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) && awsErr.Code() == awsRestoreInProgress {
+		return nil
+	}
+
+	return objectError(err)
+}
+
+func getAWSRestoreState(ctx context.Context, client *s3.S3, bucketName, key string) (RestoreState, error) {
+	head, err := client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return RestoreState{}, objectError(err)
+	}
+
+	switch aws.StringValue(head.StorageClass) {
+	case s3.StorageClassGlacier, s3.StorageClassDeepArchive:
+	default:
+		return RestoreState{Readable: true}, nil
+	}
+
+	return parseAWSRestoreHeader(aws.StringValue(head.Restore))
+}
+
+// parseAWSRestoreHeader parses the x-amz-restore header of an archived object,
+// e.g. ongoing-request="false", expiry-date="Fri, 21 Dec 2012 00:00:00 GMT".
+func parseAWSRestoreHeader(header string) (RestoreState, error) {
+	state := RestoreState{
+		Archived: true,
+	}
+
+	if header == "" {
+		return state, nil
+	}
+
+	if strings.Contains(header, `ongoing-request="true"`) {
+		state.InProgress = true
+
+		return state, nil
+	}
+
+	state.Readable = true
+
+	const expiryDatePrefix = `expiry-date="`
+
+	start := strings.Index(header, expiryDatePrefix)
+	if start < 0 {
+		return state, nil
+	}
+
+	expiryDate := header[start+len(expiryDatePrefix):]
+
+	end := strings.Index(expiryDate, `"`)
+	if end < 0 {
+		return RestoreState{}, fmt.Errorf("invalid restore header '%s'", header)
+	}
+
+	expiryTime, err := http.ParseTime(expiryDate[:end])
+	if err != nil {
+		return RestoreState{}, fmt.Errorf("invalid restore header '%s': %v", header, err)
+	}
+
+	state.ExpiryTime = expiryTime
+
+	return state, nil
+}
+
+// appendAWSObject appends the data to the object with a multipart upload made of the copy of the object and the data.
+// The objects smaller than the minimal part size are read and written again instead.
+// The object mustn't be written concurrently, the appends are not serialized.
+func appendAWSObject(
+	ctx context.Context,
+	client *s3.S3,
+	bucketName, key string,
+	data []byte,
+	sseKMSKeyID string,
+	logger Logger,
+) error {
+	head, err := client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	})
+	if errors.Is(objectError(err), ErrNotFound) {
+		input := &s3.PutObjectInput{
+			Bucket: aws.String(bucketName),
+			Key:    aws.String(key),
+			Body:   bytes.NewReader(data),
+		}
+
+		if sseKMSKeyID != "" {
+			input.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAwsKms)
+			input.SSEKMSKeyId = aws.String(sseKMSKeyID)
+		}
+
+		_, err = client.PutObjectWithContext(ctx, input, request.WithSetRequestHeaders(map[string]string{
+			"If-None-Match": "*",
+		}))
+
+		return objectError(err)
+	}
+
+	if err != nil {
+		return objectError(err)
+	}
+
+	if aws.Int64Value(head.ContentLength) < awsMinPartSize {
+		return rewriteAWSObjectWithAppend(ctx, client, bucketName, key, data, head)
+	}
+
+	input := &s3.CreateMultipartUploadInput{
+		Bucket:               aws.String(bucketName),
+		Key:                  aws.String(key),
+		CacheControl:         head.CacheControl,
+		ContentDisposition:   head.ContentDisposition,
+		ContentEncoding:      head.ContentEncoding,
+		ContentLanguage:      head.ContentLanguage,
+		ContentType:          head.ContentType,
+		Metadata:             head.Metadata,
+		ServerSideEncryption: head.ServerSideEncryption,
+		SSEKMSKeyId:          head.SSEKMSKeyId,
+		StorageClass:         head.StorageClass,
+	}
+
+	upload, err := client.CreateMultipartUploadWithContext(ctx, input)
+	if err != nil {
+		return objectError(err)
+	}
+
+	// the parts are only removed by aborting the upload
+	abort := func() {
+		abortFailedAWSMultipartUpload(client, bucketName, key, upload.UploadId, "append", logger)
+	}
+
+	parts, err := copyAWSParts(ctx, client, bucketName, key, key, aws.Int64Value(head.ContentLength), head.ETag, upload.UploadId)
+	if err != nil {
+		abort()
+
+		return objectError(err)
+	}
+
+	partNumber := aws.Int64(int64(len(parts) + 1))
+
+	part, err := client.UploadPartWithContext(ctx, &s3.UploadPartInput{
+		Bucket:     aws.String(bucketName),
+		Key:        aws.String(key),
+		Body:       bytes.NewReader(data),
+		PartNumber: partNumber,
+		UploadId:   upload.UploadId,
+	})
+	if err != nil {
+		abort()
+
+		return objectError(err)
+	}
+
+	parts = append(parts, &s3.CompletedPart{
+		ETag:       part.ETag,
+		PartNumber: partNumber,
+	})
+
+	_, err = client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucketName),
+		Key:             aws.String(key),
+		UploadId:        upload.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		abort()
+
+		return objectError(err)
+	}
+
+	return nil
+}
+
+// rewriteAWSObjectWithAppend writes the object again with the data appended, keeping its attributes and encryption.
+func rewriteAWSObjectWithAppend(
+	ctx context.Context,
+	client *s3.S3,
+	bucketName string,
+	key string,
+	data []byte,
+	head *s3.HeadObjectOutput,
+) error {
+	output, err := client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket:  aws.String(bucketName),
+		Key:     aws.String(key),
+		IfMatch: head.ETag,
+	})
+	if err != nil {
+		return objectError(err)
+	}
+
+	defer output.Body.Close()
+
+	body, err := ioutil.ReadAll(output.Body)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:               aws.String(bucketName),
+		Key:                  aws.String(key),
+		Body:                 bytes.NewReader(append(body, data...)),
+		CacheControl:         head.CacheControl,
+		ContentDisposition:   head.ContentDisposition,
+		ContentEncoding:      head.ContentEncoding,
+		ContentLanguage:      head.ContentLanguage,
+		ContentType:          head.ContentType,
+		Metadata:             head.Metadata,
+		ServerSideEncryption: head.ServerSideEncryption,
+		SSEKMSKeyId:          head.SSEKMSKeyId,
+		StorageClass:         head.StorageClass,
+	})
+
+	return objectError(err)
+}
+
+// updateAWSAttributes copies the object onto itself with the updated attributes, keeping its storage class and encryption.
+func updateAWSAttributes(
+	ctx context.Context,
+	client *s3.S3,
+	bucketName string,
+	key string,
+	update AttributeUpdate,
+	logger Logger,
+) (*Attributes, error) {
+	head, err := client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, objectError(err)
+	}
+
+	attrs := update.apply(newAWSAttributes(head))
+
+	if err := validateAWSMetadata(&WriteOptions{Metadata: attrs.Metadata}); err != nil {
+		return nil, err
+	}
+
+	if attrs.Size > awsMaxCopyObjectSize {
+		err = copyAWSObjectMultipart(ctx, client, bucketName, key, key, &blob.Attributes{
+			CacheControl:       attrs.CacheControl,
+			ContentDisposition: attrs.ContentDisposition,
+			ContentEncoding:    attrs.ContentEncoding,
+			ContentLanguage:    attrs.ContentLanguage,
+			ContentType:        attrs.ContentType,
+			Metadata:           attrs.Metadata,
+			Size:               attrs.Size,
+		}, aws.StringValue(head.SSEKMSKeyId), logger)
+	} else {
+		_, err = client.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+			Bucket:               aws.String(bucketName),
+			Key:                  aws.String(key),
+			CopySource:           aws.String(awsCopySource(bucketName, key)),
+			CopySourceIfMatch:    head.ETag,
+			MetadataDirective:    aws.String(s3.MetadataDirectiveReplace),
+			CacheControl:         awsOptionalString(attrs.CacheControl),
+			ContentDisposition:   awsOptionalString(attrs.ContentDisposition),
+			ContentEncoding:      awsOptionalString(attrs.ContentEncoding),
+			ContentLanguage:      awsOptionalString(attrs.ContentLanguage),
+			ContentType:          awsOptionalString(attrs.ContentType),
+			Metadata:             aws.StringMap(attrs.Metadata),
+			StorageClass:         head.StorageClass,
+			ServerSideEncryption: head.ServerSideEncryption,
+			SSEKMSKeyId:          head.SSEKMSKeyId,
+		})
+	}
+
+	if err != nil {
+		return nil, objectError(err)
+	}
+
+	head, err = client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, objectError(err)
+	}
+
+	return newAWSAttributes(head), nil
+}
+
+// listAWSObjectsWithAttributes reads the listing page by page, and fills the attributes of the objects of each page
+// with concurrent HEAD requests, since S3 doesn't return them in the listing.
+func listAWSObjectsWithAttributes(
+	ctx context.Context,
+	client *s3.S3,
+	bucketName string,
+	iter *blob.ListIterator,
+	listOptions *ListOptions,
+) *ListIterator {
+	concurrency := listOptions.AttributesConcurrency
+	if concurrency < 1 {
+		concurrency = awsListAttributesConcurrency
+	}
+
+	// the objects after MaxResults are not read
+	pageSize := awsListPageSize
+	if listOptions.MaxResults > 0 && listOptions.MaxResults < pageSize {
+		pageSize = listOptions.MaxResults
+	}
+
+	page := &awsListPage{
+		client:      client,
+		bucketName:  bucketName,
+		iter:        iter,
+		pageSize:    pageSize,
+		concurrency: concurrency,
+	}
+
+	return newReplayableListIterator(page.next)
+}
+
+// awsListPage is the page of the objects listed and not returned yet. The page is kept when a HEAD request fails,
+// the next call resumes from the same objects and only requests the attributes that are still missing.
+type awsListPage struct {
+	client      *s3.S3
+	bucketName  string
+	iter        *blob.ListIterator
+	pageSize    int
+	concurrency int
+
+	objects []*awsListedObject
+	headed  bool
+	done    bool
+}
+
+type awsListedObject struct {
+	object *ListObject
+	headed bool
+}
+
+func (p *awsListPage) next(ctx context.Context) (*ListObject, error) {
+	if len(p.objects) == 0 {
+		if p.done {
+			return nil, io.EOF
+		}
+
+		if err := p.read(ctx); err != nil {
+			return nil, err
+		}
+
+		p.headed = false
+
+		if len(p.objects) == 0 {
+			return nil, io.EOF
+		}
+	}
+
+	if !p.headed {
+		if err := p.head(ctx); err != nil {
+			return nil, err
+		}
+
+		p.headed = true
+	}
+
+	object := p.objects[0].object
+	p.objects = p.objects[1:]
+
+	return object, nil
+}
+
+// read lists the objects of the next page. A listing error is only returned when no object was read,
+// the objects read before it are returned first and the listing fails again on the next page.
+func (p *awsListPage) read(ctx context.Context) error {
+	for len(p.objects) < p.pageSize {
+		attrs, err := p.iter.Next(ctx)
+		if err == io.EOF {
+			p.done = true
+
+			return nil
+		}
+
+		if err != nil {
+			if len(p.objects) > 0 {
+				return nil
+			}
+
+			return err
+		}
+
+		p.objects = append(p.objects, &awsListedObject{
+			object: &ListObject{
+				Key:     attrs.Key,
+				ModTime: attrs.ModTime.UTC(),
+				Size:    attrs.Size,
+				MD5:     attrs.MD5,
+				IsDir:   attrs.IsDir,
+			},
+			headed: attrs.IsDir,
+		})
+	}
+
+	return nil
+}
+
+// head fills the attributes of the objects of the page which don't have them yet.
+func (p *awsListPage) head(ctx context.Context) error {
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		headErr   error
+		semaphore = make(chan struct{}, p.concurrency)
+	)
+
+	for _, listed := range p.objects {
+		if listed.headed {
+			continue
+		}
+
+		semaphore <- struct{}{}
+
+		wg.Add(1)
+
+		go func(listed *awsListedObject) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+
+			head, err := p.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+				Bucket: aws.String(p.bucketName),
+				Key:    aws.String(listed.object.Key),
+			})
+			if err != nil && !errors.Is(objectError(err), ErrNotFound) {
+				mu.Lock()
+				headErr = objectError(err)
+				mu.Unlock()
+
+				return
+			}
+
+			// an object deleted since it was listed is still returned as listed
+			if err == nil {
+				attrs := newAWSAttributes(head)
+				listed.object.ContentType = attrs.ContentType
+				listed.object.Metadata = attrs.Metadata
+			}
+
+			listed.headed = true
+		}(listed)
+	}
+
+	wg.Wait()
+
+	return headErr
+}
+
+// asAWSClients sets i, a **s3.S3 or a **session.Session, to the client or to the session of a storage.
+func asAWSClients(i interface{}, client *s3.S3, awsSession *session.Session) bool {
+	switch target := i.(type) {
+	case **s3.S3:
+		*target = client
+	case **session.Session:
+		if awsSession == nil {
+			return false
+		}
+
+		*target = awsSession
+	default:
+		return false
+	}
+
+	return true
 }
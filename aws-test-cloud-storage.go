@@ -18,30 +18,44 @@ package commonblobgo
 
 import (
 	"context"
+	"fmt"
 	"io"
-	"strings"
+	"net/http"
+	"os"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/sirupsen/logrus"
 	"gocloud.dev/blob"
 	"gocloud.dev/blob/s3blob"
 )
 
 type AWSTestCloudStorage struct {
+	storageOptions
+	closeState
+
 	client          *s3.S3
+	session         *session.Session
 	bucket          *blob.Bucket
 	bucketName      string
-	bucketCloseFunc func()
+	sseKMSKeyID     string
+	bucketCloseFunc func() error
 }
 
-func newAWSTestCloudStorage(
-	ctx context.Context,
+var _ CloudStorage = (*AWSTestCloudStorage)(nil)
+
+func newAWSTestSession(
 	s3Endpoint string,
 	s3Region string,
-	bucketName string,
-) (*AWSTestCloudStorage, error) {
+	maxRetries int,
+	debugger *httpDebugger,
+) (*session.Session, error) {
+	// the unified endpoint of localstack, e.g. http://localhost:4566, like in the AWS CLI
+	if s3Endpoint == "" {
+		s3Endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+
 	// create vanilla AWS client
 	var awsConfig aws.Config
 
@@ -58,27 +72,38 @@ func newAWSTestCloudStorage(
 		}
 	}
 
-	awsSession, err := session.NewSession(&awsConfig)
-	if err != nil {
-		return nil, err
+	// the storage retries the transient errors instead of the SDK
+	if maxRetries > 0 {
+		awsConfig.MaxRetries = aws.Int(0)
 	}
 
+	return newProviderAWSSession(session.Options{Config: awsConfig}, debugger)
+}
+
+func newAWSTestCloudStorage(
+	ctx context.Context,
+	awsSession *session.Session,
+	bucketName string,
+	sseKMSKeyID string,
+	storageOpts storageOptions,
+) (*AWSTestCloudStorage, error) {
 	client := s3.New(awsSession)
 
-	bucket, err := s3blob.OpenBucket(ctx, awsSession, bucketName, nil)
+	bucket, err := s3blob.OpenBucket(ctx, withAWSChecksumMode(awsSession), bucketName, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	logrus.Infof("AWSTestCloudStorage created")
+	storageOpts.logger.Infof("AWSTestCloudStorage created")
 
 	return &AWSTestCloudStorage{
-		client:     client,
-		bucketName: bucketName,
-		bucket:     bucket,
-		bucketCloseFunc: func() {
-			bucket.Close()
-		},
+		client:          client,
+		session:         awsSession,
+		bucketName:      bucketName,
+		bucket:          bucket,
+		sseKMSKeyID:     sseKMSKeyID,
+		storageOptions:  storageOpts,
+		bucketCloseFunc: bucket.Close,
 	}, nil
 }
 
@@ -90,7 +115,7 @@ func (ts *AWSTestCloudStorage) List(
 		Prefix: prefix,
 	})
 
-	return newListIterator(func() (*ListObject, error) {
+	return newReplayableListIterator(func(ctx context.Context) (*ListObject, error) {
 		attrs, err := iter.Next(ctx)
 		if err != nil {
 			return nil, err
@@ -98,7 +123,7 @@ func (ts *AWSTestCloudStorage) List(
 
 		return &ListObject{
 			Key:     attrs.Key,
-			ModTime: attrs.ModTime,
+			ModTime: attrs.ModTime.UTC(),
 			Size:    attrs.Size,
 			MD5:     attrs.MD5,
 		}, nil
@@ -109,12 +134,13 @@ func (ts *AWSTestCloudStorage) ListWithOptions(
 	ctx context.Context,
 	listOptions *ListOptions,
 ) *ListIterator {
-	iter := ts.bucket.List(&blob.ListOptions{
-		Prefix:    listOptions.Prefix,
-		Delimiter: listOptions.Delimiter,
-	})
+	iter := ts.bucket.List(newBlobListOptions(listOptions))
+
+	if listOptions.IncludeAttributes {
+		return applyListOptions(listAWSObjectsWithAttributes(ctx, ts.client, ts.bucketName, iter, listOptions), listOptions)
+	}
 
-	return newListIterator(func() (*ListObject, error) {
+	return applyListOptions(newReplayableListIterator(func(ctx context.Context) (*ListObject, error) {
 		attrs, err := iter.Next(ctx)
 		if err != nil {
 			return nil, err
@@ -122,26 +148,45 @@ func (ts *AWSTestCloudStorage) ListWithOptions(
 
 		return &ListObject{
 			Key:     attrs.Key,
-			ModTime: attrs.ModTime,
+			ModTime: attrs.ModTime.UTC(),
 			Size:    attrs.Size,
 			MD5:     attrs.MD5,
 			IsDir:   attrs.IsDir,
 		}, nil
-	})
+	}), listOptions)
 }
 
 func (ts *AWSTestCloudStorage) Get(
 	ctx context.Context,
 	key string,
 ) ([]byte, error) {
-	return ts.bucket.ReadAll(ctx, key)
+	return readAllAndClose(ts.GetReader(ctx, key))
+}
+
+func (ts *AWSTestCloudStorage) GetIfModified(
+	ctx context.Context,
+	key string,
+	etag string,
+	modSince time.Time,
+) ([]byte, *Attributes, bool, error) {
+	return getAWSObjectIfModified(ctx, ts.client, ts.bucketName, key, etag, modSince, !ts.disableDecompression)
+}
+
+// GetWithAttributes reads the attributes from the headers of the GET response.
+func (ts *AWSTestCloudStorage) GetWithAttributes(
+	ctx context.Context,
+	key string,
+) ([]byte, *Attributes, error) {
+	body, attrs, _, err := getAWSObjectIfModified(ctx, ts.client, ts.bucketName, key, "", time.Time{}, !ts.disableDecompression)
+
+	return body, attrs, err
 }
 
 func (ts *AWSTestCloudStorage) GetReader(
 	ctx context.Context,
 	key string,
 ) (io.ReadCloser, error) {
-	return ts.bucket.NewReader(ctx, key, nil)
+	return newBlobReader(ctx, ts.bucket, key, !ts.disableDecompression)
 }
 
 func (ts *AWSTestCloudStorage) GetRangeReader(
@@ -150,14 +195,57 @@ func (ts *AWSTestCloudStorage) GetRangeReader(
 	offset,
 	length int64,
 ) (io.ReadCloser, error) {
-	return ts.bucket.NewRangeReader(ctx, key, offset, length, nil)
+	return newRangeReader(ctx, ts.bucket, key, offset, length)
 }
 
 func (ts *AWSTestCloudStorage) GetWriter(
 	ctx context.Context,
 	key string,
 ) (io.WriteCloser, error) {
-	return ts.bucket.NewWriter(ctx, key, nil)
+	return ts.GetWriterWithOptions(ctx, key, nil)
+}
+
+func (ts *AWSTestCloudStorage) GetWriterWithOptions(
+	ctx context.Context,
+	key string,
+	opts *WriteOptions,
+) (io.WriteCloser, error) {
+	opts = ts.uploadOptions(opts)
+
+	if err := opts.validateConditions(); err != nil {
+		return nil, err
+	}
+
+	if err := validateAWSMetadata(opts); err != nil {
+		return nil, err
+	}
+
+	if err := validateAWSPartSize(int64(opts.BufferSize)); err != nil {
+		return nil, err
+	}
+
+	// the checksum of the whole object can't be sent with the parts of a multipart upload
+	if opts != nil && opts.ChecksumAlgorithm != "" {
+		return nil, newTypedError(ErrNotSupported, fmt.Errorf("checksum algorithms of streamed writes on S3"))
+	}
+
+	compress := opts != nil && opts.Compress
+	if compress {
+		opts = compressedOptions(opts)
+	}
+
+	return newUploadWriter(ctx, opts, func(ctx context.Context) (io.WriteCloser, error) {
+		writer, err := ts.bucket.NewWriter(ctx, key, newAWSWriterOptions(opts, ts.sseKMSKeyID, ts.verifiesChecksum(opts)))
+		if err != nil {
+			return nil, err
+		}
+
+		if compress {
+			return newGzipWriteCloser(&typedErrorWriter{writer}), nil
+		}
+
+		return &typedErrorWriter{writer}, nil
+	})
 }
 
 func (ts *AWSTestCloudStorage) CreateBucket(
@@ -165,62 +253,117 @@ func (ts *AWSTestCloudStorage) CreateBucket(
 	bucketPrefix string,
 	expirationTimeDays int64,
 ) error {
-	logrus.Printf("CreateBucket. Name: %s, Prefix: %s, Exp Time: %v", ts.bucketName, bucketPrefix, expirationTimeDays)
-
-	if _, err := ts.client.CreateBucket(&s3.CreateBucketInput{
-		Bucket: aws.String(ts.bucketName)}); err != nil {
-		if strings.Contains(err.Error(), s3.ErrCodeBucketAlreadyExists) {
-			return nil
-		}
-
-		logrus.Errorf("unable to create bucket '%s': %v", ts.bucketName, err)
+	return ts.CreateBucketWithOptions(ctx, &CreateBucketOptions{Prefix: bucketPrefix, ExpirationDays: expirationTimeDays})
+}
 
-		return err
+func (ts *AWSTestCloudStorage) CreateBucketWithOptions(
+	ctx context.Context,
+	opts *CreateBucketOptions,
+) error {
+	if opts == nil {
+		opts = &CreateBucketOptions{}
 	}
 
-	bucketConf := s3.BucketLifecycleConfiguration{
-		Rules: []*s3.LifecycleRule{
-			{
-				ID: aws.String("Delete request user data"),
-				Filter: &s3.LifecycleRuleFilter{
-					Prefix: aws.String(strings.TrimSuffix(bucketPrefix, "/")),
-				},
-				Expiration: &s3.LifecycleExpiration{
-					Days: aws.Int64(expirationTimeDays),
-				},
-				NoncurrentVersionExpiration: &s3.NoncurrentVersionExpiration{
-					NoncurrentDays: aws.Int64(expirationTimeDays),
-				},
-				Status: aws.String(s3.ExpirationStatusEnabled),
-			},
-		},
-	}
+	ts.logger.Debugf("CreateBucket. Name: %s, Prefix: %s, Exp Time: %v", ts.bucketName, opts.Prefix, opts.ExpirationDays)
+
+	if err := createAWSBucket(ctx, ts.client, ts.bucketName, opts, ts.logger); err != nil {
+		ts.logger.Errorf("unable to create bucket '%s': %v", ts.bucketName, err)
 
-	_, err := ts.client.PutBucketLifecycleConfiguration(
-		&s3.PutBucketLifecycleConfigurationInput{
-			Bucket:                 aws.String(ts.bucketName),
-			LifecycleConfiguration: &bucketConf,
-		})
-	if err != nil {
 		return err
 	}
 
-	_, err = ts.client.ListObjects(&s3.ListObjectsInput{
+	_, err := ts.client.ListObjects(&s3.ListObjectsInput{
 		Bucket:  aws.String(ts.bucketName),
 		MaxKeys: aws.Int64(1), // nolint:gomnd
 	})
 	if err != nil {
-		logrus.Errorf("unable access bucket '%s': %v", ts.bucketName, err)
+		ts.logger.Errorf("unable access bucket '%s': %v", ts.bucketName, err)
 		return err
 	}
 
-	logrus.Printf("Bucket %v created.\n", ts.bucketName)
+	ts.logger.Infof("Bucket %v created.", ts.bucketName)
 
 	return nil
 }
 
-func (ts *AWSTestCloudStorage) Close() {
-	ts.bucketCloseFunc()
+func (ts *AWSTestCloudStorage) SetLifecycle(
+	ctx context.Context,
+	rules []LifecycleRule,
+	opts *LifecycleOptions,
+) error {
+	return setAWSLifecycle(ctx, ts.client, ts.bucketName, rules, opts)
+}
+
+func (ts *AWSTestCloudStorage) GetLifecycle(
+	ctx context.Context,
+) ([]LifecycleRule, error) {
+	return getAWSLifecycle(ctx, ts.client, ts.bucketName)
+}
+
+func (ts *AWSTestCloudStorage) SetVersioning(
+	ctx context.Context,
+	enabled bool,
+) error {
+	return setAWSVersioning(ctx, ts.client, ts.bucketName, enabled)
+}
+
+func (ts *AWSTestCloudStorage) GetVersioning(
+	ctx context.Context,
+) (bool, error) {
+	state, err := ts.GetVersioningState(ctx)
+
+	return state == VersioningEnabled, err
+}
+
+func (ts *AWSTestCloudStorage) GetVersioningState(
+	ctx context.Context,
+) (VersioningState, error) {
+	return getAWSVersioningState(ctx, ts.client, ts.bucketName)
+}
+
+func (ts *AWSTestCloudStorage) SetCORS(
+	ctx context.Context,
+	rules []CORSRule,
+) error {
+	return setAWSCORS(ctx, ts.client, ts.bucketName, rules)
+}
+
+func (ts *AWSTestCloudStorage) GetCORS(
+	ctx context.Context,
+) ([]CORSRule, error) {
+	return getAWSCORS(ctx, ts.client, ts.bucketName)
+}
+
+func (ts *AWSTestCloudStorage) SetPublicAccessBlock(
+	ctx context.Context,
+	blocked bool,
+) error {
+	return setAWSPublicAccessBlock(ctx, ts.client, ts.bucketName, blocked)
+}
+
+func (ts *AWSTestCloudStorage) GetPublicAccessBlock(
+	ctx context.Context,
+) (bool, error) {
+	block, err := ts.GetPublicAccessBlockDetails(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return block.Blocked(), nil
+}
+
+func (ts *AWSTestCloudStorage) GetPublicAccessBlockDetails(
+	ctx context.Context,
+) (*PublicAccessBlock, error) {
+	return getAWSPublicAccessBlock(ctx, ts.client, ts.bucketName)
+}
+
+func (ts *AWSTestCloudStorage) Close() error {
+	if !ts.markClosed() {
+		return nil
+	}
+
+	return ts.bucketCloseFunc()
 }
 
 func (ts *AWSTestCloudStorage) GetSignedURL(
@@ -228,13 +371,85 @@ func (ts *AWSTestCloudStorage) GetSignedURL(
 	key string,
 	opts *SignedURLOption,
 ) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	if host := signedURLHost(opts, ts.storageOptions); host != "" {
+		return signCloudFrontURL(ts.cloudFrontSigner, host, key, opts)
+	}
+
+	if opts.AllowedSourceIP != "" {
+		return "", newTypedError(ErrNotSupported,
+			fmt.Errorf("source IP restrictions of S3 presigned URLs, they require the CloudFront signed URLs of a host override"))
+	}
+
+	if (opts.Method == http.MethodPut && ts.sseKMSKeyID != "") || opts.hasResponseOverrides() || len(opts.SignedHeaders) > 0 {
+		return presignAWSRequest(ctx, ts.client, ts.bucketName, key, opts, ts.sseKMSKeyID)
+	}
+
 	options := &blob.SignedURLOptions{
 		Expiry:                   opts.Expiry,
 		Method:                   opts.Method,
 		ContentType:              opts.ContentType,
 		EnforceAbsentContentType: opts.EnforceAbsentContentType,
 	}
-	return ts.bucket.SignedURL(context.Background(), key, options)
+	return ts.bucket.SignedURL(ctx, key, options)
+}
+
+func (ts *AWSTestCloudStorage) GetSignedPostPolicy(
+	ctx context.Context,
+	keyPrefix string,
+	opts *PostPolicyOptions,
+) (*PostPolicy, error) {
+	return newAWSPostPolicy(ctx, ts.client, ts.bucketName, keyPrefix, opts, ts.sseKMSKeyID)
+}
+
+func (ts *AWSTestCloudStorage) GetPublicURL(
+	key string,
+) (string, error) {
+	return awsPublicURL(ts.client, ts.bucketName, key)
+}
+
+// As sets i, a **s3.S3 or a **session.Session, to the S3 client or to the AWS session of the storage, shared
+// with the other buckets of the factory. The other types aren't supported.
+func (ts *AWSTestCloudStorage) As(i interface{}) bool {
+	return asAWSClients(i, ts.client, ts.session)
+}
+
+func (ts *AWSTestCloudStorage) StartMultipartUpload(
+	ctx context.Context,
+	key string,
+	opts *WriteOptions,
+) (string, error) {
+	return startAWSMultipartUpload(ctx, ts.client, ts.bucketName, key, opts, ts.sseKMSKeyID)
+}
+
+func (ts *AWSTestCloudStorage) SignUploadPartURL(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	partNumber int,
+	expiry time.Duration,
+) (string, error) {
+	return signAWSUploadPartURL(ctx, ts.client, ts.bucketName, key, uploadID, partNumber, expiry)
+}
+
+func (ts *AWSTestCloudStorage) CompleteMultipartUpload(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	parts []CompletedPart,
+) error {
+	return completeAWSMultipartUpload(ctx, ts.client, ts.bucketName, key, uploadID, parts)
+}
+
+func (ts *AWSTestCloudStorage) AbortMultipartUpload(
+	ctx context.Context,
+	key string,
+	uploadID string,
+) error {
+	return abortAWSMultipartUpload(ctx, ts.client, ts.bucketName, key, uploadID)
 }
 
 func (ts *AWSTestCloudStorage) Write(
@@ -243,50 +458,216 @@ func (ts *AWSTestCloudStorage) Write(
 	body []byte,
 	contentType *string,
 ) error {
-	options := &blob.WriterOptions{}
+	options := &WriteOptions{}
 	if contentType != nil {
 		options.ContentType = *contentType
 	}
 
-	return ts.bucket.WriteAll(ctx, key, body, options)
+	return ts.WriteWithOptions(ctx, key, body, options)
+}
+
+func (ts *AWSTestCloudStorage) WriteWithOptions(
+	ctx context.Context,
+	key string,
+	body []byte,
+	opts *WriteOptions,
+) error {
+	if err := opts.validateConditions(); err != nil {
+		return err
+	}
+
+	if err := validateAWSMetadata(opts); err != nil {
+		return err
+	}
+
+	body, opts, err := compressBody(body, opts)
+	if err != nil {
+		return err
+	}
+
+	options := newAWSWriterOptions(opts, ts.sseKMSKeyID, ts.verifiesChecksum(opts))
+
+	// the whole body is in memory anyway, so that S3 can check its MD5
+	if !ts.awsDisableContentMD5 {
+		options.ContentMD5 = md5Sum(body)
+	}
+
+	if err := withAWSChecksum(options, opts, body); err != nil {
+		return err
+	}
+
+	return objectError(ts.bucket.WriteAll(ctx, key, body, options))
 }
 
 func (ts *AWSTestCloudStorage) Delete(
 	ctx context.Context,
 	key string,
 ) error {
-	return ts.bucket.Delete(ctx, key)
+	return objectError(ts.bucket.Delete(ctx, key))
+}
+
+func (ts *AWSTestCloudStorage) DeleteBatch(
+	ctx context.Context,
+	keys []string,
+) error {
+	return deleteAWSObjects(ctx, ts.client, ts.bucketName, keys)
 }
 
 func (ts *AWSTestCloudStorage) Attributes(
 	ctx context.Context,
 	key string,
 ) (*Attributes, error) {
-	attrs, err := ts.bucket.Attributes(ctx, key)
+	return getBlobAttributes(ctx, ts.bucket, key)
+}
+
+// GetSize shares the HEAD request of Attributes.
+func (ts *AWSTestCloudStorage) GetSize(
+	ctx context.Context,
+	key string,
+) (int64, error) {
+	attrs, err := getBlobAttributes(ctx, ts.bucket, key)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	return &Attributes{
-		CacheControl:       attrs.CacheControl,
-		ContentDisposition: attrs.ContentDisposition,
-		ContentEncoding:    attrs.ContentEncoding,
-		ContentLanguage:    attrs.ContentLanguage,
-		ContentType:        attrs.ContentType,
-		Metadata:           attrs.Metadata,
-		ModTime:            attrs.ModTime,
-		Size:               attrs.Size,
-		MD5:                attrs.MD5,
-	}, nil
+	return attrs.Size, nil
+}
+
+func (ts *AWSTestCloudStorage) VerifyDownload(
+	ctx context.Context,
+	key string,
+) error {
+	return verifyDownload(ctx, ts, key, func() (io.ReadCloser, error) {
+		return newBlobReader(ctx, ts.bucket, key, false)
+	})
+}
+
+func (ts *AWSTestCloudStorage) SetTags(
+	ctx context.Context,
+	key string,
+	tags map[string]string,
+) error {
+	return setAWSTags(ctx, ts.client, ts.bucketName, key, tags)
+}
+
+func (ts *AWSTestCloudStorage) GetTags(
+	ctx context.Context,
+	key string,
+) (map[string]string, error) {
+	return getAWSTags(ctx, ts.client, ts.bucketName, key)
+}
+
+func (ts *AWSTestCloudStorage) SetStorageClass(
+	ctx context.Context,
+	key string,
+	class string,
+) error {
+	return setAWSStorageClass(ctx, ts.client, ts.bucketName, key, class, ts.logger)
 }
 
 func (ts *AWSTestCloudStorage) Exists(
 	ctx context.Context,
 	key string,
 ) (bool, error) {
-	return ts.bucket.Exists(ctx, key)
+	return existsAWSObject(ctx, ts.client, ts.bucketName, key)
+}
+
+func (ts *AWSTestCloudStorage) bucketLocation() string {
+	return "aws/" + ts.bucketName
 }
 
 func (ts *AWSTestCloudStorage) Copy(ctx context.Context, dstKey, srcKey string) error {
-	return ts.bucket.Copy(ctx, dstKey, srcKey, nil)
+	return copyAWSObject(ctx, ts.client, ts.bucket, ts.bucketName, dstKey, srcKey, ts.sseKMSKeyID, ts.logger)
+}
+
+func (ts *AWSTestCloudStorage) Move(ctx context.Context, dstKey, srcKey string) error {
+	// the source is kept when the copy failed
+	if err := ts.Copy(ctx, dstKey, srcKey); err != nil {
+		return err
+	}
+
+	if dstKey == srcKey {
+		return nil
+	}
+
+	return ts.Delete(ctx, srcKey)
+}
+
+func (ts *AWSTestCloudStorage) Ping(ctx context.Context) error {
+	_, err := ts.client.HeadBucketWithContext(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(ts.bucketName),
+	})
+
+	return awsBucketError(err)
+}
+
+func (ts *AWSTestCloudStorage) ListVersions(
+	ctx context.Context,
+	prefix string,
+) *VersionIterator {
+	return listAWSVersions(ctx, ts.client, ts.bucketName, prefix)
+}
+
+func (ts *AWSTestCloudStorage) GetVersion(
+	ctx context.Context,
+	key string,
+	version string,
+) ([]byte, error) {
+	return getAWSVersion(ctx, ts.client, ts.bucketName, key, version)
+}
+
+func (ts *AWSTestCloudStorage) DeleteVersion(
+	ctx context.Context,
+	key string,
+	version string,
+) error {
+	return deleteAWSVersion(ctx, ts.client, ts.bucketName, key, version)
+}
+
+func (ts *AWSTestCloudStorage) SetObjectRetention(
+	ctx context.Context,
+	key string,
+	until time.Time,
+	mode string,
+) error {
+	return setAWSObjectRetention(ctx, ts.client, ts.bucketName, key, until, mode)
+}
+
+func (ts *AWSTestCloudStorage) GetObjectRetention(
+	ctx context.Context,
+	key string,
+) (*ObjectRetention, error) {
+	return getAWSObjectRetention(ctx, ts.client, ts.bucketName, key)
+}
+
+func (ts *AWSTestCloudStorage) Restore(
+	ctx context.Context,
+	key string,
+	days int,
+	tier string,
+) error {
+	return restoreAWSObject(ctx, ts.client, ts.bucketName, key, days, tier)
+}
+
+func (ts *AWSTestCloudStorage) RestoreStatus(
+	ctx context.Context,
+	key string,
+) (RestoreState, error) {
+	return getAWSRestoreState(ctx, ts.client, ts.bucketName, key)
+}
+
+func (ts *AWSTestCloudStorage) Append(
+	ctx context.Context,
+	key string,
+	data []byte,
+) error {
+	return appendAWSObject(ctx, ts.client, ts.bucketName, key, data, ts.sseKMSKeyID, ts.logger)
+}
+
+func (ts *AWSTestCloudStorage) UpdateAttributes(
+	ctx context.Context,
+	key string,
+	update AttributeUpdate,
+) (*Attributes, error) {
+	return updateAWSAttributes(ctx, ts.client, ts.bucketName, key, update, ts.logger)
 }
@@ -0,0 +1,276 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+)
+
+// deleteBatchConcurrency is the number of parallel deletes for the providers without a batch delete call.
+const deleteBatchConcurrency = 16
+
+// newWriterOptions translates the write options of this package into the blob package ones.
+func newWriterOptions(opts *WriteOptions) *blob.WriterOptions {
+	if opts == nil {
+		return &blob.WriterOptions{}
+	}
+
+	var metadata map[string]string
+
+	if opts.Metadata != nil {
+		// keys are lowercased to match what Attributes returns
+		metadata = make(map[string]string, len(opts.Metadata))
+		for key, value := range opts.Metadata {
+			metadata[strings.ToLower(key)] = value
+		}
+	}
+
+	return &blob.WriterOptions{
+		BufferSize:         opts.BufferSize,
+		CacheControl:       opts.CacheControl,
+		ContentDisposition: opts.ContentDisposition,
+		ContentEncoding:    opts.ContentEncoding,
+		ContentLanguage:    opts.ContentLanguage,
+		ContentType:        opts.ContentType,
+		Metadata:           metadata,
+	}
+}
+
+// newBlobListOptions passes StartAfter and MaxResults to the provider query, since the blob package doesn't support them.
+// GCS has no page size option, MaxResults is only applied by the iterator there.
+func newBlobListOptions(opts *ListOptions) *blob.ListOptions {
+	options := &blob.ListOptions{
+		Prefix:    opts.Prefix,
+		Delimiter: opts.Delimiter,
+	}
+
+	if opts.StartAfter == "" && opts.MaxResults <= 0 {
+		return options
+	}
+
+	options.BeforeList = func(asFunc func(interface{}) bool) error {
+		var (
+			s3Input  *s3.ListObjectsV2Input
+			gcsQuery *storage.Query
+		)
+
+		switch {
+		case asFunc(&s3Input):
+			if opts.StartAfter != "" {
+				s3Input.StartAfter = aws.String(opts.StartAfter)
+			}
+
+			// the pages are not bigger than needed
+			if opts.MaxResults > 0 && opts.MaxResults < awsListPageSize {
+				s3Input.MaxKeys = aws.Int64(int64(opts.MaxResults))
+			}
+		case asFunc(&gcsQuery):
+			gcsQuery.StartOffset = gcpStartOffset(opts.StartAfter)
+		}
+
+		return nil
+	}
+
+	return options
+}
+
+// getBlobAttributes reads the attributes with a HEAD request, it's the code path of Attributes and GetSize.
+func getBlobAttributes(ctx context.Context, bucket *blob.Bucket, key string) (*Attributes, error) {
+	attrs, err := bucket.Attributes(ctx, key)
+	if err != nil {
+		return nil, objectError(err)
+	}
+
+	return newAttributes(attrs), nil
+}
+
+func newAttributes(attrs *blob.Attributes) *Attributes {
+	// the ETag, the creation time, the storage class and the checksums are only available from the provider response
+	var (
+		s3Head   s3.HeadObjectOutput
+		gcsAttrs storage.ObjectAttrs
+	)
+
+	result := &Attributes{
+		CacheControl:       attrs.CacheControl,
+		ContentDisposition: attrs.ContentDisposition,
+		ContentEncoding:    attrs.ContentEncoding,
+		ContentLanguage:    attrs.ContentLanguage,
+		ContentType:        attrs.ContentType,
+		Metadata:           attrs.Metadata,
+		ModTime:            attrs.ModTime,
+		Size:               attrs.Size,
+		MD5:                attrs.MD5,
+	}
+
+	switch {
+	case attrs.As(&s3Head):
+		result.ETag = aws.StringValue(s3Head.ETag)
+		result.StorageClass = awsStorageClass(s3Head.StorageClass)
+		result.CRC32C, result.HasCRC32C, result.SHA256 = awsChecksums(&s3Head)
+	case attrs.As(&gcsAttrs):
+		result.ETag = strconv.FormatInt(gcsAttrs.Generation, 10)
+		result.CreateTime = gcsAttrs.Created
+		result.StorageClass = gcsAttrs.StorageClass
+		result.CRC32C = gcsAttrs.CRC32C
+		result.HasCRC32C = true
+	}
+
+	return normalizeAttributes(result)
+}
+
+// copyObject makes a server-side copy of the object, it's shared by the providers which don't need special handling.
+func copyObject(ctx context.Context, bucket *blob.Bucket, dstKey, srcKey string) error {
+	if dstKey == srcKey {
+		// the content is already in place, only check that the source exists
+		_, err := bucket.Attributes(ctx, srcKey)
+
+		return objectError(err)
+	}
+
+	return objectError(bucket.Copy(ctx, dstKey, srcKey, nil))
+}
+
+// newBlobReader reads the object, which is decompressed when it's gzip encoded unless decompress is false.
+func newBlobReader(ctx context.Context, bucket *blob.Bucket, key string, decompress bool) (io.ReadCloser, error) {
+	reader, err := bucket.NewReader(ctx, key, nil)
+	if err != nil {
+		return nil, objectError(err)
+	}
+
+	if !decompress {
+		return reader, nil
+	}
+
+	return newDecompressingReader(reader, blobContentEncoding(reader))
+}
+
+// blobContentEncoding returns the content encoding of the response, which the blob reader doesn't expose.
+func blobContentEncoding(reader *blob.Reader) string {
+	var (
+		s3Output  s3.GetObjectOutput
+		gcsReader *storage.Reader
+	)
+
+	switch {
+	case reader.As(&s3Output):
+		return aws.StringValue(s3Output.ContentEncoding)
+	case reader.As(&gcsReader):
+		return gcsReader.Attrs.ContentEncoding
+	default:
+		return ""
+	}
+}
+
+// newRangeReader gives the same range semantics on every provider: a negative length reads till the end of
+// the object, an offset at the end of the object returns an empty reader, and a negative offset or an offset
+// beyond the end of the object fails with ErrOutOfRange.
+func newRangeReader(ctx context.Context, bucket *blob.Bucket, key string, offset, length int64) (io.ReadCloser, error) {
+	if offset < 0 {
+		return nil, newTypedError(ErrOutOfRange, fmt.Errorf("offset %d of %s is negative", offset, key))
+	}
+
+	reader, err := bucket.NewRangeReader(ctx, key, offset, length, nil)
+	if err != nil {
+		err = objectError(err)
+
+		// S3 rejects the empty range at the end of the object
+		if errors.Is(err, ErrOutOfRange) {
+			attrs, attrsErr := bucket.Attributes(ctx, key)
+			if attrsErr == nil && attrs.Size == offset {
+				return ioutil.NopCloser(strings.NewReader("")), nil
+			}
+		}
+
+		return nil, err
+	}
+
+	if offset > reader.Size() {
+		size := reader.Size()
+
+		if err := reader.Close(); err != nil {
+			return nil, err
+		}
+
+		return nil, newTypedError(ErrOutOfRange, fmt.Errorf("offset %d is beyond the size %d of %s", offset, size, key))
+	}
+
+	return reader, nil
+}
+
+// deleteObjects deletes the objects in parallel, the objects which don't exist are counted as deleted.
+func deleteObjects(ctx context.Context, bucket *blob.Bucket, keys []string) error {
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		failures = make(map[string]error)
+	)
+
+	semaphore := make(chan struct{}, deleteBatchConcurrency)
+
+	for _, key := range keys {
+		semaphore <- struct{}{}
+
+		wg.Add(1)
+
+		go func(key string) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+
+			err := bucket.Delete(ctx, key)
+			if err == nil || gcerrors.Code(err) == gcerrors.NotFound {
+				return
+			}
+
+			mu.Lock()
+			failures[key] = objectError(err)
+			mu.Unlock()
+		}(key)
+	}
+
+	wg.Wait()
+
+	if len(failures) > 0 {
+		return &BatchError{Errors: failures}
+	}
+
+	return nil
+}
+
+// typedErrorWriter maps the upload errors, which are returned by Close, onto the typed errors of this package.
+type typedErrorWriter struct {
+	io.WriteCloser
+}
+
+func (w *typedErrorWriter) Close() error {
+	return objectError(w.WriteCloser.Close())
+}
@@ -0,0 +1,758 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// closableCloudStorage fails every operation with ErrClosed once the storage is closed, instead of calling
+// the closed bucket. Close waits for the calls in flight before closing the wrapped storage. The iterators created
+// before the close fail at their next page, while the readers and the writers already opened are left to the provider.
+type closableCloudStorage struct {
+	closeState
+
+	// mu is held for reading by the calls in flight, and for writing by Close until they end
+	mu    sync.RWMutex
+	inner CloudStorage
+	// onClose is called by the first Close, it may be nil
+	onClose func()
+}
+
+var _ CloudStorage = (*closableCloudStorage)(nil)
+
+func newClosableCloudStorage(inner CloudStorage, onClose func()) CloudStorage {
+	return &closableCloudStorage{
+		inner:   inner,
+		onClose: onClose,
+	}
+}
+
+// enter starts a call of the storage, it fails with ErrClosed once the storage is closed.
+// Close waits for the calls started before it, which end with exit.
+func (ts *closableCloudStorage) enter() error {
+	// the calls made while Close waits fail without waiting too
+	if ts.isClosed() {
+		return ErrClosed
+	}
+
+	ts.mu.RLock()
+
+	if ts.isClosed() {
+		ts.mu.RUnlock()
+
+		return ErrClosed
+	}
+
+	return nil
+}
+
+func (ts *closableCloudStorage) exit() {
+	ts.mu.RUnlock()
+}
+
+// options returns the settings of the wrapped storage.
+func (ts *closableCloudStorage) options() storageOptions {
+	return storageOptionsOf(ts.inner)
+}
+
+// bucketLocation is the one of the wrapped storage, so that CopyObjectBetween still copies by the provider.
+func (ts *closableCloudStorage) bucketLocation() string {
+	locator, ok := ts.inner.(bucketLocator)
+	if !ok {
+		return ""
+	}
+
+	return locator.bucketLocation()
+}
+
+func (ts *closableCloudStorage) List(
+	ctx context.Context,
+	prefix string,
+) *ListIterator {
+	if err := ts.enter(); err != nil {
+		return newListIterator(func(ctx context.Context) (*ListObject, error) {
+			return nil, err
+		})
+	}
+	defer ts.exit()
+
+	iter := ts.inner.List(ctx, prefix)
+
+	return newListIterator(func(ctx context.Context) (*ListObject, error) {
+		if err := ts.enter(); err != nil {
+			return nil, err
+		}
+		defer ts.exit()
+
+		return iter.Next(ctx)
+	})
+}
+
+func (ts *closableCloudStorage) ListWithOptions(
+	ctx context.Context,
+	options *ListOptions,
+) *ListIterator {
+	if err := ts.enter(); err != nil {
+		return newListIterator(func(ctx context.Context) (*ListObject, error) {
+			return nil, err
+		})
+	}
+	defer ts.exit()
+
+	iter := ts.inner.ListWithOptions(ctx, options)
+
+	return newListIterator(func(ctx context.Context) (*ListObject, error) {
+		if err := ts.enter(); err != nil {
+			return nil, err
+		}
+		defer ts.exit()
+
+		return iter.Next(ctx)
+	})
+}
+
+func (ts *closableCloudStorage) ListVersions(
+	ctx context.Context,
+	prefix string,
+) *VersionIterator {
+	if err := ts.enter(); err != nil {
+		return newVersionIterator(func(ctx context.Context) (*ObjectVersion, error) {
+			return nil, err
+		})
+	}
+	defer ts.exit()
+
+	iter := ts.inner.ListVersions(ctx, prefix)
+
+	return newVersionIterator(func(ctx context.Context) (*ObjectVersion, error) {
+		if err := ts.enter(); err != nil {
+			return nil, err
+		}
+		defer ts.exit()
+
+		return iter.Next(ctx)
+	})
+}
+
+// Close closes the wrapped storage only once, the next calls return nil.
+func (ts *closableCloudStorage) Close() error {
+	if !ts.markClosed() {
+		return nil
+	}
+
+	if ts.onClose != nil {
+		ts.onClose()
+	}
+
+	// the calls in flight end before the wrapped storage is closed
+	ts.mu.Lock()
+	ts.mu.Unlock() //nolint:staticcheck // the lock only waits for the calls in flight
+
+	return ts.inner.Close()
+}
+
+func (ts *closableCloudStorage) GetPublicURL(key string) (string, error) {
+	if err := ts.enter(); err != nil {
+		return "", err
+	}
+	defer ts.exit()
+
+	return ts.inner.GetPublicURL(key)
+}
+
+func (ts *closableCloudStorage) As(i interface{}) bool {
+	return ts.inner.As(i)
+}
+
+func (ts *closableCloudStorage) Get(
+	ctx context.Context,
+	key string,
+) ([]byte, error) {
+	if err := ts.enter(); err != nil {
+		return nil, err
+	}
+	defer ts.exit()
+
+	return ts.inner.Get(ctx, key)
+}
+
+func (ts *closableCloudStorage) GetIfModified(
+	ctx context.Context,
+	key string,
+	etag string,
+	modSince time.Time,
+) ([]byte, *Attributes, bool, error) {
+	if err := ts.enter(); err != nil {
+		return nil, nil, false, err
+	}
+	defer ts.exit()
+
+	return ts.inner.GetIfModified(ctx, key, etag, modSince)
+}
+
+func (ts *closableCloudStorage) GetWithAttributes(
+	ctx context.Context,
+	key string,
+) ([]byte, *Attributes, error) {
+	if err := ts.enter(); err != nil {
+		return nil, nil, err
+	}
+	defer ts.exit()
+
+	return ts.inner.GetWithAttributes(ctx, key)
+}
+
+func (ts *closableCloudStorage) Delete(
+	ctx context.Context,
+	key string,
+) error {
+	if err := ts.enter(); err != nil {
+		return err
+	}
+	defer ts.exit()
+
+	return ts.inner.Delete(ctx, key)
+}
+
+func (ts *closableCloudStorage) DeleteBatch(
+	ctx context.Context,
+	keys []string,
+) error {
+	if err := ts.enter(); err != nil {
+		return err
+	}
+	defer ts.exit()
+
+	return ts.inner.DeleteBatch(ctx, keys)
+}
+
+func (ts *closableCloudStorage) CreateBucket(
+	ctx context.Context,
+	bucketPrefix string,
+	expirationTimeDays int64,
+) error {
+	if err := ts.enter(); err != nil {
+		return err
+	}
+	defer ts.exit()
+
+	return ts.inner.CreateBucket(ctx, bucketPrefix, expirationTimeDays)
+}
+
+func (ts *closableCloudStorage) CreateBucketWithOptions(
+	ctx context.Context,
+	opts *CreateBucketOptions,
+) error {
+	if err := ts.enter(); err != nil {
+		return err
+	}
+	defer ts.exit()
+
+	return ts.inner.CreateBucketWithOptions(ctx, opts)
+}
+
+func (ts *closableCloudStorage) GetSignedURL(
+	ctx context.Context,
+	key string,
+	opts *SignedURLOption,
+) (string, error) {
+	if err := ts.enter(); err != nil {
+		return "", err
+	}
+	defer ts.exit()
+
+	return ts.inner.GetSignedURL(ctx, key, opts)
+}
+
+func (ts *closableCloudStorage) GetSignedPostPolicy(
+	ctx context.Context,
+	keyPrefix string,
+	opts *PostPolicyOptions,
+) (*PostPolicy, error) {
+	if err := ts.enter(); err != nil {
+		return nil, err
+	}
+	defer ts.exit()
+
+	return ts.inner.GetSignedPostPolicy(ctx, keyPrefix, opts)
+}
+
+func (ts *closableCloudStorage) Write(
+	ctx context.Context,
+	key string,
+	body []byte,
+	contentType *string,
+) error {
+	if err := ts.enter(); err != nil {
+		return err
+	}
+	defer ts.exit()
+
+	return ts.inner.Write(ctx, key, body, contentType)
+}
+
+func (ts *closableCloudStorage) WriteWithOptions(
+	ctx context.Context,
+	key string,
+	body []byte,
+	opts *WriteOptions,
+) error {
+	if err := ts.enter(); err != nil {
+		return err
+	}
+	defer ts.exit()
+
+	return ts.inner.WriteWithOptions(ctx, key, body, opts)
+}
+
+func (ts *closableCloudStorage) Attributes(
+	ctx context.Context,
+	key string,
+) (*Attributes, error) {
+	if err := ts.enter(); err != nil {
+		return nil, err
+	}
+	defer ts.exit()
+
+	return ts.inner.Attributes(ctx, key)
+}
+
+func (ts *closableCloudStorage) UpdateAttributes(
+	ctx context.Context,
+	key string,
+	update AttributeUpdate,
+) (*Attributes, error) {
+	if err := ts.enter(); err != nil {
+		return nil, err
+	}
+	defer ts.exit()
+
+	return ts.inner.UpdateAttributes(ctx, key, update)
+}
+
+func (ts *closableCloudStorage) SetTags(
+	ctx context.Context,
+	key string,
+	tags map[string]string,
+) error {
+	if err := ts.enter(); err != nil {
+		return err
+	}
+	defer ts.exit()
+
+	return ts.inner.SetTags(ctx, key, tags)
+}
+
+func (ts *closableCloudStorage) GetTags(
+	ctx context.Context,
+	key string,
+) (map[string]string, error) {
+	if err := ts.enter(); err != nil {
+		return nil, err
+	}
+	defer ts.exit()
+
+	return ts.inner.GetTags(ctx, key)
+}
+
+func (ts *closableCloudStorage) SetStorageClass(
+	ctx context.Context,
+	key string,
+	class string,
+) error {
+	if err := ts.enter(); err != nil {
+		return err
+	}
+	defer ts.exit()
+
+	return ts.inner.SetStorageClass(ctx, key, class)
+}
+
+func (ts *closableCloudStorage) GetReader(
+	ctx context.Context,
+	key string,
+) (io.ReadCloser, error) {
+	if err := ts.enter(); err != nil {
+		return nil, err
+	}
+	defer ts.exit()
+
+	return ts.inner.GetReader(ctx, key)
+}
+
+func (ts *closableCloudStorage) GetRangeReader(
+	ctx context.Context,
+	key string,
+	offset int64,
+	length int64,
+) (io.ReadCloser, error) {
+	if err := ts.enter(); err != nil {
+		return nil, err
+	}
+	defer ts.exit()
+
+	return ts.inner.GetRangeReader(ctx, key, offset, length)
+}
+
+func (ts *closableCloudStorage) GetWriter(
+	ctx context.Context,
+	key string,
+) (io.WriteCloser, error) {
+	if err := ts.enter(); err != nil {
+		return nil, err
+	}
+	defer ts.exit()
+
+	return ts.inner.GetWriter(ctx, key)
+}
+
+func (ts *closableCloudStorage) GetWriterWithOptions(
+	ctx context.Context,
+	key string,
+	opts *WriteOptions,
+) (io.WriteCloser, error) {
+	if err := ts.enter(); err != nil {
+		return nil, err
+	}
+	defer ts.exit()
+
+	return ts.inner.GetWriterWithOptions(ctx, key, opts)
+}
+
+func (ts *closableCloudStorage) Exists(
+	ctx context.Context,
+	key string,
+) (bool, error) {
+	if err := ts.enter(); err != nil {
+		return false, err
+	}
+	defer ts.exit()
+
+	return ts.inner.Exists(ctx, key)
+}
+
+func (ts *closableCloudStorage) Copy(
+	ctx context.Context,
+	dstKey string,
+	srcKey string,
+) error {
+	if err := ts.enter(); err != nil {
+		return err
+	}
+	defer ts.exit()
+
+	return ts.inner.Copy(ctx, dstKey, srcKey)
+}
+
+func (ts *closableCloudStorage) Move(
+	ctx context.Context,
+	dstKey string,
+	srcKey string,
+) error {
+	if err := ts.enter(); err != nil {
+		return err
+	}
+	defer ts.exit()
+
+	return ts.inner.Move(ctx, dstKey, srcKey)
+}
+
+func (ts *closableCloudStorage) Ping(ctx context.Context) error {
+	if err := ts.enter(); err != nil {
+		return err
+	}
+	defer ts.exit()
+
+	return ts.inner.Ping(ctx)
+}
+
+func (ts *closableCloudStorage) GetVersion(
+	ctx context.Context,
+	key string,
+	version string,
+) ([]byte, error) {
+	if err := ts.enter(); err != nil {
+		return nil, err
+	}
+	defer ts.exit()
+
+	return ts.inner.GetVersion(ctx, key, version)
+}
+
+func (ts *closableCloudStorage) DeleteVersion(
+	ctx context.Context,
+	key string,
+	version string,
+) error {
+	if err := ts.enter(); err != nil {
+		return err
+	}
+	defer ts.exit()
+
+	return ts.inner.DeleteVersion(ctx, key, version)
+}
+
+func (ts *closableCloudStorage) SetObjectRetention(
+	ctx context.Context,
+	key string,
+	until time.Time,
+	mode string,
+) error {
+	if err := ts.enter(); err != nil {
+		return err
+	}
+	defer ts.exit()
+
+	return ts.inner.SetObjectRetention(ctx, key, until, mode)
+}
+
+func (ts *closableCloudStorage) GetObjectRetention(
+	ctx context.Context,
+	key string,
+) (*ObjectRetention, error) {
+	if err := ts.enter(); err != nil {
+		return nil, err
+	}
+	defer ts.exit()
+
+	return ts.inner.GetObjectRetention(ctx, key)
+}
+
+func (ts *closableCloudStorage) Restore(
+	ctx context.Context,
+	key string,
+	days int,
+	tier string,
+) error {
+	if err := ts.enter(); err != nil {
+		return err
+	}
+	defer ts.exit()
+
+	return ts.inner.Restore(ctx, key, days, tier)
+}
+
+func (ts *closableCloudStorage) RestoreStatus(
+	ctx context.Context,
+	key string,
+) (RestoreState, error) {
+	if err := ts.enter(); err != nil {
+		return RestoreState{}, err
+	}
+	defer ts.exit()
+
+	return ts.inner.RestoreStatus(ctx, key)
+}
+
+func (ts *closableCloudStorage) Append(
+	ctx context.Context,
+	key string,
+	data []byte,
+) error {
+	if err := ts.enter(); err != nil {
+		return err
+	}
+	defer ts.exit()
+
+	return ts.inner.Append(ctx, key, data)
+}
+
+func (ts *closableCloudStorage) GetSize(
+	ctx context.Context,
+	key string,
+) (int64, error) {
+	if err := ts.enter(); err != nil {
+		return 0, err
+	}
+	defer ts.exit()
+
+	return ts.inner.GetSize(ctx, key)
+}
+
+func (ts *closableCloudStorage) VerifyDownload(
+	ctx context.Context,
+	key string,
+) error {
+	if err := ts.enter(); err != nil {
+		return err
+	}
+	defer ts.exit()
+
+	return ts.inner.VerifyDownload(ctx, key)
+}
+
+func (ts *closableCloudStorage) StartMultipartUpload(
+	ctx context.Context,
+	key string,
+	opts *WriteOptions,
+) (string, error) {
+	if err := ts.enter(); err != nil {
+		return "", err
+	}
+	defer ts.exit()
+
+	return ts.inner.StartMultipartUpload(ctx, key, opts)
+}
+
+func (ts *closableCloudStorage) SignUploadPartURL(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	partNumber int,
+	expiry time.Duration,
+) (string, error) {
+	if err := ts.enter(); err != nil {
+		return "", err
+	}
+	defer ts.exit()
+
+	return ts.inner.SignUploadPartURL(ctx, key, uploadID, partNumber, expiry)
+}
+
+func (ts *closableCloudStorage) CompleteMultipartUpload(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	parts []CompletedPart,
+) error {
+	if err := ts.enter(); err != nil {
+		return err
+	}
+	defer ts.exit()
+
+	return ts.inner.CompleteMultipartUpload(ctx, key, uploadID, parts)
+}
+
+func (ts *closableCloudStorage) AbortMultipartUpload(
+	ctx context.Context,
+	key string,
+	uploadID string,
+) error {
+	if err := ts.enter(); err != nil {
+		return err
+	}
+	defer ts.exit()
+
+	return ts.inner.AbortMultipartUpload(ctx, key, uploadID)
+}
+
+func (ts *closableCloudStorage) SetLifecycle(
+	ctx context.Context,
+	rules []LifecycleRule,
+	opts *LifecycleOptions,
+) error {
+	if err := ts.enter(); err != nil {
+		return err
+	}
+	defer ts.exit()
+
+	return ts.inner.SetLifecycle(ctx, rules, opts)
+}
+
+func (ts *closableCloudStorage) GetLifecycle(ctx context.Context) ([]LifecycleRule, error) {
+	if err := ts.enter(); err != nil {
+		return nil, err
+	}
+	defer ts.exit()
+
+	return ts.inner.GetLifecycle(ctx)
+}
+
+func (ts *closableCloudStorage) SetVersioning(
+	ctx context.Context,
+	enabled bool,
+) error {
+	if err := ts.enter(); err != nil {
+		return err
+	}
+	defer ts.exit()
+
+	return ts.inner.SetVersioning(ctx, enabled)
+}
+
+func (ts *closableCloudStorage) GetVersioning(ctx context.Context) (bool, error) {
+	if err := ts.enter(); err != nil {
+		return false, err
+	}
+	defer ts.exit()
+
+	return ts.inner.GetVersioning(ctx)
+}
+
+func (ts *closableCloudStorage) GetVersioningState(ctx context.Context) (VersioningState, error) {
+	if err := ts.enter(); err != nil {
+		return "", err
+	}
+	defer ts.exit()
+
+	return ts.inner.GetVersioningState(ctx)
+}
+
+func (ts *closableCloudStorage) SetCORS(
+	ctx context.Context,
+	rules []CORSRule,
+) error {
+	if err := ts.enter(); err != nil {
+		return err
+	}
+	defer ts.exit()
+
+	return ts.inner.SetCORS(ctx, rules)
+}
+
+func (ts *closableCloudStorage) GetCORS(ctx context.Context) ([]CORSRule, error) {
+	if err := ts.enter(); err != nil {
+		return nil, err
+	}
+	defer ts.exit()
+
+	return ts.inner.GetCORS(ctx)
+}
+
+func (ts *closableCloudStorage) SetPublicAccessBlock(
+	ctx context.Context,
+	blocked bool,
+) error {
+	if err := ts.enter(); err != nil {
+		return err
+	}
+	defer ts.exit()
+
+	return ts.inner.SetPublicAccessBlock(ctx, blocked)
+}
+
+func (ts *closableCloudStorage) GetPublicAccessBlock(ctx context.Context) (bool, error) {
+	if err := ts.enter(); err != nil {
+		return false, err
+	}
+	defer ts.exit()
+
+	return ts.inner.GetPublicAccessBlock(ctx)
+}
+
+func (ts *closableCloudStorage) GetPublicAccessBlockDetails(ctx context.Context) (*PublicAccessBlock, error) {
+	if err := ts.enter(); err != nil {
+		return nil, err
+	}
+	defer ts.exit()
+
+	return ts.inner.GetPublicAccessBlockDetails(ctx)
+}
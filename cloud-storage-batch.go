@@ -0,0 +1,238 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// uniqueKeys removes the duplicate keys, keeping the order of the first occurrences.
+func uniqueKeys(keys []string) []string {
+	seen := make(map[string]struct{}, len(keys))
+	unique := make([]string, 0, len(keys))
+
+	for _, key := range keys {
+		if _, ok := seen[key]; ok {
+			continue
+		}
+
+		seen[key] = struct{}{}
+		unique = append(unique, key)
+	}
+
+	return unique
+}
+
+// runBatch calls fn for each key with up to concurrency calls in flight, and returns the failures by key.
+// Once the context is canceled no call is started anymore, the remaining keys fail with the context error.
+func runBatch(ctx context.Context, keys []string, concurrency int, fn func(key string) error) map[string]error {
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		failures = make(map[string]error)
+	)
+
+	fail := func(key string, err error) {
+		mu.Lock()
+		failures[key] = err
+		mu.Unlock()
+	}
+
+	semaphore := make(chan struct{}, concurrency)
+
+	for _, key := range keys {
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+		}
+
+		if err := ctx.Err(); err != nil {
+			fail(key, err)
+
+			continue
+		}
+
+		wg.Add(1)
+
+		go func(key string) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+
+			if err := fn(key); err != nil {
+				fail(key, err)
+			}
+		}(key)
+	}
+
+	wg.Wait()
+
+	return failures
+}
+
+// ExistsMulti checks the existence of the keys with concurrent Exists calls, the missing keys are not failures.
+// The keys which can't be checked are reported in a BatchError along with the keys which were checked.
+func ExistsMulti(ctx context.Context, storage CloudStorage, keys []string) (map[string]bool, error) {
+	var mu sync.Mutex
+
+	keys = uniqueKeys(keys)
+	result := make(map[string]bool, len(keys))
+
+	failures := runBatch(ctx, keys, storageOptionsOf(storage).batchConcurrency, func(key string) error {
+		exists, err := storage.Exists(ctx, key)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		result[key] = exists
+		mu.Unlock()
+
+		return nil
+	})
+
+	if len(failures) > 0 {
+		return result, &BatchError{Errors: failures}
+	}
+
+	return result, nil
+}
+
+// GetMulti reads the objects concurrently, the objects which can't be read are reported in a BatchError
+// along with the objects which were read.
+func GetMulti(ctx context.Context, storage CloudStorage, keys []string) (map[string][]byte, error) {
+	return GetMultiWithOptions(ctx, storage, keys, nil)
+}
+
+// GetMultiWithOptions reads the objects like GetMulti, with the memory of the call capped by the options.
+func GetMultiWithOptions(
+	ctx context.Context,
+	storage CloudStorage,
+	keys []string,
+	opts *GetMultiOptions,
+) (map[string][]byte, error) {
+	var (
+		mu     sync.Mutex
+		budget *byteBudget
+	)
+
+	if opts != nil && opts.MaxTotalBytes > 0 {
+		budget = &byteBudget{remaining: opts.MaxTotalBytes}
+	}
+
+	keys = uniqueKeys(keys)
+	result := make(map[string][]byte, len(keys))
+
+	failures := runBatch(ctx, keys, storageOptionsOf(storage).batchConcurrency, func(key string) error {
+		reader, err := storage.GetReader(ctx, key)
+		if err != nil {
+			return objectError(err)
+		}
+
+		defer reader.Close()
+
+		if budget != nil {
+			reader = &budgetReader{ReadCloser: reader, budget: budget}
+		}
+
+		body, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		result[key] = body
+		mu.Unlock()
+
+		return nil
+	})
+
+	if len(failures) > 0 {
+		return result, &BatchError{Errors: failures}
+	}
+
+	return result, nil
+}
+
+// byteBudget is the number of bytes that the readers sharing it can still read.
+type byteBudget struct {
+	mu        sync.Mutex
+	remaining int64
+}
+
+func (b *byteBudget) take(n int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if int64(n) > b.remaining {
+		b.remaining = 0
+
+		return false
+	}
+
+	b.remaining -= int64(n)
+
+	return true
+}
+
+// budgetReader fails with ErrLimitExceeded once the budget is exhausted.
+type budgetReader struct {
+	io.ReadCloser
+	budget *byteBudget
+}
+
+func (r *budgetReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 && !r.budget.take(n) {
+		return 0, newTypedError(ErrLimitExceeded, fmt.Errorf("the objects are bigger than MaxTotalBytes"))
+	}
+
+	return n, err
+}
+
+// WriteMulti writes the objects concurrently, the objects which can't be written are reported in a BatchError.
+func WriteMulti(ctx context.Context, storage CloudStorage, objects []WriteRequest) error {
+	requests := make(map[string]*WriteRequest, len(objects))
+	keys := make([]string, 0, len(objects))
+
+	for i := range objects {
+		key := objects[i].Key
+		if _, ok := requests[key]; ok {
+			return newTypedError(ErrInvalidArgument, fmt.Errorf("key '%s' is written more than once", key))
+		}
+
+		requests[key] = &objects[i]
+		keys = append(keys, key)
+	}
+
+	failures := runBatch(ctx, keys, storageOptionsOf(storage).batchConcurrency, func(key string) error {
+		request := requests[key]
+
+		return storage.WriteWithOptions(ctx, key, request.Body, request.Options)
+	})
+
+	if len(failures) > 0 {
+		return &BatchError{Errors: failures}
+	}
+
+	return nil
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	compMeta "cloud.google.com/go/compute/metadata"
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"google.golang.org/api/iterator"
+)
+
+// BucketInfo describes a bucket of the account or of the project.
+type BucketInfo struct {
+	Name         string
+	CreationTime time.Time
+	// Location is the region of the S3 bucket, or the location of the GCS bucket, e.g. "US" or "EUROPE-WEST1".
+	Location string
+}
+
+// ListBuckets lists the buckets of the AWS account, or of the GCP project of the credentials, with the credentials
+// of opts like NewCloudStorageFactory. The GCS emulator is used when GCPStorageEmulatorHost is set.
+// ErrAccessDenied is returned when the credentials aren't allowed to list the buckets.
+func ListBuckets(ctx context.Context, provider string, opts CloudStorageOption) ([]BucketInfo, error) {
+	debugger := newHTTPDebugger(newStorageOptions(opts))
+
+	switch provider {
+	case "", "aws":
+		if err := setAWSCredentialsEnv(opts); err != nil {
+			return nil, err
+		}
+
+		awsSession, err := newAWSSession(opts.AWSS3Endpoint, opts.AWSS3Region,
+			opts.AWSEnableS3Accelerate, opts.AWSTokenDuration, opts.AWSTokenExpiryWindow, 0, debugger)
+		if err != nil {
+			return nil, err
+		}
+
+		return listAWSBuckets(ctx, s3.New(awsSession))
+
+	case "gcp":
+		switch {
+		case opts.GCPStorageEmulatorHost != "":
+			clients, err := newGCPTestClients(ctx, opts.GCPCredentialsJSON, gcpEmulatorOf(opts), debugger)
+			if err != nil {
+				return nil, err
+			}
+			defer clients.Close()
+
+			return listGCPBuckets(ctx, clients.client, clients.projectID)
+
+		case opts.GCPCredentialsJSON != "":
+			clients, err := newExplicitGCPClients(ctx, opts.GCPCredentialsJSON, debugger)
+			if err != nil {
+				return nil, err
+			}
+			defer clients.Close()
+
+			return listGCPBuckets(ctx, clients.client, clients.projectID)
+
+		case compMeta.OnGCE():
+			clients, err := newImplicitGCPClients(ctx, debugger)
+			if err != nil {
+				return nil, err
+			}
+			defer clients.Close()
+
+			return listGCPBuckets(ctx, clients.client, clients.projectID)
+
+		default:
+			return nil, fmt.Errorf("unable to create implicit GCP client without credentials")
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported Bucket Provider: %s", provider)
+	}
+}
+
+// listAWSBuckets lists the buckets with their region. S3 returns all the buckets of the account at once,
+// the region of each bucket is another call.
+func listAWSBuckets(ctx context.Context, client *s3.S3) ([]BucketInfo, error) {
+	output, err := client.ListBucketsWithContext(ctx, &s3.ListBucketsInput{})
+	if err != nil {
+		return nil, awsBucketError(err)
+	}
+
+	buckets := make([]BucketInfo, 0, len(output.Buckets))
+
+	for _, bucket := range output.Buckets {
+		location, err := client.GetBucketLocationWithContext(ctx, &s3.GetBucketLocationInput{Bucket: bucket.Name})
+		if err != nil {
+			return nil, fmt.Errorf("unable to get the region of bucket '%s': %w", aws.StringValue(bucket.Name),
+				awsBucketError(err))
+		}
+
+		buckets = append(buckets, BucketInfo{
+			Name:         aws.StringValue(bucket.Name),
+			CreationTime: aws.TimeValue(bucket.CreationDate),
+			// the legacy names of the regions, e.g. an empty location for us-east-1, are normalized
+			Location: s3.NormalizeBucketLocation(aws.StringValue(location.LocationConstraint)),
+		})
+	}
+
+	return buckets, nil
+}
+
+// listGCPBuckets lists the buckets of the project, the iterator fetches the next pages.
+func listGCPBuckets(ctx context.Context, client *storage.Client, projectID string) ([]BucketInfo, error) {
+	if projectID == "" {
+		return nil, newTypedError(ErrInvalidArgument, fmt.Errorf("the project of the credentials is required to list the buckets"))
+	}
+
+	var buckets []BucketInfo
+
+	iter := client.Buckets(ctx, projectID)
+
+	for {
+		attrs, err := iter.Next()
+		if err == iterator.Done {
+			return buckets, nil
+		}
+
+		if err != nil {
+			return nil, gcpBucketError(err)
+		}
+
+		buckets = append(buckets, BucketInfo{
+			Name:         attrs.Name,
+			CreationTime: attrs.Created,
+			Location:     attrs.Location,
+		})
+	}
+}
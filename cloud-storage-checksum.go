@@ -0,0 +1,205 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5" //nolint:gosec
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// checksum algorithms of WriteOptions.ChecksumAlgorithm
+const (
+	// ChecksumCRC32C is supported by S3 and GCS.
+	ChecksumCRC32C = "CRC32C"
+	// ChecksumSHA256 is supported by S3 only.
+	ChecksumSHA256 = "SHA256"
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// crc32cBytes encodes the checksum in big-endian order, as the providers do.
+func crc32cBytes(checksum uint32) []byte {
+	encoded := make([]byte, crc32.Size)
+	binary.BigEndian.PutUint32(encoded, checksum)
+
+	return encoded
+}
+
+func md5Sum(body []byte) []byte {
+	sum := md5.Sum(body) //nolint:gosec
+
+	return sum[:]
+}
+
+// fillEmptyMD5 sets the MD5 of the zero-byte objects, which the providers don't always return, e.g. for the
+// S3 objects encrypted with KMS.
+func fillEmptyMD5(attrs *Attributes) *Attributes {
+	if attrs.Size == 0 && len(attrs.MD5) == 0 {
+		attrs.MD5 = md5Sum(nil)
+	}
+
+	return attrs
+}
+
+// checksumWriter hashes the streamed content, and compares it with the checksums of the written object on Close.
+type checksumWriter struct {
+	io.WriteCloser
+	ctx     context.Context
+	storage CloudStorage
+	key     string
+	// md5 is nil when the MD5 is not verified
+	md5 hash.Hash
+	// crc32c is nil when the CRC32C is not verified
+	crc32c hash.Hash32
+}
+
+func newChecksumWriter(
+	ctx context.Context,
+	storage CloudStorage,
+	key string,
+	writer io.WriteCloser,
+	verifyMD5 bool,
+	verifyCRC32C bool,
+) io.WriteCloser {
+	checksumWriter := &checksumWriter{
+		WriteCloser: writer,
+		ctx:         ctx,
+		storage:     storage,
+		key:         key,
+	}
+
+	if verifyMD5 {
+		checksumWriter.md5 = md5.New() //nolint:gosec
+	}
+
+	if verifyCRC32C {
+		checksumWriter.crc32c = crc32.New(crc32cTable)
+	}
+
+	return checksumWriter
+}
+
+func (w *checksumWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+
+	if w.md5 != nil {
+		w.md5.Write(p[:n])
+	}
+
+	if w.crc32c != nil {
+		w.crc32c.Write(p[:n])
+	}
+
+	return n, err
+}
+
+func (w *checksumWriter) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+
+	attrs, err := w.storage.Attributes(w.ctx, w.key)
+	if err != nil {
+		return err
+	}
+
+	if w.md5 != nil {
+		if err := compareMD5(w.key, attrs, w.md5.Sum(nil)); err != nil {
+			return err
+		}
+	}
+
+	if w.crc32c != nil && attrs.HasCRC32C && attrs.CRC32C != w.crc32c.Sum32() {
+		return newTypedError(ErrChecksumMismatch,
+			fmt.Errorf("the CRC32C of '%s' is %08x, expected %08x", w.key, attrs.CRC32C, w.crc32c.Sum32()))
+	}
+
+	return nil
+}
+
+// verifyWrittenMD5 compares the MD5 of the written object with the expected one, when it's available.
+func verifyWrittenMD5(ctx context.Context, storage CloudStorage, key string, expected []byte) error {
+	attrs, err := storage.Attributes(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	return compareMD5(key, attrs, expected)
+}
+
+func compareMD5(key string, attrs *Attributes, expected []byte) error {
+	if len(attrs.MD5) > 0 && !bytes.Equal(attrs.MD5, expected) {
+		return newTypedError(ErrChecksumMismatch, fmt.Errorf("the MD5 of '%s' is %x, expected %x", key, attrs.MD5, expected))
+	}
+
+	return nil
+}
+
+// verifyDownload reads the object and compares its content with the strongest of its stored checksums.
+// newReader must return the stored content, which isn't decompressed.
+func verifyDownload(
+	ctx context.Context,
+	storage CloudStorage,
+	key string,
+	newReader func() (io.ReadCloser, error),
+) error {
+	attrs, err := storage.Attributes(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	var (
+		algorithm string
+		hash      hash.Hash
+		expected  []byte
+	)
+
+	switch {
+	case len(attrs.SHA256) > 0:
+		algorithm, hash, expected = ChecksumSHA256, sha256.New(), attrs.SHA256
+	case attrs.HasCRC32C:
+		algorithm, hash, expected = ChecksumCRC32C, crc32.New(crc32cTable), crc32cBytes(attrs.CRC32C)
+	case len(attrs.MD5) > 0:
+		algorithm, hash, expected = "MD5", md5.New(), attrs.MD5 //nolint:gosec
+	default:
+		return newTypedError(ErrNotSupported, fmt.Errorf("no checksum is stored for '%s'", key))
+	}
+
+	reader, err := newReader()
+	if err != nil {
+		return objectError(err)
+	}
+	defer reader.Close()
+
+	if _, err := io.Copy(hash, reader); err != nil {
+		return err
+	}
+
+	if actual := hash.Sum(nil); !bytes.Equal(actual, expected) {
+		return newTypedError(ErrChecksumMismatch,
+			fmt.Errorf("the %s of the content of '%s' is %x, expected %x", algorithm, key, actual, expected))
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"strconv"
+)
+
+const (
+	gzipContentEncoding = "gzip"
+	// UncompressedSizeMetadataKey is the metadata key of the size of the content written with WriteOptions.Compress.
+	// It's not set by the streamed writes, since the size isn't known before the object is created.
+	UncompressedSizeMetadataKey = "uncompressed-size"
+)
+
+// compressBody gzips the body written with WriteOptions.Compress, and returns the options of the compressed object.
+func compressBody(body []byte, opts *WriteOptions) ([]byte, *WriteOptions, error) {
+	if opts == nil || !opts.Compress {
+		return body, opts, nil
+	}
+
+	var buffer bytes.Buffer
+
+	gzipWriter := gzip.NewWriter(&buffer)
+
+	if _, err := gzipWriter.Write(body); err != nil {
+		return nil, nil, err
+	}
+
+	if err := gzipWriter.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	options := compressedOptions(opts)
+	options.Metadata[UncompressedSizeMetadataKey] = strconv.Itoa(len(body))
+
+	return buffer.Bytes(), options, nil
+}
+
+// compressedOptions sets the content encoding of the compressed object, without modifying the options of the caller.
+func compressedOptions(opts *WriteOptions) *WriteOptions {
+	options := *opts
+	options.ContentEncoding = gzipContentEncoding
+	options.Metadata = make(map[string]string, len(opts.Metadata)+1)
+
+	for key, value := range opts.Metadata {
+		options.Metadata[key] = value
+	}
+
+	return &options
+}
+
+// gzipWriteCloser gzips the content streamed into the writer, which is closed after the gzip footer is written.
+type gzipWriteCloser struct {
+	*gzip.Writer
+	writer io.WriteCloser
+}
+
+func newGzipWriteCloser(writer io.WriteCloser) *gzipWriteCloser {
+	return &gzipWriteCloser{Writer: gzip.NewWriter(writer), writer: writer}
+}
+
+func (w *gzipWriteCloser) Close() error {
+	if err := w.Writer.Close(); err != nil {
+		w.writer.Close()
+
+		return err
+	}
+
+	return w.writer.Close()
+}
+
+// decompressBody decompresses the content of a gzip encoded object. The content that doesn't start with
+// the gzip header was already decompressed, by the GCS decompressive transcoding or by the HTTP transport.
+func decompressBody(body []byte, contentEncoding string) ([]byte, error) {
+	if contentEncoding != gzipContentEncoding || !hasGzipHeader(body) {
+		return body, nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadAll(reader)
+}
+
+// newDecompressingReader is the streaming counterpart of decompressBody.
+func newDecompressingReader(reader io.ReadCloser, contentEncoding string) (io.ReadCloser, error) {
+	if contentEncoding != gzipContentEncoding {
+		return reader, nil
+	}
+
+	buffered := bufio.NewReader(reader)
+
+	header, err := buffered.Peek(2) //nolint:gomnd
+	if err != nil && err != io.EOF {
+		reader.Close()
+
+		return nil, err
+	}
+
+	if !hasGzipHeader(header) {
+		return &readCloser{Reader: buffered, Closer: reader}, nil
+	}
+
+	gzipReader, err := gzip.NewReader(buffered)
+	if err != nil {
+		reader.Close()
+
+		return nil, err
+	}
+
+	return &readCloser{Reader: gzipReader, Closer: reader}, nil
+}
+
+func hasGzipHeader(content []byte) bool {
+	return len(content) >= 2 && content[0] == 0x1f && content[1] == 0x8b
+}
+
+// readCloser reads from Reader and closes the underlying reader with Closer.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// readAllAndClose reads the whole content of the reader returned by GetReader, the empty objects are read as
+// an empty slice rather than nil.
+func readAllAndClose(reader io.ReadCloser, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	body, err := ioutil.ReadAll(reader)
+	if err == nil && body == nil {
+		body = []byte{}
+	}
+
+	return body, err
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5" //nolint:gosec
+	"fmt"
+	"io"
+)
+
+// bucketLocator is implemented by the storages of this package, so that CopyObjectBetween can tell
+// whether two storages hold the same bucket.
+type bucketLocator interface {
+	// bucketLocation returns the provider and the name of the bucket.
+	bucketLocation() string
+}
+
+// CopyObjectBetween copies the object from src to dst, which may be storages of different providers.
+// The content is streamed from GetReader to GetWriterWithOptions without being held in memory,
+// and the content type, the other content headers and the metadata are kept.
+// The size, and the MD5 when it's available, are verified after the copy, which is deleted on mismatch.
+// The gzip encoded objects are compressed again when src decompresses them, and are not verified.
+// When src and dst hold the same bucket, the object is copied by the provider with Copy.
+func CopyObjectBetween(ctx context.Context, src CloudStorage, srcKey string, dst CloudStorage, dstKey string) error {
+	if isSameBucket(src, dst) {
+		return dst.Copy(ctx, dstKey, srcKey)
+	}
+
+	attrs, err := src.Attributes(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+
+	// the gzip encoded content is decompressed by GetReader, so it's compressed again by the writer
+	recompress := attrs.ContentEncoding == gzipContentEncoding && !storageOptionsOf(src).disableDecompression
+
+	reader, err := src.GetReader(ctx, srcKey)
+	if err != nil {
+		return objectError(err)
+	}
+	defer reader.Close()
+
+	// the writers abort the upload when their context is canceled before Close
+	writerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	writer, err := dst.GetWriterWithOptions(writerCtx, dstKey, &WriteOptions{
+		CacheControl:       attrs.CacheControl,
+		ContentDisposition: attrs.ContentDisposition,
+		ContentEncoding:    attrs.ContentEncoding,
+		ContentLanguage:    attrs.ContentLanguage,
+		ContentType:        attrs.ContentType,
+		Metadata:           copiedMetadata(attrs.Metadata),
+		Compress:           recompress,
+	})
+	if err != nil {
+		return err
+	}
+
+	hash := md5.New() //nolint:gosec
+
+	size, err := io.Copy(io.MultiWriter(writer, hash), reader)
+	if err != nil {
+		cancel()
+		writer.Close()
+
+		return err
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	// the compressed content may differ from the source, the size and the MD5 can't be compared
+	if recompress {
+		return nil
+	}
+
+	dstAttrs, err := dst.Attributes(ctx, dstKey)
+	if err != nil {
+		return err
+	}
+
+	if err := verifyCopy(srcKey, attrs, dstAttrs, size, hash.Sum(nil)); err != nil {
+		_ = dst.Delete(ctx, dstKey)
+
+		return err
+	}
+
+	return nil
+}
+
+func isSameBucket(src, dst CloudStorage) bool {
+	srcLocator, ok := src.(bucketLocator)
+	if !ok {
+		return false
+	}
+
+	dstLocator, ok := dst.(bucketLocator)
+	if !ok {
+		return false
+	}
+
+	location := srcLocator.bucketLocation()
+
+	return location != "" && location == dstLocator.bucketLocation()
+}
+
+// copiedMetadata leaves out the metadata of EncryptedCloudStorage, which describes the source encryption only.
+func copiedMetadata(metadata map[string]string) map[string]string {
+	copied := make(map[string]string, len(metadata))
+
+	for key, value := range metadata {
+		switch key {
+		case encryptionKeyIDMetadataKey, encryptionNonceMetadataKey, plaintextSizeMetadataKey:
+		default:
+			copied[key] = value
+		}
+	}
+
+	return copied
+}
+
+// verifyCopy checks the copied content against the source and the written object.
+func verifyCopy(key string, srcAttrs, dstAttrs *Attributes, size int64, copiedMD5 []byte) error {
+	if size != srcAttrs.Size || dstAttrs.Size != srcAttrs.Size {
+		return fmt.Errorf("copy of '%s' failed: expected %d bytes, read %d and wrote %d",
+			key, srcAttrs.Size, size, dstAttrs.Size)
+	}
+
+	if len(srcAttrs.MD5) > 0 && !bytes.Equal(srcAttrs.MD5, copiedMD5) {
+		return fmt.Errorf("copy of '%s' failed: the MD5 of the read content doesn't match the source", key)
+	}
+
+	if len(dstAttrs.MD5) > 0 && !bytes.Equal(dstAttrs.MD5, copiedMD5) {
+		return fmt.Errorf("copy of '%s' failed: the MD5 of the written object doesn't match the source", key)
+	}
+
+	return nil
+}
@@ -0,0 +1,563 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	compMeta "cloud.google.com/go/compute/metadata"
+	"github.com/aws/aws-sdk-go/service/cloudfront/sign"
+)
+
+const (
+	// defaultBatchConcurrency is the number of parallel requests of the batch operations when it's not configured
+	defaultBatchConcurrency = 16
+	// defaultFileBufferSize is the size of the copy buffer of the file transfers when it's not configured
+	defaultFileBufferSize = 1024 * 1024
+	// defaultRetryBaseDelay is the backoff before the first retry when it's not configured
+	defaultRetryBaseDelay = 100 * time.Millisecond
+	// defaultComputeMD5MaxSize is the size of the largest object whose MD5 is computed when it's not configured
+	defaultComputeMD5MaxSize = 64 * 1024 * 1024
+	// defaultDebugHTTPBodyLimit is the number of bytes of the bodies logged by DebugHTTP when it's not configured
+	defaultDebugHTTPBodyLimit = 1024
+)
+
+// CloudStorageFactory opens CloudStorage instances for several buckets of the same provider.
+// All the buckets share one AWS session or one set of GCP clients and credentials.
+type CloudStorageFactory struct {
+	openBucketFunc func(ctx context.Context, bucketName string) (CloudStorage, error)
+	closeFunc      func() error
+
+	mu     sync.Mutex
+	closed bool
+
+	// storages are the open storages of the factory, they're removed when they're closed
+	storagesMu sync.Mutex
+	storages   map[CloudStorage]struct{}
+}
+
+//nolint:funlen,gocognit
+func NewCloudStorageFactory(ctx context.Context, isTesting bool, bucketProvider string, cloudStorageOpts CloudStorageOption) (*CloudStorageFactory, error) {
+	if err := validateUploadOptions(bucketProvider, cloudStorageOpts); err != nil {
+		return nil, err
+	}
+
+	if err := validateSignedURLScheme(cloudStorageOpts.SignedURLScheme); err != nil {
+		return nil, err
+	}
+
+	storageOpts := newStorageOptions(cloudStorageOpts)
+
+	cloudFrontSigner, err := newCloudFrontSigner(cloudStorageOpts.CloudFrontKeyID, cloudStorageOpts.CloudFrontPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	storageOpts.cloudFrontSigner = cloudFrontSigner
+	debugger := newHTTPDebugger(storageOpts)
+
+	storageOpts.provider = bucketProvider
+	if storageOpts.provider == "" {
+		storageOpts.provider = "aws"
+	}
+
+	switch bucketProvider {
+	case "", "aws":
+		if err := setAWSCredentialsEnv(cloudStorageOpts); err != nil {
+			return nil, err
+		}
+
+		if isTesting {
+			if cloudStorageOpts.AWSEnableS3Accelerate {
+				return nil, newTypedError(ErrInvalidArgument,
+					fmt.Errorf("S3 Transfer Acceleration isn't available on the test storage"))
+			}
+
+			awsSession, err := newAWSTestSession(cloudStorageOpts.AWSS3Endpoint, cloudStorageOpts.AWSS3Region,
+				storageOpts.maxRetries, debugger)
+			if err != nil {
+				return nil, err
+			}
+
+			return newCloudStorageFactory(func(ctx context.Context, bucketName string) (CloudStorage, error) {
+				storage, err := newAWSTestCloudStorage(ctx, awsSession, bucketName, cloudStorageOpts.AWSSSEKMSKeyID, storageOpts)
+				if err != nil {
+					return nil, err
+				}
+
+				return storage, nil
+			}, func() error { return nil }), nil
+		}
+
+		awsSession, err := newAWSSession(cloudStorageOpts.AWSS3Endpoint, cloudStorageOpts.AWSS3Region,
+			cloudStorageOpts.AWSEnableS3Accelerate, cloudStorageOpts.AWSTokenDuration, cloudStorageOpts.AWSTokenExpiryWindow,
+			storageOpts.maxRetries, debugger)
+		if err != nil {
+			return nil, err
+		}
+
+		return newCloudStorageFactory(func(ctx context.Context, bucketName string) (CloudStorage, error) {
+			storage, err := newAWSCloudStorage(ctx, awsSession, bucketName, cloudStorageOpts.AWSSSEKMSKeyID, storageOpts)
+			if err != nil {
+				return nil, err
+			}
+
+			return storage, nil
+		}, func() error { return nil }), nil
+
+	case "gcp":
+		if isTesting {
+			clients, err := newGCPTestClients(ctx, cloudStorageOpts.GCPCredentialsJSON, gcpEmulatorOf(cloudStorageOpts),
+				debugger)
+			if err != nil {
+				return nil, err
+			}
+
+			disableGCPRetries(clients.client, storageOpts.maxRetries)
+
+			return newCloudStorageFactory(func(ctx context.Context, bucketName string) (CloudStorage, error) {
+				storage, err := newGCPTestCloudStorage(ctx, clients, bucketName, storageOpts)
+				if err != nil {
+					return nil, err
+				}
+
+				return storage, nil
+			}, clients.Close), nil
+		}
+
+		// check that service has been started inside the GCP Kubernetes
+		isOnGCP := compMeta.OnGCE()
+
+		switch {
+		case cloudStorageOpts.GCPCredentialsJSON != "":
+			clients, err := newExplicitGCPClients(ctx, cloudStorageOpts.GCPCredentialsJSON, debugger)
+			if err != nil {
+				return nil, err
+			}
+
+			disableGCPRetries(clients.client, storageOpts.maxRetries)
+
+			return newCloudStorageFactory(func(ctx context.Context, bucketName string) (CloudStorage, error) {
+				storage, err := newExplicitGCPCloudStorage(ctx, clients, bucketName, storageOpts)
+				if err != nil {
+					return nil, err
+				}
+
+				return storage, nil
+			}, clients.Close), nil
+
+		case isOnGCP && cloudStorageOpts.GCPCredentialsJSON == "":
+			clients, err := newImplicitGCPClients(ctx, debugger)
+			if err != nil {
+				return nil, err
+			}
+
+			disableGCPRetries(clients.client, storageOpts.maxRetries)
+
+			return newCloudStorageFactory(func(ctx context.Context, bucketName string) (CloudStorage, error) {
+				storage, err := newImplicitGCPCloudStorage(ctx, clients, bucketName, storageOpts)
+				if err != nil {
+					return nil, err
+				}
+
+				return storage, nil
+			}, clients.Close), nil
+
+		default:
+			// don't support implicit external configuration
+			return nil, fmt.Errorf("unable to create implicit GCP client without credentials")
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported Bucket Provider: %s", bucketProvider)
+	}
+}
+
+// setAWSCredentialsEnv exports the static credentials of the options, which the AWS session reads from the environment.
+func setAWSCredentialsEnv(opts CloudStorageOption) error {
+	// 3-rd party library uses global variables
+	if opts.AWSS3AccessKeyID != "" {
+		if err := os.Setenv("AWS_ACCESS_KEY_ID", opts.AWSS3AccessKeyID); err != nil {
+			return err
+		}
+	}
+
+	// 3-rd party library uses global variables
+	if opts.AWSS3SecretAccessKey != "" {
+		if err := os.Setenv("AWS_SECRET_ACCESS_KEY", opts.AWSS3SecretAccessKey); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// storageOptions holds the settings of CloudStorageOption used by the helpers shared by the providers.
+// It's embedded in every storage.
+type storageOptions struct {
+	// batchConcurrency is the number of parallel requests of the batch operations
+	batchConcurrency int
+	// fileBufferSize is the size of the copy buffer of the file transfers
+	fileBufferSize int
+	// verifyChecksum is the default of WriteOptions.VerifyChecksum
+	verifyChecksum bool
+	// awsDisableContentMD5 stops sending the Content-MD5 of the buffered writes on S3
+	awsDisableContentMD5 bool
+	// disableDecompression returns the gzip encoded content of the reads as stored
+	disableDecompression bool
+	// uploadPartSize is the default of WriteOptions.BufferSize
+	uploadPartSize int64
+	// uploadConcurrency is the default of WriteOptions.UploadConcurrency
+	uploadConcurrency int
+	// signedURLScheme is the scheme of the GCS signed URLs
+	signedURLScheme string
+	// signedURLHostOverride is the default of SignedURLOption.HostOverride
+	signedURLHostOverride string
+	// cloudFrontSigner signs the S3 URLs with a host override, nil without a CloudFront key pair
+	cloudFrontSigner *sign.URLSigner
+	// allowBucketCreation enables CreateBucket on the production storages
+	allowBucketCreation bool
+	// validateOnCreate pings the bucket when the storage is opened
+	validateOnCreate bool
+	// maxRetries is the number of retries of the transient errors, none when not positive
+	maxRetries int
+	// retryBaseDelay is the backoff before the first retry
+	retryBaseDelay time.Duration
+	// onRetry is called before each retry, it may be nil
+	onRetry func(op, key string, retry int, err error)
+	// maxConcurrentRequests bounds the requests in flight, zero meaning no limit
+	maxConcurrentRequests int
+	// onInFlightRequests is called with the number of the requests in flight, it may be nil
+	onInFlightRequests func(inFlight int)
+	// strictKeyValidation rejects the leading slashes and the empty segments of the keys
+	strictKeyValidation bool
+	// computeMissingMD5 makes Attributes compute the MD5 which the provider doesn't return
+	computeMissingMD5 bool
+	// computeMD5MaxSize is the size of the largest object whose MD5 is computed
+	computeMD5MaxSize int64
+	// logger receives the logs of the storage
+	logger Logger
+	// provider is the bucket provider of the factory, "aws" or "gcp"
+	provider string
+	// tracer opens the spans of the operations, it may be nil
+	tracer Tracer
+	// traceHashKeys hashes the keys of the span attributes
+	traceHashKeys bool
+	// metrics records the operations, it may be nil
+	metrics MetricsRecorder
+	// interceptors are called around the operations, the first one being the outermost
+	interceptors []Interceptor
+	// debugHTTP logs the HTTP exchanges with the providers
+	debugHTTP bool
+	// debugHTTPBodyLimit is the number of bytes of the logged bodies, none when negative
+	debugHTTPBodyLimit int
+	// debugHTTPWriteBodies logs the bodies of the writes too
+	debugHTTPWriteBodies bool
+	// slowOperationThreshold is the duration above which the operations are reported, zero meaning never
+	slowOperationThreshold time.Duration
+	// auditFunc is called after the destructive operations, it may be nil
+	auditFunc func(event AuditEvent)
+}
+
+// storageOptionsProvider is implemented by the storages through storageOptions, so that the wrappers
+// use the settings of the wrapped storage.
+type storageOptionsProvider interface {
+	options() storageOptions
+}
+
+func newStorageOptions(opts CloudStorageOption) storageOptions {
+	options := storageOptions{
+		batchConcurrency:       opts.BatchConcurrency,
+		fileBufferSize:         opts.FileBufferSize,
+		verifyChecksum:         opts.VerifyChecksum,
+		awsDisableContentMD5:   opts.AWSDisableContentMD5,
+		disableDecompression:   opts.DisableDecompression,
+		uploadPartSize:         opts.UploadPartSizeBytes,
+		uploadConcurrency:      opts.UploadConcurrency,
+		signedURLScheme:        opts.SignedURLScheme,
+		signedURLHostOverride:  opts.SignedURLHostOverride,
+		allowBucketCreation:    opts.AllowBucketCreation,
+		validateOnCreate:       opts.ValidateOnCreate,
+		maxRetries:             opts.MaxRetries,
+		retryBaseDelay:         opts.RetryBaseDelay,
+		onRetry:                opts.OnRetry,
+		maxConcurrentRequests:  opts.MaxConcurrentRequests,
+		onInFlightRequests:     opts.OnInFlightRequests,
+		strictKeyValidation:    opts.StrictKeyValidation,
+		computeMissingMD5:      opts.ComputeMissingMD5,
+		computeMD5MaxSize:      opts.ComputeMD5MaxSize,
+		logger:                 opts.Logger,
+		tracer:                 opts.Tracer,
+		traceHashKeys:          opts.TraceHashKeys,
+		metrics:                opts.Metrics,
+		interceptors:           opts.Interceptors,
+		debugHTTP:              opts.DebugHTTP,
+		debugHTTPBodyLimit:     opts.DebugHTTPBodyLimit,
+		debugHTTPWriteBodies:   opts.DebugHTTPWriteBodies,
+		slowOperationThreshold: opts.SlowOperationThreshold,
+		auditFunc:              opts.AuditFunc,
+	}
+
+	if options.batchConcurrency < 1 {
+		options.batchConcurrency = defaultBatchConcurrency
+	}
+
+	if options.fileBufferSize < 1 {
+		options.fileBufferSize = defaultFileBufferSize
+	}
+
+	if options.signedURLScheme == "" {
+		options.signedURLScheme = SignedURLSchemeV4
+	}
+
+	if options.retryBaseDelay <= 0 {
+		options.retryBaseDelay = defaultRetryBaseDelay
+	}
+
+	if options.computeMD5MaxSize <= 0 {
+		options.computeMD5MaxSize = defaultComputeMD5MaxSize
+	}
+
+	if options.logger == nil {
+		options.logger = noopLogger{}
+	}
+
+	if options.debugHTTPBodyLimit == 0 {
+		options.debugHTTPBodyLimit = defaultDebugHTTPBodyLimit
+	}
+
+	return options
+}
+
+func (o storageOptions) options() storageOptions {
+	o.logger = o.log()
+
+	return o
+}
+
+// log returns the Logger of the storage, noopLogger for the storages built without the options.
+func (o storageOptions) log() Logger {
+	if o.logger == nil {
+		return noopLogger{}
+	}
+
+	return o.logger
+}
+
+func (o storageOptions) verifiesChecksum(opts *WriteOptions) bool {
+	return o.verifyChecksum || (opts != nil && opts.VerifyChecksum)
+}
+
+// uploadOptions sets the upload part size and concurrency of the streamed write when they are not set,
+// without modifying the options of the caller.
+func (o storageOptions) uploadOptions(opts *WriteOptions) *WriteOptions {
+	options := WriteOptions{}
+	if opts != nil {
+		options = *opts
+	}
+
+	if options.BufferSize == 0 {
+		options.BufferSize = int(o.uploadPartSize)
+	}
+
+	if options.UploadConcurrency == 0 {
+		options.UploadConcurrency = o.uploadConcurrency
+	}
+
+	return &options
+}
+
+// validateUploadOptions fails at construction instead of on the first streamed write.
+func validateUploadOptions(bucketProvider string, opts CloudStorageOption) error {
+	if opts.UploadPartSizeBytes < 0 || opts.UploadConcurrency < 0 {
+		return newTypedError(ErrInvalidArgument, fmt.Errorf("upload part size and concurrency can't be negative"))
+	}
+
+	if bucketProvider == "" || bucketProvider == "aws" {
+		return validateAWSPartSize(opts.UploadPartSizeBytes)
+	}
+
+	return nil
+}
+
+func validateSignedURLScheme(scheme string) error {
+	switch scheme {
+	case "", SignedURLSchemeV4, SignedURLSchemeV2:
+		return nil
+	default:
+		return newTypedError(ErrInvalidArgument, fmt.Errorf("unknown signed URL scheme '%s'", scheme))
+	}
+}
+
+// signedURLHost returns the host override of the signed URL, empty for the provider endpoint.
+func signedURLHost(opts *SignedURLOption, defaults storageOptions) string {
+	if opts.HostOverride != "" {
+		return opts.HostOverride
+	}
+
+	return defaults.signedURLHostOverride
+}
+
+// storageOptionsOf returns the settings of the storage, or the default ones for the storages of other packages.
+func storageOptionsOf(storage CloudStorage) storageOptions {
+	if provider, ok := storage.(storageOptionsProvider); ok {
+		return provider.options()
+	}
+
+	return newStorageOptions(CloudStorageOption{})
+}
+
+func newCloudStorageFactory(
+	openBucketFunc func(ctx context.Context, bucketName string) (CloudStorage, error),
+	closeFunc func() error,
+) *CloudStorageFactory {
+	return &CloudStorageFactory{
+		openBucketFunc: openBucketFunc,
+		closeFunc:      closeFunc,
+	}
+}
+
+// OpenBucket returns a CloudStorage for the bucket that reuses the session and clients of the factory.
+// Closing the returned storage doesn't affect the other storages opened by the same factory.
+// The keys are validated the same way for every provider, and the errors of the storage are wrapped with
+// the operation, the key and the bucket name.
+// The buckets are opened and validated without holding the lock of the factory, so that a slow bucket doesn't
+// block the others nor Close.
+func (f *CloudStorageFactory) OpenBucket(ctx context.Context, bucketName string) (CloudStorage, error) {
+	f.mu.Lock()
+	closed := f.closed
+	f.mu.Unlock()
+
+	if closed {
+		return nil, errFactoryClosed(bucketName)
+	}
+
+	storage, err := f.openBucketFunc(ctx, bucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	options := storageOptionsOf(storage)
+	if options.maxConcurrentRequests > 0 || options.onInFlightRequests != nil {
+		storage = newLimitedCloudStorage(storage, options.maxConcurrentRequests, options.onInFlightRequests)
+	}
+
+	storage = newRetryingCloudStorage(storage)
+	if options.computeMissingMD5 {
+		storage = newMD5ComputingCloudStorage(storage)
+	}
+
+	if options.auditFunc != nil {
+		storage = newAuditingCloudStorage(storage, options, bucketName)
+	}
+
+	storage = newInstrumentedCloudStorage(newKeyValidatingCloudStorage(storage), options, bucketName)
+
+	var opened CloudStorage
+
+	opened = newErrorContextCloudStorage(newClosableCloudStorage(storage, func() {
+		f.forget(opened)
+	}), bucketName)
+	storage = opened
+
+	if options.validateOnCreate {
+		if err := storage.Ping(ctx); err != nil {
+			_ = storage.Close()
+
+			return nil, err
+		}
+	}
+
+	if !f.register(storage) {
+		// the factory was closed while the bucket was opened
+		_ = storage.Close()
+
+		return nil, errFactoryClosed(bucketName)
+	}
+
+	return storage, nil
+}
+
+// register keeps the storage to close it with the factory, it returns false when the factory is closed.
+func (f *CloudStorageFactory) register(storage CloudStorage) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return false
+	}
+
+	f.storagesMu.Lock()
+	defer f.storagesMu.Unlock()
+
+	if f.storages == nil {
+		f.storages = make(map[CloudStorage]struct{})
+	}
+
+	f.storages[storage] = struct{}{}
+
+	return true
+}
+
+func errFactoryClosed(bucketName string) error {
+	return fmt.Errorf("unable to open bucket %s: cloud storage factory is closed", bucketName)
+}
+
+// forget removes a storage closed on its own, so that the factory doesn't keep it.
+func (f *CloudStorageFactory) forget(storage CloudStorage) {
+	f.storagesMu.Lock()
+	defer f.storagesMu.Unlock()
+
+	delete(f.storages, storage)
+}
+
+// Close closes every storage opened by the factory and releases the shared clients, and returns the first failure.
+// The next calls do nothing.
+func (f *CloudStorageFactory) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return nil
+	}
+
+	f.closed = true
+
+	// the storages forget themselves when they're closed
+	f.storagesMu.Lock()
+	storages := f.storages
+	f.storages = nil
+	f.storagesMu.Unlock()
+
+	var err error
+
+	for storage := range storages {
+		if closeErr := storage.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+
+	if closeErr := f.closeFunc(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+
+	return err
+}
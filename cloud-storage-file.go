@@ -0,0 +1,146 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"mime"
+	"os"
+	"path/filepath"
+)
+
+// maxTempFileAttempts is the number of random names tried for the temporary file of DownloadToFile
+const maxTempFileAttempts = 10000
+
+// DownloadToFile streams the object into a temporary file next to path, which is renamed to path once complete,
+// so path never holds a partial object. The missing parent directories are created, and the file gets the
+// permissions of os.Create, 0666 less the umask.
+func DownloadToFile(ctx context.Context, storage CloudStorage, key, path string) (err error) {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+
+	reader, err := storage.GetReader(ctx, key)
+	if err != nil {
+		return objectError(err)
+	}
+	defer reader.Close()
+
+	if err := os.MkdirAll(dir, 0755); err != nil { //nolint:gomnd
+		return err
+	}
+
+	file, err := createTempFile(dir, base)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}()
+
+	bufferSize := storageOptionsOf(storage).fileBufferSize
+
+	if _, err = io.CopyBuffer(file, &contextReader{ctx: ctx, reader: reader}, make([]byte, bufferSize)); err != nil {
+		return err
+	}
+
+	if err = file.Sync(); err != nil {
+		return err
+	}
+
+	if err = file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+// createTempFile creates the temporary file of DownloadToFile like ioutil.TempFile, but with the permissions of
+// os.Create instead of 0600, since it becomes the downloaded file.
+func createTempFile(dir, base string) (*os.File, error) {
+	for attempt := 1; ; attempt++ {
+		name := filepath.Join(dir, fmt.Sprintf(".%s.%d.tmp", base, rand.Uint32())) //nolint:gosec
+
+		file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666) //nolint:gomnd
+		if os.IsExist(err) && attempt < maxTempFileAttempts {
+			continue
+		}
+
+		return file, err
+	}
+}
+
+// UploadFromFile streams the file into the object. The upload is aborted on error or cancellation,
+// so no partial object is written. The content type is guessed from the file extension when it's not set.
+func UploadFromFile(ctx context.Context, storage CloudStorage, key, path string, opts *WriteOptions) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	options := WriteOptions{}
+	if opts != nil {
+		options = *opts
+	}
+
+	if options.ContentType == "" {
+		options.ContentType = mime.TypeByExtension(filepath.Ext(path))
+	}
+
+	// the writers abort the upload when their context is canceled before Close
+	writerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	writer, err := storage.GetWriterWithOptions(writerCtx, key, &options)
+	if err != nil {
+		return err
+	}
+
+	bufferSize := storageOptionsOf(storage).fileBufferSize
+
+	if _, err := io.CopyBuffer(writer, &contextReader{ctx: ctx, reader: file}, make([]byte, bufferSize)); err != nil {
+		cancel()
+		writer.Close()
+
+		return err
+	}
+
+	return writer.Close()
+}
+
+// contextReader stops reading once the context is canceled.
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return r.reader.Read(p)
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"fmt"
+)
+
+// LifecycleRule is a lifecycle rule of the objects under Prefix, the days are counted from the creation
+// of the objects, or from when they became noncurrent. The actions with 0 days are not set.
+type LifecycleRule struct {
+	// ID identifies the rule on S3, it's generated from the prefix when empty. GCS rules have no ID.
+	ID string
+	// Prefix is the key prefix of the objects of the rule, all the objects when empty.
+	Prefix string
+	// ExpirationDays deletes the objects after the days.
+	ExpirationDays int64
+	// NoncurrentVersionExpirationDays deletes the noncurrent versions after the days, on the versioned buckets.
+	NoncurrentVersionExpirationDays int64
+	// TransitionDays and TransitionStorageClass change the storage class of the objects after the days,
+	// e.g. to GLACIER on S3 or ARCHIVE on GCS.
+	TransitionDays         int64
+	TransitionStorageClass string
+}
+
+// LifecycleOptions are the options of SetLifecycle.
+type LifecycleOptions struct {
+	// ReplaceAll removes the existing rules, instead of only the ones of the prefixes of the new rules.
+	ReplaceAll bool
+}
+
+// validateLifecycleRules checks the rules before changing the lifecycle, a prefix can only have one rule.
+func validateLifecycleRules(rules []LifecycleRule) error {
+	prefixes := make(map[string]bool, len(rules))
+
+	for _, rule := range rules {
+		if rule.ExpirationDays < 0 || rule.NoncurrentVersionExpirationDays < 0 || rule.TransitionDays < 0 {
+			return newTypedError(ErrInvalidArgument, fmt.Errorf("the days of the lifecycle rule of '%s' can't be negative", rule.Prefix))
+		}
+
+		if rule.TransitionDays > 0 && rule.TransitionStorageClass == "" {
+			return newTypedError(ErrInvalidArgument, fmt.Errorf("the transition of the lifecycle rule of '%s' has no storage class", rule.Prefix))
+		}
+
+		if rule.ExpirationDays == 0 && rule.NoncurrentVersionExpirationDays == 0 && rule.TransitionStorageClass == "" {
+			return newTypedError(ErrInvalidArgument, fmt.Errorf("the lifecycle rule of '%s' has no action", rule.Prefix))
+		}
+
+		if prefixes[rule.Prefix] {
+			return newTypedError(ErrInvalidArgument, fmt.Errorf("several lifecycle rules of '%s'", rule.Prefix))
+		}
+
+		prefixes[rule.Prefix] = true
+	}
+
+	return nil
+}
+
+// replacedLifecyclePrefixes returns the prefixes whose existing rules are replaced by the new rules.
+func replacedLifecyclePrefixes(rules []LifecycleRule) map[string]bool {
+	prefixes := make(map[string]bool, len(rules))
+
+	for _, rule := range rules {
+		prefixes[rule.Prefix] = true
+	}
+
+	return prefixes
+}
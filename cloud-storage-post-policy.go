@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// PostPolicyOptions are the conditions of the uploads allowed by a signed POST policy.
+type PostPolicyOptions struct {
+	// Expiry is the duration the policy is valid for.
+	Expiry time.Duration
+	// MaxContentLength is the biggest size in bytes of the uploaded file, unlimited if 0.
+	MaxContentLength int64
+	// ExactKey only allows the upload to the key keyPrefix, instead of any key starting with keyPrefix.
+	ExactKey bool
+	// ContentType is the content type the upload must have.
+	ContentType string
+	// ContentTypePrefix is the prefix of the content type the upload must have, e.g. "image/".
+	// Ignored when ContentType is set.
+	ContentTypePrefix string
+}
+
+// PostPolicy is a signed policy of the direct uploads with an HTML form, e.g. from a browser.
+// The form is sent to URL with all the Fields, followed by the "file" field holding the content.
+// Unless the policy is for an exact key, the "key" field is keyPrefix followed by "${filename}",
+// which the provider replaces by the name of the uploaded file; it can also be changed to any key under keyPrefix.
+// The "Content-Type" field must be set by the form when the policy has a ContentTypePrefix.
+type PostPolicy struct {
+	URL    string
+	Fields map[string]string
+}
+
+// newPostPolicyConditions returns the form fields and the policy conditions shared by the providers,
+// the signature fields are added by the caller.
+func newPostPolicyConditions(bucketName, keyPrefix string, opts *PostPolicyOptions) (map[string]string, []interface{}) {
+	fields := map[string]string{}
+	conditions := []interface{}{
+		map[string]string{"bucket": bucketName},
+	}
+
+	if opts.ExactKey {
+		fields["key"] = keyPrefix
+		conditions = append(conditions, map[string]string{"key": keyPrefix})
+	} else {
+		fields["key"] = keyPrefix + "${filename}"
+		conditions = append(conditions, []string{"starts-with", "$key", keyPrefix})
+	}
+
+	if opts.MaxContentLength > 0 {
+		conditions = append(conditions, []interface{}{"content-length-range", 0, opts.MaxContentLength})
+	}
+
+	switch {
+	case opts.ContentType != "":
+		fields["Content-Type"] = opts.ContentType
+		conditions = append(conditions, map[string]string{"Content-Type": opts.ContentType})
+	case opts.ContentTypePrefix != "":
+		conditions = append(conditions, []string{"starts-with", "$Content-Type", opts.ContentTypePrefix})
+	}
+
+	return fields, conditions
+}
+
+// addPostPolicyFields adds the fields to the form and to the conditions, which must match all the form fields.
+func addPostPolicyFields(fields map[string]string, conditions []interface{}, added map[string]string) []interface{} {
+	for name, value := range added {
+		fields[name] = value
+		conditions = append(conditions, map[string]string{name: value})
+	}
+
+	return conditions
+}
+
+// encodePostPolicy returns the base64 encoded policy document, which is the signed content.
+func encodePostPolicy(expiration time.Time, conditions []interface{}) (string, error) {
+	document, err := json.Marshal(map[string]interface{}{
+		"expiration": expiration.UTC().Format("2006-01-02T15:04:05Z"),
+		"conditions": conditions,
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to encode the POST policy: %w", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(document), nil
+}
+
+func validatePostPolicyOptions(opts *PostPolicyOptions) error {
+	if opts == nil || opts.Expiry <= 0 {
+		return newTypedError(ErrInvalidArgument, fmt.Errorf("the expiry of the POST policy must be positive"))
+	}
+
+	if opts.MaxContentLength < 0 {
+		return newTypedError(ErrInvalidArgument, fmt.Errorf("the max content length can't be negative"))
+	}
+
+	return nil
+}
@@ -0,0 +1,539 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5" //nolint:gosec
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// SyncOptions sets options for UploadDirectory, DownloadPrefix and SyncPrefix.
+type SyncOptions struct {
+	// Concurrency is the number of parallel transfers, CloudStorageOption.BatchConcurrency by default.
+	Concurrency int
+	// SkipUnchanged skips the files whose size and MD5 match the object.
+	// The objects without MD5, e.g. the encrypted ones, are always transferred unless ComputeMissingMD5 is set.
+	// SyncPrefix always skips the unchanged objects.
+	SkipUnchanged bool
+	// Progress is called after each file is transferred, skipped or failed. The calls are serialized.
+	Progress func(SyncProgress)
+	// DeleteExtraneous deletes the destination objects absent from the source. Only used by SyncPrefix.
+	DeleteExtraneous bool
+	// DryRun reports what would be copied and deleted without changing anything. Only used by SyncPrefix.
+	DryRun bool
+	// ComputeMissingMD5 computes the MD5 of the objects without one when their size matches, as
+	// CloudStorageOption.ComputeMissingMD5 does, instead of always transferring them.
+	ComputeMissingMD5 bool
+}
+
+// SyncReport is the outcome of SyncPrefix.
+type SyncReport struct {
+	// Copied is the number of objects copied, or which would be copied in dry-run mode.
+	Copied int
+	// Skipped is the number of objects not copied since they are unchanged.
+	Skipped int
+	// Deleted is the number of extraneous objects deleted, or which would be deleted in dry-run mode.
+	Deleted int
+	// Errors holds the failures by destination key.
+	Errors map[string]error
+}
+
+// SyncProgress describes a file handled by UploadDirectory, DownloadPrefix or SyncPrefix.
+type SyncProgress struct {
+	// Key is the key of the object, the destination one for SyncPrefix.
+	Key string
+	// Path is the path of the local file, empty for SyncPrefix.
+	Path string
+	// Size is the size of the file in bytes.
+	Size int64
+	// Skipped indicates that the file was not transferred since it's unchanged.
+	Skipped bool
+	// Err is the error of the transfer, or nil.
+	Err error
+	// Completed is the number of files handled so far, this one included.
+	Completed int
+	// Total is the number of files to handle.
+	Total int
+}
+
+// syncFile is a file transferred by UploadDirectory, DownloadPrefix or SyncPrefix.
+type syncFile struct {
+	key  string
+	path string
+	size int64
+	// md5 is the MD5 of the object listed by DownloadPrefix or SyncPrefix, or nil
+	md5 []byte
+	// srcKey is the key of the object copied by SyncPrefix
+	srcKey string
+}
+
+// syncKeyPrefix returns the key prefix ending with a slash, so the relative paths are appended to it.
+func syncKeyPrefix(keyPrefix string) string {
+	if keyPrefix != "" && !strings.HasSuffix(keyPrefix, "/") {
+		return keyPrefix + "/"
+	}
+
+	return keyPrefix
+}
+
+// UploadDirectory uploads the regular files under localDir, the symlinks are skipped.
+// The files which can't be read or uploaded are reported by key in a BatchError.
+func UploadDirectory(ctx context.Context, storage CloudStorage, localDir, keyPrefix string, opts *SyncOptions) error {
+	defaults := storageOptionsOf(storage)
+	keyPrefix = syncKeyPrefix(keyPrefix)
+	failures := make(map[string]error)
+
+	var files []syncFile
+
+	err := filepath.Walk(localDir, func(path string, info os.FileInfo, err error) error {
+		if path == localDir {
+			return err
+		}
+
+		relPath, relErr := filepath.Rel(localDir, path)
+		if relErr != nil {
+			return relErr
+		}
+
+		key := keyPrefix + filepath.ToSlash(relPath)
+
+		if err != nil {
+			failures[key] = err
+
+			return nil
+		}
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			defaults.logger.Warnf("skipping symlink '%s'", path)
+		case info.Mode().IsRegular():
+			files = append(files, syncFile{
+				key:  key,
+				path: path,
+				size: info.Size(),
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	options := newSyncOptions(opts, defaults)
+
+	runSync(ctx, files, options, failures, func(file syncFile) (bool, error) {
+		if options.SkipUnchanged {
+			unchanged, err := isUploadUnchanged(ctx, storage, file, options.ComputeMissingMD5)
+			if err != nil || unchanged {
+				return unchanged, err
+			}
+		}
+
+		return false, UploadFromFile(ctx, storage, file.key, file.path, nil)
+	})
+
+	if len(failures) > 0 {
+		return &BatchError{Errors: failures}
+	}
+
+	return nil
+}
+
+// DownloadPrefix downloads the objects under keyPrefix into localDir.
+// The objects which can't be downloaded are reported by key in a BatchError.
+func DownloadPrefix(ctx context.Context, storage CloudStorage, keyPrefix, localDir string, opts *SyncOptions) error {
+	defaults := storageOptionsOf(storage)
+	keyPrefix = syncKeyPrefix(keyPrefix)
+	failures := make(map[string]error)
+
+	var files []syncFile
+
+	err := WalkPrefix(ctx, storage, keyPrefix, func(object *ListObject) error {
+		relPath := strings.TrimPrefix(object.Key, keyPrefix)
+
+		// the directory placeholders have no file
+		if relPath == "" || strings.HasSuffix(relPath, "/") {
+			return nil
+		}
+
+		path := filepath.Join(localDir, filepath.FromSlash(relPath))
+		if !isInDirectory(localDir, path) {
+			failures[object.Key] = newTypedError(ErrInvalidArgument,
+				fmt.Errorf("key '%s' could escape the local directory", object.Key))
+
+			return nil
+		}
+
+		files = append(files, syncFile{
+			key:  object.Key,
+			path: path,
+			size: object.Size,
+			md5:  object.MD5,
+		})
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	options := newSyncOptions(opts, defaults)
+
+	runSync(ctx, files, options, failures, func(file syncFile) (bool, error) {
+		if options.SkipUnchanged {
+			unchanged, err := isDownloadUnchanged(ctx, storage, file, options.ComputeMissingMD5)
+			if err != nil || unchanged {
+				return unchanged, err
+			}
+		}
+
+		return false, DownloadToFile(ctx, storage, file.key, file.path)
+	})
+
+	if len(failures) > 0 {
+		return &BatchError{Errors: failures}
+	}
+
+	return nil
+}
+
+// SyncPrefix mirrors the objects under srcPrefix onto dstPrefix, which may be in another storage.
+// The new objects and the ones whose size or MD5 differ are copied with CopyObjectBetween,
+// the objects without MD5 on either side are always copied unless ComputeMissingMD5 is set. With DeleteExtraneous,
+// the objects under dstPrefix which are absent from srcPrefix are deleted. With DryRun, the report is computed
+// without changing anything.
+// The failed keys don't stop the sync, they are reported in SyncReport.Errors and in a BatchError.
+func SyncPrefix(
+	ctx context.Context,
+	src CloudStorage,
+	srcPrefix string,
+	dst CloudStorage,
+	dstPrefix string,
+	opts *SyncOptions,
+) (*SyncReport, error) {
+	srcPrefix = syncKeyPrefix(srcPrefix)
+	dstPrefix = syncKeyPrefix(dstPrefix)
+
+	srcObjects, err := listSyncObjects(ctx, src, srcPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	dstObjects, err := listSyncObjects(ctx, dst, dstPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	options := newSyncOptions(opts, storageOptionsOf(dst))
+	report := &SyncReport{Errors: make(map[string]error)}
+
+	files := make([]syncFile, 0, len(srcObjects))
+
+	for relKey, object := range srcObjects {
+		files = append(files, syncFile{
+			key:    dstPrefix + relKey,
+			size:   object.Size,
+			md5:    object.MD5,
+			srcKey: object.Key,
+		})
+	}
+
+	var copied, skipped int64
+
+	runSync(ctx, files, options, report.Errors, func(file syncFile) (bool, error) {
+		dstObject, ok := dstObjects[strings.TrimPrefix(file.key, dstPrefix)]
+		if ok && dstObject.Size == file.size {
+			unchanged, err := isCopyUnchanged(ctx, src, file, dst, dstObject, options.ComputeMissingMD5)
+			if err != nil {
+				return false, err
+			}
+
+			if unchanged {
+				atomic.AddInt64(&skipped, 1)
+
+				return true, nil
+			}
+		}
+
+		if !options.DryRun {
+			if err := CopyObjectBetween(ctx, src, file.srcKey, dst, file.key); err != nil {
+				return false, err
+			}
+		}
+
+		atomic.AddInt64(&copied, 1)
+
+		return false, nil
+	})
+
+	report.Copied = int(copied)
+	report.Skipped = int(skipped)
+
+	if options.DeleteExtraneous {
+		var extraneous []string
+
+		for relKey, object := range dstObjects {
+			if _, ok := srcObjects[relKey]; !ok {
+				extraneous = append(extraneous, object.Key)
+			}
+		}
+
+		failures := runBatch(ctx, extraneous, options.Concurrency, func(key string) error {
+			if options.DryRun {
+				return nil
+			}
+
+			return dst.Delete(ctx, key)
+		})
+
+		report.Deleted = len(extraneous) - len(failures)
+
+		for key, err := range failures {
+			report.Errors[key] = err
+		}
+	}
+
+	if len(report.Errors) > 0 {
+		return report, &BatchError{Errors: report.Errors}
+	}
+
+	return report, nil
+}
+
+// listSyncObjects returns the objects under the prefix by key relative to the prefix,
+// the directory placeholders are left out.
+func listSyncObjects(ctx context.Context, storage CloudStorage, prefix string) (map[string]*ListObject, error) {
+	objects := make(map[string]*ListObject)
+
+	err := WalkPrefix(ctx, storage, prefix, func(object *ListObject) error {
+		relKey := strings.TrimPrefix(object.Key, prefix)
+		if relKey != "" && !strings.HasSuffix(relKey, "/") {
+			objects[relKey] = object
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+// isInDirectory checks that the path is a file under dir, so the keys with ".." segments are not written elsewhere.
+func isInDirectory(dir, path string) bool {
+	relPath, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+
+	return relPath != "." && relPath != ".." && !strings.HasPrefix(relPath, ".."+string(filepath.Separator))
+}
+
+func newSyncOptions(opts *SyncOptions, defaults storageOptions) SyncOptions {
+	options := SyncOptions{}
+	if opts != nil {
+		options = *opts
+	}
+
+	if options.Concurrency < 1 {
+		options.Concurrency = defaults.batchConcurrency
+	}
+
+	return options
+}
+
+// runSync calls transfer for each file concurrently, reports the progress and adds the failures by key.
+func runSync(
+	ctx context.Context,
+	files []syncFile,
+	options SyncOptions,
+	failures map[string]error,
+	transfer func(file syncFile) (skipped bool, err error),
+) {
+	var (
+		mu        sync.Mutex
+		completed int
+	)
+
+	byKey := make(map[string]syncFile, len(files))
+	keys := make([]string, 0, len(files))
+
+	for _, file := range files {
+		byKey[file.key] = file
+		keys = append(keys, file.key)
+	}
+
+	transferFailures := runBatch(ctx, keys, options.Concurrency, func(key string) error {
+		file := byKey[key]
+		skipped, err := transfer(file)
+
+		if options.Progress != nil {
+			mu.Lock()
+			completed++
+			options.Progress(SyncProgress{
+				Key:       file.key,
+				Path:      file.path,
+				Size:      file.size,
+				Skipped:   skipped,
+				Err:       err,
+				Completed: completed,
+				Total:     len(files),
+			})
+			mu.Unlock()
+		}
+
+		return err
+	})
+
+	for key, err := range transferFailures {
+		failures[key] = err
+	}
+}
+
+func isUploadUnchanged(ctx context.Context, storage CloudStorage, file syncFile, computeMD5 bool) (bool, error) {
+	attrs, err := storage.Attributes(ctx, file.key)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if attrs.Size != file.size {
+		return false, nil
+	}
+
+	if computeMD5 {
+		attrs, err = fillMissingMD5(ctx, storage, file.key, attrs, storageOptionsOf(storage).computeMD5MaxSize)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if len(attrs.MD5) == 0 {
+		return false, nil
+	}
+
+	fileMD5, err := md5File(file.path)
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(attrs.MD5, fileMD5), nil
+}
+
+func isDownloadUnchanged(ctx context.Context, storage CloudStorage, file syncFile, computeMD5 bool) (bool, error) {
+	info, err := os.Stat(file.path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if info.Size() != file.size {
+		return false, nil
+	}
+
+	objectMD5, err := syncObjectMD5(ctx, storage, file.key, file.md5, computeMD5)
+	if err != nil || len(objectMD5) == 0 {
+		return false, err
+	}
+
+	fileMD5, err := md5File(file.path)
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(objectMD5, fileMD5), nil
+}
+
+// isCopyUnchanged compares the MD5 of the source and destination objects of SyncPrefix, which have the same size.
+func isCopyUnchanged(
+	ctx context.Context,
+	src CloudStorage,
+	file syncFile,
+	dst CloudStorage,
+	dstObject *ListObject,
+	computeMD5 bool,
+) (bool, error) {
+	srcMD5, err := syncObjectMD5(ctx, src, file.srcKey, file.md5, computeMD5)
+	if err != nil || len(srcMD5) == 0 {
+		return false, err
+	}
+
+	dstMD5, err := syncObjectMD5(ctx, dst, dstObject.Key, dstObject.MD5, computeMD5)
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(srcMD5, dstMD5), nil
+}
+
+// syncObjectMD5 returns the listed MD5 of the object, or the one from fillMissingMD5 when it's missing and
+// computeMD5 is set.
+func syncObjectMD5(
+	ctx context.Context,
+	storage CloudStorage,
+	key string,
+	listedMD5 []byte,
+	computeMD5 bool,
+) ([]byte, error) {
+	if len(listedMD5) > 0 || !computeMD5 {
+		return listedMD5, nil
+	}
+
+	attrs, err := storage.Attributes(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs, err = fillMissingMD5(ctx, storage, key, attrs, storageOptionsOf(storage).computeMD5MaxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return attrs.MD5, nil
+}
+
+func md5File(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hash := md5.New() //nolint:gosec
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, err
+	}
+
+	return hash.Sum(nil), nil
+}
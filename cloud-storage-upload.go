@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// uploadWriter reports the progress of a streamed write, and aborts the upload instead of completing it
+// when Close is called after a failed Write. The writers of the providers abort the upload, the parts
+// of the S3 multipart uploads included, when their context is canceled before Close.
+type uploadWriter struct {
+	writer   io.WriteCloser
+	cancel   context.CancelFunc
+	progress func(bytesWritten int64)
+	written  int64
+	err      error
+}
+
+// newUploadWriter opens the writer with a context canceled by the abort.
+func newUploadWriter(
+	ctx context.Context,
+	opts *WriteOptions,
+	open func(ctx context.Context) (io.WriteCloser, error),
+) (io.WriteCloser, error) {
+	uploadCtx, cancel := context.WithCancel(ctx)
+
+	writer, err := open(uploadCtx)
+	if err != nil {
+		cancel()
+
+		return nil, err
+	}
+
+	uploadWriter := &uploadWriter{writer: writer, cancel: cancel}
+	if opts != nil {
+		uploadWriter.progress = opts.ProgressFunc
+	}
+
+	return uploadWriter, nil
+}
+
+func (w *uploadWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	n, err := w.writer.Write(p)
+	w.written += int64(n)
+
+	if n > 0 && w.progress != nil {
+		w.progress(w.written)
+	}
+
+	if err != nil {
+		w.err = err
+	}
+
+	return n, err
+}
+
+func (w *uploadWriter) Close() error {
+	defer w.cancel()
+
+	if w.err != nil {
+		w.cancel()
+		_ = w.writer.Close()
+
+		return fmt.Errorf("upload aborted after a failed write: %w", w.err)
+	}
+
+	return w.writer.Close()
+}
@@ -20,10 +20,10 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"os"
+	"net/http"
+	"strings"
+	"sync/atomic"
 	"time"
-
-	compMeta "cloud.google.com/go/compute/metadata"
 )
 
 //nolint:funlen
@@ -52,93 +52,274 @@ func NewCloudStorage(
 	})
 }
 
-//nolint:funlen
 func NewCloudStorageWithOption(ctx context.Context, isTesting bool, bucketProvider, bucketName string, cloudStorageOpts CloudStorageOption) (CloudStorage, error) {
-	switch bucketProvider {
-	case "", "aws":
-		// 3-rd party library uses global variables
-		if cloudStorageOpts.AWSS3AccessKeyID != "" {
-			err := os.Setenv("AWS_ACCESS_KEY_ID", cloudStorageOpts.AWSS3AccessKeyID)
-			if err != nil {
-				return nil, err
-			}
-		}
-
-		// 3-rd party library uses global variables
-		if cloudStorageOpts.AWSS3SecretAccessKey != "" {
-			err := os.Setenv("AWS_SECRET_ACCESS_KEY", cloudStorageOpts.AWSS3SecretAccessKey)
-			if err != nil {
-				return nil, err
-			}
-		}
+	factory, err := NewCloudStorageFactory(ctx, isTesting, bucketProvider, cloudStorageOpts)
+	if err != nil {
+		return nil, err
+	}
 
-		if isTesting {
-			return newAWSTestCloudStorage(ctx, cloudStorageOpts.AWSS3Endpoint, cloudStorageOpts.AWSS3Region, bucketName)
-		}
+	storage, err := factory.OpenBucket(ctx, bucketName)
+	if err != nil {
+		_ = factory.Close()
 
-		return newAWSCloudStorage(ctx, cloudStorageOpts.AWSS3Endpoint, cloudStorageOpts.AWSS3Region, bucketName,
-			&cloudStorageOpts.AWSEnableS3Accelerate, cloudStorageOpts.AWSTokenDuration, cloudStorageOpts.AWSTokenExpiryWindow)
+		return nil, err
+	}
 
-	case "gcp":
-		if isTesting {
-			err := os.Setenv("STORAGE_EMULATOR_HOST", cloudStorageOpts.GCPStorageEmulatorHost)
-			if err != nil {
-				return nil, err
-			}
+	return &factoryOwnedCloudStorage{
+		CloudStorage: storage,
+		factory:      factory,
+	}, nil
+}
 
-			return newGCPTestCloudStorage(ctx, cloudStorageOpts.GCPCredentialsJSON, bucketName)
-		}
+// factoryOwnedCloudStorage is the only storage of its factory, closing it releases the clients of the factory.
+type factoryOwnedCloudStorage struct {
+	CloudStorage
+	factory *CloudStorageFactory
+}
 
-		// check that service has been started inside the GCP Kubernetes
-		isOnGCP := compMeta.OnGCE()
+func (ts *factoryOwnedCloudStorage) Close() error {
+	err := ts.CloudStorage.Close()
 
-		switch {
-		case cloudStorageOpts.GCPCredentialsJSON != "":
-			return newExplicitGCPCloudStorage(ctx, cloudStorageOpts.GCPCredentialsJSON, bucketName)
+	if factoryErr := ts.factory.Close(); factoryErr != nil && err == nil {
+		err = factoryErr
+	}
 
-		case isOnGCP && cloudStorageOpts.GCPCredentialsJSON == "":
-			return newImplicitGCPCloudStorage(ctx, bucketName)
+	return err
+}
 
-		default:
-			// don't support implicit external configuration
-			return nil, fmt.Errorf("unable to create implicit GCP client without credentials")
-		}
+// options returns the settings of the wrapped storage.
+func (ts *factoryOwnedCloudStorage) options() storageOptions {
+	return storageOptionsOf(ts.CloudStorage)
+}
 
-	default:
-		return nil, fmt.Errorf("unsupported Bucket Provider: %s", bucketProvider)
+// bucketLocation is the one of the wrapped storage, so that CopyObjectBetween still copies by the provider.
+func (ts *factoryOwnedCloudStorage) bucketLocation() string {
+	locator, ok := ts.CloudStorage.(bucketLocator)
+	if !ok {
+		return ""
 	}
+
+	return locator.bucketLocation()
 }
 
 type CloudStorage interface {
 	List(ctx context.Context, prefix string) *ListIterator
 	ListWithOptions(ctx context.Context, options *ListOptions) *ListIterator
 	Get(ctx context.Context, key string) ([]byte, error)
+	GetIfModified(ctx context.Context, key string, etag string, modSince time.Time) (body []byte, attrs *Attributes, notModified bool, err error)
 	Delete(ctx context.Context, key string) error
+	DeleteBatch(ctx context.Context, keys []string) error
 	CreateBucket(ctx context.Context, bucketPrefix string, expirationTimeDays int64) error
-	Close()
+	CreateBucketWithOptions(ctx context.Context, opts *CreateBucketOptions) error
+	Close() error
 	GetSignedURL(ctx context.Context, key string, opts *SignedURLOption) (string, error)
 	Write(ctx context.Context, key string, body []byte, contentType *string) error
+	WriteWithOptions(ctx context.Context, key string, body []byte, opts *WriteOptions) error
 	Attributes(ctx context.Context, key string) (*Attributes, error)
+	SetTags(ctx context.Context, key string, tags map[string]string) error
+	GetTags(ctx context.Context, key string) (map[string]string, error)
+	SetStorageClass(ctx context.Context, key, class string) error
 	GetReader(ctx context.Context, key string) (io.ReadCloser, error)
 	GetRangeReader(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
 	GetWriter(ctx context.Context, key string) (io.WriteCloser, error)
+	GetWriterWithOptions(ctx context.Context, key string, opts *WriteOptions) (io.WriteCloser, error)
 	Exists(ctx context.Context, key string) (bool, error)
 	Copy(ctx context.Context, dstKey, srcKey string) error
+	Move(ctx context.Context, dstKey, srcKey string) error
+	Ping(ctx context.Context) error
+	ListVersions(ctx context.Context, prefix string) *VersionIterator
+	GetVersion(ctx context.Context, key, version string) ([]byte, error)
+	DeleteVersion(ctx context.Context, key, version string) error
+	SetObjectRetention(ctx context.Context, key string, until time.Time, mode string) error
+	GetObjectRetention(ctx context.Context, key string) (*ObjectRetention, error)
+	Restore(ctx context.Context, key string, days int, tier string) error
+	RestoreStatus(ctx context.Context, key string) (RestoreState, error)
+	Append(ctx context.Context, key string, data []byte) error
+	UpdateAttributes(ctx context.Context, key string, update AttributeUpdate) (*Attributes, error)
+	GetWithAttributes(ctx context.Context, key string) ([]byte, *Attributes, error)
+	GetSize(ctx context.Context, key string) (int64, error)
+	VerifyDownload(ctx context.Context, key string) error
+	GetSignedPostPolicy(ctx context.Context, keyPrefix string, opts *PostPolicyOptions) (*PostPolicy, error)
+	GetPublicURL(key string) (string, error)
+	StartMultipartUpload(ctx context.Context, key string, opts *WriteOptions) (string, error)
+	SignUploadPartURL(ctx context.Context, key, uploadID string, partNumber int, expiry time.Duration) (string, error)
+	CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []CompletedPart) error
+	AbortMultipartUpload(ctx context.Context, key, uploadID string) error
+	SetLifecycle(ctx context.Context, rules []LifecycleRule, opts *LifecycleOptions) error
+	GetLifecycle(ctx context.Context) ([]LifecycleRule, error)
+	SetVersioning(ctx context.Context, enabled bool) error
+	GetVersioning(ctx context.Context) (bool, error)
+	GetVersioningState(ctx context.Context) (VersioningState, error)
+	SetCORS(ctx context.Context, rules []CORSRule) error
+	GetCORS(ctx context.Context) ([]CORSRule, error)
+	SetPublicAccessBlock(ctx context.Context, blocked bool) error
+	GetPublicAccessBlock(ctx context.Context) (bool, error)
+	GetPublicAccessBlockDetails(ctx context.Context) (*PublicAccessBlock, error)
+	As(i interface{}) bool
+}
+
+// closeState makes the Close of the storages idempotent, only the first call closes the resources.
+type closeState struct {
+	closed int32
+}
+
+// markClosed reports whether the storage was open until this call.
+func (c *closeState) markClosed() bool {
+	return atomic.CompareAndSwapInt32(&c.closed, 0, 1)
 }
 
-func newListIterator(f func() (*ListObject, error)) *ListIterator {
+func (c *closeState) isClosed() bool {
+	return atomic.LoadInt32(&c.closed) == 1
+}
+
+func newListIterator(f func(ctx context.Context) (*ListObject, error)) *ListIterator {
 	return &ListIterator{
 		f: f,
 	}
 }
 
+// newReplayableListIterator returns a ListIterator whose Next can be called again after an error, f fetches
+// the failed page again instead of skipping it, so that the failed page fetches can be retried.
+func newReplayableListIterator(f func(ctx context.Context) (*ListObject, error)) *ListIterator {
+	return &ListIterator{
+		f:          f,
+		replayable: true,
+	}
+}
+
+// wrapListIterator returns a ListIterator whose Next calls f around the results of iter, replayable when iter is.
+// f must return the errors of iter without dropping the results read before them.
+func wrapListIterator(iter *ListIterator, f func(ctx context.Context) (*ListObject, error)) *ListIterator {
+	return &ListIterator{
+		f:          f,
+		replayable: iter.replayable,
+	}
+}
+
+// NewListIterator returns a ListIterator whose Next calls f, which returns io.EOF after the last result.
+// It's meant for the CloudStorage implementations outside of this package, such as the fakes of the tests.
+func NewListIterator(f func(ctx context.Context) (*ListObject, error)) *ListIterator {
+	return newListIterator(f)
+}
+
 // ListIterator iterates over List results.
+// The context of Next is the one of the page fetches, instead of the context of the listing call.
 type ListIterator struct {
-	f func() (*ListObject, error)
+	f func(ctx context.Context) (*ListObject, error)
+	// replayable is set when Next can be called again after an error, see newReplayableListIterator
+	replayable bool
 }
 
 func (i *ListIterator) Next(ctx context.Context) (*ListObject, error) {
-	return i.f()
+	return i.f(ctx)
+}
+
+// applyListOptions applies the list options which are not, or not fully, supported by the providers.
+func applyListOptions(iter *ListIterator, listOptions *ListOptions) *ListIterator {
+	return limitList(listAfter(iter, listOptions.StartAfter), listOptions.MaxResults)
+}
+
+// limitList ends the listing after maxResults results, the directories included.
+func limitList(iter *ListIterator, maxResults int) *ListIterator {
+	if maxResults <= 0 {
+		return iter
+	}
+
+	var count int
+
+	return wrapListIterator(iter, func(ctx context.Context) (*ListObject, error) {
+		if count >= maxResults {
+			return nil, io.EOF
+		}
+
+		object, err := iter.Next(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		count++
+
+		return object, nil
+	})
+}
+
+// listAfter drops the results which are not strictly after startAfter. The providers return the directory
+// holding startAfter again, and the ones which can't narrow the query return the keys before it.
+func listAfter(iter *ListIterator, startAfter string) *ListIterator {
+	if startAfter == "" {
+		return iter
+	}
+
+	return wrapListIterator(iter, func(ctx context.Context) (*ListObject, error) {
+		for {
+			object, err := iter.Next(ctx)
+			if err != nil || object.Key > startAfter {
+				return object, err
+			}
+		}
+	})
+}
+
+// listChanBufferSize is the number of results read ahead of the ListChan consumer.
+const listChanBufferSize = 100
+
+// ListChan streams the results of the listing of the options from a goroutine, which stops when the context
+// is canceled even if the consumer has stopped reading. Both channels are closed when it stops,
+// the error channel receives the listing error or the context error, if any.
+func ListChan(ctx context.Context, storage CloudStorage, opts *ListOptions) (<-chan *ListObject, <-chan error) {
+	iter := storage.ListWithOptions(ctx, opts)
+	objects := make(chan *ListObject, listChanBufferSize)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(objects)
+
+		for {
+			object, err := iter.Next(ctx)
+			if err == io.EOF {
+				return
+			}
+
+			if err != nil {
+				errs <- err
+
+				return
+			}
+
+			select {
+			case objects <- object:
+			case <-ctx.Done():
+				errs <- ctx.Err()
+
+				return
+			}
+		}
+	}()
+
+	return objects, errs
+}
+
+func newVersionIterator(f func(ctx context.Context) (*ObjectVersion, error)) *VersionIterator {
+	return &VersionIterator{
+		f: f,
+	}
+}
+
+// NewVersionIterator returns a VersionIterator whose Next calls f, which returns io.EOF after the last version.
+// It's meant for the CloudStorage implementations outside of this package, such as the fakes of the tests.
+func NewVersionIterator(f func(ctx context.Context) (*ObjectVersion, error)) *VersionIterator {
+	return newVersionIterator(f)
+}
+
+// VersionIterator iterates over ListVersions results.
+// The context of Next is the one of the page fetches, instead of the context of the listing call.
+type VersionIterator struct {
+	f func(ctx context.Context) (*ObjectVersion, error)
+}
+
+func (i *VersionIterator) Next(ctx context.Context) (*ObjectVersion, error) {
+	return i.f(ctx)
 }
 
 // ListOptions sets options for listing blobs.
@@ -160,13 +341,24 @@ type ListOptions struct {
 	// ListObject fields. These results represent "directories". Multiple results
 	// in a "directory" are returned as a single result.
 	Delimiter string
+	// IncludeAttributes fills ListObject.ContentType and ListObject.Metadata.
+	// GCS returns them in the listing, while S3 costs an additional HEAD request per object,
+	// made page by page with up to AttributesConcurrency requests in flight.
+	IncludeAttributes bool
+	// AttributesConcurrency caps the HEAD requests in flight on S3 when IncludeAttributes is set, 16 by default.
+	AttributesConcurrency int
+	// StartAfter lists only the keys strictly after this one, to resume a listing from its last returned key.
+	// With a Delimiter, a returned directory is skipped as a whole.
+	StartAfter string
+	// MaxResults ends the listing after this number of results, the directories included. Zero means unlimited.
+	MaxResults int
 }
 
 // ListObject represents a single blob returned from List.
 type ListObject struct {
 	// Key is the key for this blob.
 	Key string
-	// ModTime is the time the blob was last modified.
+	// ModTime is the time the blob was last modified, in UTC.
 	ModTime time.Time
 	// Size is the size of the blob's content in bytes.
 	Size int64
@@ -177,6 +369,41 @@ type ListObject struct {
 	// passed as ListOptions.Prefix to list items in the "directory".
 	// Fields other than Key and IsDir will not be set if IsDir is true.
 	IsDir bool
+	// ContentType is the MIME type of the blob, only set with ListOptions.IncludeAttributes.
+	ContentType string
+	// Metadata holds key/value pairs associated with the blob, only set with ListOptions.IncludeAttributes.
+	Metadata map[string]string
+}
+
+// ObjectVersion represents a single version of a blob returned from ListVersions.
+type ObjectVersion struct {
+	// Key is the key for this blob.
+	Key string
+	// Version is the version ID on S3, and the generation number on GCS.
+	// It's "null" on S3 for the objects written before the versioning was enabled.
+	Version string
+	// ModTime is the time the version was written.
+	ModTime time.Time
+	// Size is the size of the version's content in bytes.
+	Size int64
+	// IsLatest indicates that this version is the current version of the blob.
+	IsLatest bool
+	// IsDeleteMarker indicates that this version is an S3 delete marker, which has no content.
+	// GCS has no delete markers.
+	IsDeleteMarker bool
+}
+
+// RestoreState describes whether an archived blob can be read.
+type RestoreState struct {
+	// Archived indicates that the blob is in an archive storage class, GLACIER or DEEP_ARCHIVE on S3 and ARCHIVE on GCS.
+	Archived bool
+	// InProgress indicates that a restore has been requested and isn't finished yet.
+	InProgress bool
+	// Readable indicates that the blob content can be read now.
+	// The archived blobs are only readable on S3 once restored, the GCS ones are always readable.
+	Readable bool
+	// ExpiryTime is the time the restored copy on S3 is removed, or zero.
+	ExpiryTime time.Time
 }
 
 // Attributes contains attributes about a blob.
@@ -211,13 +438,311 @@ type Attributes struct {
 	Size int64
 	// MD5 is an MD5 hash of the blob contents or nil if not available.
 	MD5 []byte
+	// ETag is the entity tag of the current version of the blob, it changes whenever the blob is replaced.
+	// On GCS it's the generation number of the blob, so that it can be used as WriteOptions.IfMatchETag.
+	ETag string
+	// CreateTime is the time the blob was created, in UTC. It's zero on S3, which doesn't provide it.
+	CreateTime time.Time
+	// StorageClass is the storage class of the blob, e.g. STANDARD or GLACIER on S3 and STANDARD or ARCHIVE on GCS.
+	StorageClass string
+	// CRC32C is the CRC32C checksum of the blob contents, only set when HasCRC32C is true.
+	// It's always available on GCS, and on S3 for the blobs written with the CRC32C ChecksumAlgorithm.
+	CRC32C uint32
+	// HasCRC32C indicates that CRC32C is set.
+	HasCRC32C bool
+	// SHA256 is the SHA-256 checksum of the blob contents or nil if not available.
+	// It's only available on S3, for the blobs written with the SHA256 ChecksumAlgorithm.
+	SHA256 []byte
+}
+
+// normalizeAttributes gives the same attributes whatever the code path and the provider: lowercase metadata keys,
+// UTC times, and the MD5 of the zero-byte objects.
+func normalizeAttributes(attrs *Attributes) *Attributes {
+	for key, value := range attrs.Metadata {
+		if lowerKey := strings.ToLower(key); lowerKey != key {
+			delete(attrs.Metadata, key)
+			attrs.Metadata[lowerKey] = value
+		}
+	}
+
+	attrs.ModTime = attrs.ModTime.UTC()
+	if !attrs.CreateTime.IsZero() {
+		attrs.CreateTime = attrs.CreateTime.UTC()
+	}
+
+	return fillEmptyMD5(attrs)
+}
+
+// GetMultiOptions sets options for GetMultiWithOptions.
+type GetMultiOptions struct {
+	// MaxTotalBytes fails the objects read past this total size with ErrLimitExceeded. Zero means unlimited.
+	MaxTotalBytes int64
+}
+
+// WriteRequest is an object written by WriteMulti.
+type WriteRequest struct {
+	Key  string
+	Body []byte
+	// Options are the options of the write, nil for the defaults.
+	Options *WriteOptions
+}
+
+// AttributeUpdate sets the attributes changed by UpdateAttributes, the empty fields are left untouched.
+type AttributeUpdate struct {
+	CacheControl       string
+	ContentDisposition string
+	ContentEncoding    string
+	ContentLanguage    string
+	ContentType        string
+	// Metadata is merged into the existing metadata, the keys which are not in it are kept.
+	Metadata map[string]string
+}
+
+// apply returns the attributes with the update applied, the keys of the metadata are lowercased.
+func (u *AttributeUpdate) apply(attrs *Attributes) *Attributes {
+	updated := *attrs
+
+	if u.CacheControl != "" {
+		updated.CacheControl = u.CacheControl
+	}
+
+	if u.ContentDisposition != "" {
+		updated.ContentDisposition = u.ContentDisposition
+	}
+
+	if u.ContentEncoding != "" {
+		updated.ContentEncoding = u.ContentEncoding
+	}
+
+	if u.ContentLanguage != "" {
+		updated.ContentLanguage = u.ContentLanguage
+	}
+
+	if u.ContentType != "" {
+		updated.ContentType = u.ContentType
+	}
+
+	updated.Metadata = make(map[string]string, len(attrs.Metadata)+len(u.Metadata))
+	for key, value := range attrs.Metadata {
+		updated.Metadata[strings.ToLower(key)] = value
+	}
+
+	for key, value := range u.Metadata {
+		updated.Metadata[strings.ToLower(key)] = value
+	}
+
+	return &updated
+}
+
+// WriteOptions sets options for writing blobs.
+type WriteOptions struct {
+	// CacheControl specifies caching attributes that services may use
+	// when serving the blob.
+	// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Cache-Control
+	CacheControl string
+	// ContentDisposition specifies whether the blob content is expected to be
+	// displayed inline or as an attachment.
+	// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Content-Disposition
+	ContentDisposition string
+	// ContentEncoding specifies the encoding used for the blob's content, if any.
+	// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Content-Encoding
+	ContentEncoding string
+	// ContentLanguage specifies the language used in the blob's content, if any.
+	// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Content-Language
+	ContentLanguage string
+	// ContentType specifies the MIME type of the blob being written. If not set,
+	// it will be inferred from the content.
+	// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Content-Type
+	ContentType string
+	// Metadata holds key/value pairs to be associated with the blob.
+	// Keys are lowercased before writing, to match what Attributes returns.
+	Metadata map[string]string
+	// BufferSize changes the default size in bytes of the chunks that
+	// the writer buffers and uploads at once, it's the part size of S3 multipart uploads.
+	// Lower values reduce the memory held by large streamed uploads, S3 requires at least 5 MB.
+	// If 0, CloudStorageOption.UploadPartSizeBytes or the provider default is used. It's ignored by WriteWithOptions.
+	BufferSize int
+	// UploadConcurrency is the number of parts of the S3 multipart uploads sent in parallel.
+	// If 0, CloudStorageOption.UploadConcurrency or the provider default is used. Ignored by GCP,
+	// which uploads the chunks sequentially, and by WriteWithOptions.
+	UploadConcurrency int
+	// AWSSSEKMSKeyID encrypts the object with this KMS key instead of CloudStorageOption.AWSSSEKMSKeyID.
+	// Ignored by GCP.
+	AWSSSEKMSKeyID string
+	// IfNotExists writes the object only if it doesn't exist yet, otherwise ErrPreconditionFailed is returned.
+	IfNotExists bool
+	// IfMatchETag writes the object only if its current ETag matches, otherwise ErrPreconditionFailed is returned.
+	// On GCP, where the preconditions are based on generations, it's the generation number returned as Attributes.ETag.
+	IfMatchETag string
+	// VerifyChecksum checks the MD5 of the content, ErrChecksumMismatch is returned when it doesn't match.
+	// The MD5 is sent with each upload request on S3 and with the body on GCS; the streamed content is compared
+	// with the MD5 of the written object on GCS, unless it's not available, e.g. with customer-supplied keys.
+	VerifyChecksum bool
+	// ChecksumAlgorithm sends the ChecksumCRC32C or ChecksumSHA256 checksum of the content, which the provider checks
+	// and stores. It's only supported by WriteWithOptions on S3, and ChecksumSHA256 is not supported on GCS;
+	// ErrNotSupported is returned otherwise. The streamed content is compared with the written object on GCS.
+	ChecksumAlgorithm string
+	// Compress gzips the content, which is stored with the gzip ContentEncoding and, except for the streamed writes,
+	// the UncompressedSizeMetadataKey metadata. The checksums and the attributes are the ones of the stored content.
+	Compress bool
+	// ProgressFunc is called by the writers of GetWriterWithOptions with the number of bytes written so far,
+	// which are buffered and uploaded in parts of BufferSize. It's called from the goroutine calling Write.
+	// Ignored by WriteWithOptions.
+	ProgressFunc func(bytesWritten int64)
+}
+
+// CompletedPart is a part uploaded with a URL of SignUploadPartURL, ETag is the ETag header of the upload response.
+type CompletedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+func (o *WriteOptions) hasConditions() bool {
+	return o != nil && (o.IfNotExists || o.IfMatchETag != "")
+}
+
+// validateConditions rejects IfNotExists with IfMatchETag, an object can't both be missing and match an ETag.
+func (o *WriteOptions) validateConditions() error {
+	if o != nil && o.IfNotExists && o.IfMatchETag != "" {
+		return newTypedError(ErrInvalidArgument, fmt.Errorf("IfNotExists and IfMatchETag can't be set together"))
+	}
+
+	return nil
+}
+
+// CreateBucketOptions are the settings of the created bucket.
+type CreateBucketOptions struct {
+	// Prefix and ExpirationDays are the expiration lifecycle rule of the bucket, none when ExpirationDays is 0.
+	Prefix         string
+	ExpirationDays int64
+	// Region is the S3 region or the GCS location of the bucket, e.g. "eu-west-1" or "EUROPE-WEST1".
+	// The region of the AWS session by default, and the GCS default location, "US", on GCP.
+	Region string
+	// StorageClass is the default storage class of the objects of the GCS bucket, e.g. "NEARLINE".
+	// S3 buckets have no default storage class, ErrNotSupported is returned on AWS.
+	StorageClass string
+	// UniformAccess disables the ACLs of the objects, the access is only granted by the bucket policies:
+	// the uniform bucket-level access on GCS, and the bucket owner enforced object ownership on S3.
+	UniformAccess bool
+	// BlockPublicAccess blocks the public access to the bucket like SetPublicAccessBlock.
+	BlockPublicAccess bool
+	// ObjectLock enables the S3 Object Lock of the bucket, so the retention of its objects can be set with
+	// SetObjectRetention. It can't be disabled later. GCS buckets only have the retention policy of RetentionPeriod,
+	// ErrNotSupported is returned on GCP when RetentionPeriod isn't set.
+	ObjectLock bool
+	// RetentionPeriod is the minimum retention of the objects of the bucket: the default COMPLIANCE retention
+	// of S3 Object Lock, in whole days, or the GCS retention policy. S3 requires ObjectLock.
+	RetentionPeriod time.Duration
+}
+
+const (
+	// RetentionModeGovernance retention can be lifted by the users with the bypass permission.
+	RetentionModeGovernance = "GOVERNANCE"
+	// RetentionModeCompliance retention can't be lifted nor shortened by any user.
+	RetentionModeCompliance = "COMPLIANCE"
+)
+
+// ObjectRetention is the retention of an object, the object can't be deleted or overwritten until RetainUntil.
+// Both fields are empty when the object has no retention.
+type ObjectRetention struct {
+	Mode        string
+	RetainUntil time.Time
+}
+
+// PublicAccessBlock is the public access block configuration of the bucket. The four settings of S3 are
+// all set together by the public access prevention of GCS.
+type PublicAccessBlock struct {
+	BlockPublicACLs       bool
+	IgnorePublicACLs      bool
+	BlockPublicPolicy     bool
+	RestrictPublicBuckets bool
+}
+
+// Blocked is true when all the settings are enabled, the bucket can be made public otherwise.
+func (b *PublicAccessBlock) Blocked() bool {
+	return b.BlockPublicACLs && b.IgnorePublicACLs && b.BlockPublicPolicy && b.RestrictPublicBuckets
+}
+
+// CORSRule allows the browsers of the origins to send the requests of the methods to the bucket,
+// e.g. the uploads with signed URLs.
+type CORSRule struct {
+	// Origins are the allowed origins, e.g. "https://example.com", or "*" for any origin.
+	Origins []string
+	// Methods are the allowed methods, e.g. "GET" or "PUT".
+	Methods []string
+	// ResponseHeaders are the headers the browsers may send with the requests and read from the responses.
+	ResponseHeaders []string
+	// MaxAge is how long the browsers cache the response to the preflight request, rounded down to seconds.
+	MaxAge time.Duration
+}
+
+func validateCORSRules(rules []CORSRule) error {
+	for _, rule := range rules {
+		if len(rule.Origins) == 0 || len(rule.Methods) == 0 {
+			return newTypedError(ErrInvalidArgument, fmt.Errorf("the CORS rules require origins and methods"))
+		}
+
+		if rule.MaxAge < 0 {
+			return newTypedError(ErrInvalidArgument, fmt.Errorf("the max age of the CORS rule can't be negative"))
+		}
+	}
+
+	return nil
 }
 
+// VersioningState is the versioning state of a bucket.
+type VersioningState string
+
+const (
+	// VersioningUnversioned is the state of the buckets whose versioning has never been enabled.
+	VersioningUnversioned VersioningState = "Unversioned"
+	// VersioningEnabled keeps the previous versions of the overwritten and deleted objects.
+	VersioningEnabled VersioningState = "Enabled"
+	// VersioningSuspended is the state of the S3 buckets whose versioning was disabled, the existing versions
+	// are kept. The GCS buckets whose versioning was disabled are VersioningUnversioned.
+	VersioningSuspended VersioningState = "Suspended"
+)
+
+const (
+	// SignedURLSchemeV4 signs the GCS URLs with the V4 signing process, their expiry is at most 7 days.
+	SignedURLSchemeV4 = "v4"
+	// SignedURLSchemeV2 signs the GCS URLs with the legacy V2 signing process.
+	SignedURLSchemeV2 = "v2"
+)
+
 type SignedURLOption struct {
 	Method                   string
 	Expiry                   time.Duration
 	ContentType              string
 	EnforceAbsentContentType bool
+	// ResponseContentDisposition, ResponseContentType and ResponseCacheControl override the headers
+	// of the response to a GET URL, e.g. to save the download with a friendly file name.
+	// They are part of the signature, so they can't be changed by the client.
+	ResponseContentDisposition string
+	ResponseContentType        string
+	ResponseCacheControl       string
+	// HostOverride overrides CloudStorageOption.SignedURLHostOverride for this URL.
+	HostOverride string
+	// AllowedSourceIP restricts the URL to the clients of the IP address or CIDR range, e.g. "192.0.2.0/24".
+	// It's only supported by the CloudFront signed URLs, ErrNotSupported is returned otherwise.
+	AllowedSourceIP string
+	// SignedHeaders are part of the signature, the client must send them with the same values.
+	// They are not supported by the CloudFront signed URLs.
+	SignedHeaders map[string]string
+}
+
+func (o *SignedURLOption) hasResponseOverrides() bool {
+	return o.ResponseContentDisposition != "" || o.ResponseContentType != "" || o.ResponseCacheControl != ""
+}
+
+// validateResponseOverrides fails for the overrides of the URLs of other methods than GET, which S3 ignores.
+func (o *SignedURLOption) validateResponseOverrides() error {
+	if o.hasResponseOverrides() && o.Method != "" && o.Method != http.MethodGet {
+		return newTypedError(ErrInvalidArgument,
+			fmt.Errorf("response header overrides are only supported by GET URLs, not %s", o.Method))
+	}
+
+	return nil
 }
 
 type CloudStorageOption struct {
@@ -241,6 +766,149 @@ type CloudStorageOption struct {
 	// If unset, will default to no expiry window.
 	AWSTokenExpiryWindow time.Duration
 
+	// AWSSSEKMSKeyID encrypts the written and copied objects with this KMS key instead of the bucket default
+	// encryption. The signed PUT URLs require the uploader to send the matching x-amz-server-side-encryption headers.
+	AWSSSEKMSKeyID string
+
+	// AWSDisableContentMD5 stops sending the Content-MD5 of the body of Write and WriteWithOptions,
+	// which S3 checks to reject a corrupted upload. It saves a hash pass over the body.
+	AWSDisableContentMD5 bool
+
+	// BatchConcurrency is the number of parallel requests of ExistsMulti, GetMulti and WriteMulti, 16 by default.
+	BatchConcurrency int
+
+	// FileBufferSize is the size of the copy buffer of DownloadToFile and UploadFromFile, 1 MB by default.
+	FileBufferSize int
+
+	// VerifyChecksum sets WriteOptions.VerifyChecksum for all the writes.
+	VerifyChecksum bool
+
+	// UploadPartSizeBytes is the default of WriteOptions.BufferSize, the part size of the S3 multipart uploads
+	// and the chunk size of the GCS resumable uploads of the streamed writes. S3 requires at least 5 MB,
+	// the construction fails with ErrInvalidArgument otherwise.
+	UploadPartSizeBytes int64
+
+	// UploadConcurrency is the default of WriteOptions.UploadConcurrency.
+	UploadConcurrency int
+
+	// SignedURLScheme is the signing scheme of the GCS signed URLs, SignedURLSchemeV4 by default or SignedURLSchemeV2.
+	// Ignored by AWS, which always uses the signature V4.
+	SignedURLScheme string
+
+	// SignedURLHostOverride is the host of the signed URLs instead of the provider endpoint, e.g. a CDN domain.
+	// The S3 URLs are CloudFront signed URLs, which require CloudFrontKeyID and CloudFrontPrivateKey,
+	// and only support GET. The GCS URLs are V4 signed URLs for the host, e.g. of a Cloud CDN domain.
+	SignedURLHostOverride string
+
+	// CloudFrontKeyID and CloudFrontPrivateKey are the key pair of the CloudFront distribution of the bucket.
+	// The private key is PEM encoded.
+	CloudFrontKeyID      string
+	CloudFrontPrivateKey string
+
+	// DisableDecompression returns the stored content of the gzip encoded objects, which Get, GetReader,
+	// GetWithAttributes and GetIfModified decompress by default. GetRangeReader never decompresses.
+	DisableDecompression bool
+
+	// AllowBucketCreation makes CreateBucket create the bucket in production, with the expiration lifecycle rule,
+	// in the region of the session on AWS and in the project of the credentials on GCP. CreateBucket only logs
+	// a warning otherwise. A bucket which already exists and is owned by the credentials counts as created.
+	// The test storages always create the bucket.
+	AllowBucketCreation bool
+
+	// ValidateOnCreate checks that the bucket exists and is reachable with the credentials when the storage
+	// is created, with the single request of Ping, so that the services fail on startup. The storage isn't
+	// created and ErrBucketNotFound or ErrAccessDenied is returned otherwise.
+	ValidateOnCreate bool
+
+	// MaxRetries is the number of retries of the idempotent operations failing with a transient error, classified as
+	// ErrorKindResourceExhausted or ErrorKindUnavailable by ErrorCode: Get, Attributes, Exists, Delete, the List
+	// page fetches and the buffered writes. Zero by default, which leaves the retries to the provider SDKs. With a
+	// positive value, the retries of the AWS and GCS SDKs are disabled so that the retries don't multiply, and the
+	// operations that aren't retried here, like the streamed writes, aren't retried at all.
+	MaxRetries int
+	// RetryBaseDelay is the backoff before the first retry, doubled for each retry up to 5 seconds, with full jitter.
+	// 100 ms by default. No retry waits past the deadline of the context.
+	RetryBaseDelay time.Duration
+	// OnRetry is called before each retry with the operation, the key, the number of the retry and the error,
+	// e.g. to count the retries.
+	OnRetry func(op, key string, retry int, err error)
+
+	// MaxConcurrentRequests bounds the number of the provider requests in flight at once on the storage, zero
+	// meaning no limit. The page fetches of the listings and each object of ExistsMulti, GetMulti, WriteMulti,
+	// UploadDirectory and DownloadPrefix take a slot, while DeleteBatch takes a single one. The requests waiting
+	// for a slot fail with the context error once their context is done.
+	MaxConcurrentRequests int
+	// OnInFlightRequests is called with the number of the requests in flight each time it changes, e.g. to
+	// update a gauge.
+	OnInFlightRequests func(inFlight int)
+
+	// StrictKeyValidation rejects the keys starting with a slash or containing an empty segment "//" with
+	// ErrInvalidArgument, instead of removing the leading slashes. The empty keys, the keys longer than 1024 bytes
+	// and the keys with a line break are always rejected.
+	StrictKeyValidation bool
+
+	// ComputeMissingMD5 makes Attributes compute the MD5 that the provider doesn't return, e.g. for the S3 multipart
+	// uploads, by reading the object as stored. The MD5 is cached in the "md5" metadata of the object, in hexadecimal,
+	// so that it's only computed once, and the cached MD5 is used even after the object was modified by another
+	// client, which should remove it.
+	ComputeMissingMD5 bool
+	// ComputeMD5MaxSize is the size of the largest object whose MD5 is computed, 64 MiB by default.
+	ComputeMD5MaxSize int64
+
+	// Logger receives the logs of the storages, which are discarded by default. The credentials, the service
+	// account emails and the endpoints are only logged at the debug level.
+	Logger Logger
+
+	// Tracer opens a span for every operation of the storages opened by a factory, e.g. "blob.Get", with the
+	// provider, the bucket, the key, the number of bytes and the ErrorKind of the failure as attributes. The
+	// listings get a single span and the retries a child span each. No span is opened
+	// without a Tracer. An OpenTelemetry tracer is plugged with the adapter of the README.
+	Tracer Tracer
+	// TraceHashKeys replaces the keys of the span attributes by their SHA-256, in hexadecimal.
+	TraceHashKeys bool
+	// Metrics records the duration, the number of bytes and the error of every operation of the storages opened
+	// by a factory, and of every page fetch and failure of the listings. The promblob package records them in
+	// Prometheus.
+	Metrics MetricsRecorder
+	// Interceptors are called around every operation of the storages opened by a factory, the first one being
+	// the outermost. The readers and the writers go through them when they are opened and when they are closed,
+	// and the listings for each call of Next.
+	Interceptors []Interceptor
+
+	// DebugHTTP logs every HTTP exchange with the providers through the Logger at the debug level: the method,
+	// the URL with the signatures and the credentials of the query redacted, the status, the duration and
+	// the request IDs of the provider. The headers aren't logged.
+	DebugHTTP bool
+	// DebugHTTPBodyLimit is the number of bytes of the bodies logged by DebugHTTP, 1 KiB by default and none
+	// when negative.
+	DebugHTTPBodyLimit int
+	// DebugHTTPWriteBodies logs the request bodies of the writes, which hold the objects, too.
+	DebugHTTPWriteBodies bool
+
+	// SlowOperationThreshold warns through the Logger about the operations lasting longer, with the operation,
+	// the key, the bucket, the duration and the number of bytes, and records them with a Metrics implementing
+	// SlowOperationRecorder. The readers and the writers are measured until they are closed. The warnings are
+	// rate-limited to one every 10 seconds for each bucket. Zero, the default, disables it.
+	SlowOperationThreshold time.Duration
+
+	// AuditFunc is called synchronously after the destructive operations of the storages opened by a factory,
+	// whether they succeeded or not: Delete, DeleteBatch, DeleteVersion, Move, and Copy when it overwrites
+	// an object. The actor of the event is set with WithActor. The panics of the AuditFunc are logged and
+	// don't fail the operation.
+	AuditFunc func(event AuditEvent)
+
 	GCPCredentialsJSON     string
 	GCPStorageEmulatorHost string
+
+	// GCPStorageEmulatorScheme is the scheme of the GCS emulator, http or https, http by default.
+	// The recent fake-gcs-server releases serve HTTPS with a generated certificate unless run with -scheme http.
+	GCPStorageEmulatorScheme string
+
+	// GCPStorageEmulatorCACert is the PEM certificate of the CA of the HTTPS emulator, trusted on top of
+	// the system ones.
+	GCPStorageEmulatorCACert []byte
+
+	// GCPStorageEmulatorInsecureSkipVerify doesn't verify the certificate of the HTTPS emulator,
+	// e.g. the self-signed one generated by fake-gcs-server.
+	GCPStorageEmulatorInsecureSkipVerify bool
 }
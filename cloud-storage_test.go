@@ -17,17 +17,50 @@
 package commonblobgo
 
 import (
+	"bytes"
 	"context"
+	"crypto/md5" //nolint:gosec
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	iamcredentials "cloud.google.com/go/iam/credentials/apiv1"
+	gcs "cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/google/uuid"
-	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/s3blob"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	iamcredentialspb "google.golang.org/genproto/googleapis/iam/credentials/v1"
 )
 
 func TestAWSAPISuite(t *testing.T) {
@@ -36,10 +69,11 @@ func TestAWSAPISuite(t *testing.T) {
 		bucketName:     "gdpr-req-data",
 		bucketProvider: "aws",
 
-		awsS3Endpoint:        "http://localhost:4572",
+		// the unified endpoint of localstack, which checks the presigned URLs signed with the test credentials
+		awsS3Endpoint:        "http://localhost:4566",
 		awsS3Region:          "us-west-2",
-		awsS3AccessKeyID:     "AWS_ACCESS_KEY_ID",
-		awsS3SecretAccessKey: "AWS_SECRET_ACCESS_KEY",
+		awsS3AccessKeyID:     "test",
+		awsS3SecretAccessKey: "test",
 	})
 }
 
@@ -53,6 +87,19 @@ func TestGCPAPISuite(t *testing.T) {
 	})
 }
 
+func TestGCPHTTPSAPISuite(t *testing.T) {
+	// the recent fake-gcs-server releases serve HTTPS with a self-signed certificate by default
+	suite.Run(t, &Suite{
+		isTesting:                            true,
+		bucketName:                           "gdpr-req-data",
+		bucketProvider:                       "gcp",
+		gcpCredentialsJSON:                   `{"type": "service_account", "project_id": "my-project-id"}`,
+		gcpStorageEmulatorHost:               "0.0.0.0:4444",
+		gcpStorageEmulatorScheme:             "https",
+		gcpStorageEmulatorInsecureSkipVerify: true,
+	})
+}
+
 func TestAWSDemoAPISuite(t *testing.T) {
 	// warning, this suite uses real S3 credentials
 	awsS3Endpoint := os.Getenv("AWS_S3_ENDPOINT")
@@ -104,6 +151,10 @@ func TestGCPDemoAPISuite(t *testing.T) {
 	})
 }
 
+// RunConformanceSuite is conformance.RunSuite, set by the external test package since the conformance package
+// imports this one.
+var RunConformanceSuite func(t *testing.T, newStorage func(t *testing.T) CloudStorage)
+
 type Suite struct {
 	suite.Suite
 
@@ -120,30 +171,17 @@ type Suite struct {
 	awsS3AccessKeyID     string
 	awsS3SecretAccessKey string
 
-	gcpCredentialsJSON     string
-	gcpStorageEmulatorHost string // only for tests
+	gcpCredentialsJSON                   string
+	gcpStorageEmulatorHost               string // only for tests
+	gcpStorageEmulatorScheme             string // only for tests
+	gcpStorageEmulatorInsecureSkipVerify bool   // only for tests
 }
 
 func (s *Suite) SetupSuite() {
-	logrus.SetOutput(os.Stdout)
-	logrus.SetLevel(logrus.DebugLevel)
-	logrus.SetReportCaller(true)
-
 	s.ctx = context.Background()
 	s.bucketPrefix = fmt.Sprintf("test_%s", uuid.New().String())
 
-	storage, err := NewCloudStorage(
-		s.ctx,
-		s.isTesting,
-		s.bucketProvider,
-		s.bucketName,
-		s.awsS3Endpoint,
-		s.awsS3Region,
-		s.awsS3AccessKeyID,
-		s.awsS3SecretAccessKey,
-		s.gcpCredentialsJSON,
-		s.gcpStorageEmulatorHost,
-	)
+	storage, err := NewCloudStorageWithOption(s.ctx, s.isTesting, s.bucketProvider, s.bucketName, s.cloudStorageOption())
 	s.Require().NoError(err)
 	s.Require().NotNil(storage)
 
@@ -153,10 +191,85 @@ func (s *Suite) SetupSuite() {
 	s.Require().NoError(err)
 }
 
+func (s *Suite) cloudStorageOption() CloudStorageOption {
+	return CloudStorageOption{
+		AWSS3Endpoint:          s.awsS3Endpoint,
+		AWSS3Region:            s.awsS3Region,
+		AWSS3AccessKeyID:       s.awsS3AccessKeyID,
+		AWSS3SecretAccessKey:   s.awsS3SecretAccessKey,
+		GCPCredentialsJSON:     s.gcpCredentialsJSON,
+		GCPStorageEmulatorHost: s.gcpStorageEmulatorHost,
+
+		GCPStorageEmulatorScheme:             s.gcpStorageEmulatorScheme,
+		GCPStorageEmulatorInsecureSkipVerify: s.gcpStorageEmulatorInsecureSkipVerify,
+	}
+}
+
+// httpClient fetches the signed URLs, trusting the self-signed certificate of the emulator like the storage.
+func (s *Suite) httpClient() *http.Client {
+	if !s.gcpStorageEmulatorInsecureSkipVerify {
+		return http.DefaultClient
+	}
+
+	return &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, //nolint:gosec
+	}}
+}
+
+// openNewBucket creates a bucket of its own for the tests changing the bucket configuration.
+func (s *Suite) openNewBucket() (CloudStorage, func()) {
+	factory, err := NewCloudStorageFactory(s.ctx, s.isTesting, s.bucketProvider, s.cloudStorageOption())
+	s.Require().NoError(err)
+
+	storage, err := factory.OpenBucket(s.ctx, "test-"+uuid.New().String())
+	s.Require().NoError(err)
+	s.Require().NoError(storage.CreateBucket(s.ctx, "", 1))
+
+	return storage, func() {
+		s.Require().NoError(factory.Close())
+	}
+}
+
+// innerStorage returns the storage of the provider, without the error context added by the factory.
+func (s *Suite) innerStorage() CloudStorage {
+	storage := s.storage
+
+	for {
+		switch wrapper := storage.(type) {
+		case *errorContextCloudStorage:
+			storage = wrapper.inner
+		case *retryingCloudStorage:
+			storage = wrapper.CloudStorage
+		case *limitedCloudStorage:
+			storage = wrapper.inner
+		case *keyValidatingCloudStorage:
+			storage = wrapper.CloudStorage
+		case *md5ComputingCloudStorage:
+			storage = wrapper.CloudStorage
+		case *auditingCloudStorage:
+			storage = wrapper.CloudStorage
+		case *instrumentedCloudStorage:
+			storage = wrapper.inner
+		case *factoryOwnedCloudStorage:
+			storage = wrapper.CloudStorage
+		case *closableCloudStorage:
+			storage = wrapper.inner
+		default:
+			return storage
+		}
+	}
+}
+
 func (s *Suite) generateFileName() string {
 	return fmt.Sprintf("%s/%s.json", s.bucketPrefix, uuid.New().String())
 }
 
+func (s *Suite) TestConformance() {
+	RunConformanceSuite(s.T(), func(t *testing.T) CloudStorage {
+		return s.storage
+	})
+}
+
 func (s *Suite) TestCreateBucket() {
 	prefix := uuid.New().String()
 
@@ -164,226 +277,4977 @@ func (s *Suite) TestCreateBucket() {
 	s.Require().NoError(err)
 }
 
-func (s *Suite) TestWriteAndGet() {
-	fileName := s.generateFileName()
-	body := []byte(`{"key": "value"}`)
+func (s *Suite) TestCreateBucketInProduction() {
+	testStorage, ok := s.innerStorage().(*AWSTestCloudStorage)
+	if !ok {
+		s.T().Skip("the production GCP storages require the credentials of a project")
+	}
 
-	err := s.storage.Write(s.ctx, fileName, body, nil)
-	s.Require().NoError(err)
+	// the production storage on the localstack client
+	bucketName := "created-" + uuid.New().String()
+	storage := &AWSCloudStorage{
+		storageOptions: newStorageOptions(CloudStorageOption{}),
+		client:         testStorage.client,
+		bucketName:     bucketName,
+	}
 
-	storedBody, err := s.storage.Get(s.ctx, fileName)
-	s.Require().NoError(err)
-	s.Require().NotEmpty(storedBody)
+	s.Require().NoError(storage.CreateBucket(s.ctx, "prefix/", 1))
 
-	s.Require().JSONEq(string(body), string(storedBody))
-}
+	_, err := testStorage.client.HeadBucketWithContext(s.ctx, &s3.HeadBucketInput{Bucket: aws.String(bucketName)})
+	s.Require().Error(err)
 
-func (s *Suite) TestWriteAndGetUsingReaderAndWriter() {
-	fileName := s.generateFileName()
-	body := []byte(`{"key": "value", "key2": "value2"}`)
+	storage.allowBucketCreation = true
 
-	writer, err := s.storage.GetWriter(s.ctx, fileName)
-	s.Require().NoError(err)
+	s.Require().NoError(storage.CreateBucket(s.ctx, "prefix/", 1))
 
-	_, err = writer.Write(body[:10])
-	s.Require().NoError(err)
+	// the bucket already owned counts as created
+	s.Require().NoError(storage.CreateBucket(s.ctx, "prefix/", 1))
 
-	_, err = writer.Write(body[10:20])
+	lifecycle, err := testStorage.client.GetBucketLifecycleConfigurationWithContext(s.ctx,
+		&s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String(bucketName)})
 	s.Require().NoError(err)
+	s.Require().Len(lifecycle.Rules, 1)
+	s.Require().Equal("prefix", aws.StringValue(lifecycle.Rules[0].Filter.Prefix))
+	s.Require().Equal(int64(1), aws.Int64Value(lifecycle.Rules[0].Expiration.Days))
+}
 
-	_, err = writer.Write(body[20:])
-	s.Require().NoError(err)
+func (s *Suite) TestSetLifecycle() {
+	if s.bucketProvider == "gcp" {
+		s.T().Skip("the GCS emulator doesn't store the lifecycle of the buckets")
+	}
 
-	err = writer.Close()
-	s.Require().NoError(err)
+	storage := s.innerStorage().(*AWSTestCloudStorage)
+	prefix := uuid.New().String()
 
-	reader, err := s.storage.GetReader(s.ctx, fileName)
+	getRules := func() map[string]*s3.LifecycleRule {
+		rules, err := getAWSLifecycleRules(s.ctx, storage.client, storage.bucketName)
+		s.Require().NoError(err)
+
+		byPrefix := make(map[string]*s3.LifecycleRule, len(rules))
+		for _, rule := range rules {
+			byPrefix[awsLifecycleRulePrefix(rule)] = rule
+		}
+
+		return byPrefix
+	}
+
+	err := s.storage.SetLifecycle(s.ctx, []LifecycleRule{
+		{Prefix: prefix + "/a/", ExpirationDays: 30},
+		{Prefix: prefix + "/b/", NoncurrentVersionExpirationDays: 7, TransitionDays: 10, TransitionStorageClass: "GLACIER"},
+	}, nil)
 	s.Require().NoError(err)
 
-	storedBody, err := ioutil.ReadAll(reader)
+	// the rule of the same prefix is replaced, the other ones are kept
+	err = s.storage.SetLifecycle(s.ctx, []LifecycleRule{{Prefix: prefix + "/a/", ExpirationDays: 10}}, nil)
 	s.Require().NoError(err)
-	s.Require().NotEmpty(storedBody)
 
-	err = reader.Close()
+	rules := getRules()
+	s.Require().Equal(int64(10), aws.Int64Value(rules[prefix+"/a/"].Expiration.Days))
+	s.Require().Equal(int64(7), aws.Int64Value(rules[prefix+"/b/"].NoncurrentVersionExpiration.NoncurrentDays))
+	s.Require().Equal("GLACIER", aws.StringValue(rules[prefix+"/b/"].Transitions[0].StorageClass))
+
+	err = s.storage.SetLifecycle(s.ctx, []LifecycleRule{{Prefix: prefix + "/c/", ExpirationDays: 1}}, &LifecycleOptions{ReplaceAll: true})
 	s.Require().NoError(err)
 
-	s.Require().JSONEq(string(body), string(storedBody))
+	rules = getRules()
+	s.Require().Len(rules, 1)
+	s.Require().Contains(rules, prefix+"/c/")
+
+	err = s.storage.SetLifecycle(s.ctx, []LifecycleRule{{Prefix: prefix}}, nil)
+	s.Require().ErrorIs(err, ErrInvalidArgument)
+
+	err = s.storage.SetLifecycle(s.ctx, []LifecycleRule{{Prefix: prefix, ExpirationDays: -1}}, nil)
+	s.Require().ErrorIs(err, ErrInvalidArgument)
 }
 
-func (s *Suite) TestWriteAndGetUsingRangeReader() {
-	fileName := s.generateFileName()
-	body := []byte(`0123456789`)
+func (s *Suite) TestGetLifecycle() {
+	if s.bucketProvider == "gcp" {
+		s.T().Skip("the GCS emulator doesn't store the lifecycle of the buckets")
+	}
 
-	writer, err := s.storage.GetWriter(s.ctx, fileName)
+	bucketName := "lifecycle-" + uuid.New().String()
+	storage := &AWSCloudStorage{
+		client:         s.innerStorage().(*AWSTestCloudStorage).client,
+		bucketName:     bucketName,
+		storageOptions: storageOptions{allowBucketCreation: true},
+	}
+
+	s.Require().NoError(storage.CreateBucket(s.ctx, "", 0))
+
+	// a bucket without lifecycle configuration has no rule
+	rules, err := storage.GetLifecycle(s.ctx)
 	s.Require().NoError(err)
+	s.Require().NotNil(rules)
+	s.Require().Empty(rules)
 
-	_, err = writer.Write(body[:10])
+	expected := []LifecycleRule{
+		{ID: "gdpr", Prefix: "gdpr/", ExpirationDays: 30, NoncurrentVersionExpirationDays: 1},
+		{ID: "Prefix archives/", Prefix: "archives/", TransitionDays: 10, TransitionStorageClass: "GLACIER"},
+	}
+
+	s.Require().NoError(storage.SetLifecycle(s.ctx, expected, nil))
+
+	rules, err = storage.GetLifecycle(s.ctx)
 	s.Require().NoError(err)
+	s.Require().ElementsMatch(expected, rules)
 
-	err = writer.Close()
+	rules, err = NewPrefixedStorage(storage, "gdpr").GetLifecycle(s.ctx)
 	s.Require().NoError(err)
+	s.Require().Equal([]LifecycleRule{{ID: "gdpr", ExpirationDays: 30, NoncurrentVersionExpirationDays: 1}}, rules)
+}
+
+func (s *Suite) TestVersioning() {
+	storage, closeFunc := s.openNewBucket()
+	defer closeFunc()
 
-	// Read chunk 1 : offset:0, length:5
-	rangeReader, err := s.storage.GetRangeReader(s.ctx, fileName, 0, 5)
+	state, err := storage.GetVersioningState(s.ctx)
 	s.Require().NoError(err)
+	s.Require().Equal(VersioningUnversioned, state)
 
-	chunk1Result, err := ioutil.ReadAll(rangeReader)
+	s.Require().NoError(storage.SetVersioning(s.ctx, true))
+
+	enabled, err := storage.GetVersioning(s.ctx)
 	s.Require().NoError(err)
-	s.Require().NotEmpty(chunk1Result)
+	s.Require().True(enabled)
 
-	err = rangeReader.Close()
+	s.Require().NoError(storage.SetVersioning(s.ctx, false))
 
+	enabled, err = storage.GetVersioning(s.ctx)
 	s.Require().NoError(err)
-	s.Require().Equal(string(chunk1Result), "01234")
+	s.Require().False(enabled)
 
-	// Read chunk 2 : offset:5, length:5
-	rangeReader, err = s.storage.GetRangeReader(s.ctx, fileName, 5, 5)
+	state, err = storage.GetVersioningState(s.ctx)
 	s.Require().NoError(err)
 
-	chunk2Result, err := ioutil.ReadAll(rangeReader)
+	if s.bucketProvider == "gcp" {
+		s.Require().Equal(VersioningUnversioned, state)
+	} else {
+		s.Require().Equal(VersioningSuspended, state)
+	}
+}
+
+func (s *Suite) TestCORS() {
+	if s.isTesting && s.bucketProvider == "gcp" {
+		s.T().Skip("the GCS emulator doesn't store the CORS configuration of the buckets")
+	}
+
+	storage, closeFunc := s.openNewBucket()
+	defer closeFunc()
+
+	rules, err := storage.GetCORS(s.ctx)
 	s.Require().NoError(err)
-	s.Require().NotEmpty(chunk2Result)
+	s.Require().Empty(rules)
+
+	expected := []CORSRule{
+		{
+			Origins:         []string{"https://example.com"},
+			Methods:         []string{http.MethodGet, http.MethodPut},
+			ResponseHeaders: []string{"Content-Type"},
+			MaxAge:          time.Hour,
+		},
+		{
+			Origins: []string{"*"},
+			Methods: []string{http.MethodGet},
+		},
+	}
 
-	err = rangeReader.Close()
+	s.Require().NoError(storage.SetCORS(s.ctx, expected))
 
+	rules, err = storage.GetCORS(s.ctx)
 	s.Require().NoError(err)
-	s.Require().Equal(string(chunk2Result), "56789")
-}
+	s.Require().Len(rules, 2)
+	s.Require().Equal(expected[0], rules[0])
+	s.Require().Equal(expected[1].Origins, rules[1].Origins)
+	s.Require().Equal(expected[1].Methods, rules[1].Methods)
 
-func (s *Suite) TestWriteAndList() {
-	fileName := s.generateFileName()
-	body := []byte(`{"key": "value"}`)
+	// the empty rules clear the configuration
+	s.Require().NoError(storage.SetCORS(s.ctx, nil))
 
-	err := s.storage.Write(s.ctx, fileName, body, nil)
+	rules, err = storage.GetCORS(s.ctx)
 	s.Require().NoError(err)
+	s.Require().Empty(rules)
 
-	var fileFound bool
+	err = storage.SetCORS(s.ctx, []CORSRule{{Origins: []string{"*"}}})
+	s.Require().ErrorIs(err, ErrInvalidArgument)
+}
 
-	list := s.storage.List(s.ctx, s.bucketPrefix)
+func TestCreateGCPBucketPrefixes(t *testing.T) {
+	// the GCS emulator doesn't store the lifecycle of the buckets, the resource of the bucket is kept here instead
+	var (
+		mu     sync.Mutex
+		bucket map[string]interface{}
+	)
 
-	for {
-		item, err := list.Next(s.ctx)
-		if err == io.EOF {
-			break
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.Method == http.MethodPost && bucket != nil {
+			w.WriteHeader(http.StatusConflict)
+			_, _ = w.Write([]byte(`{"error": {"code": 409, "message": "the bucket already exists"}}`))
+
+			return
 		}
 
-		s.Require().NoError(err)
+		if r.Method != http.MethodGet {
+			if bucket == nil {
+				bucket = make(map[string]interface{})
+			}
 
-		if item.Key == fileName {
-			fileFound = true
+			var changes map[string]interface{}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&changes))
+
+			for field, value := range changes {
+				bucket[field] = value
+			}
 		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(bucket)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+
+	client, err := gcs.NewClient(ctx, option.WithEndpoint(server.URL+"/storage/v1/"), option.WithoutAuthentication())
+	require.NoError(t, err)
+
+	defer client.Close()
+
+	storage := &GCPTestCloudStorage{
+		storageOptions: newStorageOptions(CloudStorageOption{}),
+		client:         client,
+		bucketName:     "my-bucket",
+		projectID:      "my-project-id",
+	}
+
+	require.NoError(t, storage.CreateBucket(ctx, "short/", 1))
+	require.NoError(t, storage.CreateBucket(ctx, "long/", 30))
+
+	attrs, err := client.Bucket("my-bucket").Attrs(ctx)
+	require.NoError(t, err)
+
+	expirations := make(map[string]int64)
+
+	for _, rule := range attrs.Lifecycle.Rules {
+		require.Len(t, rule.Condition.MatchesPrefix, 1)
+		expirations[rule.Condition.MatchesPrefix[0]] = rule.Condition.AgeInDays
 	}
 
-	s.Require().True(fileFound)
+	require.Equal(t, map[string]int64{"short": 1, "long": 30}, expirations)
 }
 
-func (s *Suite) TestWriteAndListWithOptions() {
-	// file without directory
-	fileNameWithoutDirectory := s.bucketPrefix + "/" + uuid.New().String()
-	body := []byte(`{"key": "value1"}`)
-	err := s.storage.Write(s.ctx, fileNameWithoutDirectory, body, nil)
+func (s *Suite) TestCreateBucketWithOptions() {
+	factory, err := NewCloudStorageFactory(s.ctx, s.isTesting, s.bucketProvider, s.cloudStorageOption())
 	s.Require().NoError(err)
 
-	// file with directory
-	fileNameWithDirectory := s.bucketPrefix + "/directory/" + uuid.New().String()
-	body = []byte(`{"key": "value2"}`)
-	err = s.storage.Write(s.ctx, fileNameWithDirectory, body, nil)
+	defer factory.Close()
+
+	storage, err := factory.OpenBucket(s.ctx, "test-"+uuid.New().String())
 	s.Require().NoError(err)
 
-	list := s.storage.ListWithOptions(s.ctx, &ListOptions{
-		Prefix:    s.bucketPrefix + "/",
-		Delimiter: "/",
-	})
-	var fileFound int
-	for {
-		item, err := list.Next(s.ctx)
-		if err == io.EOF {
-			break
-		}
+	options := &CreateBucketOptions{Prefix: "gdpr/", ExpirationDays: 30, UniformAccess: true}
+	if s.bucketProvider == "gcp" {
+		options.StorageClass = "NEARLINE"
+	}
 
-		s.Require().NoError(err)
+	s.Require().NoError(storage.CreateBucketWithOptions(s.ctx, options))
 
-		if item.Key == fileNameWithoutDirectory {
-			s.Require().False(item.IsDir)
-			fileFound++
-		}
-		if item.Key == s.bucketPrefix+"/directory/" {
-			s.Require().True(item.IsDir)
-			fileFound++
-		}
+	// the bucket of the account counts as created
+	s.Require().NoError(storage.CreateBucketWithOptions(s.ctx, options))
+
+	// the default region of the localstack session and the default location of GCS are other ones
+	otherRegion := "eu-west-1"
+	if s.bucketProvider == "gcp" {
+		otherRegion = "EUROPE-WEST1"
+	}
+
+	err = storage.CreateBucketWithOptions(s.ctx, &CreateBucketOptions{Region: otherRegion})
+	s.Require().ErrorIs(err, ErrBucketRegionMismatch)
+
+	if s.bucketProvider != "gcp" {
+		err = storage.CreateBucketWithOptions(s.ctx, &CreateBucketOptions{StorageClass: "STANDARD_IA"})
+		s.Require().ErrorIs(err, ErrNotSupported)
 	}
-	s.Require().Equal(2, fileFound)
 }
 
-func (s *Suite) TestAttributes() {
-	fileName := s.generateFileName()
-	body := []byte(`{"key": "value"}`)
+func (s *Suite) TestPublicAccessBlock() {
+	if s.isTesting && s.bucketProvider == "gcp" {
+		s.T().Skip("the GCS emulator doesn't store the public access prevention of the buckets")
+	}
 
-	err := s.storage.Write(s.ctx, fileName, body, nil)
+	storage, closeFunc := s.openNewBucket()
+	defer closeFunc()
+
+	blocked, err := storage.GetPublicAccessBlock(s.ctx)
 	s.Require().NoError(err)
+	s.Require().False(blocked)
 
-	attrs, err := s.storage.Attributes(s.ctx, fileName)
+	s.Require().NoError(storage.SetPublicAccessBlock(s.ctx, true))
+
+	details, err := storage.GetPublicAccessBlockDetails(s.ctx)
 	s.Require().NoError(err)
-	s.Require().Equal(int64(len(body)), attrs.Size)
-	s.Require().True(attrs.ModTime.Before(time.Now()))
+	s.Require().Equal(&PublicAccessBlock{
+		BlockPublicACLs:       true,
+		IgnorePublicACLs:      true,
+		BlockPublicPolicy:     true,
+		RestrictPublicBuckets: true,
+	}, details)
+
+	s.Require().NoError(storage.SetPublicAccessBlock(s.ctx, false))
+
+	blocked, err = storage.GetPublicAccessBlock(s.ctx)
+	s.Require().NoError(err)
+	s.Require().False(blocked)
+
+	// the public access is blocked at creation
+	s.Require().NoError(storage.CreateBucketWithOptions(s.ctx, &CreateBucketOptions{BlockPublicAccess: true}))
+
+	blocked, err = storage.GetPublicAccessBlock(s.ctx)
+	s.Require().NoError(err)
+	s.Require().True(blocked)
+}
+
+func TestPublicAccessBlockBlocked(t *testing.T) {
+	// a single setting left disabled lets the bucket be made public
+	block := &PublicAccessBlock{BlockPublicACLs: true, IgnorePublicACLs: true, BlockPublicPolicy: true}
+	require.False(t, block.Blocked())
+
+	block.RestrictPublicBuckets = true
+	require.True(t, block.Blocked())
 }
 
-func (s *Suite) TestDelete() {
+func (s *Suite) TestObjectRetention() {
 	fileName := s.generateFileName()
-	body := []byte(`{"key": "value"}`)
+	s.Require().NoError(s.storage.Write(s.ctx, fileName, []byte("retained"), nil))
 
-	err := s.storage.Write(s.ctx, fileName, body, nil)
+	// the objects are not retained by default
+	retention, err := s.storage.GetObjectRetention(s.ctx, fileName)
 	s.Require().NoError(err)
+	s.Require().Equal(&ObjectRetention{}, retention)
 
-	storedBody, err := s.storage.Get(s.ctx, fileName)
+	until := time.Now().Add(time.Hour)
+
+	if s.bucketProvider == "gcp" {
+		err = s.storage.SetObjectRetention(s.ctx, fileName, until, RetentionModeGovernance)
+		s.Require().True(errors.Is(err, ErrNotSupported), err)
+
+		return
+	}
+
+	err = s.storage.SetObjectRetention(s.ctx, fileName, until, "LEGAL")
+	s.Require().True(errors.Is(err, ErrInvalidArgument), err)
+
+	factory, err := NewCloudStorageFactory(s.ctx, s.isTesting, s.bucketProvider, s.cloudStorageOption())
 	s.Require().NoError(err)
-	s.Require().NotEmpty(storedBody)
+	defer factory.Close()
 
-	err = s.storage.Delete(s.ctx, fileName)
+	storage, err := factory.OpenBucket(s.ctx, "locked-"+uuid.New().String())
 	s.Require().NoError(err)
+	s.Require().NoError(storage.CreateBucketWithOptions(s.ctx, &CreateBucketOptions{ObjectLock: true}))
 
-	_, err = s.storage.Get(s.ctx, fileName)
-	s.Require().Error(err)
+	s.Require().NoError(storage.Write(s.ctx, fileName, []byte("retained"), nil))
+	s.Require().NoError(storage.SetObjectRetention(s.ctx, fileName, until, RetentionModeGovernance))
+
+	retention, err = storage.GetObjectRetention(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().Equal(RetentionModeGovernance, retention.Mode)
+	s.Require().WithinDuration(until, retention.RetainUntil, time.Second)
+
+	version, err := storage.ListVersions(s.ctx, fileName).Next(s.ctx)
+	s.Require().NoError(err)
+
+	// the retained version can't be deleted
+	err = storage.DeleteVersion(s.ctx, fileName, version.Version)
+	s.Require().True(errors.Is(err, ErrObjectLocked), err)
+
+	// the default retention is in whole days
+	err = storage.CreateBucketWithOptions(s.ctx, &CreateBucketOptions{ObjectLock: true, RetentionPeriod: time.Hour})
+	s.Require().True(errors.Is(err, ErrInvalidArgument), err)
 }
 
-func (s *Suite) TestGetSignedURL() {
+func (s *Suite) TestErrorCodeNotFound() {
+	_, err := s.storage.Get(s.ctx, s.generateFileName())
+	s.Require().Equal(ErrorKindNotFound, ErrorCode(fmt.Errorf("get: %w", err)))
+
+	s.Require().Equal(ErrorKindOK, ErrorCode(nil))
+}
+
+func (s *Suite) TestErrorContext() {
 	fileName := s.generateFileName()
+
+	_, err := s.storage.Get(s.ctx, fileName)
+	s.Require().Error(err)
+	s.Require().Contains(err.Error(), fmt.Sprintf("Get %q in bucket %q", fileName, s.bucketName))
+	s.Require().True(errors.Is(err, ErrNotFound), err)
+	s.Require().Equal(ErrorKindNotFound, ErrorCode(err))
+
+	var typedErr *typedError
+	s.Require().True(errors.As(err, &typedErr))
+
+	_, err = s.storage.GetReader(s.ctx, fileName)
+	s.Require().Contains(err.Error(), fmt.Sprintf("GetReader %q", fileName))
+	s.Require().True(errors.Is(err, ErrNotFound), err)
+
+	err = s.storage.Copy(s.ctx, fileName+".copy", fileName)
+	s.Require().Contains(err.Error(), fmt.Sprintf("Copy %q to %q", fileName, fileName+".copy"))
+
+	// the signed URLs are not part of the errors
+	_, err = s.storage.GetSignedURL(s.ctx, fileName, &SignedURLOption{
+		Expiry:          time.Minute,
+		Method:          http.MethodGet,
+		AllowedSourceIP: "10.0.0.1",
+	})
+	s.Require().True(errors.Is(err, ErrNotSupported), err)
+	s.Require().Contains(err.Error(), fmt.Sprintf("GetSignedURL %q", fileName))
+	s.Require().NotContains(err.Error(), "http")
+
+	// the end of the listing isn't wrapped
+	_, err = s.storage.List(s.ctx, fileName).Next(s.ctx)
+	s.Require().Equal(io.EOF, err)
+}
+
+func (s *Suite) TestAs() {
+	switch s.bucketProvider {
+	case "aws":
+		var client *s3.S3
+		s.Require().True(s.storage.As(&client))
+		s.Require().NotNil(client)
+
+		var awsSession *session.Session
+		s.Require().True(s.storage.As(&awsSession))
+		s.Require().NotNil(awsSession)
+
+	case "gcp":
+		var client *gcs.Client
+		s.Require().True(s.storage.As(&client))
+		s.Require().NotNil(client)
+
+		var bucket *gcs.BucketHandle
+		s.Require().True(s.storage.As(&bucket))
+
+		attrs, err := bucket.Attrs(s.ctx)
+		s.Require().NoError(err)
+		s.Require().Equal(s.bucketName, attrs.Name)
+	}
+
+	var unsupported *http.Client
+	s.Require().False(s.storage.As(&unsupported))
+	s.Require().Nil(unsupported)
+
+	// the target must be a pointer to the client
+	s.Require().False(s.storage.As(unsupported))
+}
+
+func (s *Suite) TestRequestID() {
+	_, err := s.storage.Get(s.ctx, s.generateFileName())
+	s.Require().ErrorIs(err, ErrNotFound)
+
+	// the GCS emulator doesn't identify its responses
+	if s.bucketProvider == "aws" {
+		s.Require().NotEmpty(RequestID(err), err)
+	}
+
+	s.Require().Empty(RequestID(nil))
+}
+
+func (s *Suite) TestValidateOnCreate() {
+	options := s.cloudStorageOption()
+	options.ValidateOnCreate = true
+
+	_, err := NewCloudStorageWithOption(s.ctx, s.isTesting, s.bucketProvider, "missing-"+uuid.New().String(), options)
+	s.Require().ErrorIs(err, ErrBucketNotFound)
+
+	storage, err := NewCloudStorageWithOption(s.ctx, s.isTesting, s.bucketProvider, s.bucketName, options)
+	s.Require().NoError(err)
+	storage.Close()
+}
+
+func TestValidateOnCreateAccessDenied(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	awsSession := session.Must(session.NewSession(&aws.Config{
+		Endpoint:         aws.String(server.URL),
+		Region:           aws.String("us-west-2"),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.AnonymousCredentials,
+		MaxRetries:       aws.Int(0),
+	}))
+
+	factory := newCloudStorageFactory(func(ctx context.Context, bucketName string) (CloudStorage, error) {
+		storage, err := newAWSCloudStorage(ctx, awsSession, bucketName, "",
+			newStorageOptions(CloudStorageOption{ValidateOnCreate: true}))
+		if err != nil {
+			return nil, err
+		}
+
+		return storage, nil
+	}, func() error { return nil })
+
+	defer factory.Close()
+
+	_, err := factory.OpenBucket(context.Background(), "my-bucket")
+	require.ErrorIs(t, err, ErrAccessDenied)
+}
+
+func (s *Suite) TestKeyValidation() {
 	body := []byte(`{"key": "value"}`)
 
-	err := s.storage.Write(s.ctx, fileName, body, nil)
+	for _, key := range []string{"", "/", "dir/\nfile.json", strings.Repeat("a", maxKeyLength+1)} {
+		err := s.storage.Write(s.ctx, key, body, nil)
+		s.Require().ErrorIs(err, ErrInvalidArgument, key)
+
+		_, err = s.storage.Exists(s.ctx, key)
+		s.Require().ErrorIs(err, ErrInvalidArgument, key)
+	}
+
+	// the leading slashes are removed
+	fileName := s.generateFileName()
+
+	err := s.storage.Write(s.ctx, "/"+fileName, body, nil)
 	s.Require().NoError(err)
 
+	defer func() {
+		_ = s.storage.Delete(s.ctx, fileName)
+	}()
+
 	storedBody, err := s.storage.Get(s.ctx, fileName)
 	s.Require().NoError(err)
-	s.Require().NotEmpty(storedBody)
+	s.Require().Equal(body, storedBody)
 
-	options := &SignedURLOption{
-		Expiry:                   time.Hour,
-		Method:                   "GET",
-		ContentType:              "",
-		EnforceAbsentContentType: false,
-	}
+	options := s.cloudStorageOption()
+	options.StrictKeyValidation = true
 
-	url, err := s.storage.GetSignedURL(s.ctx, fileName, options)
+	storage, err := NewCloudStorageWithOption(s.ctx, s.isTesting, s.bucketProvider, s.bucketName, options)
 	s.Require().NoError(err)
-	s.Require().NotEmpty(url)
+
+	defer storage.Close()
+
+	_, err = storage.Get(s.ctx, "/"+fileName)
+	s.Require().ErrorIs(err, ErrInvalidArgument)
+
+	_, err = storage.Get(s.ctx, strings.Replace(fileName, "/", "//", 1))
+	s.Require().ErrorIs(err, ErrInvalidArgument)
 }
 
-func (s *Suite) TestCopy() {
-	sourceFileName := s.generateFileName()
-	destFileName := s.generateFileName()
-	body := []byte(`{"key": "value"}`)
+func (s *Suite) TestEmptyObject() {
+	fileName := s.generateFileName()
 
-	err := s.storage.Write(s.ctx, sourceFileName, body, nil)
+	err := s.storage.Write(s.ctx, fileName, []byte{}, nil)
 	s.Require().NoError(err)
 
-	_, err = s.storage.Get(s.ctx, destFileName)
-	s.Require().Error(err)
+	body, err := s.storage.Get(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().NotNil(body)
+	s.Require().Empty(body)
 
-	err = s.storage.Copy(s.ctx, destFileName, sourceFileName)
+	attrs, err := s.storage.Attributes(s.ctx, fileName)
 	s.Require().NoError(err)
+	s.Require().Equal(int64(0), attrs.Size)
+	s.Require().Equal(md5Sum([]byte{}), attrs.MD5)
 
-	storeBody, err := s.storage.Get(s.ctx, destFileName)
+	body, attrs, err = s.storage.GetWithAttributes(s.ctx, fileName)
 	s.Require().NoError(err)
-	s.Require().ElementsMatch(body, storeBody)
+	s.Require().NotNil(body)
+	s.Require().Empty(body)
+	s.Require().Equal(int64(0), attrs.Size)
+	s.Require().Equal(md5Sum([]byte{}), attrs.MD5)
+
+	exists, err := s.storage.Exists(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().True(exists)
+
+	reader, err := s.storage.GetReader(s.ctx, fileName)
+	s.Require().NoError(err)
+
+	n, err := reader.Read(make([]byte, 16))
+	s.Require().Equal(0, n)
+	s.Require().Equal(io.EOF, err)
+	s.Require().NoError(reader.Close())
+}
+
+func (s *Suite) TestAttributesNormalized() {
+	fileName := s.generateFileName()
+
+	err := s.storage.WriteWithOptions(s.ctx, fileName, []byte(`{"key": "value"}`), &WriteOptions{
+		Metadata: map[string]string{"Mixed-Case": "Value"},
+	})
+	s.Require().NoError(err)
+
+	attrs, err := s.storage.Attributes(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().Equal(map[string]string{"mixed-case": "Value"}, attrs.Metadata)
+	s.Require().Equal(time.UTC, attrs.ModTime.Location())
+
+	if !attrs.CreateTime.IsZero() {
+		s.Require().Equal(time.UTC, attrs.CreateTime.Location())
+	}
+
+	_, attrs, err = s.storage.GetWithAttributes(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().Equal(map[string]string{"mixed-case": "Value"}, attrs.Metadata)
+	s.Require().Equal(time.UTC, attrs.ModTime.Location())
+
+	object, err := s.storage.List(s.ctx, fileName).Next(s.ctx)
+	s.Require().NoError(err)
+	s.Require().Equal(fileName, object.Key)
+	s.Require().Equal(time.UTC, object.ModTime.Location())
+}
+
+func (s *Suite) TestListBuckets() {
+	buckets, err := ListBuckets(s.ctx, s.bucketProvider, s.cloudStorageOption())
+	s.Require().NoError(err)
+
+	var found *BucketInfo
+
+	for i := range buckets {
+		if buckets[i].Name == s.bucketName {
+			found = &buckets[i]
+		}
+	}
+
+	s.Require().NotNil(found)
+	s.Require().NotEmpty(found.Location)
+	s.Require().False(found.CreationTime.IsZero())
+
+	_, err = ListBuckets(s.ctx, "azure", s.cloudStorageOption())
+	s.Require().Error(err)
+}
+
+func TestListBucketsAccessDenied(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/storage/v1/") {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"error": {"code": 403, "message": "denied"}}`))
+
+			return
+		}
+
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+
+	awsClient := s3.New(session.Must(session.NewSession(&aws.Config{
+		Endpoint:         aws.String(server.URL),
+		Region:           aws.String("us-west-2"),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.AnonymousCredentials,
+		MaxRetries:       aws.Int(0),
+	})))
+
+	_, err := listAWSBuckets(ctx, awsClient)
+	require.ErrorIs(t, err, ErrAccessDenied)
+
+	gcpClient, err := gcs.NewClient(ctx, option.WithEndpoint(server.URL+"/storage/v1/"), option.WithoutAuthentication())
+	require.NoError(t, err)
+
+	defer gcpClient.Close()
+
+	_, err = listGCPBuckets(ctx, gcpClient, "my-project-id")
+	require.ErrorIs(t, err, ErrAccessDenied)
+}
+
+func (s *Suite) TestWriteAndGetUsingReaderAndWriter() {
+	fileName := s.generateFileName()
+	body := []byte(`{"key": "value", "key2": "value2"}`)
+
+	writer, err := s.storage.GetWriter(s.ctx, fileName)
+	s.Require().NoError(err)
+
+	_, err = writer.Write(body[:10])
+	s.Require().NoError(err)
+
+	_, err = writer.Write(body[10:20])
+	s.Require().NoError(err)
+
+	_, err = writer.Write(body[20:])
+	s.Require().NoError(err)
+
+	err = writer.Close()
+	s.Require().NoError(err)
+
+	reader, err := s.storage.GetReader(s.ctx, fileName)
+	s.Require().NoError(err)
+
+	storedBody, err := ioutil.ReadAll(reader)
+	s.Require().NoError(err)
+	s.Require().NotEmpty(storedBody)
+
+	err = reader.Close()
+	s.Require().NoError(err)
+
+	s.Require().JSONEq(string(body), string(storedBody))
+}
+
+func (s *Suite) TestAttributes() {
+	fileName := s.generateFileName()
+	body := []byte(`{"key": "value"}`)
+
+	err := s.storage.Write(s.ctx, fileName, body, nil)
+	s.Require().NoError(err)
+
+	attrs, err := s.storage.Attributes(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().Equal(int64(len(body)), attrs.Size)
+	s.Require().True(attrs.ModTime.Before(time.Now()))
+	s.Require().NotEmpty(attrs.ETag)
+	s.Require().Equal("STANDARD", attrs.StorageClass)
+
+	// S3 doesn't provide the creation time
+	if s.bucketProvider == "gcp" {
+		s.Require().False(attrs.CreateTime.IsZero())
+	} else {
+		s.Require().True(attrs.CreateTime.IsZero())
+	}
+}
+
+func (s *Suite) TestGetSignedURL() {
+	fileName := s.generateFileName()
+	body := []byte(`{"key": "value"}`)
+
+	err := s.storage.Write(s.ctx, fileName, body, nil)
+	s.Require().NoError(err)
+
+	storedBody, err := s.storage.Get(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().NotEmpty(storedBody)
+
+	options := &SignedURLOption{
+		Expiry:                   time.Hour,
+		Method:                   "GET",
+		ContentType:              "",
+		EnforceAbsentContentType: false,
+	}
+
+	signedURL, err := s.storage.GetSignedURL(s.ctx, fileName, options)
+	s.Require().NoError(err)
+	s.Require().NotEmpty(signedURL)
+
+	response, err := s.httpClient().Get(signedURL) //nolint:noctx
+	s.Require().NoError(err)
+
+	defer response.Body.Close()
+
+	s.Require().Equal(http.StatusOK, response.StatusCode)
+
+	downloadedBody, err := ioutil.ReadAll(response.Body)
+	s.Require().NoError(err)
+	s.Require().Equal(body, downloadedBody)
+}
+
+func (s *Suite) TestGetSignedURLEscapedKey() {
+	fileName := s.bucketPrefix + "/dir/file name " + uuid.New().String() + ".json"
+	body := []byte(`{"key": "value"}`)
+
+	s.Require().NoError(s.storage.Write(s.ctx, fileName, body, nil))
+
+	signedURL, err := s.storage.GetSignedURL(s.ctx, fileName, &SignedURLOption{Expiry: time.Hour, Method: http.MethodGet})
+	s.Require().NoError(err)
+
+	parsedURL, err := url.Parse(signedURL)
+	s.Require().NoError(err)
+	s.Require().Contains(parsedURL.EscapedPath(), "/dir/file%20name%20")
+
+	expires := parsedURL.Query().Get("X-Amz-Expires")
+	if s.bucketProvider == "gcp" {
+		expires = parsedURL.Query().Get("X-Goog-Expires")
+	}
+
+	s.Require().Equal("3600", expires)
+
+	response, err := s.httpClient().Get(signedURL) //nolint:noctx
+	s.Require().NoError(err)
+
+	defer response.Body.Close()
+
+	s.Require().Equal(http.StatusOK, response.StatusCode)
+
+	if s.bucketProvider == "gcp" {
+		// the emulator rejects the download URLs of the missing objects
+		_, err = s.storage.GetSignedURL(s.ctx, s.generateFileName(), &SignedURLOption{Expiry: time.Hour, Method: http.MethodGet})
+		s.Require().ErrorIs(err, ErrNotFound)
+	}
+}
+
+func (s *Suite) TestGetSignedURLSignature() {
+	if s.bucketProvider == "gcp" {
+		s.T().Skip("the GCS emulator doesn't check the signatures")
+	}
+
+	fileName := s.generateFileName()
+	body := []byte(`{"key": "value"}`)
+
+	s.Require().NoError(s.storage.Write(s.ctx, fileName, body, nil))
+
+	signedURL, err := s.storage.GetSignedURL(s.ctx, fileName, &SignedURLOption{Expiry: time.Hour, Method: http.MethodGet})
+	s.Require().NoError(err)
+
+	parsedURL, err := url.Parse(signedURL)
+	s.Require().NoError(err)
+	s.Require().Equal("AWS4-HMAC-SHA256", parsedURL.Query().Get("X-Amz-Algorithm"))
+
+	response, err := s.httpClient().Get(signedURL) //nolint:noctx
+	s.Require().NoError(err)
+
+	downloadedBody, err := ioutil.ReadAll(response.Body)
+	s.Require().NoError(err)
+	s.Require().NoError(response.Body.Close())
+	s.Require().Equal(http.StatusOK, response.StatusCode)
+	s.Require().Equal(body, downloadedBody)
+
+	// the URLs with another signature are rejected
+	query := parsedURL.Query()
+	query.Set("X-Amz-Signature", strings.Repeat("0", 64))
+	parsedURL.RawQuery = query.Encode()
+
+	response, err = s.httpClient().Get(parsedURL.String()) //nolint:noctx
+	s.Require().NoError(err)
+	s.Require().NoError(response.Body.Close())
+	s.Require().Equal(http.StatusForbidden, response.StatusCode)
+}
+
+func (s *Suite) TestGetSignedURLCanceled() {
+	fileName := s.generateFileName()
+	s.Require().NoError(s.storage.Write(s.ctx, fileName, []byte(`{"key": "value"}`), nil))
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	cancel()
+
+	for _, method := range []string{http.MethodGet, http.MethodPut} {
+		signedURL, err := s.storage.GetSignedURL(ctx, fileName, &SignedURLOption{Expiry: time.Hour, Method: method})
+		s.Require().ErrorIs(err, context.Canceled)
+		s.Require().Empty(signedURL)
+	}
+}
+
+func (s *Suite) TestGetSignedURLPut() {
+	if s.bucketProvider == "gcp" {
+		s.T().Skip("the GCS emulator doesn't support the uploads through signed URLs")
+	}
+
+	fileName := s.generateFileName()
+	body := []byte(`{"key": "value"}`)
+
+	signedURL, err := s.storage.GetSignedURL(s.ctx, fileName, &SignedURLOption{
+		Expiry:      time.Hour,
+		Method:      http.MethodPut,
+		ContentType: "application/json",
+	})
+	s.Require().NoError(err)
+
+	request, err := http.NewRequestWithContext(s.ctx, http.MethodPut, signedURL, bytes.NewReader(body))
+	s.Require().NoError(err)
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := s.httpClient().Do(request)
+	s.Require().NoError(err)
+	s.Require().NoError(response.Body.Close())
+	s.Require().Equal(http.StatusOK, response.StatusCode)
+
+	storedBody, attrs, err := s.storage.GetWithAttributes(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().Equal(body, storedBody)
+	s.Require().Equal("application/json", attrs.ContentType)
+
+	_, err = s.storage.GetSignedURL(s.ctx, fileName, &SignedURLOption{Expiry: time.Hour, Method: http.MethodPatch})
+	s.Require().Error(err)
+}
+
+func (s *Suite) TestCopy() {
+	sourceFileName := s.generateFileName()
+	destFileName := s.generateFileName()
+	body := []byte(`{"key": "value"}`)
+
+	err := s.storage.Write(s.ctx, sourceFileName, body, nil)
+	s.Require().NoError(err)
+
+	_, err = s.storage.Get(s.ctx, destFileName)
+	s.Require().Error(err)
+
+	err = s.storage.Copy(s.ctx, destFileName, sourceFileName)
+	s.Require().NoError(err)
+
+	storeBody, err := s.storage.Get(s.ctx, destFileName)
+	s.Require().NoError(err)
+	s.Require().ElementsMatch(body, storeBody)
+}
+
+func (s *Suite) TestPing() {
+	err := s.storage.Ping(s.ctx)
+	s.Require().NoError(err)
+}
+
+func (s *Suite) TestPingWrongBucket() {
+	if s.gcpStorageEmulatorScheme != "" {
+		s.T().Skip("NewCloudStorage has no parameter for the scheme of the GCS emulator")
+	}
+
+	storage, err := NewCloudStorage(
+		s.ctx,
+		s.isTesting,
+		s.bucketProvider,
+		fmt.Sprintf("missing-%s", uuid.New().String()),
+		s.awsS3Endpoint,
+		s.awsS3Region,
+		s.awsS3AccessKeyID,
+		s.awsS3SecretAccessKey,
+		s.gcpCredentialsJSON,
+		s.gcpStorageEmulatorHost,
+	)
+	s.Require().NoError(err)
+
+	defer storage.Close()
+
+	err = storage.Ping(s.ctx)
+	s.Require().ErrorIs(err, ErrBucketNotFound)
+}
+
+func (s *Suite) TestCloudStorageFactory() {
+	factory, err := NewCloudStorageFactory(s.ctx, s.isTesting, s.bucketProvider, s.cloudStorageOption())
+	s.Require().NoError(err)
+
+	first, err := factory.OpenBucket(s.ctx, s.bucketName)
+	s.Require().NoError(err)
+
+	second, err := factory.OpenBucket(s.ctx, s.bucketName)
+	s.Require().NoError(err)
+
+	// closing one storage must not break its siblings, and closing it again does nothing
+	s.Require().NoError(first.Close())
+	s.Require().NoError(first.Close())
+
+	fileName := s.generateFileName()
+	body := []byte(`{"key": "value"}`)
+
+	err = second.Write(s.ctx, fileName, body, nil)
+	s.Require().NoError(err)
+
+	storedBody, err := second.Get(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().JSONEq(string(body), string(storedBody))
+
+	// closing the factory closes every storage opened by it
+	s.Require().NoError(factory.Close())
+	s.Require().NoError(factory.Close())
+	s.Require().NoError(second.Close())
+
+	_, err = second.Get(s.ctx, fileName)
+	s.Require().ErrorIs(err, ErrClosed)
+
+	_, err = factory.OpenBucket(s.ctx, s.bucketName)
+	s.Require().Error(err)
+}
+
+func (s *Suite) TestExists() {
+	fileName := s.generateFileName()
+	body := []byte(`{"key": "value"}`)
+
+	isExists, err := s.storage.Exists(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().False(isExists)
+
+	err = s.storage.Write(s.ctx, fileName, body, nil)
+	s.Require().NoError(err)
+
+	isExists, err = s.storage.Exists(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().True(isExists)
+
+	err = s.storage.Delete(s.ctx, fileName)
+	s.Require().NoError(err)
+
+	isExists, err = s.storage.Exists(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().False(isExists)
+
+	// the missing keys are reported the same way by every provider
+	err = s.storage.Delete(s.ctx, fileName)
+	s.Require().ErrorIs(err, ErrNotFound)
+	s.Require().Equal(ErrorKindNotFound, ErrorCode(err))
+}
+
+func (s *Suite) TestCopyOntoSameKey() {
+	fileName := s.generateFileName()
+	body := []byte(`{"key": "value"}`)
+
+	err := s.storage.Write(s.ctx, fileName, body, nil)
+	s.Require().NoError(err)
+
+	err = s.storage.Copy(s.ctx, fileName, fileName)
+	s.Require().NoError(err)
+
+	storedBody, err := s.storage.Get(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().JSONEq(string(body), string(storedBody))
+}
+
+func (s *Suite) TestCopyMissingSource() {
+	err := s.storage.Copy(s.ctx, s.generateFileName(), s.generateFileName())
+	s.Require().ErrorIs(err, ErrNotFound)
+}
+
+func (s *Suite) TestGetRangeReaderEdges() {
+	fileName := s.generateFileName()
+	body := []byte(`0123456789`)
+	size := int64(len(body))
+
+	err := s.storage.Write(s.ctx, fileName, body, nil)
+	s.Require().NoError(err)
+
+	for _, offset := range []int64{0, size / 2, size - 1, size, size + 1} {
+		for _, length := range []int64{-1, 0, 1, 1 << 40} {
+			name := fmt.Sprintf("offset %d length %d", offset, length)
+
+			rangeReader, err := s.storage.GetRangeReader(s.ctx, fileName, offset, length)
+			if offset > size {
+				s.Require().ErrorIs(err, ErrOutOfRange, name)
+
+				continue
+			}
+
+			s.Require().NoError(err, name)
+
+			result, err := ioutil.ReadAll(rangeReader)
+			s.Require().NoError(err, name)
+			s.Require().NoError(rangeReader.Close(), name)
+
+			end := size
+			if length >= 0 && offset+length < size {
+				end = offset + length
+			}
+
+			s.Require().Equal(string(body[offset:end]), string(result), name)
+		}
+	}
+}
+
+func (s *Suite) TestMove() {
+	sourceFileName := s.generateFileName()
+	destFileName := s.generateFileName()
+	body := []byte(`{"key": "value"}`)
+
+	err := s.storage.Write(s.ctx, sourceFileName, body, nil)
+	s.Require().NoError(err)
+
+	// the destination is overwritten
+	err = s.storage.Write(s.ctx, destFileName, []byte(`{"key": "old"}`), nil)
+	s.Require().NoError(err)
+
+	err = s.storage.Move(s.ctx, destFileName, sourceFileName)
+	s.Require().NoError(err)
+
+	storedBody, err := s.storage.Get(s.ctx, destFileName)
+	s.Require().NoError(err)
+	s.Require().JSONEq(string(body), string(storedBody))
+
+	isExists, err := s.storage.Exists(s.ctx, sourceFileName)
+	s.Require().NoError(err)
+	s.Require().False(isExists)
+}
+
+func (s *Suite) TestMoveMissingSource() {
+	err := s.storage.Move(s.ctx, s.generateFileName(), s.generateFileName())
+	s.Require().ErrorIs(err, ErrNotFound)
+}
+
+func (s *Suite) TestDeleteBatch() {
+	body := []byte(`{"key": "value"}`)
+
+	var fileNames []string
+
+	for i := 0; i < 5; i++ {
+		fileName := s.generateFileName()
+
+		err := s.storage.Write(s.ctx, fileName, body, nil)
+		s.Require().NoError(err)
+
+		fileNames = append(fileNames, fileName)
+	}
+
+	// a missing key counts as deleted
+	err := s.storage.DeleteBatch(s.ctx, append(fileNames, s.generateFileName()))
+	s.Require().NoError(err)
+
+	for _, fileName := range fileNames {
+		isExists, err := s.storage.Exists(s.ctx, fileName)
+		s.Require().NoError(err)
+		s.Require().False(isExists)
+	}
+}
+
+func (s *Suite) TestWriteWithOptions() {
+	fileName := s.generateFileName()
+	body := []byte(`{"key": "value"}`)
+
+	options := &WriteOptions{
+		CacheControl:       "public, max-age=3600",
+		ContentDisposition: `attachment; filename="export.json"`,
+		ContentEncoding:    "identity",
+		ContentLanguage:    "en",
+		ContentType:        "application/json",
+		Metadata:           map[string]string{"User-ID": "42"},
+	}
+
+	err := s.storage.WriteWithOptions(s.ctx, fileName, body, options)
+	s.Require().NoError(err)
+
+	attrs, err := s.storage.Attributes(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().Equal(options.CacheControl, attrs.CacheControl)
+	s.Require().Equal(options.ContentDisposition, attrs.ContentDisposition)
+	s.Require().Equal(options.ContentEncoding, attrs.ContentEncoding)
+	s.Require().Equal(options.ContentLanguage, attrs.ContentLanguage)
+	s.Require().Equal(options.ContentType, attrs.ContentType)
+	s.Require().Equal(map[string]string{"user-id": "42"}, attrs.Metadata)
+}
+
+func (s *Suite) TestGetWriterWithOptions() {
+	fileName := s.generateFileName()
+	body := []byte(`{"key": "value", "key2": "value2"}`)
+
+	writer, err := s.storage.GetWriterWithOptions(s.ctx, fileName, &WriteOptions{
+		CacheControl: "no-cache",
+		ContentType:  "application/json",
+		Metadata:     map[string]string{"source": "stream"},
+		BufferSize:   5 * 1024 * 1024,
+	})
+	s.Require().NoError(err)
+
+	_, err = writer.Write(body[:10])
+	s.Require().NoError(err)
+
+	_, err = writer.Write(body[10:])
+	s.Require().NoError(err)
+
+	err = writer.Close()
+	s.Require().NoError(err)
+
+	storedBody, err := s.storage.Get(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().JSONEq(string(body), string(storedBody))
+
+	attrs, err := s.storage.Attributes(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().Equal("no-cache", attrs.CacheControl)
+	s.Require().Equal("application/json", attrs.ContentType)
+	s.Require().Equal("stream", attrs.Metadata["source"])
+}
+
+func (s *Suite) TestWriteWithMetadata() {
+	fileName := s.generateFileName()
+	body := []byte(`{"key": "value"}`)
+
+	err := s.storage.WriteWithOptions(s.ctx, fileName, body, &WriteOptions{
+		Metadata: map[string]string{
+			"Export-ID": "42",
+			"owner":     "gdpr",
+		},
+	})
+	s.Require().NoError(err)
+
+	attrs, err := s.storage.Attributes(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().Equal(map[string]string{"export-id": "42", "owner": "gdpr"}, attrs.Metadata)
+}
+
+func (s *Suite) TestWriteWithTooLargeMetadata() {
+	if s.bucketProvider != "aws" {
+		s.T().Skip("metadata limit is S3-specific")
+	}
+
+	err := s.storage.WriteWithOptions(s.ctx, s.generateFileName(), []byte(`{}`), &WriteOptions{
+		Metadata: map[string]string{"large": strings.Repeat("x", 3*1024)},
+	})
+	s.Require().ErrorIs(err, ErrMetadataTooLarge)
+}
+
+func (s *Suite) TestTags() {
+	fileName := s.generateFileName()
+	body := []byte(`{"key": "value"}`)
+
+	err := s.storage.Write(s.ctx, fileName, body, nil)
+	s.Require().NoError(err)
+
+	tags := map[string]string{"retention": "short", "team": "gdpr"}
+
+	err = s.storage.SetTags(s.ctx, fileName, tags)
+	if s.bucketProvider == "gcp" {
+		s.Require().ErrorIs(err, ErrNotSupported)
+
+		_, err = s.storage.GetTags(s.ctx, fileName)
+		s.Require().ErrorIs(err, ErrNotSupported)
+
+		return
+	}
+
+	s.Require().NoError(err)
+
+	storedTags, err := s.storage.GetTags(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().Equal(tags, storedTags)
+
+	tooManyTags := make(map[string]string)
+	for i := 0; i < 11; i++ {
+		tooManyTags[fmt.Sprintf("tag%d", i)] = "value"
+	}
+
+	err = s.storage.SetTags(s.ctx, fileName, tooManyTags)
+	s.Require().ErrorIs(err, ErrInvalidArgument)
+}
+
+func (s *Suite) TestSetStorageClass() {
+	fileName := s.generateFileName()
+	body := []byte(`{"key": "value"}`)
+	contentType := "application/json"
+
+	err := s.storage.WriteWithOptions(s.ctx, fileName, body, &WriteOptions{
+		ContentType: contentType,
+		Metadata:    map[string]string{"owner": "gdpr"},
+	})
+	s.Require().NoError(err)
+
+	class := "STANDARD_IA"
+	if s.bucketProvider == "gcp" {
+		class = "NEARLINE"
+	}
+
+	err = s.storage.SetStorageClass(s.ctx, fileName, class)
+	s.Require().NoError(err)
+
+	// already in the requested class
+	err = s.storage.SetStorageClass(s.ctx, fileName, class)
+	s.Require().NoError(err)
+
+	storedBody, err := s.storage.Get(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().JSONEq(string(body), string(storedBody))
+
+	attrs, err := s.storage.Attributes(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().Equal(contentType, attrs.ContentType)
+	s.Require().Equal("gdpr", attrs.Metadata["owner"])
+
+	// the GCS emulator keeps the class of the bucket for the rewritten objects
+	if !s.isTesting || s.bucketProvider != "gcp" {
+		s.Require().Equal(class, attrs.StorageClass)
+	}
+}
+
+func (s *Suite) TestWriteWithSSEKMS() {
+	// warning, this test requires a real KMS key
+	sseKMSKeyID := os.Getenv("AWS_SSE_KMS_KEY_ID")
+
+	if s.bucketProvider != "aws" || sseKMSKeyID == "" {
+		s.T().Skip("Skipped. Required ENV variable AWS_SSE_KMS_KEY_ID")
+	}
+
+	fileName := s.generateFileName()
+	body := []byte(`{"key": "value"}`)
+
+	err := s.storage.WriteWithOptions(s.ctx, fileName, body, &WriteOptions{
+		AWSSSEKMSKeyID: sseKMSKeyID,
+	})
+	s.Require().NoError(err)
+
+	// reads of encrypted objects are transparent
+	storedBody, err := s.storage.Get(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().JSONEq(string(body), string(storedBody))
+}
+
+func (s *Suite) TestEncryptedCloudStorage() {
+	keyProvider := &StaticKeyProvider{
+		CurrentKeyID: "key1",
+		Keys: map[string][]byte{
+			"key1": []byte("0123456789abcdef0123456789abcdef"),
+			"key2": []byte("fedcba9876543210fedcba9876543210"),
+		},
+	}
+	storage := NewEncryptedCloudStorage(s.storage, keyProvider)
+
+	fileName := s.generateFileName()
+	body := []byte(`{"key": "value"}`)
+
+	err := storage.Write(s.ctx, fileName, body, nil)
+	s.Require().NoError(err)
+
+	rawBody, err := s.storage.Get(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().NotEqual(body, rawBody)
+
+	storedBody, err := storage.Get(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().Equal(body, storedBody)
+
+	attrs, err := storage.Attributes(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().Equal(int64(len(body)), attrs.Size)
+
+	_, err = storage.GetRangeReader(s.ctx, fileName, 0, 1)
+	s.Require().ErrorIs(err, ErrNotSupported)
+
+	// the objects encrypted with the previous key are still readable after the rotation
+	keyProvider.CurrentKeyID = "key2"
+
+	rotatedFileName := s.generateFileName()
+
+	writer, err := storage.GetWriter(s.ctx, rotatedFileName)
+	s.Require().NoError(err)
+
+	_, err = writer.Write(body)
+	s.Require().NoError(err)
+
+	err = writer.Close()
+	s.Require().NoError(err)
+
+	for _, name := range []string{fileName, rotatedFileName} {
+		reader, err := storage.GetReader(s.ctx, name)
+		s.Require().NoError(err)
+
+		storedBody, err := ioutil.ReadAll(reader)
+		s.Require().NoError(err)
+		s.Require().Equal(body, storedBody)
+
+		err = reader.Close()
+		s.Require().NoError(err)
+	}
+}
+
+func (s *Suite) TestWriteIfNotExistsConcurrently() {
+	fileName := s.generateFileName()
+
+	errs := make(chan error, 2)
+
+	for i := 0; i < 2; i++ {
+		go func(i int) {
+			errs <- s.storage.WriteWithOptions(s.ctx, fileName, []byte(fmt.Sprintf(`{"writer": %d}`, i)), &WriteOptions{
+				IfNotExists: true,
+			})
+		}(i)
+	}
+
+	var succeeded, failed int
+
+	for i := 0; i < 2; i++ {
+		err := <-errs
+		if err == nil {
+			succeeded++
+			continue
+		}
+
+		s.Require().ErrorIs(err, ErrPreconditionFailed)
+		failed++
+	}
+
+	s.Require().Equal(1, succeeded)
+	s.Require().Equal(1, failed)
+
+	// the writer also honors the condition
+	writer, err := s.storage.GetWriterWithOptions(s.ctx, fileName, &WriteOptions{IfNotExists: true})
+	s.Require().NoError(err)
+
+	_, err = writer.Write([]byte(`{"writer": 2}`))
+	s.Require().NoError(err)
+
+	err = writer.Close()
+	s.Require().ErrorIs(err, ErrPreconditionFailed)
+}
+
+func (s *Suite) TestWriteConflictingConditions() {
+	fileName := s.generateFileName()
+	opts := &WriteOptions{IfNotExists: true, IfMatchETag: "1"}
+
+	err := s.storage.WriteWithOptions(s.ctx, fileName, []byte(`{"key": "value"}`), opts)
+	s.Require().ErrorIs(err, ErrInvalidArgument)
+
+	_, err = s.storage.GetWriterWithOptions(s.ctx, fileName, opts)
+	s.Require().ErrorIs(err, ErrInvalidArgument)
+
+	exists, err := s.storage.Exists(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().False(exists)
+}
+
+func (s *Suite) TestGetIfModified() {
+	fileName := s.generateFileName()
+	body := []byte(`{"key": "value"}`)
+
+	err := s.storage.Write(s.ctx, fileName, body, nil)
+	s.Require().NoError(err)
+
+	storedBody, attrs, notModified, err := s.storage.GetIfModified(s.ctx, fileName, "", time.Time{})
+	s.Require().NoError(err)
+	s.Require().False(notModified)
+	s.Require().Equal(body, storedBody)
+	s.Require().NotEmpty(attrs.ETag)
+
+	storedBody, notModifiedAttrs, notModified, err := s.storage.GetIfModified(s.ctx, fileName, attrs.ETag, time.Time{})
+	s.Require().NoError(err)
+	s.Require().True(notModified)
+	s.Require().Empty(storedBody)
+	s.Require().Equal(attrs.ETag, notModifiedAttrs.ETag)
+
+	updatedBody := []byte(`{"key": "updated"}`)
+
+	err = s.storage.Write(s.ctx, fileName, updatedBody, nil)
+	s.Require().NoError(err)
+
+	storedBody, updatedAttrs, notModified, err := s.storage.GetIfModified(s.ctx, fileName, attrs.ETag, time.Time{})
+	s.Require().NoError(err)
+	s.Require().False(notModified)
+	s.Require().Equal(updatedBody, storedBody)
+	s.Require().NotEqual(attrs.ETag, updatedAttrs.ETag)
+}
+
+func (s *Suite) TestVersions() {
+	fileName := s.generateFileName()
+	body := []byte(`{"key": "value"}`)
+
+	err := s.storage.Write(s.ctx, fileName, body, nil)
+	s.Require().NoError(err)
+
+	// the test buckets are not versioned, so only the current version is listed
+	iter := s.storage.ListVersions(s.ctx, fileName)
+
+	version, err := iter.Next(s.ctx)
+	s.Require().NoError(err)
+	s.Require().Equal(fileName, version.Key)
+	s.Require().NotEmpty(version.Version)
+	s.Require().Equal(int64(len(body)), version.Size)
+	s.Require().True(version.IsLatest)
+	s.Require().False(version.IsDeleteMarker)
+
+	_, err = iter.Next(s.ctx)
+	s.Require().Equal(io.EOF, err)
+
+	storedBody, err := s.storage.GetVersion(s.ctx, fileName, version.Version)
+	s.Require().NoError(err)
+	s.Require().Equal(body, storedBody)
+
+	err = s.storage.DeleteVersion(s.ctx, fileName, version.Version)
+	s.Require().NoError(err)
+
+	exists, err := s.storage.Exists(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().False(exists)
+}
+
+func (s *Suite) TestRestore() {
+	fileName := s.generateFileName()
+
+	err := s.storage.Write(s.ctx, fileName, []byte(`{"key": "value"}`), nil)
+	s.Require().NoError(err)
+
+	// the object isn't archived, so it's a no-op
+	err = s.storage.Restore(s.ctx, fileName, 1, "")
+	s.Require().NoError(err)
+
+	state, err := s.storage.RestoreStatus(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().False(state.Archived)
+	s.Require().False(state.InProgress)
+	s.Require().True(state.Readable)
+
+	err = s.storage.Restore(s.ctx, s.generateFileName(), 1, "")
+	s.Require().ErrorIs(err, ErrNotFound)
+}
+
+func (s *Suite) TestAppend() {
+	fileName := s.generateFileName()
+
+	// the object is created by the first append
+	err := s.storage.Append(s.ctx, fileName, []byte("line 1\n"))
+	s.Require().NoError(err)
+
+	err = s.storage.Append(s.ctx, fileName, []byte("line 2\n"))
+	s.Require().NoError(err)
+
+	body, err := s.storage.Get(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().Equal("line 1\nline 2\n", string(body))
+
+	// the temporary objects are removed
+	var keys []string
+
+	iter := s.storage.List(s.ctx, fileName)
+
+	for {
+		object, err := iter.Next(s.ctx)
+		if err == io.EOF {
+			break
+		}
+
+		s.Require().NoError(err)
+
+		keys = append(keys, object.Key)
+	}
+
+	s.Require().Equal([]string{fileName}, keys)
+}
+
+func (s *Suite) TestUpdateAttributes() {
+	fileName := s.generateFileName()
+	body := []byte(`{"key": "value"}`)
+
+	err := s.storage.WriteWithOptions(s.ctx, fileName, body, &WriteOptions{
+		ContentType: "application/json",
+		Metadata:    map[string]string{"owner": "test"},
+	})
+	s.Require().NoError(err)
+
+	attrs, err := s.storage.UpdateAttributes(s.ctx, fileName, AttributeUpdate{
+		CacheControl: "no-cache",
+		Metadata:     map[string]string{"reviewed": "true"},
+	})
+	s.Require().NoError(err)
+	s.Require().Equal("no-cache", attrs.CacheControl)
+	s.Require().Equal("application/json", attrs.ContentType)
+	s.Require().Equal(map[string]string{"owner": "test", "reviewed": "true"}, attrs.Metadata)
+
+	storedBody, err := s.storage.Get(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().Equal(body, storedBody)
+
+	_, err = s.storage.UpdateAttributes(s.ctx, s.generateFileName(), AttributeUpdate{CacheControl: "no-cache"})
+	s.Require().ErrorIs(err, ErrNotFound)
+}
+
+func (s *Suite) TestGetWithAttributes() {
+	fileName := s.generateFileName()
+	body := []byte(`{"key": "value"}`)
+
+	err := s.storage.WriteWithOptions(s.ctx, fileName, body, &WriteOptions{
+		ContentType: "application/json",
+		Metadata:    map[string]string{"owner": "test"},
+	})
+	s.Require().NoError(err)
+
+	storedBody, attrs, err := s.storage.GetWithAttributes(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().Equal(body, storedBody)
+	s.Require().Equal("application/json", attrs.ContentType)
+	s.Require().Equal(int64(len(body)), attrs.Size)
+	s.Require().Equal(map[string]string{"owner": "test"}, attrs.Metadata)
+	s.Require().NotEmpty(attrs.ETag)
+	s.Require().False(attrs.ModTime.IsZero())
+
+	_, _, err = s.storage.GetWithAttributes(s.ctx, s.generateFileName())
+	s.Require().ErrorIs(err, ErrNotFound)
+}
+
+func (s *Suite) TestListWithAttributes() {
+	prefix := s.bucketPrefix + "/" + uuid.New().String() + "/"
+	keys := []string{prefix + "a.json", prefix + "b.json", prefix + "c.json"}
+
+	for _, key := range keys {
+		err := s.storage.WriteWithOptions(s.ctx, key, []byte(`{"key": "value"}`), &WriteOptions{
+			ContentType: "application/json",
+			Metadata:    map[string]string{"key": key},
+		})
+		s.Require().NoError(err)
+	}
+
+	list := s.storage.ListWithOptions(s.ctx, &ListOptions{
+		Prefix:                prefix,
+		IncludeAttributes:     true,
+		AttributesConcurrency: 2,
+	})
+
+	var listedKeys []string
+
+	for {
+		item, err := list.Next(s.ctx)
+		if err == io.EOF {
+			break
+		}
+
+		s.Require().NoError(err)
+		s.Require().Equal("application/json", item.ContentType)
+		s.Require().Equal(map[string]string{"key": item.Key}, item.Metadata)
+
+		listedKeys = append(listedKeys, item.Key)
+	}
+
+	s.Require().Equal(keys, listedKeys)
+}
+
+func (s *Suite) listKeys(options *ListOptions) []string {
+	var keys []string
+
+	list := s.storage.ListWithOptions(s.ctx, options)
+
+	for {
+		item, err := list.Next(s.ctx)
+		if err == io.EOF {
+			return keys
+		}
+
+		s.Require().NoError(err)
+
+		keys = append(keys, item.Key)
+	}
+}
+
+func (s *Suite) TestListWithStartAfter() {
+	prefix := s.bucketPrefix + "/" + uuid.New().String() + "/"
+	keys := []string{prefix + "a", prefix + "b", prefix + "c", prefix + "dir/x", prefix + "dir/y", prefix + "e"}
+
+	for _, key := range keys {
+		err := s.storage.Write(s.ctx, key, []byte(`{"key": "value"}`), nil)
+		s.Require().NoError(err)
+	}
+
+	// resuming mid-way has no duplicates nor gaps
+	var resumed []string
+
+	list := s.storage.ListWithOptions(s.ctx, &ListOptions{Prefix: prefix})
+
+	for i := 0; i < 2; i++ {
+		item, err := list.Next(s.ctx)
+		s.Require().NoError(err)
+
+		resumed = append(resumed, item.Key)
+	}
+
+	resumed = append(resumed, s.listKeys(&ListOptions{Prefix: prefix, StartAfter: resumed[1]})...)
+	s.Require().Equal(keys, resumed)
+
+	// with a delimiter, a returned directory is skipped as a whole when resuming after it
+	s.Require().Equal(
+		[]string{prefix + "c", prefix + "dir/", prefix + "e"},
+		s.listKeys(&ListOptions{Prefix: prefix, Delimiter: "/", StartAfter: prefix + "b"}),
+	)
+	s.Require().Equal(
+		[]string{prefix + "e"},
+		s.listKeys(&ListOptions{Prefix: prefix, Delimiter: "/", StartAfter: prefix + "dir/"}),
+	)
+}
+
+func (s *Suite) TestListChan() {
+	prefix := s.bucketPrefix + "/" + uuid.New().String() + "/"
+	keys := []string{prefix + "a", prefix + "b", prefix + "c"}
+
+	for _, key := range keys {
+		err := s.storage.Write(s.ctx, key, []byte(`{"key": "value"}`), nil)
+		s.Require().NoError(err)
+	}
+
+	objects, errs := ListChan(s.ctx, s.storage, &ListOptions{Prefix: prefix})
+
+	var listedKeys []string
+	for object := range objects {
+		listedKeys = append(listedKeys, object.Key)
+	}
+
+	s.Require().NoError(<-errs)
+	s.Require().Equal(keys, listedKeys)
+
+	// the listing stops when the context is canceled, even if the results are not read
+	ctx, cancel := context.WithCancel(s.ctx)
+	objects, errs = ListChan(ctx, s.storage, &ListOptions{Prefix: prefix})
+	cancel()
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			s.Require().ErrorIs(err, context.Canceled)
+		}
+	case <-time.After(10 * time.Second):
+		s.Fail("the listing didn't stop")
+	}
+
+	// the objects channel is closed as well, after the results buffered before the cancellation
+	for range objects {
+	}
+}
+
+func (s *Suite) TestListWithMaxResults() {
+	prefix := s.bucketPrefix + "/" + uuid.New().String() + "/"
+	keys := []string{prefix + "a", prefix + "b", prefix + "dir/x", prefix + "dir/y", prefix + "e"}
+
+	for _, key := range keys {
+		err := s.storage.Write(s.ctx, key, []byte(`{"key": "value"}`), nil)
+		s.Require().NoError(err)
+	}
+
+	s.Require().Equal(keys[:2], s.listKeys(&ListOptions{Prefix: prefix, MaxResults: 2}))
+	s.Require().Equal(keys, s.listKeys(&ListOptions{Prefix: prefix, MaxResults: 10}))
+
+	// the directories count toward the limit
+	s.Require().Equal(
+		[]string{prefix + "a", prefix + "b", prefix + "dir/"},
+		s.listKeys(&ListOptions{Prefix: prefix, Delimiter: "/", MaxResults: 3}),
+	)
+
+	// the attributes are only read for the returned objects
+	s.Require().Equal(
+		keys[:1],
+		s.listKeys(&ListOptions{Prefix: prefix, MaxResults: 1, IncludeAttributes: true}),
+	)
+}
+
+func (s *Suite) TestWalkPrefix() {
+	prefix := s.bucketPrefix + "/" + uuid.New().String() + "/"
+	keys := []string{prefix + "a", prefix + "dir/b", prefix + "dir/nested/c"}
+
+	for _, key := range keys {
+		err := s.storage.Write(s.ctx, key, []byte(`{"key": "value"}`), nil)
+		s.Require().NoError(err)
+	}
+
+	var walked []string
+
+	err := WalkPrefix(s.ctx, s.storage, prefix, func(object *ListObject) error {
+		walked = append(walked, object.Key)
+		return nil
+	})
+	s.Require().NoError(err)
+	s.Require().Equal(keys, walked)
+
+	// SkipAll stops the walk without error
+	walked = nil
+	err = WalkPrefix(s.ctx, s.storage, prefix, func(object *ListObject) error {
+		walked = append(walked, object.Key)
+		return SkipAll
+	})
+	s.Require().NoError(err)
+	s.Require().Equal(keys[:1], walked)
+
+	// the other errors are returned
+	errStop := errors.New("stop")
+	walked = nil
+	err = WalkPrefix(s.ctx, s.storage, prefix, func(object *ListObject) error {
+		walked = append(walked, object.Key)
+		if len(walked) == 2 {
+			return errStop
+		}
+		return nil
+	})
+	s.Require().ErrorIs(err, errStop)
+	s.Require().Equal(keys[:2], walked)
+
+	// the walk is aborted when the context is canceled
+	ctx, cancel := context.WithCancel(s.ctx)
+	walked = nil
+	err = WalkPrefix(ctx, s.storage, prefix, func(object *ListObject) error {
+		walked = append(walked, object.Key)
+		cancel()
+		return nil
+	})
+	s.Require().ErrorIs(err, context.Canceled)
+	s.Require().Equal(keys[:1], walked)
+}
+
+func (s *Suite) TestPrefixedStorage() {
+	prefix := s.bucketPrefix + "/" + uuid.New().String()
+	storage := NewPrefixedStorage(s.storage, prefix)
+	body := []byte(`{"key": "value"}`)
+
+	err := storage.Write(s.ctx, "dir/a.json", body, nil)
+	s.Require().NoError(err)
+
+	// the object is written under the prefix
+	storedBody, err := s.storage.Get(s.ctx, prefix+"/dir/a.json")
+	s.Require().NoError(err)
+	s.Require().Equal(body, storedBody)
+
+	storedBody, err = storage.Get(s.ctx, "dir/a.json")
+	s.Require().NoError(err)
+	s.Require().Equal(body, storedBody)
+
+	err = storage.Copy(s.ctx, "dir/b.json", "dir/a.json")
+	s.Require().NoError(err)
+
+	var keys []string
+
+	list := storage.List(s.ctx, "dir/")
+
+	for {
+		item, err := list.Next(s.ctx)
+		if err == io.EOF {
+			break
+		}
+
+		s.Require().NoError(err)
+
+		keys = append(keys, item.Key)
+	}
+
+	s.Require().Equal([]string{"dir/a.json", "dir/b.json"}, keys)
+
+	for _, key := range []string{"", "../escape.json", "dir/../../escape.json", "./a.json"} {
+		err = storage.Write(s.ctx, key, body, nil)
+		s.Require().ErrorIs(err, ErrInvalidArgument, key)
+	}
+
+	_, err = storage.List(s.ctx, "../").Next(s.ctx)
+	s.Require().ErrorIs(err, ErrInvalidArgument)
+
+	err = storage.DeleteBatch(s.ctx, []string{"dir/a.json", "dir/b.json"})
+	s.Require().NoError(err)
+
+	exists, err := s.storage.Exists(s.ctx, prefix+"/dir/a.json")
+	s.Require().NoError(err)
+	s.Require().False(exists)
+}
+
+func (s *Suite) TestExistsMulti() {
+	existingKeys := []string{s.generateFileName(), s.generateFileName()}
+	missingKey := s.generateFileName()
+
+	for _, key := range existingKeys {
+		err := s.storage.Write(s.ctx, key, []byte(`{"key": "value"}`), nil)
+		s.Require().NoError(err)
+	}
+
+	// the duplicate keys are checked once
+	exists, err := ExistsMulti(s.ctx, s.storage, []string{missingKey, existingKeys[1], existingKeys[0], existingKeys[1]})
+	s.Require().NoError(err)
+	s.Require().Equal(map[string]bool{
+		existingKeys[0]: true,
+		existingKeys[1]: true,
+		missingKey:      false,
+	}, exists)
+
+	exists, err = ExistsMulti(s.ctx, s.storage, nil)
+	s.Require().NoError(err)
+	s.Require().Empty(exists)
+}
+
+func (s *Suite) TestGetMulti() {
+	keys := []string{s.generateFileName(), s.generateFileName()}
+	missingKey := s.generateFileName()
+
+	for _, key := range keys {
+		err := s.storage.Write(s.ctx, key, []byte(key), nil)
+		s.Require().NoError(err)
+	}
+
+	bodies, err := GetMulti(s.ctx, s.storage, []string{keys[0], missingKey, keys[1]})
+
+	var batchErr *BatchError
+	s.Require().ErrorAs(err, &batchErr)
+	s.Require().Len(batchErr.Errors, 1)
+	s.Require().ErrorIs(batchErr.Errors[missingKey], ErrNotFound)
+	s.Require().Equal(map[string][]byte{
+		keys[0]: []byte(keys[0]),
+		keys[1]: []byte(keys[1]),
+	}, bodies)
+
+	// only one of the objects fits in the limit
+	bodies, err = GetMultiWithOptions(s.ctx, s.storage, keys, &GetMultiOptions{MaxTotalBytes: int64(len(keys[0]) + 1)})
+	s.Require().ErrorAs(err, &batchErr)
+	s.Require().Len(batchErr.Errors, 1)
+	s.Require().Len(bodies, 1)
+
+	for _, keyErr := range batchErr.Errors {
+		s.Require().ErrorIs(keyErr, ErrLimitExceeded)
+	}
+}
+
+func (s *Suite) TestWriteMulti() {
+	objects := []WriteRequest{
+		{Key: s.generateFileName(), Body: []byte(`{"key": "value1"}`)},
+		{Key: s.generateFileName(), Body: []byte(`{"key": "value2"}`), Options: &WriteOptions{ContentType: "application/json"}},
+	}
+
+	err := WriteMulti(s.ctx, s.storage, objects)
+	s.Require().NoError(err)
+
+	for _, object := range objects {
+		body, err := s.storage.Get(s.ctx, object.Key)
+		s.Require().NoError(err)
+		s.Require().Equal(object.Body, body)
+	}
+
+	attrs, err := s.storage.Attributes(s.ctx, objects[1].Key)
+	s.Require().NoError(err)
+	s.Require().Equal("application/json", attrs.ContentType)
+
+	err = WriteMulti(s.ctx, s.storage, append(objects, objects[0]))
+	s.Require().ErrorIs(err, ErrInvalidArgument)
+
+	// no write is started once the context is canceled
+	ctx, cancel := context.WithCancel(s.ctx)
+	cancel()
+
+	canceled := []WriteRequest{{Key: s.generateFileName(), Body: []byte(`{"key": "value"}`)}}
+
+	err = WriteMulti(ctx, s.storage, canceled)
+
+	var batchErr *BatchError
+	s.Require().ErrorAs(err, &batchErr)
+	s.Require().ErrorIs(batchErr.Errors[canceled[0].Key], context.Canceled)
+
+	exists, err := s.storage.Exists(s.ctx, canceled[0].Key)
+	s.Require().NoError(err)
+	s.Require().False(exists)
+}
+
+func (s *Suite) TestDownloadToFileAndUploadFromFile() {
+	dir, err := ioutil.TempDir("", "common-blob-go")
+	s.Require().NoError(err)
+
+	defer os.RemoveAll(dir)
+
+	uploadPath := filepath.Join(dir, "upload.json")
+	body := []byte(`{"key": "value"}`)
+
+	err = ioutil.WriteFile(uploadPath, body, 0600)
+	s.Require().NoError(err)
+
+	key := s.generateFileName()
+
+	err = UploadFromFile(s.ctx, s.storage, key, uploadPath, nil)
+	s.Require().NoError(err)
+
+	attrs, err := s.storage.Attributes(s.ctx, key)
+	s.Require().NoError(err)
+	s.Require().Equal("application/json", attrs.ContentType)
+
+	// the parent directories are created
+	downloadPath := filepath.Join(dir, "nested", "download.json")
+
+	err = DownloadToFile(s.ctx, s.storage, key, downloadPath)
+	s.Require().NoError(err)
+
+	downloaded, err := ioutil.ReadFile(downloadPath)
+	s.Require().NoError(err)
+	s.Require().Equal(body, downloaded)
+
+	// the downloaded file has the permissions of the created files
+	created, err := os.Create(filepath.Join(dir, "created.json"))
+	s.Require().NoError(err)
+	s.Require().NoError(created.Close())
+
+	createdInfo, err := os.Stat(created.Name())
+	s.Require().NoError(err)
+
+	downloadedInfo, err := os.Stat(downloadPath)
+	s.Require().NoError(err)
+	s.Require().Equal(createdInfo.Mode(), downloadedInfo.Mode())
+
+	// no file is left when the object is missing
+	missingPath := filepath.Join(dir, "missing.json")
+
+	err = DownloadToFile(s.ctx, s.storage, s.generateFileName(), missingPath)
+	s.Require().ErrorIs(err, ErrNotFound)
+
+	_, err = os.Stat(missingPath)
+	s.Require().True(os.IsNotExist(err))
+
+	// no object is written when the context is canceled
+	ctx, cancel := context.WithCancel(s.ctx)
+	cancel()
+
+	canceledKey := s.generateFileName()
+
+	err = UploadFromFile(ctx, s.storage, canceledKey, uploadPath, nil)
+	s.Require().Error(err)
+
+	exists, err := s.storage.Exists(s.ctx, canceledKey)
+	s.Require().NoError(err)
+	s.Require().False(exists)
+}
+
+func (s *Suite) TestUploadDirectoryAndDownloadPrefix() {
+	dir, err := ioutil.TempDir("", "common-blob-go")
+	s.Require().NoError(err)
+
+	defer os.RemoveAll(dir)
+
+	uploadDir := filepath.Join(dir, "upload")
+	files := map[string][]byte{
+		"a.txt":         []byte("a"),
+		"nested/b.json": []byte(`{"key": "value"}`),
+	}
+
+	for relPath, body := range files {
+		path := filepath.Join(uploadDir, filepath.FromSlash(relPath))
+		s.Require().NoError(os.MkdirAll(filepath.Dir(path), 0700))
+		s.Require().NoError(ioutil.WriteFile(path, body, 0600))
+	}
+
+	// the symlinks are skipped
+	s.Require().NoError(os.Symlink(filepath.Join(uploadDir, "a.txt"), filepath.Join(uploadDir, "link.txt")))
+
+	prefix := s.bucketPrefix + "/" + uuid.New().String()
+
+	var progress []SyncProgress
+
+	options := &SyncOptions{
+		Concurrency: 2,
+		Progress: func(p SyncProgress) {
+			progress = append(progress, p)
+		},
+	}
+
+	err = UploadDirectory(s.ctx, s.storage, uploadDir, prefix, options)
+	s.Require().NoError(err)
+	s.Require().ElementsMatch([]string{prefix + "/a.txt", prefix + "/nested/b.json"}, s.listKeys(&ListOptions{Prefix: prefix + "/"}))
+	s.Require().Len(progress, 2)
+	s.Require().Equal(2, progress[1].Completed)
+	s.Require().Equal(2, progress[1].Total)
+
+	downloadDir := filepath.Join(dir, "download")
+
+	err = DownloadPrefix(s.ctx, s.storage, prefix, downloadDir, nil)
+	s.Require().NoError(err)
+
+	for relPath, body := range files {
+		downloaded, err := ioutil.ReadFile(filepath.Join(downloadDir, filepath.FromSlash(relPath)))
+		s.Require().NoError(err)
+		s.Require().Equal(body, downloaded)
+	}
+
+	// the unchanged files are not transferred again
+	progress = nil
+	options.SkipUnchanged = true
+
+	err = UploadDirectory(s.ctx, s.storage, uploadDir, prefix, options)
+	s.Require().NoError(err)
+
+	for _, p := range progress {
+		s.Require().True(p.Skipped, p.Key)
+	}
+
+	progress = nil
+
+	err = DownloadPrefix(s.ctx, s.storage, prefix, downloadDir, options)
+	s.Require().NoError(err)
+	s.Require().Len(progress, 2)
+
+	for _, p := range progress {
+		s.Require().True(p.Skipped, p.Key)
+	}
+}
+
+func (s *Suite) TestCopyObjectBetween() {
+	srcKey := s.generateFileName()
+	body := []byte(`{"key": "value"}`)
+
+	err := s.storage.WriteWithOptions(s.ctx, srcKey, body, &WriteOptions{
+		ContentType: "application/json",
+		Metadata:    map[string]string{"owner": "test"},
+	})
+	s.Require().NoError(err)
+
+	// copied by the provider within the same bucket
+	dstKey := s.generateFileName()
+
+	err = CopyObjectBetween(s.ctx, s.storage, srcKey, s.storage, dstKey)
+	s.Require().NoError(err)
+
+	copied, err := s.storage.Get(s.ctx, dstKey)
+	s.Require().NoError(err)
+	s.Require().Equal(body, copied)
+
+	// streamed into another storage, encrypted here
+	keyProvider := &StaticKeyProvider{
+		CurrentKeyID: "key1",
+		Keys: map[string][]byte{
+			"key1": []byte("0123456789abcdef0123456789abcdef"),
+		},
+	}
+	encrypted := NewEncryptedCloudStorage(s.storage, keyProvider)
+	encryptedKey := s.generateFileName()
+
+	err = CopyObjectBetween(s.ctx, s.storage, srcKey, encrypted, encryptedKey)
+	s.Require().NoError(err)
+
+	copied, attrs, err := encrypted.GetWithAttributes(s.ctx, encryptedKey)
+	s.Require().NoError(err)
+	s.Require().Equal(body, copied)
+	s.Require().Equal("application/json", attrs.ContentType)
+	s.Require().Equal("test", attrs.Metadata["owner"])
+
+	// and back, without the encryption metadata
+	decryptedKey := s.generateFileName()
+
+	err = CopyObjectBetween(s.ctx, encrypted, encryptedKey, s.storage, decryptedKey)
+	s.Require().NoError(err)
+
+	copied, attrs, err = s.storage.GetWithAttributes(s.ctx, decryptedKey)
+	s.Require().NoError(err)
+	s.Require().Equal(body, copied)
+	s.Require().NotContains(attrs.Metadata, encryptionKeyIDMetadataKey)
+
+	err = CopyObjectBetween(s.ctx, encrypted, s.generateFileName(), s.storage, s.generateFileName())
+	s.Require().ErrorIs(err, ErrNotFound)
+}
+
+func (s *Suite) TestSyncPrefix() {
+	srcPrefix := s.bucketPrefix + "/" + uuid.New().String()
+	dstPrefix := s.bucketPrefix + "/" + uuid.New().String()
+
+	src := map[string]string{"a": "a", "b": "b", "dir/c": "c"}
+	for key, body := range src {
+		s.Require().NoError(s.storage.Write(s.ctx, srcPrefix+"/"+key, []byte(body), nil))
+	}
+
+	// b is unchanged, dir/c is changed and d is extraneous
+	dst := map[string]string{"b": "b", "dir/c": "changed", "d": "d"}
+	for key, body := range dst {
+		s.Require().NoError(s.storage.Write(s.ctx, dstPrefix+"/"+key, []byte(body), nil))
+	}
+
+	options := &SyncOptions{
+		DeleteExtraneous: true,
+		DryRun:           true,
+	}
+
+	report, err := SyncPrefix(s.ctx, s.storage, srcPrefix, s.storage, dstPrefix, options)
+	s.Require().NoError(err)
+	s.Require().Equal(&SyncReport{Copied: 2, Skipped: 1, Deleted: 1, Errors: map[string]error{}}, report)
+
+	// nothing is changed in dry-run mode
+	body, err := s.storage.Get(s.ctx, dstPrefix+"/dir/c")
+	s.Require().NoError(err)
+	s.Require().Equal([]byte("changed"), body)
+	s.Require().Len(s.listKeys(&ListOptions{Prefix: dstPrefix + "/"}), 3)
+
+	options.DryRun = false
+
+	report, err = SyncPrefix(s.ctx, s.storage, srcPrefix, s.storage, dstPrefix, options)
+	s.Require().NoError(err)
+	s.Require().Equal(&SyncReport{Copied: 2, Skipped: 1, Deleted: 1, Errors: map[string]error{}}, report)
+
+	s.Require().ElementsMatch(
+		[]string{dstPrefix + "/a", dstPrefix + "/b", dstPrefix + "/dir/c"},
+		s.listKeys(&ListOptions{Prefix: dstPrefix + "/"}))
+
+	for key, srcBody := range src {
+		body, err := s.storage.Get(s.ctx, dstPrefix+"/"+key)
+		s.Require().NoError(err)
+		s.Require().Equal([]byte(srcBody), body)
+	}
+
+	// everything is unchanged now
+	report, err = SyncPrefix(s.ctx, s.storage, srcPrefix, s.storage, dstPrefix, options)
+	s.Require().NoError(err)
+	s.Require().Equal(&SyncReport{Skipped: 3, Errors: map[string]error{}}, report)
+}
+
+func (s *Suite) TestGetSize() {
+	fileName := s.generateFileName()
+	body := []byte(`{"key": "value"}`)
+
+	err := s.storage.Write(s.ctx, fileName, body, nil)
+	s.Require().NoError(err)
+
+	size, err := s.storage.GetSize(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().Equal(int64(len(body)), size)
+
+	_, err = s.storage.GetSize(s.ctx, s.generateFileName())
+	s.Require().ErrorIs(err, ErrNotFound)
+}
+
+func (s *Suite) TestVerifyChecksum() {
+	body := []byte(`{"key": "value"}`)
+	options := &WriteOptions{VerifyChecksum: true}
+
+	fileName := s.generateFileName()
+
+	err := s.storage.WriteWithOptions(s.ctx, fileName, body, options)
+	s.Require().NoError(err)
+
+	written, err := s.storage.Get(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().Equal(body, written)
+
+	streamedFileName := s.generateFileName()
+
+	writer, err := s.storage.GetWriterWithOptions(s.ctx, streamedFileName, options)
+	s.Require().NoError(err)
+
+	_, err = writer.Write(body)
+	s.Require().NoError(err)
+	s.Require().NoError(writer.Close())
+
+	written, err = s.storage.Get(s.ctx, streamedFileName)
+	s.Require().NoError(err)
+	s.Require().Equal(body, written)
+
+	err = verifyWrittenMD5(s.ctx, s.storage, streamedFileName, md5Sum([]byte("corrupted")))
+	s.Require().ErrorIs(err, ErrChecksumMismatch)
+}
+
+func (s *Suite) TestChecksumAlgorithm() {
+	body := []byte(`{"key": "value"}`)
+	fileName := s.generateFileName()
+
+	err := s.storage.WriteWithOptions(s.ctx, fileName, body, &WriteOptions{ChecksumAlgorithm: ChecksumCRC32C})
+	s.Require().NoError(err)
+
+	attrs, err := s.storage.Attributes(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().True(attrs.HasCRC32C)
+	s.Require().Equal(crc32.Checksum(body, crc32cTable), attrs.CRC32C)
+
+	err = s.storage.VerifyDownload(s.ctx, fileName)
+	s.Require().NoError(err)
+
+	sha256FileName := s.generateFileName()
+
+	err = s.storage.WriteWithOptions(s.ctx, sha256FileName, body, &WriteOptions{ChecksumAlgorithm: ChecksumSHA256})
+	if s.bucketProvider == "gcp" {
+		s.Require().ErrorIs(err, ErrNotSupported)
+	} else {
+		s.Require().NoError(err)
+
+		attrs, err = s.storage.Attributes(s.ctx, sha256FileName)
+		s.Require().NoError(err)
+
+		sum := sha256.Sum256(body)
+		s.Require().Equal(sum[:], attrs.SHA256)
+
+		err = s.storage.VerifyDownload(s.ctx, sha256FileName)
+		s.Require().NoError(err)
+	}
+
+	// the checksum of a streamed write can only be verified after the write on GCS
+	_, err = s.storage.GetWriterWithOptions(s.ctx, s.generateFileName(), &WriteOptions{ChecksumAlgorithm: ChecksumCRC32C})
+	if s.bucketProvider == "gcp" {
+		s.Require().NoError(err)
+	} else {
+		s.Require().ErrorIs(err, ErrNotSupported)
+	}
+}
+
+func (s *Suite) TestCompress() {
+	body := []byte(strings.Repeat(`{"key": "value", "items": [1, 2, 3]}`, 10000))
+	fileName := s.generateFileName()
+
+	err := s.storage.WriteWithOptions(s.ctx, fileName, body, &WriteOptions{ContentType: "application/json", Compress: true})
+	s.Require().NoError(err)
+
+	attrs, err := s.storage.Attributes(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().Equal("gzip", attrs.ContentEncoding)
+	s.Require().Less(attrs.Size, int64(len(body)))
+	s.Require().Equal(fmt.Sprint(len(body)), attrs.Metadata[UncompressedSizeMetadataKey])
+
+	err = s.storage.VerifyDownload(s.ctx, fileName)
+	s.Require().NoError(err)
+
+	content, err := s.storage.Get(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().Equal(body, content)
+
+	content, _, err = s.storage.GetWithAttributes(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().Equal(body, content)
+
+	reader, err := s.storage.GetReader(s.ctx, fileName)
+	s.Require().NoError(err)
+
+	content, err = ioutil.ReadAll(reader)
+	s.Require().NoError(reader.Close())
+	s.Require().NoError(err)
+	s.Require().Equal(body, content)
+
+	streamedFileName := s.generateFileName()
+
+	writer, err := s.storage.GetWriterWithOptions(s.ctx, streamedFileName, &WriteOptions{Compress: true})
+	s.Require().NoError(err)
+
+	_, err = writer.Write(body)
+	s.Require().NoError(err)
+	s.Require().NoError(writer.Close())
+
+	content, err = s.storage.Get(s.ctx, streamedFileName)
+	s.Require().NoError(err)
+	s.Require().Equal(body, content)
+}
+
+func (s *Suite) TestUploadPartSizeAndConcurrency() {
+	options := s.cloudStorageOption()
+	options.UploadPartSizeBytes = 1024
+
+	factory, err := NewCloudStorageFactory(s.ctx, s.isTesting, s.bucketProvider, options)
+	if s.bucketProvider == "gcp" {
+		s.Require().NoError(err)
+		factory.Close()
+	} else {
+		s.Require().ErrorIs(err, ErrInvalidArgument)
+	}
+
+	options.UploadPartSizeBytes = 5 * 1024 * 1024
+	options.UploadConcurrency = 2
+
+	factory, err = NewCloudStorageFactory(s.ctx, s.isTesting, s.bucketProvider, options)
+	s.Require().NoError(err)
+
+	defer factory.Close()
+
+	storage, err := factory.OpenBucket(s.ctx, s.bucketName)
+	s.Require().NoError(err)
+
+	// three parts
+	body := []byte(strings.Repeat("0123456789", 1200*1024))
+	fileName := s.generateFileName()
+
+	writer, err := storage.GetWriterWithOptions(s.ctx, fileName, &WriteOptions{UploadConcurrency: 3})
+	s.Require().NoError(err)
+
+	_, err = writer.Write(body)
+	s.Require().NoError(err)
+	s.Require().NoError(writer.Close())
+
+	size, err := storage.GetSize(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().Equal(int64(len(body)), size)
+}
+
+func (s *Suite) TestUploadProgressAndAbort() {
+	body := []byte(strings.Repeat("0123456789", 1200*1024))
+	fileName := s.generateFileName()
+
+	var progress []int64
+
+	writer, err := s.storage.GetWriterWithOptions(s.ctx, fileName, &WriteOptions{
+		BufferSize:   5 * 1024 * 1024,
+		ProgressFunc: func(bytesWritten int64) { progress = append(progress, bytesWritten) },
+	})
+	s.Require().NoError(err)
+
+	_, err = writer.Write(body[:len(body)/2])
+	s.Require().NoError(err)
+
+	_, err = writer.Write(body[len(body)/2:])
+	s.Require().NoError(err)
+	s.Require().NoError(writer.Close())
+	s.Require().Equal([]int64{int64(len(body) / 2), int64(len(body))}, progress)
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	abortedFileName := s.generateFileName()
+
+	writer, err = s.storage.GetWriterWithOptions(ctx, abortedFileName, &WriteOptions{BufferSize: 5 * 1024 * 1024})
+	s.Require().NoError(err)
+
+	// the first parts are uploaded before the cancellation
+	_, err = writer.Write(body)
+	s.Require().NoError(err)
+
+	cancel()
+	s.Require().Error(writer.Close())
+
+	exists, err := s.storage.Exists(s.ctx, abortedFileName)
+	s.Require().NoError(err)
+	s.Require().False(exists)
+
+	if storage, ok := s.innerStorage().(*AWSTestCloudStorage); ok {
+		uploads, err := storage.client.ListMultipartUploadsWithContext(s.ctx, &s3.ListMultipartUploadsInput{
+			Bucket: aws.String(storage.bucketName),
+			Prefix: aws.String(abortedFileName),
+		})
+		s.Require().NoError(err)
+		s.Require().Empty(uploads.Uploads)
+	}
+}
+
+func (s *Suite) TestGetSignedPostPolicy() {
+	keyPrefix := s.generateFileName() + "/"
+	body := []byte(`{"key": "value"}`)
+
+	policy, err := s.storage.GetSignedPostPolicy(s.ctx, keyPrefix, &PostPolicyOptions{
+		Expiry:           time.Hour,
+		MaxContentLength: 1024,
+		ContentType:      "application/json",
+	})
+	if s.bucketProvider == "gcp" {
+		s.Require().ErrorIs(err, ErrNotSupported)
+
+		return
+	}
+
+	s.Require().NoError(err)
+	s.Require().Equal(keyPrefix+"${filename}", policy.Fields["key"])
+
+	var form bytes.Buffer
+
+	formWriter := multipart.NewWriter(&form)
+
+	for name, value := range policy.Fields {
+		s.Require().NoError(formWriter.WriteField(name, value))
+	}
+
+	fileWriter, err := formWriter.CreateFormFile("file", "upload.json")
+	s.Require().NoError(err)
+
+	_, err = fileWriter.Write(body)
+	s.Require().NoError(err)
+	s.Require().NoError(formWriter.Close())
+
+	response, err := s.httpClient().Post(policy.URL, formWriter.FormDataContentType(), &form) //nolint:noctx
+	s.Require().NoError(err)
+	s.Require().NoError(response.Body.Close())
+	s.Require().Less(response.StatusCode, 300)
+
+	storedBody, err := s.storage.Get(s.ctx, keyPrefix+"upload.json")
+	s.Require().NoError(err)
+	s.Require().Equal(body, storedBody)
+
+	_, err = s.storage.GetSignedPostPolicy(s.ctx, keyPrefix, &PostPolicyOptions{})
+	s.Require().ErrorIs(err, ErrInvalidArgument)
+}
+
+func (s *Suite) TestGetSignedURLResponseOverrides() {
+	if s.bucketProvider == "gcp" {
+		s.T().Skip("the GCS emulator ignores the response header overrides")
+	}
+
+	fileName := s.generateFileName()
+	body := []byte(`{"key": "value"}`)
+
+	err := s.storage.Write(s.ctx, fileName, body, nil)
+	s.Require().NoError(err)
+
+	signedURL, err := s.storage.GetSignedURL(s.ctx, fileName, &SignedURLOption{
+		Expiry:                     time.Hour,
+		Method:                     http.MethodGet,
+		ResponseContentDisposition: `attachment; filename="export.json"`,
+		ResponseContentType:        "application/json",
+	})
+	s.Require().NoError(err)
+	s.Require().Contains(signedURL, "response-content-disposition=")
+
+	response, err := s.httpClient().Get(signedURL) //nolint:noctx
+	s.Require().NoError(err)
+
+	defer response.Body.Close()
+
+	s.Require().Equal(http.StatusOK, response.StatusCode)
+	s.Require().Equal(`attachment; filename="export.json"`, response.Header.Get("Content-Disposition"))
+	s.Require().Equal("application/json", response.Header.Get("Content-Type"))
+
+	_, err = s.storage.GetSignedURL(s.ctx, fileName, &SignedURLOption{
+		Expiry:              time.Hour,
+		Method:              http.MethodPut,
+		ResponseContentType: "application/json",
+	})
+	s.Require().ErrorIs(err, ErrInvalidArgument)
+}
+
+func (s *Suite) TestSignedURLScheme() {
+	options := s.cloudStorageOption()
+	options.SignedURLScheme = "v3"
+
+	_, err := NewCloudStorageFactory(s.ctx, s.isTesting, s.bucketProvider, options)
+	s.Require().ErrorIs(err, ErrInvalidArgument)
+
+	options.SignedURLScheme = SignedURLSchemeV2
+
+	factory, err := NewCloudStorageFactory(s.ctx, s.isTesting, s.bucketProvider, options)
+	s.Require().NoError(err)
+	factory.Close()
+}
+
+func (s *Suite) TestSignedURLHostOverride() {
+	fileName := s.generateFileName()
+
+	signedURL, err := s.storage.GetSignedURL(s.ctx, fileName, &SignedURLOption{
+		Expiry:       time.Hour,
+		Method:       http.MethodGet,
+		HostOverride: "cdn.example.com",
+	})
+	if s.bucketProvider == "gcp" {
+		s.Require().NoError(err)
+		s.Require().True(strings.HasPrefix(signedURL, "https://cdn.example.com/"))
+
+		return
+	}
+
+	// the CloudFront key pair isn't configured
+	s.Require().ErrorIs(err, ErrInvalidArgument)
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	s.Require().NoError(err)
+
+	options := s.cloudStorageOption()
+	options.SignedURLHostOverride = "cdn.example.com"
+	options.CloudFrontKeyID = "APKAEXAMPLE"
+	options.CloudFrontPrivateKey = string(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+	}))
+
+	factory, err := NewCloudStorageFactory(s.ctx, s.isTesting, s.bucketProvider, options)
+	s.Require().NoError(err)
+
+	defer factory.Close()
+
+	storage, err := factory.OpenBucket(s.ctx, s.bucketName)
+	s.Require().NoError(err)
+
+	signedURL, err = storage.GetSignedURL(s.ctx, fileName, &SignedURLOption{Expiry: time.Hour, Method: http.MethodGet})
+	s.Require().NoError(err)
+
+	parsedURL, err := url.Parse(signedURL)
+	s.Require().NoError(err)
+	s.Require().Equal("cdn.example.com", parsedURL.Host)
+	s.Require().Equal("APKAEXAMPLE", parsedURL.Query().Get("Key-Pair-Id"))
+	s.Require().NotEmpty(parsedURL.Query().Get("Signature"))
+
+	// the source IP is signed with a custom policy
+	signedURL, err = storage.GetSignedURL(s.ctx, fileName, &SignedURLOption{
+		Expiry:          time.Hour,
+		Method:          http.MethodGet,
+		AllowedSourceIP: "192.0.2.1",
+	})
+	s.Require().NoError(err)
+
+	parsedURL, err = url.Parse(signedURL)
+	s.Require().NoError(err)
+	s.Require().NotEmpty(parsedURL.Query().Get("Policy"))
+	s.Require().Empty(parsedURL.Query().Get("Expires"))
+
+	_, err = storage.GetSignedURL(s.ctx, fileName, &SignedURLOption{
+		Expiry:          time.Hour,
+		Method:          http.MethodGet,
+		AllowedSourceIP: "not-an-ip",
+	})
+	s.Require().ErrorIs(err, ErrInvalidArgument)
+
+	_, err = storage.GetSignedURL(s.ctx, fileName, &SignedURLOption{
+		Expiry:        time.Hour,
+		Method:        http.MethodGet,
+		SignedHeaders: map[string]string{"Content-Language": "en"},
+	})
+	s.Require().ErrorIs(err, ErrNotSupported)
+}
+
+func (s *Suite) TestSignedURLRestrictions() {
+	fileName := s.generateFileName()
+
+	// the presigned URLs of the providers can't be restricted to a source IP
+	_, err := s.storage.GetSignedURL(s.ctx, fileName, &SignedURLOption{
+		Expiry:          time.Hour,
+		Method:          http.MethodGet,
+		AllowedSourceIP: "192.0.2.0/24",
+	})
+	s.Require().ErrorIs(err, ErrNotSupported)
+
+	signedURL, err := s.storage.GetSignedURL(s.ctx, fileName, &SignedURLOption{
+		Expiry:        time.Hour,
+		Method:        http.MethodPut,
+		SignedHeaders: map[string]string{"Content-Language": "en"},
+	})
+	s.Require().NoError(err)
+
+	parsedURL, err := url.Parse(signedURL)
+	s.Require().NoError(err)
+
+	signedHeaders := parsedURL.Query().Get("X-Amz-SignedHeaders")
+	if s.bucketProvider == "gcp" {
+		signedHeaders = parsedURL.Query().Get("X-Goog-SignedHeaders")
+	}
+
+	s.Require().Contains(strings.Split(signedHeaders, ";"), "content-language")
+}
+
+func (s *Suite) TestPresignedMultipartUpload() {
+	fileName := s.generateFileName()
+
+	uploadID, err := s.storage.StartMultipartUpload(s.ctx, fileName, &WriteOptions{ContentType: "text/plain"})
+	if s.bucketProvider == "gcp" {
+		s.Require().ErrorIs(err, ErrNotSupported)
+
+		return
+	}
+
+	s.Require().NoError(err)
+	s.Require().NotEmpty(uploadID)
+
+	// the parts except the last one are at least 5 MB
+	bodies := [][]byte{
+		[]byte(strings.Repeat("a", 5*1024*1024)),
+		[]byte("the last part"),
+	}
+
+	var parts []CompletedPart
+
+	for i, body := range bodies {
+		partURL, err := s.storage.SignUploadPartURL(s.ctx, fileName, uploadID, i+1, time.Hour)
+		s.Require().NoError(err)
+
+		request, err := http.NewRequestWithContext(s.ctx, http.MethodPut, partURL, bytes.NewReader(body))
+		s.Require().NoError(err)
+
+		response, err := s.httpClient().Do(request)
+		s.Require().NoError(err)
+		response.Body.Close()
+		s.Require().Equal(http.StatusOK, response.StatusCode)
+
+		parts = append(parts, CompletedPart{PartNumber: i + 1, ETag: response.Header.Get("ETag")})
+	}
+
+	// the parts are sorted by number
+	parts[0], parts[1] = parts[1], parts[0]
+
+	s.Require().NoError(s.storage.CompleteMultipartUpload(s.ctx, fileName, uploadID, parts))
+
+	content, err := s.storage.Get(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().Equal(append(append([]byte{}, bodies[0]...), bodies[1]...), content)
+
+	attrs, err := s.storage.Attributes(s.ctx, fileName)
+	s.Require().NoError(err)
+	s.Require().Equal("text/plain", attrs.ContentType)
+
+	_, err = s.storage.SignUploadPartURL(s.ctx, fileName, uploadID, 0, time.Hour)
+	s.Require().ErrorIs(err, ErrInvalidArgument)
+
+	// the aborted upload doesn't create the object
+	abortedFileName := s.generateFileName()
+
+	uploadID, err = s.storage.StartMultipartUpload(s.ctx, abortedFileName, nil)
+	s.Require().NoError(err)
+	s.Require().NoError(s.storage.AbortMultipartUpload(s.ctx, abortedFileName, uploadID))
+
+	err = s.storage.CompleteMultipartUpload(s.ctx, abortedFileName, uploadID, parts)
+	s.Require().ErrorIs(err, ErrNotFound)
+}
+
+func TestGetPublicURL(t *testing.T) {
+	newAWSStorage := func(config *aws.Config) CloudStorage {
+		config.Region = aws.String("us-west-2")
+		config.Credentials = credentials.AnonymousCredentials
+
+		return &AWSCloudStorage{client: s3.New(session.Must(session.NewSession(config))), bucketName: "my-bucket"}
+	}
+
+	testCases := []struct {
+		name     string
+		storage  CloudStorage
+		key      string
+		expected string
+	}{
+		{
+			name:     "S3 virtual-hosted",
+			storage:  newAWSStorage(&aws.Config{}),
+			key:      "dir/file name.json",
+			expected: "https://my-bucket.s3.us-west-2.amazonaws.com/dir/file%20name.json",
+		},
+		{
+			name:     "S3 unicode key",
+			storage:  newAWSStorage(&aws.Config{}),
+			key:      "dir/fichier-été.json",
+			expected: "https://my-bucket.s3.us-west-2.amazonaws.com/dir/fichier-%C3%A9t%C3%A9.json",
+		},
+		{
+			name:     "S3 path-style",
+			storage:  newAWSStorage(&aws.Config{S3ForcePathStyle: aws.Bool(true)}),
+			key:      "dir/file.json",
+			expected: "https://s3.us-west-2.amazonaws.com/my-bucket/dir/file.json",
+		},
+		{
+			name: "S3 custom endpoint",
+			storage: newAWSStorage(&aws.Config{
+				Endpoint:         aws.String("http://localhost:4566"),
+				S3ForcePathStyle: aws.Bool(true),
+			}),
+			key:      "dir/file name.json",
+			expected: "http://localhost:4566/my-bucket/dir/file%20name.json",
+		},
+		{
+			name:     "GCS",
+			storage:  &ExplicitGCPCloudStorage{bucketName: "my-bucket"},
+			key:      "dir/file name?.json",
+			expected: "https://storage.googleapis.com/my-bucket/dir/file%20name%3F.json",
+		},
+		{
+			name:     "GCS unicode key",
+			storage:  &ImplicitGCPCloudStorage{bucketName: "my-bucket"},
+			key:      "dir/fichier-été.json",
+			expected: "https://storage.googleapis.com/my-bucket/dir/fichier-%C3%A9t%C3%A9.json",
+		},
+		{
+			name:     "GCS emulator",
+			storage:  &GCPTestCloudStorage{bucketName: "my-bucket", scheme: "http", host: "localhost:4443"},
+			key:      "dir/file.json",
+			expected: "http://localhost:4443/my-bucket/dir/file.json",
+		},
+		{
+			name:     "prefixed",
+			storage:  NewPrefixedStorage(&ExplicitGCPCloudStorage{bucketName: "my-bucket"}, "tenant"),
+			key:      "file.json",
+			expected: "https://storage.googleapis.com/my-bucket/tenant/file.json",
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			publicURL, err := testCase.storage.GetPublicURL(testCase.key)
+			require.NoError(t, err)
+			require.Equal(t, testCase.expected, publicURL)
+		})
+	}
+
+	_, err := testCases[0].storage.GetPublicURL("")
+	require.ErrorIs(t, err, ErrInvalidArgument)
+}
+
+func TestAWSAccelerate(t *testing.T) {
+	_, err := newAWSConfig("http://localhost:4566", "us-west-2", true, 0)
+	require.ErrorIs(t, err, ErrInvalidArgument)
+
+	config, err := newAWSConfig("", "us-west-2", true, 0)
+	require.NoError(t, err)
+	require.False(t, aws.BoolValue(config.S3ForcePathStyle))
+	require.Nil(t, config.MaxRetries)
+
+	// the storages retry instead of the SDK
+	retryingConfig, err := newAWSConfig("", "us-west-2", true, 3)
+	require.NoError(t, err)
+	require.Equal(t, 0, aws.IntValue(retryingConfig.MaxRetries))
+
+	config.Credentials = credentials.NewStaticCredentials("access-key-id", "secret-access-key", "")
+	ctx := context.Background()
+
+	storage, err := newAWSCloudStorage(ctx, session.Must(session.NewSession(&config)), "my-bucket", "",
+		newStorageOptions(CloudStorageOption{}))
+	require.NoError(t, err)
+
+	for _, method := range []string{http.MethodGet, http.MethodPut} {
+		signedURL, err := storage.GetSignedURL(ctx, "dir/file.json", &SignedURLOption{
+			Method: method,
+			Expiry: time.Minute,
+		})
+		require.NoError(t, err)
+
+		parsedURL, err := url.Parse(signedURL)
+		require.NoError(t, err)
+		require.Equal(t, "my-bucket.s3-accelerate.amazonaws.com", parsedURL.Host)
+		require.Equal(t, "/dir/file.json", parsedURL.Path)
+	}
+
+	publicURL, err := storage.GetPublicURL("dir/file.json")
+	require.NoError(t, err)
+	require.Equal(t, "https://my-bucket.s3-accelerate.amazonaws.com/dir/file.json", publicURL)
+}
+
+func TestCopyAWSObjectMultipartAbort(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var aborted int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost:
+			_, _ = w.Write([]byte(`<InitiateMultipartUploadResult><UploadId>upload-id</UploadId></InitiateMultipartUploadResult>`))
+		case r.Method == http.MethodPut:
+			// the copy is canceled during the first part
+			cancel()
+			w.WriteHeader(http.StatusInternalServerError)
+		case r.Method == http.MethodDelete && r.URL.Query().Get("uploadId") == "upload-id":
+			atomic.AddInt32(&aborted, 1)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	client := s3.New(session.Must(session.NewSession(&aws.Config{
+		Endpoint:         aws.String(server.URL),
+		Region:           aws.String("us-west-2"),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.AnonymousCredentials,
+		MaxRetries:       aws.Int(0),
+	})))
+
+	err := copyAWSObjectMultipart(ctx, client, "my-bucket", "dst.json", "src.json",
+		&blob.Attributes{Size: 6 * 1024 * 1024 * 1024}, "", noopLogger{})
+	require.Error(t, err)
+
+	// the parts are removed although the context of the copy is done
+	require.Equal(t, int32(1), atomic.LoadInt32(&aborted))
+}
+
+func TestSetAWSStorageClassMultipart(t *testing.T) {
+	var (
+		mu           sync.Mutex
+		storageClass string
+		copySources  []string
+		completed    bool
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case r.Method == http.MethodHead:
+			w.Header().Set("Content-Length", fmt.Sprint(6*1024*1024*1024))
+			w.Header().Set("ETag", `"etag"`)
+		case r.Method == http.MethodPost && r.URL.Query().Get("uploadId") == "":
+			storageClass = r.Header.Get("X-Amz-Storage-Class")
+			_, _ = w.Write([]byte(`<InitiateMultipartUploadResult><UploadId>upload-id</UploadId></InitiateMultipartUploadResult>`))
+		case r.Method == http.MethodPut:
+			assert.Equal(t, `"etag"`, r.Header.Get("X-Amz-Copy-Source-If-Match"))
+			copySources = append(copySources, r.Header.Get("X-Amz-Copy-Source"))
+			_, _ = w.Write([]byte(`<CopyPartResult><ETag>"part"</ETag></CopyPartResult>`))
+		case r.Method == http.MethodPost:
+			completed = true
+			_, _ = w.Write([]byte(`<CompleteMultipartUploadResult><ETag>"etag-12"</ETag></CompleteMultipartUploadResult>`))
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer server.Close()
+
+	client := s3.New(session.Must(session.NewSession(&aws.Config{
+		Endpoint:         aws.String(server.URL),
+		Region:           aws.String("us-west-2"),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.AnonymousCredentials,
+		MaxRetries:       aws.Int(0),
+	})))
+
+	// the object is too big for CopyObject
+	err := setAWSStorageClass(context.Background(), client, "my-bucket", "dir/file.bin", s3.StorageClassGlacierIr,
+		noopLogger{})
+	require.NoError(t, err)
+	require.Equal(t, s3.StorageClassGlacierIr, storageClass)
+	require.Len(t, copySources, 12)
+	require.Equal(t, "my-bucket/dir/file.bin", copySources[0])
+	require.True(t, completed)
+}
+
+func TestAppendAWSObjectAbort(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var aborted int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodHead:
+			w.Header().Set("Content-Length", fmt.Sprint(awsMinPartSize))
+			w.Header().Set("ETag", `"etag"`)
+		case r.Method == http.MethodPost:
+			_, _ = w.Write([]byte(`<InitiateMultipartUploadResult><UploadId>upload-id</UploadId></InitiateMultipartUploadResult>`))
+		case r.Method == http.MethodPut:
+			// the append is canceled during the copy of the object
+			cancel()
+			w.WriteHeader(http.StatusInternalServerError)
+		case r.Method == http.MethodDelete && r.URL.Query().Get("uploadId") == "upload-id":
+			atomic.AddInt32(&aborted, 1)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	client := s3.New(session.Must(session.NewSession(&aws.Config{
+		Endpoint:         aws.String(server.URL),
+		Region:           aws.String("us-west-2"),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.AnonymousCredentials,
+		MaxRetries:       aws.Int(0),
+	})))
+
+	err := appendAWSObject(ctx, client, "my-bucket", "file.log", []byte("appended"), "", noopLogger{})
+	require.Error(t, err)
+
+	// the parts are removed although the context of the append is done
+	require.Equal(t, int32(1), atomic.LoadInt32(&aborted))
+}
+
+func TestDebugHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = ioutil.ReadAll(r.Body)
+
+		w.Header().Set("X-Amz-Request-Id", "request-id")
+		w.Header().Set("ETag", `"etag"`)
+
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte("0123456789"))
+		}
+	}))
+	defer server.Close()
+
+	logger := &recordingLogger{logs: map[string][]string{}}
+	options := newStorageOptions(CloudStorageOption{Logger: logger, DebugHTTP: true, DebugHTTPBodyLimit: 4})
+	debugger := newHTTPDebugger(options)
+
+	require.Nil(t, newHTTPDebugger(newStorageOptions(CloudStorageOption{})))
+
+	awsSession, err := newAWSSession(server.URL, "us-west-2", false, 0, 0, 0, debugger)
+	require.NoError(t, err)
+
+	awsSession.Config.Credentials = credentials.NewStaticCredentials("access-key-id", "secret-access-key", "")
+	ctx := context.Background()
+
+	storage, err := newAWSCloudStorage(ctx, awsSession, "my-bucket", "", options)
+	require.NoError(t, err)
+
+	// the body is still read whole
+	body, err := storage.Get(ctx, "dir/file.json")
+	require.NoError(t, err)
+	require.Equal(t, "0123456789", string(body))
+
+	require.NoError(t, storage.Write(ctx, "dir/file.json", []byte("user data"), nil))
+
+	signedURL, err := storage.GetSignedURL(ctx, "dir/file.json", &SignedURLOption{Method: http.MethodGet})
+	require.NoError(t, err)
+
+	resp, err := newProviderHTTPClient(debugger).Get(signedURL)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	logs := strings.Join(logger.logs["debug"], "\n")
+	require.Contains(t, logs, "HTTP GET "+server.URL+"/my-bucket/dir/file.json")
+	require.Contains(t, logs, "200 OK")
+	require.Contains(t, logs, "request IDs: [X-Amz-Request-Id=request-id]")
+	require.Contains(t, logs, `response body: "0123"`)
+	require.Contains(t, logs, "X-Amz-Signature=REDACTED")
+	require.Contains(t, logs, "X-Amz-Credential=REDACTED")
+	require.NotContains(t, logs, "access-key-id")
+	require.NotContains(t, logs, "user data")
+	require.NotContains(t, logs, "request body")
+}
+
+func TestDebugHTTPWriteBodies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	}))
+	defer server.Close()
+
+	logger := &recordingLogger{logs: map[string][]string{}}
+	client := newProviderHTTPClient(newHTTPDebugger(newStorageOptions(CloudStorageOption{
+		Logger:               logger,
+		DebugHTTP:            true,
+		DebugHTTPWriteBodies: true,
+	})))
+
+	resp, err := client.Post(server.URL+"/upload?upload_id=1", "text/plain", strings.NewReader("user data"))
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	// the server received the whole body
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "user data", string(body))
+
+	require.Contains(t, logger.logs["debug"], fmt.Sprintf(`HTTP POST %s/upload?upload_id=1 request body: "user data"`,
+		server.URL))
+}
+
+func TestWithStats(t *testing.T) {
+	var requests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		request := atomic.AddInt32(&requests, 1)
+		w.Header().Set("X-Amz-Request-Id", fmt.Sprintf("request-%d", request))
+		w.Header().Set("ETag", `"etag"`)
+
+		switch {
+		case r.URL.Path == "/my-bucket/flaky.json" && request == 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.URL.Path == "/my-bucket/missing.json":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodGet:
+			_, _ = w.Write([]byte("0123456789"))
+		default:
+			assert.Equal(t, "user data", string(body))
+		}
+	}))
+	defer server.Close()
+
+	// the storage retries instead of the SDK
+	awsSession, err := newAWSSession(server.URL, "us-west-2", false, 0, 0, 3, nil)
+	require.NoError(t, err)
+
+	awsSession.Config.Credentials = credentials.AnonymousCredentials
+
+	factory := newCloudStorageFactory(func(ctx context.Context, bucketName string) (CloudStorage, error) {
+		storage, err := newAWSCloudStorage(ctx, awsSession, bucketName, "",
+			newStorageOptions(CloudStorageOption{MaxRetries: 3, RetryBaseDelay: time.Millisecond}))
+		if err != nil {
+			return nil, err
+		}
+
+		return storage, nil
+	}, func() error { return nil })
+
+	defer factory.Close()
+
+	storage, err := factory.OpenBucket(context.Background(), "my-bucket")
+	require.NoError(t, err)
+
+	ctx, stats := WithStats(context.Background())
+
+	_, err = storage.Get(ctx, "flaky.json")
+	require.NoError(t, err)
+	require.Equal(t, int64(10), stats.Bytes)
+	require.Equal(t, 2, stats.Attempts)
+	require.Equal(t, "request-2", stats.RequestID)
+	require.Equal(t, http.StatusOK, stats.HTTPStatus)
+	require.NotZero(t, stats.Duration)
+
+	// the next operation replaces the stats
+	_, err = storage.Get(ctx, "missing.json")
+	require.ErrorIs(t, err, ErrNotFound)
+	require.Equal(t, "request-3", RequestID(err))
+	require.Equal(t, OpStats{Attempts: 1, RequestID: "request-3", HTTPStatus: http.StatusNotFound},
+		OpStats{Attempts: stats.Attempts, RequestID: stats.RequestID, HTTPStatus: stats.HTTPStatus})
+
+	ctx, stats = WithStats(context.Background())
+	require.NoError(t, storage.Write(ctx, "dir/file.json", []byte("user data"), nil))
+	require.Equal(t, int64(len("user data")), stats.Bytes)
+	require.Equal(t, http.StatusOK, stats.HTTPStatus)
+
+	// the readers fill the stats when they are closed
+	ctx, stats = WithStats(context.Background())
+
+	reader, err := storage.GetReader(ctx, "dir/file.json")
+	require.NoError(t, err)
+
+	_, err = ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.Zero(t, stats.Attempts)
+	require.NoError(t, reader.Close())
+	require.Equal(t, int64(10), stats.Bytes)
+	require.Equal(t, 1, stats.Attempts)
+	require.Equal(t, http.StatusOK, stats.HTTPStatus)
+
+	// the stats are bound to the context of each call
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			ctx, stats := WithStats(context.Background())
+			_, err := storage.Get(ctx, "dir/file.json")
+			assert.NoError(t, err)
+			assert.Equal(t, int64(10), stats.Bytes)
+			assert.Equal(t, 1, stats.Attempts)
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestRequestID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-GUploader-UploadID", "upload-id")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+
+	clients, err := newGCPTestClients(ctx, `{"type": "service_account", "project_id": "my-project-id"}`,
+		gcpEmulator{host: server.URL}, nil)
+	require.NoError(t, err)
+
+	factory := newCloudStorageFactory(func(ctx context.Context, bucketName string) (CloudStorage, error) {
+		storage, err := newGCPTestCloudStorage(ctx, clients, bucketName, newStorageOptions(CloudStorageOption{}))
+		if err != nil {
+			return nil, err
+		}
+
+		return storage, nil
+	}, clients.Close)
+
+	defer factory.Close()
+
+	storage, err := factory.OpenBucket(ctx, "my-bucket")
+	require.NoError(t, err)
+
+	// the errors of the GCS reads don't carry the response
+	_, err = storage.Get(ctx, "dir/file.json")
+	require.ErrorIs(t, err, ErrNotFound)
+	require.Equal(t, "upload-id", RequestID(err))
+	require.Contains(t, err.Error(), "(request ID: upload-id)")
+
+	_, err = storage.Attributes(ctx, "dir/file.json")
+	require.ErrorIs(t, err, ErrNotFound)
+	require.Equal(t, "upload-id", RequestID(err))
+
+	_, err = storage.List(ctx, "dir/").Next(ctx)
+	require.Error(t, err)
+	require.Equal(t, "upload-id", RequestID(err))
+
+	// the request IDs of the provider errors
+	require.Equal(t, "request-id", RequestID(fmt.Errorf("get: %w",
+		awserr.NewRequestFailure(awserr.New(s3.ErrCodeNoSuchKey, "no such key", nil), http.StatusNotFound, "request-id"))))
+	require.Equal(t, "upload-id", RequestID(&googleapi.Error{
+		Code:   http.StatusNotFound,
+		Header: http.Header{"X-Guploader-Uploadid": []string{"upload-id"}},
+	}))
+	require.Empty(t, RequestID(errors.New("connection reset")))
+}
+
+func TestGCPEmulatorEndpoint(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		emulator gcpEmulator
+		scheme   string
+		host     string
+	}{
+		{name: "default scheme", emulator: gcpEmulator{host: "localhost:4443"}, scheme: "http", host: "localhost:4443"},
+		{name: "scheme option", emulator: gcpEmulator{scheme: "https", host: "localhost:4443"}, scheme: "https",
+			host: "localhost:4443"},
+		{name: "scheme of the host", emulator: gcpEmulator{host: "https://localhost:4443"}, scheme: "https",
+			host: "localhost:4443"},
+		{name: "scheme option first", emulator: gcpEmulator{scheme: "http", host: "https://localhost:4443"},
+			scheme: "http", host: "localhost:4443"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			scheme, host, err := test.emulator.endpoint()
+			require.NoError(t, err)
+			require.Equal(t, test.scheme, scheme)
+			require.Equal(t, test.host, host)
+		})
+	}
+
+	_, _, err := gcpEmulator{scheme: "ftp", host: "localhost:4443"}.endpoint()
+	require.ErrorIs(t, err, ErrInvalidArgument)
+
+	_, err = gcpEmulator{caCert: []byte("not a certificate")}.tlsConfig()
+	require.ErrorIs(t, err, ErrInvalidArgument)
+}
+
+func TestGCPEmulatorTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	for _, test := range []struct {
+		name     string
+		emulator gcpEmulator
+		trusted  bool
+	}{
+		{name: "untrusted", emulator: gcpEmulator{host: server.URL}},
+		{name: "CA certificate", emulator: gcpEmulator{host: server.URL, caCert: caCert}, trusted: true},
+		{name: "skip verify", emulator: gcpEmulator{host: server.URL, insecureSkipVerify: true}, trusted: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			clients, err := newGCPTestClients(ctx, `{"type": "service_account", "project_id": "my-project-id"}`,
+				test.emulator, nil)
+			require.NoError(t, err)
+
+			defer clients.Close()
+
+			storage, err := newGCPTestCloudStorage(ctx, clients, "my-bucket", newStorageOptions(CloudStorageOption{}))
+			require.NoError(t, err)
+
+			defer storage.Close()
+
+			// the reads go through the gocloud bucket, and the attributes through the GCS client
+			_, err = storage.Get(ctx, "dir/file.json")
+			require.Equal(t, test.trusted, errors.Is(err, ErrNotFound), "%v", err)
+
+			_, err = storage.Attributes(ctx, "dir/file.json")
+			require.Equal(t, test.trusted, errors.Is(err, ErrNotFound), "%v", err)
+
+			publicURL, err := storage.GetPublicURL("dir/file.json")
+			require.NoError(t, err)
+			require.Equal(t, server.URL+"/my-bucket/dir/file.json", publicURL)
+		})
+	}
+}
+
+func TestBatchError(t *testing.T) {
+	require.Equal(t, "batch operation failed", (&BatchError{}).Error())
+
+	err := &BatchError{Errors: map[string]error{
+		"b.json": ErrNotFound,
+		"a.json": ErrPermissionDenied,
+	}}
+	require.Equal(t, "batch operation failed for 2 keys, first a.json: permission denied", err.Error())
+}
+
+func TestErrorCode(t *testing.T) {
+	awsFailure := func(code string, status int) error {
+		return awserr.NewRequestFailure(awserr.New(code, "injected", nil), status, "request-id")
+	}
+
+	testCases := []struct {
+		name     string
+		err      error
+		expected ErrorKind
+	}{
+		{name: "nil", err: nil, expected: ErrorKindOK},
+		{name: "unclassified", err: errors.New("injected"), expected: ErrorKindUnknown},
+
+		{name: "typed not found", err: newTypedError(ErrNotFound, errors.New("injected")), expected: ErrorKindNotFound},
+		{name: "typed object locked", err: newTypedError(ErrObjectLocked, errors.New("injected")),
+			expected: ErrorKindPermissionDenied},
+		{name: "typed limit exceeded", err: newTypedError(ErrLimitExceeded, errors.New("injected")),
+			expected: ErrorKindResourceExhausted},
+		{name: "context canceled", err: context.Canceled, expected: ErrorKindCanceled},
+		{name: "context deadline", err: context.DeadlineExceeded, expected: ErrorKindDeadlineExceeded},
+
+		{name: "aws not found", err: awsFailure(s3.ErrCodeNoSuchKey, http.StatusNotFound), expected: ErrorKindNotFound},
+		{name: "aws permission denied", err: awsFailure("AccessDenied", http.StatusForbidden),
+			expected: ErrorKindPermissionDenied},
+		{name: "aws precondition failed", err: awsFailure("PreconditionFailed", http.StatusPreconditionFailed),
+			expected: ErrorKindPreconditionFailed},
+		{name: "aws slow down", err: awsFailure("SlowDown", http.StatusServiceUnavailable),
+			expected: ErrorKindResourceExhausted},
+		{name: "aws canceled", err: awserr.New(request.CanceledErrorCode, "injected", context.Canceled),
+			expected: ErrorKindCanceled},
+		{name: "aws status only", err: awsFailure("", http.StatusNotFound), expected: ErrorKindNotFound},
+		{name: "aws service unavailable", err: awsFailure("ServiceUnavailable", http.StatusServiceUnavailable),
+			expected: ErrorKindUnavailable},
+		{name: "aws bad gateway", err: awsFailure("", http.StatusBadGateway), expected: ErrorKindUnavailable},
+
+		{name: "gcp not found", err: &googleapi.Error{Code: http.StatusNotFound}, expected: ErrorKindNotFound},
+		{name: "gcp object not exist", err: gcs.ErrObjectNotExist, expected: ErrorKindNotFound},
+		{name: "gcp permission denied", err: &googleapi.Error{Code: http.StatusForbidden},
+			expected: ErrorKindPermissionDenied},
+		{name: "gcp precondition failed", err: &googleapi.Error{Code: http.StatusPreconditionFailed},
+			expected: ErrorKindPreconditionFailed},
+		{name: "gcp rate limited", err: &googleapi.Error{Code: http.StatusTooManyRequests},
+			expected: ErrorKindResourceExhausted},
+		{name: "gcp service unavailable", err: &googleapi.Error{Code: http.StatusServiceUnavailable},
+			expected: ErrorKindUnavailable},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.expected, ErrorCode(testCase.err))
+
+			if testCase.err != nil {
+				// the classification survives the wrapping
+				wrapped := fmt.Errorf("operation: %w", objectError(testCase.err))
+				require.Equal(t, testCase.expected, ErrorCode(wrapped))
+			}
+		})
+	}
+}
+
+func TestExistsFailures(t *testing.T) {
+	newAWSStorage := func(endpoint string) CloudStorage {
+		client := s3.New(session.Must(session.NewSession(&aws.Config{
+			Endpoint:         aws.String(endpoint),
+			Region:           aws.String("us-west-2"),
+			S3ForcePathStyle: aws.Bool(true),
+			Credentials:      credentials.AnonymousCredentials,
+			MaxRetries:       aws.Int(0),
+		})))
+
+		return &AWSCloudStorage{client: client, bucketName: "my-bucket"}
+	}
+
+	newGCPStorage := func(endpoint string) CloudStorage {
+		client, err := gcs.NewClient(context.Background(),
+			option.WithEndpoint(endpoint+"/storage/v1/"), option.WithoutAuthentication())
+		require.NoError(t, err)
+
+		return &GCPTestCloudStorage{client: client, bucketName: "my-bucket"}
+	}
+
+	// the injected faults answer every request
+	faults := []struct {
+		name     string
+		handler  http.HandlerFunc
+		expected ErrorKind
+	}{
+		{
+			name: "not found",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			},
+			expected: ErrorKindOK,
+		},
+		{
+			name: "forbidden",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+			},
+			expected: ErrorKindPermissionDenied,
+		},
+		{
+			name: "timeout",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+			},
+			expected: ErrorKindDeadlineExceeded,
+		},
+	}
+
+	providers := []struct {
+		name       string
+		newStorage func(endpoint string) CloudStorage
+	}{
+		{name: "aws", newStorage: newAWSStorage},
+		{name: "gcp", newStorage: newGCPStorage},
+	}
+
+	for _, provider := range providers {
+		for _, fault := range faults {
+			provider, fault := provider, fault
+
+			t.Run(provider.name+" "+fault.name, func(t *testing.T) {
+				server := httptest.NewServer(fault.handler)
+				defer server.Close()
+
+				storage := provider.newStorage(server.URL)
+
+				ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+				defer cancel()
+
+				exists, err := storage.Exists(ctx, "dir/file.json")
+				require.False(t, exists)
+				require.Equal(t, fault.expected, ErrorCode(err), err)
+			})
+		}
+	}
+}
+
+func TestCheckExistingAWSBucket(t *testing.T) {
+	testCases := []struct {
+		name     string
+		code     string
+		location string
+		check    func(t *testing.T, err error)
+	}{
+		{name: "owned by you", code: s3.ErrCodeBucketAlreadyOwnedByYou, location: "us-west-2",
+			check: func(t *testing.T, err error) { require.NoError(t, err) }},
+		{name: "legacy localstack", code: s3.ErrCodeBucketAlreadyExists, location: "us-west-2",
+			check: func(t *testing.T, err error) { require.NoError(t, err) }},
+		{name: "other region", code: s3.ErrCodeBucketAlreadyOwnedByYou, location: "eu-west-1",
+			check: func(t *testing.T, err error) { require.ErrorIs(t, err, ErrBucketRegionMismatch) }},
+		{name: "denied", code: "AccessDenied", location: "us-west-2",
+			check: func(t *testing.T, err error) {
+				require.Error(t, err)
+				require.Equal(t, ErrorKindPermissionDenied, ErrorCode(err))
+			}},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			// the error bodies of localstack v3
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if _, ok := r.URL.Query()["location"]; ok {
+					fmt.Fprintf(w, `<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">%s`+
+						`</LocationConstraint>`, testCase.location)
+
+					return
+				}
+
+				status := http.StatusConflict
+				if testCase.code == "AccessDenied" {
+					status = http.StatusForbidden
+				}
+
+				w.WriteHeader(status)
+				fmt.Fprintf(w, `<?xml version='1.0' encoding='utf-8'?><Error><Code>%s</Code>`+
+					`<Message>The bucket is unavailable.</Message><BucketName>my-bucket</BucketName>`+
+					`<RequestId>request-id</RequestId></Error>`, testCase.code)
+			}))
+			defer server.Close()
+
+			client := s3.New(session.Must(session.NewSession(&aws.Config{
+				Endpoint:         aws.String(server.URL),
+				Region:           aws.String("us-west-2"),
+				S3ForcePathStyle: aws.Bool(true),
+				Credentials:      credentials.AnonymousCredentials,
+				MaxRetries:       aws.Int(0),
+			})))
+
+			ctx := context.Background()
+
+			_, createErr := client.CreateBucketWithContext(ctx, &s3.CreateBucketInput{Bucket: aws.String("my-bucket")})
+			require.Error(t, createErr)
+
+			testCase.check(t, checkExistingAWSBucket(ctx, client, "my-bucket", "us-west-2", createErr))
+		})
+	}
+}
+
+func TestValidateKey(t *testing.T) {
+	testCases := []struct {
+		name     string
+		key      string
+		strict   bool
+		expected string
+		rule     string
+	}{
+		{name: "valid", key: "dir/file.json", expected: "dir/file.json"},
+		{name: "empty", key: "", rule: "is empty"},
+		{name: "leading slash", key: "/dir/file.json", expected: "dir/file.json"},
+		{name: "only slashes", key: "//", rule: "is empty"},
+		{name: "empty segment", key: "dir//file.json", expected: "dir//file.json"},
+		{name: "line feed", key: "dir/\nfile.json", rule: "line break"},
+		{name: "carriage return", key: "dir/\rfile.json", rule: "line break"},
+		{name: "longest", key: strings.Repeat("a", maxKeyLength), expected: strings.Repeat("a", maxKeyLength)},
+		{name: "too long", key: strings.Repeat("a", maxKeyLength+1), rule: "longer than 1024 bytes"},
+		{name: "strict valid", key: "dir/file.json", strict: true, expected: "dir/file.json"},
+		{name: "strict leading slash", key: "/dir/file.json", strict: true, rule: "starts with a slash"},
+		{name: "strict empty segment", key: "dir//file.json", strict: true, rule: "empty segment"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			key, err := validateKey(testCase.key, testCase.strict)
+			if testCase.rule != "" {
+				require.ErrorIs(t, err, ErrInvalidArgument)
+				require.Contains(t, err.Error(), testCase.rule)
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, testCase.expected, key)
+		})
+	}
+}
+
+func TestNormalizeAttributes(t *testing.T) {
+	zone := time.FixedZone("UTC+7", 7*60*60)
+	modTime := time.Date(2020, 1, 2, 10, 0, 0, 0, zone)
+
+	attrs := normalizeAttributes(&Attributes{
+		Metadata:   map[string]string{"Mixed-Case": "Value", "lower": "value"},
+		ModTime:    modTime,
+		CreateTime: modTime,
+		Size:       1,
+	})
+
+	require.Equal(t, map[string]string{"mixed-case": "Value", "lower": "value"}, attrs.Metadata)
+	require.Equal(t, time.UTC, attrs.ModTime.Location())
+	require.True(t, attrs.ModTime.Equal(modTime))
+	require.Equal(t, time.UTC, attrs.CreateTime.Location())
+	require.Nil(t, attrs.MD5)
+}
+
+func TestRetryTransientErrors(t *testing.T) {
+	testCases := []struct {
+		name       string
+		statuses   []int
+		maxRetries int
+		exists     bool
+		expected   ErrorKind
+		requests   int
+	}{
+		{
+			name:       "recovered",
+			statuses:   []int{http.StatusServiceUnavailable, http.StatusInternalServerError, http.StatusOK},
+			maxRetries: 3,
+			exists:     true,
+			expected:   ErrorKindOK,
+			requests:   3,
+		},
+		{
+			name:       "retries exhausted",
+			statuses:   []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+			maxRetries: 2,
+			expected:   ErrorKindUnavailable,
+			requests:   3,
+		},
+		{
+			name:       "not transient",
+			statuses:   []int{http.StatusForbidden, http.StatusOK},
+			maxRetries: 3,
+			expected:   ErrorKindPermissionDenied,
+			requests:   1,
+		},
+		{
+			name:     "default",
+			statuses: []int{http.StatusServiceUnavailable, http.StatusOK},
+			expected: ErrorKindUnavailable,
+			requests: 1,
+		},
+		{
+			name:       "disabled",
+			statuses:   []int{http.StatusServiceUnavailable, http.StatusOK},
+			maxRetries: -1,
+			expected:   ErrorKindUnavailable,
+			requests:   1,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			var requests int32
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				request := int(atomic.AddInt32(&requests, 1)) - 1
+				w.WriteHeader(testCase.statuses[request%len(testCase.statuses)])
+			}))
+			defer server.Close()
+
+			client := s3.New(session.Must(session.NewSession(&aws.Config{
+				Endpoint:         aws.String(server.URL),
+				Region:           aws.String("us-west-2"),
+				S3ForcePathStyle: aws.Bool(true),
+				Credentials:      credentials.AnonymousCredentials,
+				MaxRetries:       aws.Int(0),
+			})))
+
+			var retries []int
+
+			storage := newRetryingCloudStorage(&AWSCloudStorage{
+				client:     client,
+				bucketName: "my-bucket",
+				storageOptions: storageOptions{
+					maxRetries:     testCase.maxRetries,
+					retryBaseDelay: time.Millisecond,
+					onRetry: func(op, key string, retry int, err error) {
+						require.Equal(t, "Exists", op)
+						require.Equal(t, "dir/file.json", key)
+						require.Equal(t, ErrorKindUnavailable, ErrorCode(err))
+
+						retries = append(retries, retry)
+					},
+				},
+			})
+
+			exists, err := storage.Exists(context.Background(), "dir/file.json")
+			require.Equal(t, testCase.exists, exists)
+			require.Equal(t, testCase.expected, ErrorCode(err), err)
+			require.Equal(t, testCase.requests, int(atomic.LoadInt32(&requests)))
+			require.Len(t, retries, testCase.requests-1)
+
+			for i, retry := range retries {
+				require.Equal(t, i+1, retry)
+			}
+		})
+	}
+}
+
+func TestRetryRespectsDeadline(t *testing.T) {
+	var requests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := s3.New(session.Must(session.NewSession(&aws.Config{
+		Endpoint:         aws.String(server.URL),
+		Region:           aws.String("us-west-2"),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.AnonymousCredentials,
+		MaxRetries:       aws.Int(0),
+	})))
+
+	storage := newRetryingCloudStorage(&AWSCloudStorage{
+		client:     client,
+		bucketName: "my-bucket",
+		storageOptions: storageOptions{
+			maxRetries:     100,
+			retryBaseDelay: time.Second,
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := storage.Exists(ctx, "dir/file.json")
+	require.Equal(t, ErrorKindUnavailable, ErrorCode(err), err)
+	require.Less(t, time.Since(start), time.Second)
+}
+
+// writtenStorage counts the writes.
+type writtenStorage struct {
+	CloudStorage
+
+	writes int
+}
+
+func (ts *writtenStorage) WriteWithOptions(ctx context.Context, key string, body []byte, opts *WriteOptions) error {
+	ts.writes++
+
+	return nil
+}
+
+// retriedStorage enables the retries of the transient errors on the storage.
+type retriedStorage struct {
+	CloudStorage
+}
+
+func (ts retriedStorage) options() storageOptions {
+	return newStorageOptions(CloudStorageOption{MaxRetries: 3})
+}
+
+func TestRetryConditionalWrites(t *testing.T) {
+	ctx := context.Background()
+	inner := &writtenStorage{}
+
+	unavailable := NewFaultError(http.StatusServiceUnavailable)
+	storage := newRetryingCloudStorage(NewFaultyStorage(retriedStorage{inner}, FaultConfig{
+		Sequences: map[string][]error{"WriteWithOptions": {unavailable, unavailable, unavailable}},
+	}))
+
+	// the conditional writes aren't retried
+	err := storage.WriteWithOptions(ctx, "file.json", []byte("body"), &WriteOptions{IfNotExists: true})
+	require.Equal(t, ErrorKindUnavailable, ErrorCode(err), err)
+	require.Equal(t, 0, inner.writes)
+
+	err = storage.WriteWithOptions(ctx, "file.json", []byte("body"), &WriteOptions{IfMatchETag: "etag"})
+	require.Equal(t, ErrorKindUnavailable, ErrorCode(err), err)
+	require.Equal(t, 0, inner.writes)
+
+	// the other writes are, the third failure is retried
+	err = storage.WriteWithOptions(ctx, "file.json", []byte("body"), nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, inner.writes)
+}
+
+// flakyListStorage lists a single object, after failing the first page fetch.
+type flakyListStorage struct {
+	CloudStorage
+
+	replayable bool
+}
+
+func (ts *flakyListStorage) List(ctx context.Context, prefix string) *ListIterator {
+	var fetches int
+
+	next := func(ctx context.Context) (*ListObject, error) {
+		fetches++
+
+		switch fetches {
+		case 1:
+			return nil, NewFaultError(http.StatusServiceUnavailable)
+		case 2:
+			return &ListObject{Key: prefix + "file.json"}, nil
+		}
+
+		return nil, io.EOF
+	}
+
+	if ts.replayable {
+		return newReplayableListIterator(next)
+	}
+
+	return newListIterator(next)
+}
+
+func TestRetryReplayableListings(t *testing.T) {
+	ctx := context.Background()
+
+	// the failed page is fetched again
+	iter := newRetryingCloudStorage(retriedStorage{&flakyListStorage{replayable: true}}).List(ctx, "dir/")
+
+	object, err := iter.Next(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "dir/file.json", object.Key)
+
+	_, err = iter.Next(ctx)
+	require.Equal(t, io.EOF, err)
+
+	// the other listings would skip it, they aren't retried
+	iter = newRetryingCloudStorage(retriedStorage{&flakyListStorage{}}).List(ctx, "dir/")
+
+	_, err = iter.Next(ctx)
+	require.Equal(t, ErrorKindUnavailable, ErrorCode(err), err)
+
+	// the listings of the limited storages stay replayable
+	iter = newRetryingCloudStorage(newLimitedCloudStorage(retriedStorage{&flakyListStorage{replayable: true}}, 1, nil)).
+		List(ctx, "dir/")
+
+	object, err = iter.Next(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "dir/file.json", object.Key)
+}
+
+func TestDisableGCPRetries(t *testing.T) {
+	var requests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+
+	client, err := gcs.NewClient(ctx, option.WithEndpoint(server.URL+"/storage/v1/"), option.WithoutAuthentication())
+	require.NoError(t, err)
+
+	defer client.Close()
+
+	// the storages retry instead of the client
+	disableGCPRetries(client, 3)
+
+	_, err = client.Bucket("my-bucket").Object("dir/file.json").Attrs(ctx)
+	require.Equal(t, ErrorKindUnavailable, ErrorCode(err), err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+// slowExistsStorage answers Exists after a delay, recording the most calls in flight at once.
+type slowExistsStorage struct {
+	CloudStorage
+
+	delay       time.Duration
+	inFlight    int32
+	maxInFlight int32
+}
+
+func (ts *slowExistsStorage) Exists(ctx context.Context, key string) (bool, error) {
+	inFlight := atomic.AddInt32(&ts.inFlight, 1)
+	defer atomic.AddInt32(&ts.inFlight, -1)
+
+	for {
+		maxInFlight := atomic.LoadInt32(&ts.maxInFlight)
+		if inFlight <= maxInFlight || atomic.CompareAndSwapInt32(&ts.maxInFlight, maxInFlight, inFlight) {
+			break
+		}
+	}
+
+	select {
+	case <-time.After(ts.delay):
+		return true, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	inner := &slowExistsStorage{delay: 20 * time.Millisecond}
+
+	var (
+		mu          sync.Mutex
+		maxInFlight int
+	)
+
+	storage := newLimitedCloudStorage(inner, 2, func(inFlight int) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+	})
+
+	keys := make([]string, 10)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("dir/file-%d.json", i)
+	}
+
+	// the batch runs more keys at once than the limit
+	result, err := ExistsMulti(context.Background(), storage, keys)
+	require.NoError(t, err)
+	require.Len(t, result, len(keys))
+	require.Equal(t, int32(2), atomic.LoadInt32(&inner.maxInFlight))
+	require.Equal(t, 2, maxInFlight)
+
+	// a blocked request gives up with its context
+	inner.delay = time.Second
+
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, _ = storage.Exists(context.Background(), "dir/slow.json")
+		}()
+	}
+
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&inner.inFlight) == 2
+	}, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = storage.Exists(ctx, "dir/file.json")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, int32(2), atomic.LoadInt32(&inner.maxInFlight))
+}
+
+// countingStorage counts the writes and the closes, and lists endless objects.
+type countingStorage struct {
+	CloudStorage
+
+	writes int32
+	closes int32
+}
+
+func (ts *countingStorage) Write(ctx context.Context, key string, body []byte, contentType *string) error {
+	atomic.AddInt32(&ts.writes, 1)
+
+	return nil
+}
+
+func (ts *countingStorage) List(ctx context.Context, prefix string) *ListIterator {
+	return newListIterator(func(ctx context.Context) (*ListObject, error) {
+		return &ListObject{Key: prefix + "file.json"}, nil
+	})
+}
+
+func (ts *countingStorage) Close() error {
+	atomic.AddInt32(&ts.closes, 1)
+
+	return nil
+}
+
+func TestCloseWhileWriting(t *testing.T) {
+	inner := &countingStorage{}
+	storage := newClosableCloudStorage(inner, nil)
+	ctx := context.Background()
+
+	iter := storage.List(ctx, "dir/")
+	_, err := iter.Next(ctx)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				err := storage.Write(ctx, "dir/file.json", []byte("body"), nil)
+				if errors.Is(err, ErrClosed) {
+					return
+				}
+
+				assert.NoError(t, err)
+			}
+		}()
+	}
+
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&inner.writes) > 100
+	}, time.Second, time.Millisecond)
+
+	require.NoError(t, storage.Close())
+	require.NoError(t, storage.Close())
+	require.Equal(t, int32(1), atomic.LoadInt32(&inner.closes))
+
+	wg.Wait()
+
+	err = storage.Write(ctx, "dir/file.json", []byte("body"), nil)
+	require.ErrorIs(t, err, ErrClosed)
+
+	_, err = storage.Exists(ctx, "dir/file.json")
+	require.ErrorIs(t, err, ErrClosed)
+
+	// the iterators created before the close fail too
+	_, err = iter.Next(ctx)
+	require.ErrorIs(t, err, ErrClosed)
+
+	_, err = storage.List(ctx, "dir/").Next(ctx)
+	require.ErrorIs(t, err, ErrClosed)
+}
+
+// blockedStorage answers Exists once it's released, and fails the calls which end after its close.
+type blockedStorage struct {
+	CloudStorage
+
+	started chan struct{}
+	release chan struct{}
+	closed  int32
+}
+
+func (ts *blockedStorage) Exists(ctx context.Context, key string) (bool, error) {
+	close(ts.started)
+	<-ts.release
+
+	if atomic.LoadInt32(&ts.closed) == 1 {
+		return false, fmt.Errorf("the storage was closed during the call")
+	}
+
+	return true, nil
+}
+
+func (ts *blockedStorage) Close() error {
+	atomic.StoreInt32(&ts.closed, 1)
+
+	return nil
+}
+
+func TestCloseWaitsForCallsInFlight(t *testing.T) {
+	inner := &blockedStorage{started: make(chan struct{}), release: make(chan struct{})}
+	storage := newClosableCloudStorage(inner, nil)
+	ctx := context.Background()
+
+	existsErr := make(chan error, 1)
+
+	go func() {
+		_, err := storage.Exists(ctx, "dir/file.json")
+		existsErr <- err
+	}()
+
+	<-inner.started
+
+	closed := make(chan error, 1)
+
+	go func() {
+		closed <- storage.Close()
+	}()
+
+	select {
+	case <-closed:
+		require.Fail(t, "the storage was closed during a call")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the calls made while closing fail without waiting
+	_, err := storage.Exists(ctx, "dir/file.json")
+	require.ErrorIs(t, err, ErrClosed)
+
+	close(inner.release)
+
+	require.NoError(t, <-existsErr)
+	require.NoError(t, <-closed)
+	require.Equal(t, int32(1), atomic.LoadInt32(&inner.closed))
+}
+
+func TestFactoryForgetsClosedStorages(t *testing.T) {
+	inners := make(map[string]*countingStorage)
+
+	factory := newCloudStorageFactory(func(ctx context.Context, bucketName string) (CloudStorage, error) {
+		inners[bucketName] = &countingStorage{}
+
+		return inners[bucketName], nil
+	}, func() error { return nil })
+
+	ctx := context.Background()
+
+	first, err := factory.OpenBucket(ctx, "first")
+	require.NoError(t, err)
+
+	_, err = factory.OpenBucket(ctx, "second")
+	require.NoError(t, err)
+
+	require.NoError(t, first.Close())
+	require.Len(t, factory.storages, 1)
+
+	// the storage closed on its own isn't closed again by the factory
+	require.NoError(t, factory.Close())
+	require.Equal(t, int32(1), atomic.LoadInt32(&inners["first"].closes))
+	require.Equal(t, int32(1), atomic.LoadInt32(&inners["second"].closes))
+	require.Empty(t, factory.storages)
+}
+
+func TestFactoryClosedWhileOpening(t *testing.T) {
+	opening := make(chan struct{})
+	release := make(chan struct{})
+	inner := &countingStorage{}
+
+	factory := newCloudStorageFactory(func(ctx context.Context, bucketName string) (CloudStorage, error) {
+		close(opening)
+		<-release
+
+		return inner, nil
+	}, func() error { return nil })
+
+	opened := make(chan error, 1)
+
+	go func() {
+		_, err := factory.OpenBucket(context.Background(), "my-bucket")
+		opened <- err
+	}()
+
+	// the factory is closed without waiting for the bucket
+	<-opening
+	require.NoError(t, factory.Close())
+
+	close(release)
+
+	require.EqualError(t, <-opened, "unable to open bucket my-bucket: cloud storage factory is closed")
+	require.Equal(t, int32(1), atomic.LoadInt32(&inner.closes))
+	require.Empty(t, factory.storages)
+}
+
+// md5lessStorage holds a single object whose attributes have no MD5, and counts its reads.
+type md5lessStorage struct {
+	CloudStorage
+
+	body     []byte
+	metadata map[string]string
+	reads    int
+}
+
+func (ts *md5lessStorage) Attributes(ctx context.Context, key string) (*Attributes, error) {
+	metadata := make(map[string]string)
+	for name, value := range ts.metadata {
+		metadata[name] = value
+	}
+
+	return &Attributes{Size: int64(len(ts.body)), ETag: "etag", Metadata: metadata}, nil
+}
+
+func (ts *md5lessStorage) GetRangeReader(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	ts.reads++
+
+	return ioutil.NopCloser(bytes.NewReader(ts.body)), nil
+}
+
+func (ts *md5lessStorage) UpdateAttributes(
+	ctx context.Context,
+	key string,
+	update AttributeUpdate,
+) (*Attributes, error) {
+	for name, value := range update.Metadata {
+		ts.metadata[name] = value
+	}
+
+	return ts.Attributes(ctx, key)
+}
+
+func TestComputeMissingMD5(t *testing.T) {
+	body := []byte("multipart upload")
+	sum := md5.Sum(body) //nolint:gosec
+	ctx := context.Background()
+
+	inner := &md5lessStorage{body: body, metadata: map[string]string{}}
+	storage := newMD5ComputingCloudStorage(inner)
+
+	attrs, err := storage.Attributes(ctx, "dir/file.json")
+	require.NoError(t, err)
+	require.Equal(t, sum[:], attrs.MD5)
+	require.Equal(t, fmt.Sprintf("%x", sum), inner.metadata["md5"])
+
+	// the cached MD5 is used by the next calls
+	attrs, err = storage.Attributes(ctx, "dir/file.json")
+	require.NoError(t, err)
+	require.Equal(t, sum[:], attrs.MD5)
+	require.Equal(t, 1, inner.reads)
+
+	// a malformed cache is ignored
+	inner.metadata["md5"] = "not-hex"
+
+	attrs, err = storage.Attributes(ctx, "dir/file.json")
+	require.NoError(t, err)
+	require.Equal(t, sum[:], attrs.MD5)
+	require.Equal(t, 2, inner.reads)
+
+	// the objects larger than the limit are not read
+	large := &md5lessStorage{body: body, metadata: map[string]string{}}
+
+	attrs, err = fillMissingMD5(ctx, large, "dir/file.json", &Attributes{Size: int64(len(body))}, int64(len(body)-1))
+	require.NoError(t, err)
+	require.Nil(t, attrs.MD5)
+	require.Equal(t, 0, large.reads)
+}
+
+// recordingLogger keeps the formatted logs by level.
+type recordingLogger struct {
+	mu   sync.Mutex
+	logs map[string][]string
+}
+
+func (l *recordingLogger) record(level, format string, args []interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.logs[level] = append(l.logs[level], fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) Debugf(format string, args ...interface{}) { l.record("debug", format, args) }
+
+func (l *recordingLogger) Infof(format string, args ...interface{}) { l.record("info", format, args) }
+
+func (l *recordingLogger) Warnf(format string, args ...interface{}) { l.record("warn", format, args) }
+
+func (l *recordingLogger) Errorf(format string, args ...interface{}) { l.record("error", format, args) }
+
+func TestLogger(t *testing.T) {
+	require.Equal(t, noopLogger{}, newStorageOptions(CloudStorageOption{}).logger)
+	require.Equal(t, noopLogger{}, (&AWSCloudStorage{}).log())
+	require.Equal(t, noopLogger{}, storageOptionsOf(&ExplicitGCPCloudStorage{}).logger)
+	require.Equal(t, noopLogger{}, (&ImplicitGCPCloudStorage{}).log())
+
+	dir, err := ioutil.TempDir("", "common-blob-go")
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	link := filepath.Join(dir, "link.txt")
+	require.NoError(t, os.Symlink(filepath.Join(dir, "missing.txt"), link))
+
+	logger := &recordingLogger{logs: make(map[string][]string)}
+	options := newStorageOptions(CloudStorageOption{Logger: logger})
+
+	// the symlink is skipped before any call of the storage
+	err = UploadDirectory(context.Background(), &AWSCloudStorage{storageOptions: options}, dir, "dir", nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{fmt.Sprintf("skipping symlink '%s'", link)}, logger.logs["warn"])
+}
+
+// recordingSpan keeps the attributes of a span.
+type recordingSpan struct {
+	name       string
+	parent     *recordingSpan
+	attributes map[string]interface{}
+	err        error
+	ended      bool
+}
+
+func (s *recordingSpan) SetAttribute(key string, value interface{}) { s.attributes[key] = value }
+
+func (s *recordingSpan) RecordError(err error) { s.err = err }
+
+func (s *recordingSpan) End() { s.ended = true }
+
+type recordingSpanKey struct{}
+
+// recordingTracer keeps the started spans, with their parent from the context.
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordingSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	parent, _ := ctx.Value(recordingSpanKey{}).(*recordingSpan)
+	span := &recordingSpan{name: name, parent: parent, attributes: make(map[string]interface{})}
+	t.spans = append(t.spans, span)
+
+	return context.WithValue(ctx, recordingSpanKey{}, span), span
+}
+
+// listedStorage lists count objects and fails the Get of the missing key.
+type listedStorage struct {
+	CloudStorage
+
+	count int
+}
+
+func (ts *listedStorage) List(ctx context.Context, prefix string) *ListIterator {
+	var listed int
+
+	return newListIterator(func(ctx context.Context) (*ListObject, error) {
+		if listed >= ts.count {
+			return nil, io.EOF
+		}
+
+		// a page of 1000 objects is fetched from the provider
+		if recorder := opStatsRecorderFrom(ctx); recorder != nil && listed%1000 == 0 {
+			recorder.response(&http.Response{StatusCode: http.StatusOK, Header: http.Header{}})
+		}
+
+		listed++
+
+		return &ListObject{Key: fmt.Sprintf("%sfile-%d.json", prefix, listed)}, nil
+	})
+}
+
+func (ts *listedStorage) Get(ctx context.Context, key string) ([]byte, error) {
+	if key == "missing.json" {
+		return nil, newTypedError(ErrNotFound, fmt.Errorf("no such key"))
+	}
+
+	return []byte("body"), nil
+}
+
+func TestTracing(t *testing.T) {
+	tracer := &recordingTracer{}
+	tracingOptions := storageOptions{tracer: tracer, provider: "aws"}
+	storage := newInstrumentedCloudStorage(&listedStorage{count: 1500}, tracingOptions, "my-bucket")
+	ctx := context.Background()
+
+	_, err := storage.Get(ctx, "dir/file.json")
+	require.NoError(t, err)
+
+	_, err = storage.Get(ctx, "missing.json")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	require.Len(t, tracer.spans, 2)
+	require.Equal(t, "blob.Get", tracer.spans[0].name)
+	require.Equal(t, map[string]interface{}{
+		TraceAttributeProvider: "aws",
+		TraceAttributeBucket:   "my-bucket",
+		TraceAttributeKey:      "dir/file.json",
+		TraceAttributeBytes:    int64(4),
+	}, tracer.spans[0].attributes)
+	require.True(t, tracer.spans[0].ended)
+	require.Equal(t, "NotFound", tracer.spans[1].attributes[TraceAttributeErrorKind])
+	require.ErrorIs(t, tracer.spans[1].err, ErrNotFound)
+
+	tracer.spans = nil
+	iter := storage.List(ctx, "dir/")
+
+	for {
+		_, err := iter.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+
+		require.NoError(t, err)
+	}
+
+	// a single span for the listing
+	require.Len(t, tracer.spans, 1)
+	require.Equal(t, "blob.List", tracer.spans[0].name)
+	require.Equal(t, int64(1500), tracer.spans[0].attributes[TraceAttributeObjects])
+	require.True(t, tracer.spans[0].ended)
+
+	// the keys may be hashed
+	tracer.spans = nil
+	tracingOptions.traceHashKeys = true
+	storage = newInstrumentedCloudStorage(&listedStorage{}, tracingOptions, "my-bucket")
+
+	_, err = storage.Get(ctx, "dir/file.json")
+	require.NoError(t, err)
+
+	sum := sha256.Sum256([]byte("dir/file.json"))
+	require.Equal(t, fmt.Sprintf("%x", sum), tracer.spans[0].attributes[TraceAttributeKey])
+}
+
+// recordingMetrics keeps the recorded operations.
+type recordingMetrics struct {
+	mu         sync.Mutex
+	operations []string
+	slow       []string
+	bytes      int64
+	provider   string
+	bucketName string
+}
+
+func (m *recordingMetrics) Record(op string, dur time.Duration, bytes int64, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.operations = append(m.operations, fmt.Sprintf("%s %s", op, ErrorCode(err)))
+	m.bytes += bytes
+}
+
+func (m *recordingMetrics) RecordSlow(op string, dur time.Duration, bytes int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.slow = append(m.slow, fmt.Sprintf("%s %d", op, bytes))
+}
+
+func (m *recordingMetrics) ForBucket(provider, bucketName string) MetricsRecorder {
+	m.provider = provider
+	m.bucketName = bucketName
+
+	return m
+}
+
+func TestMetrics(t *testing.T) {
+	metrics := &recordingMetrics{}
+	storage := newInstrumentedCloudStorage(&listedStorage{count: 1500},
+		storageOptions{metrics: metrics, provider: "gcp"}, "my-bucket")
+	ctx := context.Background()
+
+	require.Equal(t, "gcp", metrics.provider)
+	require.Equal(t, "my-bucket", metrics.bucketName)
+
+	_, err := storage.Get(ctx, "dir/file.json")
+	require.NoError(t, err)
+
+	_, err = storage.Get(ctx, "missing.json")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	iter := storage.List(ctx, "dir/")
+
+	for {
+		_, err := iter.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+
+		require.NoError(t, err)
+	}
+
+	// a record for each page fetch of the listing
+	require.Equal(t, []string{"Get OK", "Get NotFound", "List OK", "List OK"}, metrics.operations)
+	require.Equal(t, int64(4), metrics.bytes)
+
+	// the failed calls of Next are recorded, although they got no response of the provider
+	metrics.operations = nil
+	storage = newInstrumentedCloudStorage(&flakyListStorage{}, storageOptions{metrics: metrics}, "my-bucket")
+
+	_, err = storage.List(ctx, "dir/").Next(ctx)
+	require.Equal(t, ErrorKindUnavailable, ErrorCode(err), err)
+	require.Equal(t, []string{"List Unavailable"}, metrics.operations)
+}
+
+func (ts *listedStorage) GetReader(ctx context.Context, key string) (io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader("body")), nil
+}
+
+// countingInterceptor counts the calls of each operation, e.g. for a quota per tenant.
+type countingInterceptor struct {
+	mu    sync.Mutex
+	calls map[string]int
+	bytes int64
+}
+
+func (c *countingInterceptor) intercept(
+	ctx context.Context,
+	op OpInfo,
+	next func(ctx context.Context) error,
+) error {
+	c.mu.Lock()
+	c.calls[op.Name]++
+
+	if op.Bytes > 0 {
+		c.bytes += op.Bytes
+	}
+
+	c.mu.Unlock()
+
+	return next(ctx)
+}
+
+type interceptedKey struct{}
+
+func TestInterceptors(t *testing.T) {
+	counter := &countingInterceptor{calls: map[string]int{}}
+
+	var order []string
+
+	interceptors := []Interceptor{
+		counter.intercept,
+		func(ctx context.Context, op OpInfo, next func(ctx context.Context) error) error {
+			order = append(order, op.Name+" "+op.Key)
+
+			return next(context.WithValue(ctx, interceptedKey{}, true))
+		},
+		func(ctx context.Context, op OpInfo, next func(ctx context.Context) error) error {
+			if ctx.Value(interceptedKey{}) != true {
+				return fmt.Errorf("the context of the previous interceptor is missing")
+			}
+
+			if op.Key == "denied.json" {
+				return newTypedError(ErrPermissionDenied, fmt.Errorf("denied by the interceptor"))
+			}
+
+			return next(ctx)
+		},
+	}
+	storage := newInstrumentedCloudStorage(&listedStorage{count: 1500},
+		storageOptions{interceptors: interceptors}, "my-bucket")
+	ctx := context.Background()
+
+	_, err := storage.Get(ctx, "dir/file.json")
+	require.NoError(t, err)
+
+	_, err = storage.Get(ctx, "denied.json")
+	require.ErrorIs(t, err, ErrPermissionDenied)
+
+	reader, err := storage.GetReader(ctx, "dir/file.json")
+	require.NoError(t, err)
+
+	_, err = ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	require.NoError(t, reader.Close())
+
+	iter := storage.List(ctx, "dir/")
+
+	for {
+		_, err := iter.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+
+		require.NoError(t, err)
+	}
+
+	// every call of Next of the listing, the end included, and the Close of the reader are intercepted too
+	require.Equal(t, map[string]int{"Get": 2, "GetReader": 1, "GetReader.Close": 1, "List": 1501}, counter.calls)
+	require.Equal(t, int64(4), counter.bytes)
+	require.Equal(t, "Get denied.json", order[1])
+	require.Equal(t, "List dir/", order[len(order)-1])
+}
+
+func TestSlowOperations(t *testing.T) {
+	logger := &recordingLogger{logs: map[string][]string{}}
+	metrics := &recordingMetrics{}
+	storage := newInstrumentedCloudStorage(&listedStorage{},
+		storageOptions{logger: logger, metrics: metrics, slowOperationThreshold: time.Nanosecond}, "my-bucket")
+	ctx := context.Background()
+
+	_, err := storage.Get(ctx, "dir/file.json")
+	require.NoError(t, err)
+
+	reader, err := storage.GetReader(ctx, "dir/file.json")
+	require.NoError(t, err)
+
+	_, err = ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+
+	// every slow operation is recorded, but only the first one is logged
+	require.Equal(t, []string{"Get 4", "GetReader 4"}, metrics.slow)
+	require.Len(t, logger.logs["warn"], 1)
+	require.Regexp(t, `^slow Get of 'dir/file.json' in bucket 'my-bucket': .+ for 4 bytes \(0 more`, logger.logs["warn"][0])
+
+	storage.(*instrumentedCloudStorage).slow.lastWarned = time.Now().Add(-slowOperationLogInterval)
+
+	_, err = storage.Get(ctx, "dir/file.json")
+	require.NoError(t, err)
+	require.Len(t, logger.logs["warn"], 2)
+	require.Contains(t, logger.logs["warn"][1], "(1 more slow operations not logged)")
+
+	// the threshold is disabled by default
+	require.Nil(t, newInstrumentedCloudStorage(&listedStorage{}, newStorageOptions(CloudStorageOption{}),
+		"my-bucket").(*instrumentedCloudStorage).slow)
+}
+
+// objectSetStorage holds the keys of its objects, without content.
+type objectSetStorage struct {
+	CloudStorage
+
+	keys map[string]bool
+}
+
+func (ts *objectSetStorage) Exists(ctx context.Context, key string) (bool, error) {
+	return ts.keys[key], nil
+}
+
+func (ts *objectSetStorage) Delete(ctx context.Context, key string) error {
+	if !ts.keys[key] {
+		return ErrNotFound
+	}
+
+	delete(ts.keys, key)
+
+	return nil
+}
+
+func (ts *objectSetStorage) DeleteBatch(ctx context.Context, keys []string) error {
+	for _, key := range keys {
+		delete(ts.keys, key)
+	}
+
+	return nil
+}
+
+func (ts *objectSetStorage) DeleteVersion(ctx context.Context, key string, version string) error {
+	return nil
+}
+
+func (ts *objectSetStorage) Copy(ctx context.Context, dstKey string, srcKey string) error {
+	ts.keys[dstKey] = true
+
+	return nil
+}
+
+func (ts *objectSetStorage) Move(ctx context.Context, dstKey string, srcKey string) error {
+	delete(ts.keys, srcKey)
+	ts.keys[dstKey] = true
+
+	return nil
+}
+
+// jsonLinesAuditor is a reference AuditFunc, which writes each event as a line of JSON to a file.
+type jsonLinesAuditor struct {
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+	err     error
+}
+
+type auditLine struct {
+	Operation string    `json:"operation"`
+	Keys      []string  `json:"keys"`
+	Version   string    `json:"version,omitempty"`
+	Overwrite bool      `json:"overwrite,omitempty"`
+	Bucket    string    `json:"bucket"`
+	Outcome   string    `json:"outcome"`
+	Error     string    `json:"error,omitempty"`
+	Time      time.Time `json:"time"`
+	Actor     string    `json:"actor"`
+}
+
+func newJSONLinesAuditor(path string) (*jsonLinesAuditor, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &jsonLinesAuditor{file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+func (a *jsonLinesAuditor) audit(event AuditEvent) {
+	line := auditLine{
+		Operation: event.Operation,
+		Keys:      event.Keys,
+		Version:   event.Version,
+		Overwrite: event.Overwrite,
+		Bucket:    event.Bucket,
+		Outcome:   string(event.Outcome),
+		Time:      event.Time,
+		Actor:     event.Actor,
+	}
+
+	if event.Err != nil {
+		line.Error = event.Err.Error()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.encoder.Encode(line); err != nil && a.err == nil {
+		a.err = err
+	}
+}
+
+// Close closes the file, and returns the first error of the writes.
+func (a *jsonLinesAuditor) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.file.Close(); err != nil && a.err == nil {
+		a.err = err
+	}
+
+	return a.err
+}
+
+func TestAudit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "common-blob-go")
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.jsonl")
+	auditor, err := newJSONLinesAuditor(path)
+	require.NoError(t, err)
+
+	inner := &objectSetStorage{keys: map[string]bool{"a.json": true, "b.json": true, "c.json": true}}
+	storage := newAuditingCloudStorage(inner, storageOptions{auditFunc: auditor.audit, logger: noopLogger{}},
+		"my-bucket")
+	ctx := WithActor(context.Background(), "service:gdpr-worker")
+
+	require.NoError(t, storage.Delete(ctx, "a.json"))
+	require.True(t, errors.Is(storage.Delete(ctx, "a.json"), ErrNotFound))
+	require.NoError(t, storage.DeleteBatch(ctx, []string{"b.json"}))
+	require.NoError(t, storage.DeleteVersion(ctx, "c.json", "v1"))
+	// a copy to a new key isn't destructive
+	require.NoError(t, storage.Copy(ctx, "d.json", "c.json"))
+	require.NoError(t, storage.Copy(ctx, "d.json", "c.json"))
+	require.NoError(t, storage.Move(ctx, "e.json", "d.json"))
+	require.NoError(t, auditor.Close())
+
+	content, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+
+	var lines []auditLine
+
+	for _, raw := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		var line auditLine
+
+		require.NoError(t, json.Unmarshal([]byte(raw), &line))
+		require.Equal(t, "my-bucket", line.Bucket)
+		require.Equal(t, "service:gdpr-worker", line.Actor)
+		require.False(t, line.Time.IsZero())
+
+		line.Bucket, line.Actor, line.Time = "", "", time.Time{}
+		lines = append(lines, line)
+	}
+
+	require.Equal(t, []auditLine{
+		{Operation: "Delete", Keys: []string{"a.json"}, Outcome: "success"},
+		{Operation: "Delete", Keys: []string{"a.json"}, Outcome: "failure", Error: ErrNotFound.Error()},
+		{Operation: "DeleteBatch", Keys: []string{"b.json"}, Outcome: "success"},
+		{Operation: "DeleteVersion", Keys: []string{"c.json"}, Version: "v1", Outcome: "success"},
+		{Operation: "Copy", Keys: []string{"d.json", "c.json"}, Overwrite: true, Outcome: "success"},
+		{Operation: "Move", Keys: []string{"e.json", "d.json"}, Outcome: "success"},
+	}, lines)
+
+	// the failures of the AuditFunc are logged without failing the operation
+	logger := &recordingLogger{logs: map[string][]string{}}
+	storage = newAuditingCloudStorage(inner, storageOptions{
+		auditFunc: func(event AuditEvent) { panic("disk full") },
+		logger:    logger,
+	}, "my-bucket")
+
+	require.NoError(t, storage.Delete(context.Background(), "e.json"))
+	require.Equal(t, []string{"unable to audit Delete of [e.json] in bucket 'my-bucket': disk full"}, logger.logs["error"])
+
+	// the storages are audited only with an AuditFunc
+	require.Nil(t, newStorageOptions(CloudStorageOption{}).auditFunc)
+}
+
+func TestFaultyStorage(t *testing.T) {
+	ctx := context.Background()
+
+	// the scripted failures are retried like the provider ones
+	storage := NewFaultyStorage(&listedStorage{}, FaultConfig{
+		Sequences: map[string][]error{
+			"Get": {NewFaultError(http.StatusServiceUnavailable), NewFaultError(http.StatusServiceUnavailable)},
+		},
+	})
+
+	_, err := storage.Get(ctx, "file.json")
+	require.Equal(t, ErrorKindUnavailable, ErrorCode(err))
+	require.EqualError(t, err, "injected fault: 503 Service Unavailable")
+
+	_, err = storage.Get(ctx, "file.json")
+	require.Error(t, err)
+
+	body, err := storage.Get(ctx, "file.json")
+	require.NoError(t, err)
+	require.Equal(t, "body", string(body))
+
+	retrying := newRetryingCloudStorage(NewFaultyStorage(retriedStorage{&listedStorage{}}, FaultConfig{
+		Sequences: map[string][]error{"*": {NewFaultError(http.StatusServiceUnavailable)}},
+	}))
+
+	_, err = retrying.Get(ctx, "file.json")
+	require.NoError(t, err)
+
+	// the random failures are the same for the same seed
+	failures := func(seed int64) []bool {
+		storage := NewFaultyStorage(&listedStorage{}, FaultConfig{
+			ErrorRates: map[string]float64{"*": 0.5},
+			Err:        ErrNetworkUnreachable,
+			Seed:       seed,
+		})
+
+		var failed []bool
+
+		for i := 0; i < 20; i++ {
+			_, err := storage.Get(ctx, "file.json")
+			failed = append(failed, errors.Is(err, ErrNetworkUnreachable))
+		}
+
+		return failed
+	}
+
+	require.Equal(t, failures(42), failures(42))
+	require.Contains(t, failures(42), true)
+	require.Contains(t, failures(42), false)
+
+	// the latencies end with the context
+	storage = NewFaultyStorage(&listedStorage{}, FaultConfig{
+		Latencies: map[string]time.Duration{"Get": time.Hour},
+	})
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+
+	defer cancel()
+
+	_, err = storage.Get(timeoutCtx, "file.json")
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	// the truncated readers fail in the middle of the body
+	storage = NewFaultyStorage(&listedStorage{}, FaultConfig{TruncateReadRate: 1, TruncateAfter: 2})
+
+	reader, err := storage.GetReader(ctx, "file.json")
+	require.NoError(t, err)
+
+	body, err = ioutil.ReadAll(reader)
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+	require.Equal(t, "bo", string(body))
+	require.NoError(t, reader.Close())
+}
+
+func TestGCPTestEmulatorPerInstance(t *testing.T) {
+	// each emulator only knows its own bucket
+	newEmulator := func(bucketName string, requests *int32) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(requests, 1)
+
+			if !strings.Contains(r.URL.Path, bucketName) {
+				w.WriteHeader(http.StatusBadRequest)
+
+				return
+			}
+
+			w.WriteHeader(http.StatusNotFound)
+		}))
+	}
+
+	var wg sync.WaitGroup
+
+	for _, bucketName := range []string{"first-bucket", "second-bucket"} {
+		bucketName := bucketName
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			var requests int32
+
+			server := newEmulator(bucketName, &requests)
+			defer server.Close()
+
+			ctx := context.Background()
+
+			clients, err := newGCPTestClients(ctx, `{"type": "service_account", "project_id": "my-project-id"}`,
+				gcpEmulator{host: server.URL}, nil)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			defer clients.Close()
+
+			storage, err := newGCPTestCloudStorage(ctx, clients, bucketName, newStorageOptions(CloudStorageOption{}))
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			defer storage.Close()
+
+			// through the GCS client
+			exists, err := storage.Exists(ctx, "dir/file.json")
+			assert.NoError(t, err)
+			assert.False(t, exists)
+
+			// through the gocloud bucket
+			err = storage.Delete(ctx, "dir/file.json")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestListNextContext(t *testing.T) {
+	// the first page is served, the next one never is
+	awsHandler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("continuation-token") != "" || r.URL.Query().Get("marker") != "" {
+			<-r.Context().Done()
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, `<ListBucketResult><Name>my-bucket</Name><KeyCount>1</KeyCount><IsTruncated>true</IsTruncated>`+
+			`<NextContinuationToken>next</NextContinuationToken><NextMarker>a.json</NextMarker>`+
+			`<Contents><Key>a.json</Key><Size>1</Size><LastModified>2020-01-01T00:00:00.000Z</LastModified></Contents>`+
+			`</ListBucketResult>`)
+	}
+
+	gcpHandler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("pageToken") != "" {
+			<-r.Context().Done()
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"kind": "storage#objects", "nextPageToken": "next", `+
+			`"items": [{"name": "a.json", "bucket": "my-bucket", "size": "1"}]}`)
+	}
+
+	newAWSStorage := func(endpoint string) CloudStorage {
+		awsSession := session.Must(session.NewSession(&aws.Config{
+			Endpoint:         aws.String(endpoint),
+			Region:           aws.String("us-west-2"),
+			S3ForcePathStyle: aws.Bool(true),
+			Credentials:      credentials.AnonymousCredentials,
+			MaxRetries:       aws.Int(0),
+		}))
+
+		bucket, err := s3blob.OpenBucket(context.Background(), awsSession, "my-bucket", nil)
+		require.NoError(t, err)
+
+		return &AWSCloudStorage{client: s3.New(awsSession), bucket: bucket, bucketName: "my-bucket"}
+	}
+
+	newGCPStorage := func(endpoint string) CloudStorage {
+		client, err := gcs.NewClient(context.Background(),
+			option.WithEndpoint(endpoint+"/storage/v1/"), option.WithoutAuthentication())
+		require.NoError(t, err)
+
+		return &GCPTestCloudStorage{client: client, bucketName: "my-bucket"}
+	}
+
+	testCases := []struct {
+		name       string
+		handler    http.HandlerFunc
+		newStorage func(endpoint string) CloudStorage
+	}{
+		{name: "aws", handler: awsHandler, newStorage: newAWSStorage},
+		{name: "gcp", handler: gcpHandler, newStorage: newGCPStorage},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			server := httptest.NewServer(testCase.handler)
+			defer server.Close()
+
+			// the listing context outlives the one of Next
+			iter := testCase.newStorage(server.URL).List(context.Background(), "")
+
+			object, err := iter.Next(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, "a.json", object.Key)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+
+			_, err = iter.Next(ctx)
+			require.Contains(t, []ErrorKind{ErrorKindCanceled, ErrorKindDeadlineExceeded}, ErrorCode(err), err)
+			require.Less(t, int64(time.Since(start)), int64(2*time.Second))
+		})
+	}
+}
+
+func TestListAttributesResumesAfterHeadFailure(t *testing.T) {
+	var lists, failedHeads int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			// the first HEAD of b.json fails
+			if strings.HasSuffix(r.URL.Path, "/b.json") && atomic.CompareAndSwapInt32(&failedHeads, 0, 1) {
+				w.WriteHeader(http.StatusForbidden)
+
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+
+			return
+		}
+
+		atomic.AddInt32(&lists, 1)
+
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, `<ListBucketResult><Name>my-bucket</Name><KeyCount>2</KeyCount><IsTruncated>false</IsTruncated>`+
+			`<Contents><Key>a.json</Key><Size>1</Size><LastModified>2020-01-01T00:00:00.000Z</LastModified></Contents>`+
+			`<Contents><Key>b.json</Key><Size>1</Size><LastModified>2020-01-01T00:00:00.000Z</LastModified></Contents>`+
+			`</ListBucketResult>`)
+	}))
+	defer server.Close()
+
+	awsSession := session.Must(session.NewSession(&aws.Config{
+		Endpoint:         aws.String(server.URL),
+		Region:           aws.String("us-west-2"),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.AnonymousCredentials,
+		MaxRetries:       aws.Int(0),
+	}))
+
+	ctx := context.Background()
+
+	bucket, err := s3blob.OpenBucket(ctx, awsSession, "my-bucket", nil)
+	require.NoError(t, err)
+
+	storage := &AWSCloudStorage{client: s3.New(awsSession), bucket: bucket, bucketName: "my-bucket"}
+	iter := storage.ListWithOptions(ctx, &ListOptions{IncludeAttributes: true})
+
+	_, err = iter.Next(ctx)
+	require.Error(t, err)
+
+	// the page isn't read again, the objects of the failed page are still returned
+	var keys []string
+
+	for {
+		object, err := iter.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+
+		require.NoError(t, err)
+		require.Equal(t, "application/json", object.ContentType)
+
+		keys = append(keys, object.Key)
+	}
+
+	require.Equal(t, []string{"a.json", "b.json"}, keys)
+	require.Equal(t, int32(1), atomic.LoadInt32(&lists))
+}
+
+func TestImplicitGCPClientsMissingCredentials(t *testing.T) {
+	previous, isSet := os.LookupEnv("GOOGLE_APPLICATION_CREDENTIALS")
+	defer func() {
+		if isSet {
+			os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", previous)
+		} else {
+			os.Unsetenv("GOOGLE_APPLICATION_CREDENTIALS")
+		}
+	}()
+
+	os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", filepath.Join(os.TempDir(), uuid.New().String()+".json"))
+
+	_, err := newImplicitGCPClients(context.Background(), nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unable to find the GCP default credentials")
+
+	_, err = getDefaultServiceAccountEmail(context.Background(), nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no credentials")
+}
+
+func TestImplicitGCPClientsClose(t *testing.T) {
+	ctx := context.Background()
+
+	client, err := gcs.NewClient(ctx, option.WithoutAuthentication())
+	require.NoError(t, err)
+
+	iamCredentialsClient, err := iamcredentials.NewIamCredentialsClient(ctx,
+		option.WithoutAuthentication(), option.WithEndpoint("localhost:1"))
+	require.NoError(t, err)
+
+	clients := &implicitGCPClients{client: client, iamCredentialsClient: iamCredentialsClient}
+	factory := newCloudStorageFactory(func(ctx context.Context, bucketName string) (CloudStorage, error) {
+		return &ImplicitGCPCloudStorage{
+			client:               clients.client,
+			bucketName:           bucketName,
+			iamCredentialsClient: clients.iamCredentialsClient,
+			bucketCloseFunc:      func() error { return nil },
+		}, nil
+	}, clients.Close)
+
+	storage, err := factory.OpenBucket(ctx, "my-bucket")
+	require.NoError(t, err)
+
+	require.NoError(t, factory.Close())
+	require.NoError(t, factory.Close())
+	require.NoError(t, storage.Close())
+
+	// the connection of the IAM client is shut down
+	_, err = iamCredentialsClient.SignBlob(ctx, &iamcredentialspb.SignBlobRequest{Name: "name"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "closing")
+}
+
+func TestExplicitGCPSigningWithoutKey(t *testing.T) {
+	// the user credentials have no service account key, but the storage can still be used
+	clients, err := newExplicitGCPClients(context.Background(),
+		`{"type": "authorized_user", "client_id": "id", "client_secret": "secret", "refresh_token": "token"}`, nil)
+	require.NoError(t, err)
+
+	defer clients.Close()
+
+	require.Empty(t, clients.privateKey)
+
+	storage := &ExplicitGCPCloudStorage{
+		client:         clients.client,
+		bucketName:     "my-bucket",
+		googleAccessID: clients.googleAccessID,
+		privateKey:     clients.privateKey,
+		storageOptions: newStorageOptions(CloudStorageOption{}),
+	}
+
+	_, err = storage.GetSignedURL(context.Background(), "file.json", &SignedURLOption{Expiry: time.Hour, Method: http.MethodGet})
+	require.ErrorIs(t, err, ErrInvalidArgument)
+	require.Contains(t, err.Error(), "no private_key")
+
+	_, err = storage.GetSignedPostPolicy(context.Background(), "uploads/", &PostPolicyOptions{Expiry: time.Hour})
+	require.ErrorIs(t, err, ErrInvalidArgument)
 }
@@ -0,0 +1,383 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+// Package conformance checks that a commonblobgo.CloudStorage behaves like the storages of the providers,
+// so that the in-tree implementations don't drift apart and the third-party ones can certify themselves.
+//
+//	func TestConformance(t *testing.T) {
+//		conformance.RunSuite(t, func(t *testing.T) commonblobgo.CloudStorage {
+//			return newMyStorage(t)
+//		})
+//	}
+package conformance
+
+import (
+	"context"
+	"crypto/md5" //nolint:gosec
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	commonblobgo "github.com/AccelByte/common-blob-go"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// test is a behavior of the contract, checked on the keys under prefix.
+type test struct {
+	name string
+	f    func(t *testing.T, storage commonblobgo.CloudStorage, prefix string)
+}
+
+// RunSuite runs the conformance tests as subtests of t. newStorage is called by each of them, and may return
+// the same storage every time, the tests only use the keys under a prefix of their own, which are deleted
+// once they end.
+func RunSuite(t *testing.T, newStorage func(t *testing.T) commonblobgo.CloudStorage) {
+	for _, test := range []test{
+		{"RoundTrip", testRoundTrip},
+		{"ZeroByteObject", testZeroByteObject},
+		{"UnicodeKeys", testUnicodeKeys},
+		{"NotFound", testNotFound},
+		{"DelimiterListing", testDelimiterListing},
+		{"RangeReader", testRangeReader},
+		{"Attributes", testAttributes},
+		{"SignedURL", testSignedURL},
+	} {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			storage := newStorage(t)
+			prefix := "conformance-" + uuid.New().String() + "/"
+
+			defer deleteAll(t, storage, prefix)
+
+			test.f(t, storage, prefix)
+		})
+	}
+}
+
+// deleteAll deletes the objects written under the prefix by a test.
+func deleteAll(t *testing.T, storage commonblobgo.CloudStorage, prefix string) {
+	var keys []string
+
+	err := commonblobgo.WalkPrefix(context.Background(), storage, prefix, func(object *commonblobgo.ListObject) error {
+		keys = append(keys, object.Key)
+
+		return nil
+	})
+	if err == nil && len(keys) > 0 {
+		err = storage.DeleteBatch(context.Background(), keys)
+	}
+
+	if err != nil {
+		t.Logf("unable to delete the objects under %s: %v", prefix, err)
+	}
+}
+
+// list returns the results of the listing, which must end with io.EOF and keep returning it.
+func list(t *testing.T, iter *commonblobgo.ListIterator) []*commonblobgo.ListObject {
+	ctx := context.Background()
+
+	var objects []*commonblobgo.ListObject
+
+	for {
+		object, err := iter.Next(ctx)
+		if err == io.EOF {
+			_, err = iter.Next(ctx)
+			require.Equal(t, io.EOF, err, "the listing must keep returning io.EOF")
+
+			return objects
+		}
+
+		require.NoError(t, err)
+
+		objects = append(objects, object)
+	}
+}
+
+func md5Sum(body []byte) []byte {
+	sum := md5.Sum(body) //nolint:gosec
+
+	return sum[:]
+}
+
+func testRoundTrip(t *testing.T, storage commonblobgo.CloudStorage, prefix string) {
+	ctx := context.Background()
+	key := prefix + "round-trip.json"
+
+	require.NoError(t, storage.Write(ctx, key, []byte(`{"version":1}`), nil))
+
+	body, err := storage.Get(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, `{"version":1}`, string(body))
+
+	exists, err := storage.Exists(ctx, key)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	// the objects are replaced as a whole
+	require.NoError(t, storage.Write(ctx, key, []byte(`{"version":2}`), nil))
+
+	reader, err := storage.GetReader(ctx, key)
+	require.NoError(t, err)
+
+	body, err = ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	require.Equal(t, `{"version":2}`, string(body))
+
+	writer, err := storage.GetWriter(ctx, key)
+	require.NoError(t, err)
+
+	_, err = writer.Write([]byte(`{"version":3}`))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	body, err = storage.Get(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, `{"version":3}`, string(body))
+
+	require.NoError(t, storage.Delete(ctx, key))
+
+	exists, err = storage.Exists(ctx, key)
+	require.NoError(t, err)
+	require.False(t, exists)
+}
+
+func testZeroByteObject(t *testing.T, storage commonblobgo.CloudStorage, prefix string) {
+	ctx := context.Background()
+	key := prefix + "empty"
+
+	require.NoError(t, storage.Write(ctx, key, nil, nil))
+
+	body, err := storage.Get(ctx, key)
+	require.NoError(t, err)
+	require.Empty(t, body)
+
+	attrs, err := storage.Attributes(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), attrs.Size)
+	require.Equal(t, md5Sum(nil), attrs.MD5, "the zero-byte objects have the MD5 of the empty content")
+
+	reader, err := storage.GetRangeReader(ctx, key, 0, -1)
+	require.NoError(t, err)
+
+	body, err = ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	require.Empty(t, body)
+}
+
+func testUnicodeKeys(t *testing.T, storage commonblobgo.CloudStorage, prefix string) {
+	ctx := context.Background()
+	keys := []string{
+		prefix + "données/été.json",
+		prefix + "with space+plus.txt",
+		prefix + "日本語/ファイル.txt",
+		prefix + "😀.txt",
+	}
+
+	for _, key := range keys {
+		require.NoError(t, storage.Write(ctx, key, []byte(key), nil), key)
+	}
+
+	for _, key := range keys {
+		body, err := storage.Get(ctx, key)
+		require.NoError(t, err, key)
+		require.Equal(t, key, string(body))
+	}
+
+	var listed []string
+	for _, object := range list(t, storage.List(ctx, prefix)) {
+		listed = append(listed, object.Key)
+	}
+
+	require.ElementsMatch(t, keys, listed)
+}
+
+func testNotFound(t *testing.T, storage commonblobgo.CloudStorage, prefix string) {
+	ctx := context.Background()
+	key := prefix + "missing.json"
+
+	requireNotFound := func(err error, op string) {
+		require.Error(t, err, op)
+		require.True(t, errors.Is(err, commonblobgo.ErrNotFound), "%s: %v", op, err)
+		require.Equal(t, commonblobgo.ErrorKindNotFound, commonblobgo.ErrorCode(err), op)
+	}
+
+	_, err := storage.Get(ctx, key)
+	requireNotFound(err, "Get")
+
+	_, err = storage.GetReader(ctx, key)
+	requireNotFound(err, "GetReader")
+
+	_, err = storage.GetRangeReader(ctx, key, 0, 1)
+	requireNotFound(err, "GetRangeReader")
+
+	_, err = storage.Attributes(ctx, key)
+	requireNotFound(err, "Attributes")
+
+	requireNotFound(storage.Copy(ctx, prefix+"copy.json", key), "Copy")
+
+	exists, err := storage.Exists(ctx, key)
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	// the missing objects are counted as deleted by the batches
+	require.NoError(t, storage.DeleteBatch(ctx, []string{key}))
+}
+
+func testDelimiterListing(t *testing.T, storage commonblobgo.CloudStorage, prefix string) {
+	ctx := context.Background()
+
+	for _, key := range []string{"a/1", "a/2", "a/b/3", "c"} {
+		require.NoError(t, storage.Write(ctx, prefix+key, []byte(key), nil))
+	}
+
+	objects := list(t, storage.ListWithOptions(ctx, &commonblobgo.ListOptions{Prefix: prefix, Delimiter: "/"}))
+	require.Len(t, objects, 2)
+	require.Equal(t, prefix+"a/", objects[0].Key)
+	require.True(t, objects[0].IsDir)
+	require.Equal(t, prefix+"c", objects[1].Key)
+	require.False(t, objects[1].IsDir)
+	require.Equal(t, int64(1), objects[1].Size)
+
+	var keys []string
+	for _, object := range list(t, storage.ListWithOptions(ctx, &commonblobgo.ListOptions{
+		Prefix:    prefix + "a/",
+		Delimiter: "/",
+	})) {
+		keys = append(keys, object.Key)
+	}
+
+	require.Equal(t, []string{prefix + "a/1", prefix + "a/2", prefix + "a/b/"}, keys)
+
+	// the flat listings return the nested objects in order
+	keys = nil
+	for _, object := range list(t, storage.List(ctx, prefix)) {
+		keys = append(keys, object.Key)
+	}
+
+	require.Equal(t, []string{prefix + "a/1", prefix + "a/2", prefix + "a/b/3", prefix + "c"}, keys)
+}
+
+func testRangeReader(t *testing.T, storage commonblobgo.CloudStorage, prefix string) {
+	ctx := context.Background()
+	key := prefix + "digits.txt"
+
+	require.NoError(t, storage.Write(ctx, key, []byte("0123456789"), nil))
+
+	for _, test := range []struct {
+		offset, length int64
+		expected       string
+	}{
+		{0, 10, "0123456789"},
+		{2, 3, "234"},
+		{2, -1, "23456789"},
+		{8, 10, "89"},
+		{10, 5, ""},
+		{10, -1, ""},
+	} {
+		reader, err := storage.GetRangeReader(ctx, key, test.offset, test.length)
+		require.NoError(t, err, "offset %d, length %d", test.offset, test.length)
+
+		body, err := ioutil.ReadAll(reader)
+		require.NoError(t, err)
+		require.NoError(t, reader.Close())
+		require.Equal(t, test.expected, string(body), "offset %d, length %d", test.offset, test.length)
+	}
+
+	for _, offset := range []int64{-1, 11} {
+		_, err := storage.GetRangeReader(ctx, key, offset, 1)
+		require.True(t, errors.Is(err, commonblobgo.ErrOutOfRange), "offset %d: %v", offset, err)
+	}
+}
+
+func testAttributes(t *testing.T, storage commonblobgo.CloudStorage, prefix string) {
+	ctx := context.Background()
+	key := prefix + "attributes.json"
+	body := []byte(`{"attributes":true}`)
+
+	require.NoError(t, storage.WriteWithOptions(ctx, key, body, &commonblobgo.WriteOptions{
+		ContentType:  "application/json",
+		CacheControl: "no-cache",
+		Metadata:     map[string]string{"Mixed-Case": "value"},
+	}))
+
+	attrs, err := storage.Attributes(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(body)), attrs.Size)
+	require.Equal(t, md5Sum(body), attrs.MD5)
+	require.Equal(t, "application/json", attrs.ContentType)
+	require.Equal(t, "no-cache", attrs.CacheControl)
+	require.Equal(t, map[string]string{"mixed-case": "value"}, attrs.Metadata, "the metadata keys are lowercase")
+	require.False(t, attrs.ModTime.IsZero())
+	require.Equal(t, time.UTC, attrs.ModTime.Location(), "the times are in UTC")
+	require.NotEmpty(t, attrs.ETag)
+
+	size, err := storage.GetSize(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, attrs.Size, size)
+
+	// the listings return the same attributes
+	objects := list(t, storage.List(ctx, key))
+	require.Len(t, objects, 1)
+	require.Equal(t, attrs.Size, objects[0].Size)
+	require.Equal(t, attrs.MD5, objects[0].MD5)
+	require.Equal(t, time.UTC, objects[0].ModTime.Location())
+
+	// the content type is detected when it's not set
+	require.NoError(t, storage.Write(ctx, prefix+"detected.txt", []byte("plain text"), nil))
+
+	attrs, err = storage.Attributes(ctx, prefix+"detected.txt")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(attrs.ContentType, "text/plain"), attrs.ContentType)
+}
+
+func testSignedURL(t *testing.T, storage commonblobgo.CloudStorage, prefix string) {
+	ctx := context.Background()
+	key := prefix + "signed.json"
+
+	// the GCS emulator storage rejects the GET URLs of the missing objects
+	require.NoError(t, storage.Write(ctx, key, []byte(`{"signed":true}`), nil))
+
+	for _, method := range []string{"GET", "PUT"} {
+		signedURL, err := storage.GetSignedURL(ctx, key, &commonblobgo.SignedURLOption{
+			Method: method,
+			Expiry: time.Minute,
+		})
+		require.NoError(t, err, method)
+
+		parsed, err := url.Parse(signedURL)
+		require.NoError(t, err)
+		require.Contains(t, []string{"http", "https"}, parsed.Scheme)
+		require.NotEmpty(t, parsed.Host)
+		require.True(t, strings.HasSuffix(parsed.Path, "/"+key), "the path %s must end with the key", parsed.Path)
+		require.NotEmpty(t, parsed.RawQuery, "the signature is in the query")
+	}
+
+	// the response overrides are only supported by GET URLs
+	_, err := storage.GetSignedURL(ctx, key, &commonblobgo.SignedURLOption{
+		Method:                     "PUT",
+		Expiry:                     time.Minute,
+		ResponseContentDisposition: "attachment",
+	})
+	require.True(t, errors.Is(err, commonblobgo.ErrInvalidArgument), "%v", err)
+}
@@ -0,0 +1,185 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// debugHTTPRedacted replaces the values of the query parameters carrying a signature or a credential.
+const debugHTTPRedacted = "REDACTED"
+
+var (
+	// debugHTTPSecretParams are the fragments of the names of the query parameters which are redacted,
+	// e.g. X-Amz-Signature, X-Goog-Credential, or the Policy and the Key-Pair-Id of the CloudFront URLs.
+	debugHTTPSecretParams = []string{
+		"signature", "credential", "security-token", "access_token", "policy", "key-pair-id", "googleaccessid",
+	}
+	// debugHTTPRequestIDHeaders are the response headers identifying the request for the support of the providers.
+	debugHTTPRequestIDHeaders = []string{"X-Amz-Request-Id", "X-Amz-Id-2", "X-Guploader-Uploadid"}
+)
+
+// httpDebugger wraps the transports of the providers with the logging of DebugHTTP, it's nil without it.
+type httpDebugger struct {
+	logger      Logger
+	bodyLimit   int
+	writeBodies bool
+}
+
+func newHTTPDebugger(options storageOptions) *httpDebugger {
+	if !options.debugHTTP {
+		return nil
+	}
+
+	return &httpDebugger{
+		logger:      options.logger,
+		bodyLimit:   options.debugHTTPBodyLimit,
+		writeBodies: options.debugHTTPWriteBodies,
+	}
+}
+
+// transport returns base, or the default transport when it's nil, logging the exchanges with DebugHTTP.
+func (d *httpDebugger) transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	if d == nil {
+		return base
+	}
+
+	return &debugTransport{base: base, debugger: d}
+}
+
+// debugTransport logs the method, the redacted URL, the status, the duration and the request IDs of every
+// exchange at the debug level. The bodies are truncated, and the bodies of the writes, which hold the objects
+// of the users, are only logged with DebugHTTPWriteBodies.
+type debugTransport struct {
+	base     http.RoundTripper
+	debugger *httpDebugger
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	logger := t.debugger.logger
+	target := redactURL(req.URL)
+
+	if t.logsRequestBody(req) {
+		// the request mustn't be modified by the transports
+		req = req.Clone(req.Context())
+
+		var body []byte
+		body, req.Body = peekBody(req.Body, t.debugger.bodyLimit)
+
+		logger.Debugf("HTTP %s %s request body: %q", req.Method, target, body)
+	}
+
+	started := time.Now()
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		logger.Debugf("HTTP %s %s failed in %s: %v", req.Method, target, time.Since(started), err)
+
+		return nil, err
+	}
+
+	logger.Debugf("HTTP %s %s: %s in %s, request IDs: [%s]", req.Method, target, resp.Status,
+		time.Since(started), requestIDs(resp.Header))
+
+	if t.debugger.bodyLimit > 0 && resp.Body != nil && resp.Body != http.NoBody {
+		var body []byte
+		body, resp.Body = peekBody(resp.Body, t.debugger.bodyLimit)
+
+		logger.Debugf("HTTP %s %s response body: %q", req.Method, target, body)
+	}
+
+	return resp, nil
+}
+
+func (t *debugTransport) logsRequestBody(req *http.Request) bool {
+	if t.debugger.bodyLimit <= 0 || req.Body == nil || req.Body == http.NoBody {
+		return false
+	}
+
+	switch req.Method {
+	case http.MethodPut, http.MethodPost, http.MethodPatch:
+		return t.debugger.writeBodies
+	}
+
+	return true
+}
+
+// redactURL returns the URL without its user info, and with the values of the secret query parameters redacted.
+func redactURL(u *url.URL) string {
+	redacted := *u
+	redacted.User = nil
+
+	query := redacted.Query()
+	for name := range query {
+		if isSecretQueryParam(name) {
+			query[name] = []string{debugHTTPRedacted}
+		}
+	}
+
+	redacted.RawQuery = query.Encode()
+
+	return redacted.String()
+}
+
+func isSecretQueryParam(name string) bool {
+	name = strings.ToLower(name)
+
+	for _, secret := range debugHTTPSecretParams {
+		if strings.Contains(name, secret) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func requestIDs(header http.Header) string {
+	var ids []string
+
+	for _, name := range debugHTTPRequestIDHeaders {
+		if id := header.Get(name); id != "" {
+			ids = append(ids, name+"="+id)
+		}
+	}
+
+	return strings.Join(ids, " ")
+}
+
+// peekBody reads the first limit bytes of the body, and returns them with a body reading the whole content.
+// A read error is left to the reads of the returned body, which read the body again after the peeked bytes.
+func peekBody(body io.ReadCloser, limit int) ([]byte, io.ReadCloser) {
+	peeked := make([]byte, limit)
+	n, _ := io.ReadFull(body, peeked)
+	peeked = peeked[:n]
+
+	return peeked, peekedBody{Reader: io.MultiReader(bytes.NewReader(peeked), body), Closer: body}
+}
+
+// peekedBody reads the peeked bytes before the rest of the body.
+type peekedBody struct {
+	io.Reader
+	io.Closer
+}
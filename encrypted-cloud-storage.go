@@ -0,0 +1,411 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metadata keys of the encrypted objects
+const (
+	encryptionKeyIDMetadataKey = "encryption-key-id"
+	encryptionNonceMetadataKey = "encryption-nonce"
+	plaintextSizeMetadataKey   = "plaintext-size"
+)
+
+// KeyProvider provides the AES keys used by EncryptedCloudStorage.
+type KeyProvider interface {
+	// CurrentKey returns the key used to encrypt the new objects, and its ID.
+	CurrentKey(ctx context.Context) (keyID string, key []byte, err error)
+	// Key returns the key with the ID recorded in an encrypted object.
+	Key(ctx context.Context, keyID string) ([]byte, error)
+}
+
+// StaticKeyProvider provides the keys held in memory.
+type StaticKeyProvider struct {
+	// CurrentKeyID is the ID of the key used to encrypt the new objects.
+	CurrentKeyID string
+	// Keys holds the 16, 24 or 32 bytes AES keys by ID. The old keys have to be kept to read the old objects.
+	Keys map[string][]byte
+}
+
+func (p *StaticKeyProvider) CurrentKey(ctx context.Context) (string, []byte, error) {
+	key, err := p.Key(ctx, p.CurrentKeyID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return p.CurrentKeyID, key, nil
+}
+
+func (p *StaticKeyProvider) Key(ctx context.Context, keyID string) ([]byte, error) {
+	key, ok := p.Keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown encryption key '%s'", keyID)
+	}
+
+	return key, nil
+}
+
+// EncryptedCloudStorage encrypts the objects with AES-GCM before writing them to the wrapped CloudStorage,
+// and decrypts them on read. The key ID and the nonce are stored in the object metadata, so the keys can be rotated.
+// The operations which don't read or write the object content are passed through unchanged.
+type EncryptedCloudStorage struct {
+	CloudStorage
+
+	keyProvider KeyProvider
+}
+
+var _ CloudStorage = (*EncryptedCloudStorage)(nil)
+
+// options returns the settings of the wrapped storage.
+func (ts *EncryptedCloudStorage) options() storageOptions {
+	return storageOptionsOf(ts.CloudStorage)
+}
+
+func NewEncryptedCloudStorage(inner CloudStorage, keyProvider KeyProvider) CloudStorage {
+	return &EncryptedCloudStorage{
+		CloudStorage: inner,
+		keyProvider:  keyProvider,
+	}
+}
+
+func (ts *EncryptedCloudStorage) Get(
+	ctx context.Context,
+	key string,
+) ([]byte, error) {
+	body, _, err := ts.GetWithAttributes(ctx, key)
+
+	return body, err
+}
+
+func (ts *EncryptedCloudStorage) GetWithAttributes(
+	ctx context.Context,
+	key string,
+) ([]byte, *Attributes, error) {
+	body, attrs, err := ts.CloudStorage.GetWithAttributes(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body, err = ts.decrypt(ctx, key, body, attrs.Metadata)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	attrs, err = plaintextAttributes(key, attrs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return body, attrs, nil
+}
+
+func (ts *EncryptedCloudStorage) GetIfModified(
+	ctx context.Context,
+	key string,
+	etag string,
+	modSince time.Time,
+) ([]byte, *Attributes, bool, error) {
+	body, attrs, notModified, err := ts.CloudStorage.GetIfModified(ctx, key, etag, modSince)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	if !notModified {
+		body, err = ts.decrypt(ctx, key, body, attrs.Metadata)
+		if err != nil {
+			return nil, nil, false, err
+		}
+	}
+
+	attrs, err = plaintextAttributes(key, attrs)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	return body, attrs, notModified, nil
+}
+
+func (ts *EncryptedCloudStorage) GetReader(
+	ctx context.Context,
+	key string,
+) (io.ReadCloser, error) {
+	body, err := ts.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(body)), nil
+}
+
+func (ts *EncryptedCloudStorage) GetRangeReader(
+	ctx context.Context,
+	key string,
+	offset,
+	length int64,
+) (io.ReadCloser, error) {
+	return nil, newTypedError(ErrNotSupported, fmt.Errorf("range reads of encrypted objects"))
+}
+
+// GetVersion is not supported, since the encryption metadata of the noncurrent versions isn't available.
+func (ts *EncryptedCloudStorage) GetVersion(
+	ctx context.Context,
+	key string,
+	version string,
+) ([]byte, error) {
+	return nil, newTypedError(ErrNotSupported, fmt.Errorf("version reads of encrypted objects"))
+}
+
+func (ts *EncryptedCloudStorage) Write(
+	ctx context.Context,
+	key string,
+	body []byte,
+	contentType *string,
+) error {
+	options := &WriteOptions{}
+	if contentType != nil {
+		options.ContentType = *contentType
+	}
+
+	return ts.WriteWithOptions(ctx, key, body, options)
+}
+
+func (ts *EncryptedCloudStorage) WriteWithOptions(
+	ctx context.Context,
+	key string,
+	body []byte,
+	opts *WriteOptions,
+) error {
+	keyID, encryptionKey, err := ts.keyProvider.CurrentKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	aead, err := newAEAD(encryptionKey)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	options := WriteOptions{}
+	if opts != nil {
+		options = *opts
+	}
+
+	// the caller's metadata is not modified
+	metadata := make(map[string]string, len(options.Metadata)+3) //nolint:gomnd
+	for metadataKey, value := range options.Metadata {
+		metadata[metadataKey] = value
+	}
+
+	metadata[encryptionKeyIDMetadataKey] = keyID
+	metadata[encryptionNonceMetadataKey] = base64.StdEncoding.EncodeToString(nonce)
+	metadata[plaintextSizeMetadataKey] = strconv.Itoa(len(body))
+	options.Metadata = metadata
+
+	return ts.CloudStorage.WriteWithOptions(ctx, key, aead.Seal(nil, nonce, body, nil), &options)
+}
+
+func (ts *EncryptedCloudStorage) GetWriter(
+	ctx context.Context,
+	key string,
+) (io.WriteCloser, error) {
+	return ts.GetWriterWithOptions(ctx, key, nil)
+}
+
+// GetWriterWithOptions buffers the whole object in memory, since AES-GCM seals the object at once.
+func (ts *EncryptedCloudStorage) GetWriterWithOptions(
+	ctx context.Context,
+	key string,
+	opts *WriteOptions,
+) (io.WriteCloser, error) {
+	return newUploadWriter(ctx, opts, func(ctx context.Context) (io.WriteCloser, error) {
+		return &encryptedWriter{
+			ctx:     ctx,
+			storage: ts,
+			key:     key,
+			opts:    opts,
+		}, nil
+	})
+}
+
+// Append is not supported, since AES-GCM seals the whole object.
+func (ts *EncryptedCloudStorage) Append(
+	ctx context.Context,
+	key string,
+	data []byte,
+) error {
+	return newTypedError(ErrNotSupported, fmt.Errorf("appends to encrypted objects"))
+}
+
+// StartMultipartUpload is not supported, since the parts are uploaded by the clients without being encrypted.
+func (ts *EncryptedCloudStorage) StartMultipartUpload(
+	ctx context.Context,
+	key string,
+	opts *WriteOptions,
+) (string, error) {
+	return "", newTypedError(ErrNotSupported, fmt.Errorf("multipart uploads of encrypted objects"))
+}
+
+func (ts *EncryptedCloudStorage) Attributes(
+	ctx context.Context,
+	key string,
+) (*Attributes, error) {
+	attrs, err := ts.CloudStorage.Attributes(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return plaintextAttributes(key, attrs)
+}
+
+// GetSize returns the size of the decrypted content.
+func (ts *EncryptedCloudStorage) GetSize(
+	ctx context.Context,
+	key string,
+) (int64, error) {
+	attrs, err := ts.Attributes(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+
+	return attrs.Size, nil
+}
+
+func (ts *EncryptedCloudStorage) UpdateAttributes(
+	ctx context.Context,
+	key string,
+	update AttributeUpdate,
+) (*Attributes, error) {
+	for metadataKey := range update.Metadata {
+		switch strings.ToLower(metadataKey) {
+		case encryptionKeyIDMetadataKey, encryptionNonceMetadataKey, plaintextSizeMetadataKey:
+			return nil, newTypedError(ErrInvalidArgument, fmt.Errorf("metadata key '%s' is reserved for encryption", metadataKey))
+		}
+	}
+
+	attrs, err := ts.CloudStorage.UpdateAttributes(ctx, key, update)
+	if err != nil {
+		return nil, err
+	}
+
+	return plaintextAttributes(key, attrs)
+}
+
+// decrypt returns the objects written without encryption unchanged.
+func (ts *EncryptedCloudStorage) decrypt(
+	ctx context.Context,
+	key string,
+	body []byte,
+	metadata map[string]string,
+) ([]byte, error) {
+	keyID, ok := metadata[encryptionKeyIDMetadataKey]
+	if !ok {
+		return body, nil
+	}
+
+	encryptionKey, err := ts.keyProvider.Key(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := base64.StdEncoding.DecodeString(metadata[encryptionNonceMetadataKey])
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption nonce of '%s': %v", key, err)
+	}
+
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid encryption nonce of '%s': expected %d bytes, got %d",
+			key, aead.NonceSize(), len(nonce))
+	}
+
+	plaintext, err := aead.Open(nil, nonce, body, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt '%s': %v", key, err)
+	}
+
+	return plaintext, nil
+}
+
+// plaintextAttributes describes the decrypted content of the object.
+func plaintextAttributes(key string, attrs *Attributes) (*Attributes, error) {
+	plaintextSize, ok := attrs.Metadata[plaintextSizeMetadataKey]
+	if !ok {
+		return attrs, nil
+	}
+
+	size, err := strconv.ParseInt(plaintextSize, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid plaintext size of '%s': %v", key, err)
+	}
+
+	attrs.Size = size
+	// the checksums of the ciphertext don't match the decrypted content
+	attrs.MD5 = nil
+	attrs.CRC32C = 0
+	attrs.HasCRC32C = false
+	attrs.SHA256 = nil
+
+	return attrs, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// encryptedWriter encrypts and writes the buffered object on Close.
+type encryptedWriter struct {
+	ctx     context.Context
+	storage *EncryptedCloudStorage
+	key     string
+	opts    *WriteOptions
+	buffer  bytes.Buffer
+}
+
+func (w *encryptedWriter) Write(p []byte) (int, error) {
+	return w.buffer.Write(p)
+}
+
+func (w *encryptedWriter) Close() error {
+	return w.storage.WriteWithOptions(w.ctx, w.key, w.buffer.Bytes(), w.opts)
+}
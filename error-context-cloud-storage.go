@@ -0,0 +1,575 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// errorContextCloudStorage wraps the errors of the storages opened by the factories with the operation,
+// the key and the bucket, e.g. `commonblobgo: Get "a/b.json" in bucket "my-bucket": object not found: ...`.
+// The errors are wrapped with %w, so errors.Is, errors.As and ErrorCode still see the original error.
+// Only the key and the bucket name are added, never the signed URLs nor the credentials.
+type errorContextCloudStorage struct {
+	inner      CloudStorage
+	bucketName string
+}
+
+var _ CloudStorage = (*errorContextCloudStorage)(nil)
+
+func newErrorContextCloudStorage(inner CloudStorage, bucketName string) CloudStorage {
+	return &errorContextCloudStorage{
+		inner:      inner,
+		bucketName: bucketName,
+	}
+}
+
+// wrap adds the context to the error, io.EOF is kept as is since it ends the iterators and the readers.
+func (ts *errorContextCloudStorage) wrap(op, key string, err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+
+	if key == "" {
+		return fmt.Errorf("commonblobgo: %s in bucket %q: %w", op, ts.bucketName, err)
+	}
+
+	return fmt.Errorf("commonblobgo: %s %q in bucket %q: %w", op, key, ts.bucketName, err)
+}
+
+// options returns the settings of the wrapped storage.
+func (ts *errorContextCloudStorage) options() storageOptions {
+	return storageOptionsOf(ts.inner)
+}
+
+// bucketLocation is the one of the wrapped storage, so that CopyObjectBetween still copies by the provider.
+func (ts *errorContextCloudStorage) bucketLocation() string {
+	locator, ok := ts.inner.(bucketLocator)
+	if !ok {
+		return ""
+	}
+
+	return locator.bucketLocation()
+}
+
+func listOptionsPrefix(opts *ListOptions) string {
+	if opts == nil {
+		return ""
+	}
+
+	return opts.Prefix
+}
+
+func (ts *errorContextCloudStorage) List(
+	ctx context.Context,
+	prefix string,
+) *ListIterator {
+	iter := ts.inner.List(ctx, prefix)
+
+	return newListIterator(func(ctx context.Context) (*ListObject, error) {
+		object, err := iter.Next(ctx)
+
+		return object, ts.wrap("List", prefix, err)
+	})
+}
+
+func (ts *errorContextCloudStorage) ListWithOptions(
+	ctx context.Context,
+	options *ListOptions,
+) *ListIterator {
+	iter := ts.inner.ListWithOptions(ctx, options)
+
+	return newListIterator(func(ctx context.Context) (*ListObject, error) {
+		object, err := iter.Next(ctx)
+
+		return object, ts.wrap("List", listOptionsPrefix(options), err)
+	})
+}
+
+func (ts *errorContextCloudStorage) ListVersions(
+	ctx context.Context,
+	prefix string,
+) *VersionIterator {
+	iter := ts.inner.ListVersions(ctx, prefix)
+
+	return newVersionIterator(func(ctx context.Context) (*ObjectVersion, error) {
+		version, err := iter.Next(ctx)
+
+		return version, ts.wrap("ListVersions", prefix, err)
+	})
+}
+
+func (ts *errorContextCloudStorage) Get(
+	ctx context.Context,
+	key string,
+) ([]byte, error) {
+	body, err := ts.inner.Get(ctx, key)
+
+	return body, ts.wrap("Get", key, err)
+}
+
+func (ts *errorContextCloudStorage) GetIfModified(
+	ctx context.Context,
+	key string,
+	etag string,
+	modSince time.Time,
+) ([]byte, *Attributes, bool, error) {
+	body, attrs, notModified, err := ts.inner.GetIfModified(ctx, key, etag, modSince)
+
+	return body, attrs, notModified, ts.wrap("GetIfModified", key, err)
+}
+
+func (ts *errorContextCloudStorage) GetWithAttributes(
+	ctx context.Context,
+	key string,
+) ([]byte, *Attributes, error) {
+	body, attrs, err := ts.inner.GetWithAttributes(ctx, key)
+
+	return body, attrs, ts.wrap("GetWithAttributes", key, err)
+}
+
+func (ts *errorContextCloudStorage) Delete(
+	ctx context.Context,
+	key string,
+) error {
+	return ts.wrap("Delete", key, ts.inner.Delete(ctx, key))
+}
+
+func (ts *errorContextCloudStorage) DeleteBatch(
+	ctx context.Context,
+	keys []string,
+) error {
+	return ts.wrap("DeleteBatch", "", ts.inner.DeleteBatch(ctx, keys))
+}
+
+func (ts *errorContextCloudStorage) CreateBucket(
+	ctx context.Context,
+	bucketPrefix string,
+	expirationTimeDays int64,
+) error {
+	return ts.wrap("CreateBucket", "", ts.inner.CreateBucket(ctx, bucketPrefix, expirationTimeDays))
+}
+
+func (ts *errorContextCloudStorage) CreateBucketWithOptions(
+	ctx context.Context,
+	opts *CreateBucketOptions,
+) error {
+	return ts.wrap("CreateBucket", "", ts.inner.CreateBucketWithOptions(ctx, opts))
+}
+
+func (ts *errorContextCloudStorage) Close() error {
+	return ts.wrap("Close", "", ts.inner.Close())
+}
+
+func (ts *errorContextCloudStorage) GetSignedURL(
+	ctx context.Context,
+	key string,
+	opts *SignedURLOption,
+) (string, error) {
+	url, err := ts.inner.GetSignedURL(ctx, key, opts)
+
+	return url, ts.wrap("GetSignedURL", key, err)
+}
+
+func (ts *errorContextCloudStorage) GetSignedPostPolicy(
+	ctx context.Context,
+	keyPrefix string,
+	opts *PostPolicyOptions,
+) (*PostPolicy, error) {
+	policy, err := ts.inner.GetSignedPostPolicy(ctx, keyPrefix, opts)
+
+	return policy, ts.wrap("GetSignedPostPolicy", keyPrefix, err)
+}
+
+func (ts *errorContextCloudStorage) GetPublicURL(key string) (string, error) {
+	url, err := ts.inner.GetPublicURL(key)
+
+	return url, ts.wrap("GetPublicURL", key, err)
+}
+
+func (ts *errorContextCloudStorage) As(i interface{}) bool {
+	return ts.inner.As(i)
+}
+
+func (ts *errorContextCloudStorage) Write(
+	ctx context.Context,
+	key string,
+	body []byte,
+	contentType *string,
+) error {
+	return ts.wrap("Write", key, ts.inner.Write(ctx, key, body, contentType))
+}
+
+func (ts *errorContextCloudStorage) WriteWithOptions(
+	ctx context.Context,
+	key string,
+	body []byte,
+	opts *WriteOptions,
+) error {
+	return ts.wrap("Write", key, ts.inner.WriteWithOptions(ctx, key, body, opts))
+}
+
+func (ts *errorContextCloudStorage) Attributes(
+	ctx context.Context,
+	key string,
+) (*Attributes, error) {
+	attrs, err := ts.inner.Attributes(ctx, key)
+
+	return attrs, ts.wrap("Attributes", key, err)
+}
+
+func (ts *errorContextCloudStorage) UpdateAttributes(
+	ctx context.Context,
+	key string,
+	update AttributeUpdate,
+) (*Attributes, error) {
+	attrs, err := ts.inner.UpdateAttributes(ctx, key, update)
+
+	return attrs, ts.wrap("UpdateAttributes", key, err)
+}
+
+func (ts *errorContextCloudStorage) SetTags(
+	ctx context.Context,
+	key string,
+	tags map[string]string,
+) error {
+	return ts.wrap("SetTags", key, ts.inner.SetTags(ctx, key, tags))
+}
+
+func (ts *errorContextCloudStorage) GetTags(
+	ctx context.Context,
+	key string,
+) (map[string]string, error) {
+	tags, err := ts.inner.GetTags(ctx, key)
+
+	return tags, ts.wrap("GetTags", key, err)
+}
+
+func (ts *errorContextCloudStorage) SetStorageClass(
+	ctx context.Context,
+	key string,
+	class string,
+) error {
+	return ts.wrap("SetStorageClass", key, ts.inner.SetStorageClass(ctx, key, class))
+}
+
+func (ts *errorContextCloudStorage) GetReader(
+	ctx context.Context,
+	key string,
+) (io.ReadCloser, error) {
+	reader, err := ts.inner.GetReader(ctx, key)
+	if err != nil {
+		return nil, ts.wrap("GetReader", key, err)
+	}
+
+	return &errorContextReader{ReadCloser: reader, wrap: func(err error) error {
+		return ts.wrap("Read", key, err)
+	}}, nil
+}
+
+func (ts *errorContextCloudStorage) GetRangeReader(
+	ctx context.Context,
+	key string,
+	offset int64,
+	length int64,
+) (io.ReadCloser, error) {
+	reader, err := ts.inner.GetRangeReader(ctx, key, offset, length)
+	if err != nil {
+		return nil, ts.wrap("GetRangeReader", key, err)
+	}
+
+	return &errorContextReader{ReadCloser: reader, wrap: func(err error) error {
+		return ts.wrap("Read", key, err)
+	}}, nil
+}
+
+func (ts *errorContextCloudStorage) GetWriter(
+	ctx context.Context,
+	key string,
+) (io.WriteCloser, error) {
+	writer, err := ts.inner.GetWriter(ctx, key)
+	if err != nil {
+		return nil, ts.wrap("GetWriter", key, err)
+	}
+
+	return &errorContextWriter{WriteCloser: writer, wrap: func(err error) error {
+		return ts.wrap("Write", key, err)
+	}}, nil
+}
+
+func (ts *errorContextCloudStorage) GetWriterWithOptions(
+	ctx context.Context,
+	key string,
+	opts *WriteOptions,
+) (io.WriteCloser, error) {
+	writer, err := ts.inner.GetWriterWithOptions(ctx, key, opts)
+	if err != nil {
+		return nil, ts.wrap("GetWriter", key, err)
+	}
+
+	return &errorContextWriter{WriteCloser: writer, wrap: func(err error) error {
+		return ts.wrap("Write", key, err)
+	}}, nil
+}
+
+func (ts *errorContextCloudStorage) Exists(
+	ctx context.Context,
+	key string,
+) (bool, error) {
+	exists, err := ts.inner.Exists(ctx, key)
+
+	return exists, ts.wrap("Exists", key, err)
+}
+
+func (ts *errorContextCloudStorage) Copy(
+	ctx context.Context,
+	dstKey string,
+	srcKey string,
+) error {
+	return ts.wrap(fmt.Sprintf("Copy %q to", srcKey), dstKey, ts.inner.Copy(ctx, dstKey, srcKey))
+}
+
+func (ts *errorContextCloudStorage) Move(
+	ctx context.Context,
+	dstKey string,
+	srcKey string,
+) error {
+	return ts.wrap(fmt.Sprintf("Move %q to", srcKey), dstKey, ts.inner.Move(ctx, dstKey, srcKey))
+}
+
+func (ts *errorContextCloudStorage) Ping(ctx context.Context) error {
+	return ts.wrap("Ping", "", ts.inner.Ping(ctx))
+}
+
+func (ts *errorContextCloudStorage) GetVersion(
+	ctx context.Context,
+	key string,
+	version string,
+) ([]byte, error) {
+	body, err := ts.inner.GetVersion(ctx, key, version)
+
+	return body, ts.wrap("GetVersion", key, err)
+}
+
+func (ts *errorContextCloudStorage) DeleteVersion(
+	ctx context.Context,
+	key string,
+	version string,
+) error {
+	return ts.wrap("DeleteVersion", key, ts.inner.DeleteVersion(ctx, key, version))
+}
+
+func (ts *errorContextCloudStorage) SetObjectRetention(
+	ctx context.Context,
+	key string,
+	until time.Time,
+	mode string,
+) error {
+	return ts.wrap("SetObjectRetention", key, ts.inner.SetObjectRetention(ctx, key, until, mode))
+}
+
+func (ts *errorContextCloudStorage) GetObjectRetention(
+	ctx context.Context,
+	key string,
+) (*ObjectRetention, error) {
+	retention, err := ts.inner.GetObjectRetention(ctx, key)
+
+	return retention, ts.wrap("GetObjectRetention", key, err)
+}
+
+func (ts *errorContextCloudStorage) Restore(
+	ctx context.Context,
+	key string,
+	days int,
+	tier string,
+) error {
+	return ts.wrap("Restore", key, ts.inner.Restore(ctx, key, days, tier))
+}
+
+func (ts *errorContextCloudStorage) RestoreStatus(
+	ctx context.Context,
+	key string,
+) (RestoreState, error) {
+	state, err := ts.inner.RestoreStatus(ctx, key)
+
+	return state, ts.wrap("RestoreStatus", key, err)
+}
+
+func (ts *errorContextCloudStorage) Append(
+	ctx context.Context,
+	key string,
+	data []byte,
+) error {
+	return ts.wrap("Append", key, ts.inner.Append(ctx, key, data))
+}
+
+func (ts *errorContextCloudStorage) GetSize(
+	ctx context.Context,
+	key string,
+) (int64, error) {
+	size, err := ts.inner.GetSize(ctx, key)
+
+	return size, ts.wrap("GetSize", key, err)
+}
+
+func (ts *errorContextCloudStorage) VerifyDownload(
+	ctx context.Context,
+	key string,
+) error {
+	return ts.wrap("VerifyDownload", key, ts.inner.VerifyDownload(ctx, key))
+}
+
+func (ts *errorContextCloudStorage) StartMultipartUpload(
+	ctx context.Context,
+	key string,
+	opts *WriteOptions,
+) (string, error) {
+	uploadID, err := ts.inner.StartMultipartUpload(ctx, key, opts)
+
+	return uploadID, ts.wrap("StartMultipartUpload", key, err)
+}
+
+func (ts *errorContextCloudStorage) SignUploadPartURL(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	partNumber int,
+	expiry time.Duration,
+) (string, error) {
+	url, err := ts.inner.SignUploadPartURL(ctx, key, uploadID, partNumber, expiry)
+
+	return url, ts.wrap("SignUploadPartURL", key, err)
+}
+
+func (ts *errorContextCloudStorage) CompleteMultipartUpload(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	parts []CompletedPart,
+) error {
+	return ts.wrap("CompleteMultipartUpload", key, ts.inner.CompleteMultipartUpload(ctx, key, uploadID, parts))
+}
+
+func (ts *errorContextCloudStorage) AbortMultipartUpload(
+	ctx context.Context,
+	key string,
+	uploadID string,
+) error {
+	return ts.wrap("AbortMultipartUpload", key, ts.inner.AbortMultipartUpload(ctx, key, uploadID))
+}
+
+func (ts *errorContextCloudStorage) SetLifecycle(
+	ctx context.Context,
+	rules []LifecycleRule,
+	opts *LifecycleOptions,
+) error {
+	return ts.wrap("SetLifecycle", "", ts.inner.SetLifecycle(ctx, rules, opts))
+}
+
+func (ts *errorContextCloudStorage) GetLifecycle(ctx context.Context) ([]LifecycleRule, error) {
+	rules, err := ts.inner.GetLifecycle(ctx)
+
+	return rules, ts.wrap("GetLifecycle", "", err)
+}
+
+func (ts *errorContextCloudStorage) SetVersioning(
+	ctx context.Context,
+	enabled bool,
+) error {
+	return ts.wrap("SetVersioning", "", ts.inner.SetVersioning(ctx, enabled))
+}
+
+func (ts *errorContextCloudStorage) GetVersioning(ctx context.Context) (bool, error) {
+	enabled, err := ts.inner.GetVersioning(ctx)
+
+	return enabled, ts.wrap("GetVersioning", "", err)
+}
+
+func (ts *errorContextCloudStorage) GetVersioningState(ctx context.Context) (VersioningState, error) {
+	state, err := ts.inner.GetVersioningState(ctx)
+
+	return state, ts.wrap("GetVersioningState", "", err)
+}
+
+func (ts *errorContextCloudStorage) SetCORS(
+	ctx context.Context,
+	rules []CORSRule,
+) error {
+	return ts.wrap("SetCORS", "", ts.inner.SetCORS(ctx, rules))
+}
+
+func (ts *errorContextCloudStorage) GetCORS(ctx context.Context) ([]CORSRule, error) {
+	rules, err := ts.inner.GetCORS(ctx)
+
+	return rules, ts.wrap("GetCORS", "", err)
+}
+
+func (ts *errorContextCloudStorage) SetPublicAccessBlock(
+	ctx context.Context,
+	blocked bool,
+) error {
+	return ts.wrap("SetPublicAccessBlock", "", ts.inner.SetPublicAccessBlock(ctx, blocked))
+}
+
+func (ts *errorContextCloudStorage) GetPublicAccessBlock(ctx context.Context) (bool, error) {
+	blocked, err := ts.inner.GetPublicAccessBlock(ctx)
+
+	return blocked, ts.wrap("GetPublicAccessBlock", "", err)
+}
+
+func (ts *errorContextCloudStorage) GetPublicAccessBlockDetails(ctx context.Context) (*PublicAccessBlock, error) {
+	block, err := ts.inner.GetPublicAccessBlockDetails(ctx)
+
+	return block, ts.wrap("GetPublicAccessBlockDetails", "", err)
+}
+
+// errorContextReader wraps the read errors of the object, io.EOF included as is.
+type errorContextReader struct {
+	io.ReadCloser
+
+	wrap func(err error) error
+}
+
+func (r *errorContextReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+
+	return n, r.wrap(err)
+}
+
+func (r *errorContextReader) Close() error {
+	return r.wrap(r.ReadCloser.Close())
+}
+
+// errorContextWriter wraps the write errors of the object, the upload errors are returned by Close.
+type errorContextWriter struct {
+	io.WriteCloser
+
+	wrap func(err error) error
+}
+
+func (w *errorContextWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+
+	return n, w.wrap(err)
+}
+
+func (w *errorContextWriter) Close() error {
+	return w.wrap(w.WriteCloser.Close())
+}
@@ -0,0 +1,465 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"gocloud.dev/gcerrors"
+	"google.golang.org/api/googleapi"
+)
+
+var (
+	// ErrNotFound is returned when the object doesn't exist.
+	ErrNotFound = errors.New("object not found")
+	// ErrOutOfRange is returned when a range read starts beyond the end of the object.
+	ErrOutOfRange = errors.New("offset out of range")
+	// ErrMetadataTooLarge is returned when the object metadata exceeds the provider limit.
+	ErrMetadataTooLarge = errors.New("metadata too large")
+	// ErrInvalidArgument is returned when an argument is rejected before calling the provider.
+	ErrInvalidArgument = errors.New("invalid argument")
+	// ErrNotSupported is returned when the provider doesn't support the operation.
+	ErrNotSupported = errors.New("operation not supported")
+	// ErrPreconditionFailed is returned when the condition of a conditional write doesn't hold.
+	ErrPreconditionFailed = errors.New("precondition failed")
+	// ErrBucketNotFound is returned when the bucket doesn't exist.
+	ErrBucketNotFound = errors.New("bucket not found")
+	// ErrPermissionDenied is returned when the credentials are not allowed to access the bucket or the object.
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrAccessDenied is ErrPermissionDenied, under the name used by the bucket operations.
+	ErrAccessDenied = ErrPermissionDenied
+	// ErrArchived is returned when reading an archived object which has not been restored.
+	ErrArchived = errors.New("object archived")
+	// ErrLimitExceeded is returned when a batch operation goes past its configured limit.
+	ErrLimitExceeded = errors.New("limit exceeded")
+	// ErrChecksumMismatch is returned when the provider rejects the checksum of a write,
+	// or when the checksum of the written object doesn't match the content.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrNetworkUnreachable is returned when the provider endpoint can't be reached.
+	ErrNetworkUnreachable = errors.New("network unreachable")
+	// ErrBucketRegionMismatch is returned when creating a bucket which already exists in another region or location.
+	ErrBucketRegionMismatch = errors.New("bucket exists in another region")
+	// ErrObjectLocked is returned when deleting or overwriting an object protected by a retention.
+	ErrObjectLocked = errors.New("object locked")
+	// ErrClosed is returned by the operations called after Close.
+	ErrClosed = errors.New("storage closed")
+)
+
+// typedError marks a provider error with one of the errors of this package, so it can be checked with errors.Is
+// while the provider error is still available with errors.As.
+type typedError struct {
+	kind error
+	err  error
+}
+
+func newTypedError(kind, err error) error {
+	return &typedError{
+		kind: kind,
+		err:  err,
+	}
+}
+
+func (e *typedError) Error() string {
+	return fmt.Sprintf("%v: %v", e.kind, e.err)
+}
+
+func (e *typedError) Is(target error) bool {
+	return e.kind == target
+}
+
+func (e *typedError) Unwrap() error {
+	return e.err
+}
+
+// requestIDError adds the request ID of the response of the provider to an error which doesn't carry it,
+// e.g. the errors of the GCS reads.
+type requestIDError struct {
+	err       error
+	requestID string
+}
+
+func (e *requestIDError) Error() string {
+	return fmt.Sprintf("%v (request ID: %s)", e.err, e.requestID)
+}
+
+func (e *requestIDError) Unwrap() error {
+	return e.err
+}
+
+// RequestID returns the ID of the request of the provider which failed, which the support of the provider asks for:
+// the x-amz-request-id of S3, the x-amz-id-2 being in the message of the S3 errors, or the x-guploader-uploadid
+// of GCS. It's empty when the error didn't come from a response of the provider.
+func RequestID(err error) string {
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) && reqErr.RequestID() != "" {
+		return reqErr.RequestID()
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		if requestID := providerRequestID(apiErr.Header); requestID != "" {
+			return requestID
+		}
+	}
+
+	var idErr *requestIDError
+	if errors.As(err, &idErr) {
+		return idErr.requestID
+	}
+
+	return ""
+}
+
+// BatchError is returned by batch operations when some of the keys failed.
+// The keys which are not in Errors succeeded.
+type BatchError struct {
+	Errors map[string]error
+}
+
+func (e *BatchError) Error() string {
+	keys := make([]string, 0, len(e.Errors))
+	for key := range e.Errors {
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return "batch operation failed"
+	}
+
+	sort.Strings(keys)
+
+	return fmt.Sprintf("batch operation failed for %d keys, first %s: %v", len(keys), keys[0], e.Errors[keys[0]])
+}
+
+// objectError maps an error returned for an object, by the blob package or by the provider clients,
+// onto the typed errors of this package.
+func objectError(err error) error {
+	if isObjectLockedError(err) {
+		return newTypedError(ErrObjectLocked, err)
+	}
+
+	switch gcerrors.Code(err) {
+	case gcerrors.OK:
+		return nil
+	case gcerrors.NotFound:
+		return newTypedError(ErrNotFound, err)
+	case gcerrors.PermissionDenied:
+		return newTypedError(ErrPermissionDenied, err)
+	case gcerrors.FailedPrecondition:
+		return newTypedError(ErrPreconditionFailed, err)
+	}
+
+	// range errors are not classified by the blob package, and the provider clients are used directly by some calls
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		switch awsErr.Code() {
+		case "InvalidRange":
+			return newTypedError(ErrOutOfRange, err)
+		case s3.ErrCodeNoSuchBucket:
+			return newTypedError(ErrBucketNotFound, err)
+		case s3.ErrCodeNoSuchKey, s3.ErrCodeNoSuchUpload, "NotFound":
+			return newTypedError(ErrNotFound, err)
+		case "AccessDenied", "Forbidden":
+			return newTypedError(ErrPermissionDenied, err)
+		case "PreconditionFailed", "ConditionalRequestConflict":
+			return newTypedError(ErrPreconditionFailed, err)
+		case s3.ErrCodeInvalidObjectState:
+			return newTypedError(ErrArchived, err)
+		case "BadDigest", "InvalidDigest":
+			return newTypedError(ErrChecksumMismatch, err)
+		}
+	}
+
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return newTypedError(ErrNotFound, err)
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case http.StatusRequestedRangeNotSatisfiable:
+			return newTypedError(ErrOutOfRange, err)
+		case http.StatusNotFound:
+			return newTypedError(ErrNotFound, err)
+		case http.StatusForbidden, http.StatusUnauthorized:
+			return newTypedError(ErrPermissionDenied, err)
+		case http.StatusPreconditionFailed:
+			return newTypedError(ErrPreconditionFailed, err)
+		case http.StatusBadRequest:
+			// GCS rejects the uploads whose content doesn't match the provided MD5 or CRC32C
+			if strings.Contains(apiErr.Message, "hash") {
+				return newTypedError(ErrChecksumMismatch, err)
+			}
+		}
+	}
+
+	return err
+}
+
+// isObjectLockedError reports whether the provider denied the request because of the retention of the object,
+// both providers answer it with a plain 403 so it is told apart by the message.
+func isObjectLockedError(err error) bool {
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) && awsErr.Code() == "AccessDenied" {
+		return strings.Contains(strings.ToLower(awsErr.Message()), "object lock") ||
+			strings.Contains(strings.ToLower(awsErr.Message()), "retention")
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusForbidden {
+		return strings.Contains(strings.ToLower(apiErr.Message), "retention")
+	}
+
+	return false
+}
+
+// awsBucketError maps an error returned by a bucket-level S3 call onto the typed errors of this package.
+func awsBucketError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) {
+		switch reqErr.StatusCode() {
+		case http.StatusNotFound:
+			return newTypedError(ErrBucketNotFound, err)
+		case http.StatusForbidden, http.StatusUnauthorized:
+			return newTypedError(ErrPermissionDenied, err)
+		}
+	}
+
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) && awsErr.Code() == request.ErrCodeRequestError {
+		return newTypedError(ErrNetworkUnreachable, err)
+	}
+
+	return err
+}
+
+// gcpBucketError maps an error returned by a bucket-level GCS call onto the typed errors of this package.
+func gcpBucketError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, storage.ErrBucketNotExist) {
+		return newTypedError(ErrBucketNotFound, err)
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case http.StatusNotFound:
+			return newTypedError(ErrBucketNotFound, err)
+		case http.StatusForbidden, http.StatusUnauthorized:
+			return newTypedError(ErrPermissionDenied, err)
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return newTypedError(ErrNetworkUnreachable, err)
+	}
+
+	return err
+}
+
+// ErrorKind is the class of an error returned by the storages, like the gcerrors.ErrorCode of gocloud.
+type ErrorKind int
+
+const (
+	// ErrorKindOK is the kind of a nil error.
+	ErrorKindOK ErrorKind = iota
+	// ErrorKindUnknown is the kind of the errors which are not classified.
+	ErrorKindUnknown
+	// ErrorKindNotFound is the kind of the missing objects and buckets.
+	ErrorKindNotFound
+	// ErrorKindPermissionDenied is the kind of the requests rejected for the credentials, or for the retention of the object.
+	ErrorKindPermissionDenied
+	// ErrorKindPreconditionFailed is the kind of the conditional requests whose condition doesn't hold.
+	ErrorKindPreconditionFailed
+	// ErrorKindResourceExhausted is the kind of the requests throttled by the provider, or going past a limit.
+	ErrorKindResourceExhausted
+	// ErrorKindCanceled is the kind of the requests whose context was canceled.
+	ErrorKindCanceled
+	// ErrorKindDeadlineExceeded is the kind of the requests whose context deadline passed.
+	ErrorKindDeadlineExceeded
+	// ErrorKindUnavailable is the kind of the transient failures of the provider, e.g. the 503 and the timeouts.
+	ErrorKindUnavailable
+)
+
+var errorKindNames = map[ErrorKind]string{
+	ErrorKindOK:                 "OK",
+	ErrorKindUnknown:            "Unknown",
+	ErrorKindNotFound:           "NotFound",
+	ErrorKindPermissionDenied:   "PermissionDenied",
+	ErrorKindPreconditionFailed: "PreconditionFailed",
+	ErrorKindResourceExhausted:  "ResourceExhausted",
+	ErrorKindCanceled:           "Canceled",
+	ErrorKindDeadlineExceeded:   "DeadlineExceeded",
+	ErrorKindUnavailable:        "Unavailable",
+}
+
+func (k ErrorKind) String() string {
+	if name, ok := errorKindNames[k]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("ErrorKind(%d)", int(k))
+}
+
+// ErrorCode classifies an error returned by the storages, through the fmt.Errorf("%w") chains. The typed errors
+// of this package are classified first, then the AWS error codes, the GCS statuses and the gocloud codes.
+func ErrorCode(err error) ErrorKind {
+	if err == nil {
+		return ErrorKindOK
+	}
+
+	if kind := typedErrorKind(err); kind != ErrorKindUnknown {
+		return kind
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ErrorKindCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorKindDeadlineExceeded
+	}
+
+	if kind := awsErrorKind(err); kind != ErrorKindUnknown {
+		return kind
+	}
+
+	if kind := gcpErrorKind(err); kind != ErrorKindUnknown {
+		return kind
+	}
+
+	switch gcerrors.Code(err) {
+	case gcerrors.NotFound:
+		return ErrorKindNotFound
+	case gcerrors.PermissionDenied:
+		return ErrorKindPermissionDenied
+	case gcerrors.FailedPrecondition:
+		return ErrorKindPreconditionFailed
+	case gcerrors.ResourceExhausted:
+		return ErrorKindResourceExhausted
+	case gcerrors.Canceled:
+		return ErrorKindCanceled
+	case gcerrors.DeadlineExceeded:
+		return ErrorKindDeadlineExceeded
+	}
+
+	return ErrorKindUnknown
+}
+
+func typedErrorKind(err error) ErrorKind {
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrBucketNotFound):
+		return ErrorKindNotFound
+	case errors.Is(err, ErrPermissionDenied), errors.Is(err, ErrObjectLocked):
+		return ErrorKindPermissionDenied
+	case errors.Is(err, ErrPreconditionFailed):
+		return ErrorKindPreconditionFailed
+	case errors.Is(err, ErrLimitExceeded):
+		return ErrorKindResourceExhausted
+	case errors.Is(err, ErrNetworkUnreachable):
+		return ErrorKindUnavailable
+	}
+
+	var faultErr *FaultError
+	if errors.As(err, &faultErr) {
+		return httpStatusKind(faultErr.StatusCode)
+	}
+
+	return ErrorKindUnknown
+}
+
+func awsErrorKind(err error) ErrorKind {
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) {
+		return ErrorKindUnknown
+	}
+
+	switch awsErr.Code() {
+	case s3.ErrCodeNoSuchBucket, s3.ErrCodeNoSuchKey, s3.ErrCodeNoSuchUpload, "NotFound":
+		return ErrorKindNotFound
+	case "AccessDenied", "Forbidden":
+		return ErrorKindPermissionDenied
+	case "PreconditionFailed", "ConditionalRequestConflict":
+		return ErrorKindPreconditionFailed
+	case "SlowDown", "Throttling", "ThrottlingException", "RequestLimitExceeded", "TooManyRequestsException":
+		return ErrorKindResourceExhausted
+	case "RequestTimeout", "InternalError", "ServiceUnavailable", request.ErrCodeRequestError:
+		return ErrorKindUnavailable
+	case request.CanceledErrorCode:
+		// the SDK reports the passed deadlines as canceled requests
+		if errors.Is(awsErr.OrigErr(), context.DeadlineExceeded) {
+			return ErrorKindDeadlineExceeded
+		}
+
+		return ErrorKindCanceled
+	}
+
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) {
+		return httpStatusKind(reqErr.StatusCode())
+	}
+
+	return ErrorKindUnknown
+}
+
+func gcpErrorKind(err error) ErrorKind {
+	if errors.Is(err, storage.ErrObjectNotExist) || errors.Is(err, storage.ErrBucketNotExist) {
+		return ErrorKindNotFound
+	}
+
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return ErrorKindUnknown
+	}
+
+	return httpStatusKind(apiErr.Code)
+}
+
+// httpStatusKind classifies the HTTP status of a response of the provider.
+func httpStatusKind(statusCode int) ErrorKind {
+	switch statusCode {
+	case http.StatusNotFound:
+		return ErrorKindNotFound
+	case http.StatusForbidden, http.StatusUnauthorized:
+		return ErrorKindPermissionDenied
+	case http.StatusPreconditionFailed:
+		return ErrorKindPreconditionFailed
+	case http.StatusTooManyRequests:
+		return ErrorKindResourceExhausted
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return ErrorKindUnavailable
+	}
+
+	return ErrorKindUnknown
+}
@@ -0,0 +1,592 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package fakeblob
+
+import (
+	"context"
+	"crypto/md5" //nolint:gosec
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	commonblobgo "github.com/AccelByte/common-blob-go"
+)
+
+const (
+	// host is the host of the URLs, which can't be resolved
+	host = "fakeblob.invalid"
+	// defaultSignedURLExpiry is the expiry of the signed URLs without one, as for the providers
+	defaultSignedURLExpiry = time.Hour
+	// maxPartNumber is the number of parts of the S3 multipart uploads
+	maxPartNumber = 10000
+)
+
+// multipartUpload is a multipart upload started by StartMultipartUpload.
+type multipartUpload struct {
+	key   string
+	opts  *commonblobgo.WriteOptions
+	parts map[int][]byte
+}
+
+func (s *Storage) CreateBucket(
+	ctx context.Context,
+	bucketPrefix string,
+	expirationTimeDays int64,
+) error {
+	return s.CreateBucketWithOptions(ctx, &commonblobgo.CreateBucketOptions{
+		Prefix:         bucketPrefix,
+		ExpirationDays: expirationTimeDays,
+	})
+}
+
+// CreateBucketWithOptions sets the expiration rule and the public access block of the options,
+// the other settings have no effect on the fake.
+func (s *Storage) CreateBucketWithOptions(
+	ctx context.Context,
+	opts *commonblobgo.CreateBucketOptions,
+) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	if opts.RetentionPeriod < 0 {
+		return newError(commonblobgo.ErrInvalidArgument, "the retention period can't be negative")
+	}
+
+	if opts.ExpirationDays > 0 {
+		s.lifecycle = []commonblobgo.LifecycleRule{{
+			Prefix:         opts.Prefix,
+			ExpirationDays: opts.ExpirationDays,
+		}}
+	}
+
+	if opts.BlockPublicAccess {
+		s.publicAccessBlock = blockedPublicAccess(true)
+	}
+
+	return nil
+}
+
+// SetLifecycle only keeps the rules, the objects don't expire.
+func (s *Storage) SetLifecycle(
+	ctx context.Context,
+	rules []commonblobgo.LifecycleRule,
+	opts *commonblobgo.LifecycleOptions,
+) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	prefixes := make(map[string]bool, len(rules))
+
+	for _, rule := range rules {
+		if err := validateLifecycleRule(rule); err != nil {
+			return err
+		}
+
+		if prefixes[rule.Prefix] {
+			return newError(commonblobgo.ErrInvalidArgument, "several lifecycle rules of '%s'", rule.Prefix)
+		}
+
+		prefixes[rule.Prefix] = true
+	}
+
+	var kept []commonblobgo.LifecycleRule
+
+	if opts == nil || !opts.ReplaceAll {
+		for _, rule := range s.lifecycle {
+			if !prefixes[rule.Prefix] {
+				kept = append(kept, rule)
+			}
+		}
+	}
+
+	s.lifecycle = append(kept, rules...)
+
+	return nil
+}
+
+func validateLifecycleRule(rule commonblobgo.LifecycleRule) error {
+	switch {
+	case rule.ExpirationDays < 0 || rule.NoncurrentVersionExpirationDays < 0 || rule.TransitionDays < 0:
+		return newError(commonblobgo.ErrInvalidArgument, "the days of the lifecycle rule of '%s' can't be negative",
+			rule.Prefix)
+	case rule.TransitionDays > 0 && rule.TransitionStorageClass == "":
+		return newError(commonblobgo.ErrInvalidArgument, "the transition of the lifecycle rule of '%s' has no storage class",
+			rule.Prefix)
+	case rule.ExpirationDays == 0 && rule.NoncurrentVersionExpirationDays == 0 && rule.TransitionStorageClass == "":
+		return newError(commonblobgo.ErrInvalidArgument, "the lifecycle rule of '%s' has no action", rule.Prefix)
+	default:
+		return nil
+	}
+}
+
+func (s *Storage) GetLifecycle(ctx context.Context) ([]commonblobgo.LifecycleRule, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	return append([]commonblobgo.LifecycleRule{}, s.lifecycle...), nil
+}
+
+// SetVersioning suspends the versioning when it's disabled, as on S3.
+func (s *Storage) SetVersioning(ctx context.Context, enabled bool) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	switch {
+	case enabled:
+		s.versioning = commonblobgo.VersioningEnabled
+	case s.versioning == commonblobgo.VersioningEnabled:
+		s.versioning = commonblobgo.VersioningSuspended
+	}
+
+	return nil
+}
+
+func (s *Storage) GetVersioning(ctx context.Context) (bool, error) {
+	state, err := s.GetVersioningState(ctx)
+
+	return state == commonblobgo.VersioningEnabled, err
+}
+
+func (s *Storage) GetVersioningState(ctx context.Context) (commonblobgo.VersioningState, error) {
+	if err := s.lock(ctx); err != nil {
+		return "", err
+	}
+	defer s.mu.Unlock()
+
+	return s.versioning, nil
+}
+
+func (s *Storage) SetCORS(ctx context.Context, rules []commonblobgo.CORSRule) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	for _, rule := range rules {
+		if len(rule.Origins) == 0 || len(rule.Methods) == 0 {
+			return newError(commonblobgo.ErrInvalidArgument, "the CORS rules require origins and methods")
+		}
+
+		if rule.MaxAge < 0 {
+			return newError(commonblobgo.ErrInvalidArgument, "the max age of the CORS rule can't be negative")
+		}
+	}
+
+	s.cors = append([]commonblobgo.CORSRule{}, rules...)
+
+	return nil
+}
+
+func (s *Storage) GetCORS(ctx context.Context) ([]commonblobgo.CORSRule, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	return append([]commonblobgo.CORSRule{}, s.cors...), nil
+}
+
+func blockedPublicAccess(blocked bool) commonblobgo.PublicAccessBlock {
+	return commonblobgo.PublicAccessBlock{
+		BlockPublicACLs:       blocked,
+		IgnorePublicACLs:      blocked,
+		BlockPublicPolicy:     blocked,
+		RestrictPublicBuckets: blocked,
+	}
+}
+
+func (s *Storage) SetPublicAccessBlock(ctx context.Context, blocked bool) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	s.publicAccessBlock = blockedPublicAccess(blocked)
+
+	return nil
+}
+
+func (s *Storage) GetPublicAccessBlock(ctx context.Context) (bool, error) {
+	details, err := s.GetPublicAccessBlockDetails(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return details.Blocked(), nil
+}
+
+func (s *Storage) GetPublicAccessBlockDetails(ctx context.Context) (*commonblobgo.PublicAccessBlock, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	details := s.publicAccessBlock
+
+	return &details, nil
+}
+
+// objectURL returns the URL of the object on the host.
+func objectURL(urlHost, key string) *url.URL {
+	if urlHost == "" {
+		urlHost = host
+	}
+
+	return &url.URL{
+		Scheme: "https",
+		Host:   urlHost,
+		Path:   "/" + bucketName + "/" + key,
+	}
+}
+
+// sign adds the fake signature of the query to it, the URLs are never checked.
+func sign(query url.Values) {
+	sum := sha256.Sum256([]byte(query.Encode()))
+	query.Set("X-Fake-Signature", hex.EncodeToString(sum[:]))
+}
+
+// GetSignedURL returns a URL of the shape of the provider ones, with its method, its expiry and its
+// restrictions in the query, which can't be used to reach the object.
+func (s *Storage) GetSignedURL(
+	ctx context.Context,
+	key string,
+	opts *commonblobgo.SignedURLOption,
+) (string, error) {
+	if err := s.lock(ctx); err != nil {
+		return "", err
+	}
+	defer s.mu.Unlock()
+
+	if opts == nil {
+		opts = &commonblobgo.SignedURLOption{}
+	}
+
+	method := opts.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	switch method {
+	case http.MethodGet, http.MethodPut, http.MethodDelete:
+	default:
+		return "", newError(commonblobgo.ErrInvalidArgument, "unsupported signed URL method %s", method)
+	}
+
+	hasOverrides := opts.ResponseContentDisposition != "" || opts.ResponseContentType != "" ||
+		opts.ResponseCacheControl != ""
+	if hasOverrides && method != http.MethodGet {
+		return "", newError(commonblobgo.ErrInvalidArgument,
+			"response header overrides are only supported by GET URLs, not %s", method)
+	}
+
+	if opts.AllowedSourceIP != "" {
+		return "", newError(commonblobgo.ErrNotSupported, "source IP restrictions of the signed URLs")
+	}
+
+	expiry := opts.Expiry
+	if expiry <= 0 {
+		expiry = defaultSignedURLExpiry
+	}
+
+	query := url.Values{}
+	query.Set("X-Fake-Method", method)
+	query.Set("X-Fake-Expires", strconv.FormatInt(time.Now().Add(expiry).Unix(), 10))
+
+	for name, value := range map[string]string{
+		"X-Fake-Content-Type":          opts.ContentType,
+		"response-content-disposition": opts.ResponseContentDisposition,
+		"response-content-type":        opts.ResponseContentType,
+		"response-cache-control":       opts.ResponseCacheControl,
+	} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+
+	if len(opts.SignedHeaders) > 0 {
+		headers := make([]string, 0, len(opts.SignedHeaders))
+		for name := range opts.SignedHeaders {
+			headers = append(headers, strings.ToLower(name))
+		}
+
+		sort.Strings(headers)
+		query.Set("X-Fake-SignedHeaders", strings.Join(headers, ";"))
+	}
+
+	sign(query)
+
+	signedURL := objectURL(opts.HostOverride, key)
+	signedURL.RawQuery = query.Encode()
+
+	return signedURL.String(), nil
+}
+
+// GetSignedPostPolicy returns the form fields of a policy of the shape of the provider ones, which can't
+// be used to upload.
+func (s *Storage) GetSignedPostPolicy(
+	ctx context.Context,
+	keyPrefix string,
+	opts *commonblobgo.PostPolicyOptions,
+) (*commonblobgo.PostPolicy, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	if opts == nil || opts.Expiry <= 0 {
+		return nil, newError(commonblobgo.ErrInvalidArgument, "the expiry of the POST policy must be positive")
+	}
+
+	if opts.MaxContentLength < 0 {
+		return nil, newError(commonblobgo.ErrInvalidArgument, "the max content length can't be negative")
+	}
+
+	fields := map[string]string{"key": keyPrefix}
+	conditions := []interface{}{[]interface{}{"starts-with", "$key", keyPrefix}}
+
+	if opts.ExactKey {
+		conditions = []interface{}{map[string]string{"key": keyPrefix}}
+	} else {
+		fields["key"] = keyPrefix + "${filename}"
+	}
+
+	switch {
+	case opts.ContentType != "":
+		fields["Content-Type"] = opts.ContentType
+		conditions = append(conditions, map[string]string{"Content-Type": opts.ContentType})
+	case opts.ContentTypePrefix != "":
+		conditions = append(conditions, []interface{}{"starts-with", "$Content-Type", opts.ContentTypePrefix})
+	}
+
+	if opts.MaxContentLength > 0 {
+		conditions = append(conditions, []interface{}{"content-length-range", 0, opts.MaxContentLength})
+	}
+
+	document, err := json.Marshal(map[string]interface{}{
+		"expiration": time.Now().Add(opts.Expiry).UTC().Format(time.RFC3339),
+		"conditions": conditions,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fields["policy"] = base64.StdEncoding.EncodeToString(document)
+	sum := sha256.Sum256(document)
+	fields["x-fake-signature"] = hex.EncodeToString(sum[:])
+
+	return &commonblobgo.PostPolicy{
+		URL:    (&url.URL{Scheme: "https", Host: host, Path: "/" + bucketName}).String(),
+		Fields: fields,
+	}, nil
+}
+
+func (s *Storage) GetPublicURL(key string) (string, error) {
+	return objectURL("", key).String(), nil
+}
+
+func (s *Storage) StartMultipartUpload(
+	ctx context.Context,
+	key string,
+	opts *commonblobgo.WriteOptions,
+) (string, error) {
+	if err := s.lock(ctx); err != nil {
+		return "", err
+	}
+	defer s.mu.Unlock()
+
+	s.generation++
+	uploadID := "upload-" + strconv.FormatInt(s.generation, 10)
+	s.uploads[uploadID] = &multipartUpload{
+		key:   key,
+		opts:  opts,
+		parts: make(map[int][]byte),
+	}
+
+	return uploadID, nil
+}
+
+// upload returns the multipart upload of the object.
+func (s *Storage) upload(key, uploadID string) (*multipartUpload, error) {
+	upload, ok := s.uploads[uploadID]
+	if !ok || upload.key != key {
+		return nil, newError(commonblobgo.ErrNotFound, "upload %s of '%s' doesn't exist", uploadID, key)
+	}
+
+	return upload, nil
+}
+
+func checkPartNumber(partNumber int) error {
+	if partNumber < 1 || partNumber > maxPartNumber {
+		return newError(commonblobgo.ErrInvalidArgument, "part number %d is not between 1 and %d", partNumber,
+			maxPartNumber)
+	}
+
+	return nil
+}
+
+// SignUploadPartURL returns a URL which can't be used to upload the part, see UploadPart.
+func (s *Storage) SignUploadPartURL(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	partNumber int,
+	expiry time.Duration,
+) (string, error) {
+	if err := s.lock(ctx); err != nil {
+		return "", err
+	}
+	defer s.mu.Unlock()
+
+	if _, err := s.upload(key, uploadID); err != nil {
+		return "", err
+	}
+
+	if err := checkPartNumber(partNumber); err != nil {
+		return "", err
+	}
+
+	if expiry <= 0 {
+		expiry = defaultSignedURLExpiry
+	}
+
+	query := url.Values{}
+	query.Set("uploadId", uploadID)
+	query.Set("partNumber", strconv.Itoa(partNumber))
+	query.Set("X-Fake-Method", http.MethodPut)
+	query.Set("X-Fake-Expires", strconv.FormatInt(time.Now().Add(expiry).Unix(), 10))
+	sign(query)
+
+	partURL := objectURL("", key)
+	partURL.RawQuery = query.Encode()
+
+	return partURL.String(), nil
+}
+
+// UploadPart stands for the upload of a part to a URL of SignUploadPartURL, and returns the ETag of
+// the response to pass to CompleteMultipartUpload. A part uploaded again replaces the previous one.
+func (s *Storage) UploadPart(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	partNumber int,
+	body []byte,
+) (string, error) {
+	if err := s.lock(ctx); err != nil {
+		return "", err
+	}
+	defer s.mu.Unlock()
+
+	upload, err := s.upload(key, uploadID)
+	if err != nil {
+		return "", err
+	}
+
+	if err := checkPartNumber(partNumber); err != nil {
+		return "", err
+	}
+
+	upload.parts[partNumber] = append([]byte{}, body...)
+
+	return partETag(body), nil
+}
+
+func partETag(body []byte) string {
+	sum := md5.Sum(body) //nolint:gosec
+
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// CompleteMultipartUpload writes the parts in order, their ETags must match the uploaded parts.
+func (s *Storage) CompleteMultipartUpload(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	parts []commonblobgo.CompletedPart,
+) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	upload, err := s.upload(key, uploadID)
+	if err != nil {
+		return err
+	}
+
+	if len(parts) == 0 {
+		return newError(commonblobgo.ErrInvalidArgument, "upload %s of '%s' has no part", uploadID, key)
+	}
+
+	var body []byte
+
+	for i, part := range parts {
+		if i > 0 && part.PartNumber <= parts[i-1].PartNumber {
+			return newError(commonblobgo.ErrInvalidArgument, "the parts of upload %s are not in ascending order",
+				uploadID)
+		}
+
+		content, ok := upload.parts[part.PartNumber]
+		if !ok || partETag(content) != part.ETag {
+			return newError(commonblobgo.ErrInvalidArgument, "part %d of upload %s doesn't match the uploaded one",
+				part.PartNumber, uploadID)
+		}
+
+		body = append(body, content...)
+	}
+
+	if err := s.put(key, body, upload.opts); err != nil {
+		return err
+	}
+
+	delete(s.uploads, uploadID)
+
+	return nil
+}
+
+func (s *Storage) AbortMultipartUpload(
+	ctx context.Context,
+	key string,
+	uploadID string,
+) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	if _, err := s.upload(key, uploadID); err != nil {
+		return err
+	}
+
+	delete(s.uploads, uploadID)
+
+	return nil
+}
@@ -0,0 +1,1222 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+// Package fakeblob provides an in-memory commonblobgo.CloudStorage for the tests of the services, with the
+// semantics of the provider storages: io.EOF at the end of the listings, the directories of the delimiter
+// listings, the normalized attributes, the range reads and the typed errors of commonblobgo.
+//
+//	storage := fakeblob.New()
+//	err := storage.Write(ctx, "configs/game.json", body, nil)
+package fakeblob
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5" //nolint:gosec
+	"crypto/sha256"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	commonblobgo "github.com/AccelByte/common-blob-go"
+)
+
+const (
+	// bucketName is the name of the bucket in the URLs
+	bucketName = "fakeblob"
+	// defaultStorageClass is the storage class of the written objects
+	defaultStorageClass = "STANDARD"
+	gzipContentEncoding = "gzip"
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Storage is a goroutine-safe in-memory CloudStorage. The objects are versioned by generation, like on GCS,
+// their ETag and their version being the generation number.
+type Storage struct {
+	mu sync.Mutex
+
+	objects map[string]*object
+	// noncurrent holds the previous versions of the objects, oldest first, kept while the versioning is enabled
+	noncurrent map[string][]*object
+	generation int64
+	uploads    map[string]*multipartUpload
+	closed     bool
+
+	versioning        commonblobgo.VersioningState
+	lifecycle         []commonblobgo.LifecycleRule
+	cors              []commonblobgo.CORSRule
+	publicAccessBlock commonblobgo.PublicAccessBlock
+}
+
+var _ commonblobgo.CloudStorage = (*Storage)(nil)
+
+// object is a version of an object.
+type object struct {
+	body          []byte
+	attrs         commonblobgo.Attributes
+	tags          map[string]string
+	retention     commonblobgo.ObjectRetention
+	restoredUntil time.Time
+}
+
+// New returns an empty storage.
+func New() *Storage {
+	return &Storage{
+		objects:    make(map[string]*object),
+		noncurrent: make(map[string][]*object),
+		uploads:    make(map[string]*multipartUpload),
+		versioning: commonblobgo.VersioningUnversioned,
+	}
+}
+
+// newError returns an error matching kind with errors.Is, like the typed errors of the provider storages.
+func newError(kind error, format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", kind, fmt.Sprintf(format, args...))
+}
+
+// lock locks the storage, the caller unlocks it unless an error is returned for a closed storage
+// or a done context.
+func (s *Storage) lock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+
+	if s.closed {
+		s.mu.Unlock()
+
+		return commonblobgo.ErrClosed
+	}
+
+	return nil
+}
+
+// current returns the current version of the object.
+func (s *Storage) current(key string) (*object, error) {
+	obj, ok := s.objects[key]
+	if !ok {
+		return nil, newError(commonblobgo.ErrNotFound, "object '%s' doesn't exist", key)
+	}
+
+	return obj, nil
+}
+
+// readable returns the current version of the object, unless it's archived and not restored.
+func (s *Storage) readable(key string) (*object, error) {
+	obj, err := s.current(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if needsRestore(obj.attrs.StorageClass) && !obj.restoredUntil.After(time.Now()) {
+		return nil, newError(commonblobgo.ErrArchived, "object '%s' is in the %s storage class", key,
+			obj.attrs.StorageClass)
+	}
+
+	return obj, nil
+}
+
+// checkUnlocked fails for the objects whose retention isn't over.
+func checkUnlocked(key string, obj *object) error {
+	if obj != nil && obj.retention.RetainUntil.After(time.Now()) {
+		return newError(commonblobgo.ErrObjectLocked, "object '%s' is retained until %s", key,
+			obj.retention.RetainUntil)
+	}
+
+	return nil
+}
+
+// needsRestore is true for the S3 archive storage classes, whose objects are read once restored.
+func needsRestore(storageClass string) bool {
+	return storageClass == "GLACIER" || storageClass == "DEEP_ARCHIVE"
+}
+
+// replace makes obj the current version of the object, the previous one is kept while the versioning is enabled.
+func (s *Storage) replace(key string, obj *object) {
+	if previous, ok := s.objects[key]; ok && s.versioning == commonblobgo.VersioningEnabled {
+		s.noncurrent[key] = append(s.noncurrent[key], previous)
+	}
+
+	s.generation++
+	now := time.Now().UTC()
+	obj.attrs.ETag = strconv.FormatInt(s.generation, 10)
+	obj.attrs.ModTime = now
+	obj.attrs.CreateTime = now
+	s.objects[key] = obj
+}
+
+// remove deletes the current version of the object, which is kept while the versioning is enabled.
+func (s *Storage) remove(key string) {
+	if s.versioning == commonblobgo.VersioningEnabled {
+		s.noncurrent[key] = append(s.noncurrent[key], s.objects[key])
+	}
+
+	delete(s.objects, key)
+}
+
+// newObject returns an object holding the body with the attributes of the options.
+func newObject(body []byte, opts *commonblobgo.WriteOptions) (*object, error) {
+	if opts == nil {
+		opts = &commonblobgo.WriteOptions{}
+	}
+
+	obj := &object{
+		attrs: commonblobgo.Attributes{
+			CacheControl:       opts.CacheControl,
+			ContentDisposition: opts.ContentDisposition,
+			ContentEncoding:    opts.ContentEncoding,
+			ContentLanguage:    opts.ContentLanguage,
+			ContentType:        opts.ContentType,
+			Metadata:           make(map[string]string, len(opts.Metadata)),
+			StorageClass:       defaultStorageClass,
+		},
+	}
+
+	for key, value := range opts.Metadata {
+		obj.attrs.Metadata[strings.ToLower(key)] = value
+	}
+
+	if obj.attrs.ContentType == "" {
+		obj.attrs.ContentType = http.DetectContentType(body)
+	}
+
+	if opts.Compress {
+		compressed, err := compress(body)
+		if err != nil {
+			return nil, err
+		}
+
+		obj.attrs.ContentEncoding = gzipContentEncoding
+		obj.attrs.Metadata[commonblobgo.UncompressedSizeMetadataKey] = strconv.Itoa(len(body))
+		body = compressed
+	}
+
+	switch opts.ChecksumAlgorithm {
+	case "", commonblobgo.ChecksumCRC32C:
+	case commonblobgo.ChecksumSHA256:
+		sum := sha256.Sum256(body)
+		obj.attrs.SHA256 = sum[:]
+	default:
+		return nil, newError(commonblobgo.ErrInvalidArgument, "unknown checksum algorithm '%s'", opts.ChecksumAlgorithm)
+	}
+
+	md5Sum := md5.Sum(body) //nolint:gosec
+	obj.body = body
+	obj.attrs.Size = int64(len(body))
+	obj.attrs.MD5 = md5Sum[:]
+	obj.attrs.CRC32C = crc32.Checksum(body, crc32cTable)
+	obj.attrs.HasCRC32C = true
+
+	return obj, nil
+}
+
+func compress(body []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write(body); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// content returns a copy of the body, which is decompressed when it's gzip encoded.
+func (o *object) content() ([]byte, error) {
+	if o.attrs.ContentEncoding != gzipContentEncoding {
+		return append([]byte{}, o.body...), nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(o.body))
+	if err != nil {
+		return nil, err
+	}
+
+	defer reader.Close()
+
+	return ioutil.ReadAll(reader)
+}
+
+// attributes returns a copy of the attributes.
+func (o *object) attributes() *commonblobgo.Attributes {
+	attrs := o.attrs
+	attrs.Metadata = copyMap(o.attrs.Metadata)
+	attrs.MD5 = append([]byte{}, o.attrs.MD5...)
+
+	if o.attrs.SHA256 != nil {
+		attrs.SHA256 = append([]byte{}, o.attrs.SHA256...)
+	}
+
+	return &attrs
+}
+
+// clone returns a new object with the content and the attributes of o, and no retention.
+func (o *object) clone() *object {
+	return &object{
+		body:  o.body,
+		attrs: *o.attributes(),
+		tags:  copyMap(o.tags),
+	}
+}
+
+func copyMap(m map[string]string) map[string]string {
+	copied := make(map[string]string, len(m))
+	for key, value := range m {
+		copied[key] = value
+	}
+
+	return copied
+}
+
+// put writes the object, after checking the conditions of the options.
+func (s *Storage) put(key string, body []byte, opts *commonblobgo.WriteOptions) error {
+	existing := s.objects[key]
+
+	if opts != nil && opts.IfNotExists && opts.IfMatchETag != "" {
+		return newError(commonblobgo.ErrInvalidArgument, "IfNotExists and IfMatchETag can't be set together")
+	}
+
+	if opts != nil && opts.IfNotExists && existing != nil {
+		return newError(commonblobgo.ErrPreconditionFailed, "object '%s' already exists", key)
+	}
+
+	if opts != nil && opts.IfMatchETag != "" && (existing == nil || existing.attrs.ETag != opts.IfMatchETag) {
+		return newError(commonblobgo.ErrPreconditionFailed, "object '%s' doesn't match the ETag %s", key,
+			opts.IfMatchETag)
+	}
+
+	if err := checkUnlocked(key, existing); err != nil {
+		return err
+	}
+
+	obj, err := newObject(body, opts)
+	if err != nil {
+		return err
+	}
+
+	s.replace(key, obj)
+
+	return nil
+}
+
+func (s *Storage) Get(
+	ctx context.Context,
+	key string,
+) ([]byte, error) {
+	body, _, err := s.GetWithAttributes(ctx, key)
+
+	return body, err
+}
+
+func (s *Storage) GetWithAttributes(
+	ctx context.Context,
+	key string,
+) ([]byte, *commonblobgo.Attributes, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, nil, err
+	}
+	defer s.mu.Unlock()
+
+	obj, err := s.readable(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body, err := obj.content()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return body, obj.attributes(), nil
+}
+
+// GetIfModified compares the ETag when it's set, and the modification time, to the second, otherwise.
+func (s *Storage) GetIfModified(
+	ctx context.Context,
+	key string,
+	etag string,
+	modSince time.Time,
+) ([]byte, *commonblobgo.Attributes, bool, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, nil, false, err
+	}
+	defer s.mu.Unlock()
+
+	obj, err := s.readable(key)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	notModified := false
+
+	switch {
+	case etag != "":
+		notModified = etag == obj.attrs.ETag
+	case !modSince.IsZero():
+		notModified = !obj.attrs.ModTime.Truncate(time.Second).After(modSince)
+	}
+
+	if notModified {
+		return nil, obj.attributes(), true, nil
+	}
+
+	body, err := obj.content()
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	return body, obj.attributes(), false, nil
+}
+
+func (s *Storage) GetReader(
+	ctx context.Context,
+	key string,
+) (io.ReadCloser, error) {
+	body, err := s.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(body)), nil
+}
+
+// GetRangeReader reads the stored content: a negative length reads till the end of the object, an offset at
+// the end of the object returns an empty reader, and a negative offset or an offset beyond the end of the
+// object fails with ErrOutOfRange.
+func (s *Storage) GetRangeReader(
+	ctx context.Context,
+	key string,
+	offset int64,
+	length int64,
+) (io.ReadCloser, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	if offset < 0 {
+		return nil, newError(commonblobgo.ErrOutOfRange, "offset %d of %s is negative", offset, key)
+	}
+
+	obj, err := s.readable(key)
+	if err != nil {
+		return nil, err
+	}
+
+	size := int64(len(obj.body))
+	if offset > size {
+		return nil, newError(commonblobgo.ErrOutOfRange, "offset %d is beyond the size %d of %s", offset, size, key)
+	}
+
+	end := size
+	if length >= 0 && offset+length < size {
+		end = offset + length
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(append([]byte{}, obj.body[offset:end]...))), nil
+}
+
+func (s *Storage) Write(
+	ctx context.Context,
+	key string,
+	body []byte,
+	contentType *string,
+) error {
+	opts := &commonblobgo.WriteOptions{}
+	if contentType != nil {
+		opts.ContentType = *contentType
+	}
+
+	return s.WriteWithOptions(ctx, key, body, opts)
+}
+
+func (s *Storage) WriteWithOptions(
+	ctx context.Context,
+	key string,
+	body []byte,
+	opts *commonblobgo.WriteOptions,
+) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	return s.put(key, body, opts)
+}
+
+func (s *Storage) GetWriter(
+	ctx context.Context,
+	key string,
+) (io.WriteCloser, error) {
+	return s.GetWriterWithOptions(ctx, key, nil)
+}
+
+// GetWriterWithOptions buffers the content, which is written on Close unless the context is done.
+func (s *Storage) GetWriterWithOptions(
+	ctx context.Context,
+	key string,
+	opts *commonblobgo.WriteOptions,
+) (io.WriteCloser, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	return &writer{
+		ctx:     ctx,
+		storage: s,
+		key:     key,
+		opts:    opts,
+	}, nil
+}
+
+// writer writes the object on Close, like the provider writers which abort the upload when their context
+// is done.
+type writer struct {
+	ctx     context.Context
+	storage *Storage
+	key     string
+	opts    *commonblobgo.WriteOptions
+	buffer  bytes.Buffer
+	closed  bool
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, fmt.Errorf("writer of '%s' is closed", w.key)
+	}
+
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, _ := w.buffer.Write(p)
+
+	if w.opts != nil && w.opts.ProgressFunc != nil {
+		w.opts.ProgressFunc(int64(w.buffer.Len()))
+	}
+
+	return n, nil
+}
+
+func (w *writer) Close() error {
+	if w.closed {
+		return fmt.Errorf("writer of '%s' is already closed", w.key)
+	}
+
+	w.closed = true
+
+	return w.storage.WriteWithOptions(w.ctx, w.key, w.buffer.Bytes(), w.opts)
+}
+
+// Append creates the object when it doesn't exist, the attributes of an existing object are kept.
+func (s *Storage) Append(
+	ctx context.Context,
+	key string,
+	data []byte,
+) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	existing, ok := s.objects[key]
+	if !ok {
+		return s.put(key, data, nil)
+	}
+
+	if err := checkUnlocked(key, existing); err != nil {
+		return err
+	}
+
+	obj := existing.clone()
+	obj.body = append(append([]byte{}, existing.body...), data...)
+	md5Sum := md5.Sum(obj.body) //nolint:gosec
+	obj.attrs.Size = int64(len(obj.body))
+	obj.attrs.MD5 = md5Sum[:]
+	obj.attrs.CRC32C = crc32.Checksum(obj.body, crc32cTable)
+	obj.attrs.SHA256 = nil
+
+	s.replace(key, obj)
+
+	return nil
+}
+
+func (s *Storage) Delete(
+	ctx context.Context,
+	key string,
+) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	obj, err := s.current(key)
+	if err != nil {
+		return err
+	}
+
+	if err := checkUnlocked(key, obj); err != nil {
+		return err
+	}
+
+	s.remove(key)
+
+	return nil
+}
+
+// DeleteBatch counts the objects which don't exist as deleted, the retained objects are reported
+// in a BatchError.
+func (s *Storage) DeleteBatch(
+	ctx context.Context,
+	keys []string,
+) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	failures := make(map[string]error)
+
+	for _, key := range keys {
+		obj, ok := s.objects[key]
+		if !ok {
+			continue
+		}
+
+		if err := checkUnlocked(key, obj); err != nil {
+			failures[key] = err
+
+			continue
+		}
+
+		s.remove(key)
+	}
+
+	if len(failures) > 0 {
+		return &commonblobgo.BatchError{Errors: failures}
+	}
+
+	return nil
+}
+
+func (s *Storage) Attributes(
+	ctx context.Context,
+	key string,
+) (*commonblobgo.Attributes, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	obj, err := s.current(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return obj.attributes(), nil
+}
+
+func (s *Storage) GetSize(
+	ctx context.Context,
+	key string,
+) (int64, error) {
+	attrs, err := s.Attributes(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+
+	return attrs.Size, nil
+}
+
+// UpdateAttributes keeps the ETag, only the content changes it.
+func (s *Storage) UpdateAttributes(
+	ctx context.Context,
+	key string,
+	update commonblobgo.AttributeUpdate,
+) (*commonblobgo.Attributes, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	obj, err := s.current(key)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range []struct {
+		value  string
+		target *string
+	}{
+		{update.CacheControl, &obj.attrs.CacheControl},
+		{update.ContentDisposition, &obj.attrs.ContentDisposition},
+		{update.ContentEncoding, &obj.attrs.ContentEncoding},
+		{update.ContentLanguage, &obj.attrs.ContentLanguage},
+		{update.ContentType, &obj.attrs.ContentType},
+	} {
+		if field.value != "" {
+			*field.target = field.value
+		}
+	}
+
+	for metadataKey, value := range update.Metadata {
+		obj.attrs.Metadata[strings.ToLower(metadataKey)] = value
+	}
+
+	return obj.attributes(), nil
+}
+
+// VerifyDownload checks that the object can be read, the content of the fake always matches its MD5.
+func (s *Storage) VerifyDownload(
+	ctx context.Context,
+	key string,
+) error {
+	_, err := s.Get(ctx, key)
+
+	return err
+}
+
+func (s *Storage) Exists(
+	ctx context.Context,
+	key string,
+) (bool, error) {
+	if err := s.lock(ctx); err != nil {
+		return false, err
+	}
+	defer s.mu.Unlock()
+
+	_, ok := s.objects[key]
+
+	return ok, nil
+}
+
+// Copy copies the content, the attributes and the tags of the source.
+func (s *Storage) Copy(ctx context.Context, dstKey, srcKey string) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	return s.copy(dstKey, srcKey)
+}
+
+func (s *Storage) copy(dstKey, srcKey string) error {
+	src, err := s.current(srcKey)
+	if err != nil {
+		return err
+	}
+
+	if dstKey == srcKey {
+		return nil
+	}
+
+	if err := checkUnlocked(dstKey, s.objects[dstKey]); err != nil {
+		return err
+	}
+
+	s.replace(dstKey, src.clone())
+
+	return nil
+}
+
+// Move keeps the source when the copy failed.
+func (s *Storage) Move(ctx context.Context, dstKey, srcKey string) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	if err := checkUnlocked(srcKey, s.objects[srcKey]); err != nil {
+		return err
+	}
+
+	if err := s.copy(dstKey, srcKey); err != nil || dstKey == srcKey {
+		return err
+	}
+
+	s.remove(srcKey)
+
+	return nil
+}
+
+func (s *Storage) SetTags(
+	ctx context.Context,
+	key string,
+	tags map[string]string,
+) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	obj, err := s.current(key)
+	if err != nil {
+		return err
+	}
+
+	obj.tags = copyMap(tags)
+
+	return nil
+}
+
+func (s *Storage) GetTags(
+	ctx context.Context,
+	key string,
+) (map[string]string, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	obj, err := s.current(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return copyMap(obj.tags), nil
+}
+
+func (s *Storage) SetStorageClass(
+	ctx context.Context,
+	key string,
+	class string,
+) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	if class == "" {
+		return newError(commonblobgo.ErrInvalidArgument, "the storage class of '%s' is empty", key)
+	}
+
+	obj, err := s.current(key)
+	if err != nil {
+		return err
+	}
+
+	obj.attrs.StorageClass = class
+	obj.restoredUntil = time.Time{}
+
+	return nil
+}
+
+// Restore makes the archived object readable for the days at once.
+func (s *Storage) Restore(
+	ctx context.Context,
+	key string,
+	days int,
+	tier string,
+) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	if days <= 0 {
+		return newError(commonblobgo.ErrInvalidArgument, "the restore of '%s' must last at least one day", key)
+	}
+
+	obj, err := s.current(key)
+	if err != nil {
+		return err
+	}
+
+	if !needsRestore(obj.attrs.StorageClass) {
+		return newError(commonblobgo.ErrInvalidArgument, "object '%s' in the %s storage class can't be restored",
+			key, obj.attrs.StorageClass)
+	}
+
+	obj.restoredUntil = time.Now().Add(time.Duration(days) * 24 * time.Hour)
+
+	return nil
+}
+
+func (s *Storage) RestoreStatus(
+	ctx context.Context,
+	key string,
+) (commonblobgo.RestoreState, error) {
+	if err := s.lock(ctx); err != nil {
+		return commonblobgo.RestoreState{}, err
+	}
+	defer s.mu.Unlock()
+
+	obj, err := s.current(key)
+	if err != nil {
+		return commonblobgo.RestoreState{}, err
+	}
+
+	class := obj.attrs.StorageClass
+
+	return commonblobgo.RestoreState{
+		Archived:   needsRestore(class) || class == "ARCHIVE",
+		Readable:   !needsRestore(class) || obj.restoredUntil.After(time.Now()),
+		ExpiryTime: obj.restoredUntil,
+	}, nil
+}
+
+// SetObjectRetention fails with ErrObjectLocked when shortening a COMPLIANCE retention.
+func (s *Storage) SetObjectRetention(
+	ctx context.Context,
+	key string,
+	until time.Time,
+	mode string,
+) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	if mode != commonblobgo.RetentionModeGovernance && mode != commonblobgo.RetentionModeCompliance {
+		return newError(commonblobgo.ErrInvalidArgument, "unknown retention mode '%s'", mode)
+	}
+
+	obj, err := s.current(key)
+	if err != nil {
+		return err
+	}
+
+	if obj.retention.Mode == commonblobgo.RetentionModeCompliance && until.Before(obj.retention.RetainUntil) {
+		return newError(commonblobgo.ErrObjectLocked, "the COMPLIANCE retention of '%s' can't be shortened", key)
+	}
+
+	obj.retention = commonblobgo.ObjectRetention{
+		Mode:        mode,
+		RetainUntil: until.UTC(),
+	}
+
+	return nil
+}
+
+func (s *Storage) GetObjectRetention(
+	ctx context.Context,
+	key string,
+) (*commonblobgo.ObjectRetention, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	obj, err := s.current(key)
+	if err != nil {
+		return nil, err
+	}
+
+	retention := obj.retention
+
+	return &retention, nil
+}
+
+func (s *Storage) ListVersions(
+	ctx context.Context,
+	prefix string,
+) *commonblobgo.VersionIterator {
+	var versions []*commonblobgo.ObjectVersion
+
+	err := s.lock(ctx)
+	if err == nil {
+		versions = s.listVersions(prefix)
+		s.mu.Unlock()
+	}
+
+	return commonblobgo.NewVersionIterator(func(ctx context.Context) (*commonblobgo.ObjectVersion, error) {
+		if err != nil {
+			return nil, err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if len(versions) == 0 {
+			return nil, io.EOF
+		}
+
+		version := versions[0]
+		versions = versions[1:]
+
+		return version, nil
+	})
+}
+
+// listVersions returns the versions by key, the newest first.
+func (s *Storage) listVersions(prefix string) []*commonblobgo.ObjectVersion {
+	keys := make(map[string]bool)
+
+	for key := range s.objects {
+		keys[key] = true
+	}
+
+	for key := range s.noncurrent {
+		keys[key] = true
+	}
+
+	var versions []*commonblobgo.ObjectVersion
+
+	for _, key := range sortedKeys(keys, prefix) {
+		if obj, ok := s.objects[key]; ok {
+			versions = append(versions, newObjectVersion(key, obj, true))
+		}
+
+		previous := s.noncurrent[key]
+		for i := len(previous) - 1; i >= 0; i-- {
+			versions = append(versions, newObjectVersion(key, previous[i], false))
+		}
+	}
+
+	return versions
+}
+
+func newObjectVersion(key string, obj *object, latest bool) *commonblobgo.ObjectVersion {
+	return &commonblobgo.ObjectVersion{
+		Key:      key,
+		Version:  obj.attrs.ETag,
+		ModTime:  obj.attrs.ModTime,
+		Size:     obj.attrs.Size,
+		IsLatest: latest,
+	}
+}
+
+func sortedKeys(keys map[string]bool, prefix string) []string {
+	sorted := make([]string, 0, len(keys))
+
+	for key := range keys {
+		if strings.HasPrefix(key, prefix) {
+			sorted = append(sorted, key)
+		}
+	}
+
+	sort.Strings(sorted)
+
+	return sorted
+}
+
+// version returns the version of the object, and its index in the noncurrent versions, -1 for the current one.
+func (s *Storage) version(key, version string) (*object, int, error) {
+	if obj, ok := s.objects[key]; ok && obj.attrs.ETag == version {
+		return obj, -1, nil
+	}
+
+	for i, obj := range s.noncurrent[key] {
+		if obj.attrs.ETag == version {
+			return obj, i, nil
+		}
+	}
+
+	return nil, 0, newError(commonblobgo.ErrNotFound, "version %s of '%s' doesn't exist", version, key)
+}
+
+func (s *Storage) GetVersion(
+	ctx context.Context,
+	key string,
+	version string,
+) ([]byte, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	obj, _, err := s.version(key, version)
+	if err != nil {
+		return nil, err
+	}
+
+	return obj.content()
+}
+
+// DeleteVersion deletes the version for good, the previous version doesn't become the current one.
+func (s *Storage) DeleteVersion(
+	ctx context.Context,
+	key string,
+	version string,
+) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	obj, index, err := s.version(key, version)
+	if err != nil {
+		return err
+	}
+
+	if err := checkUnlocked(key, obj); err != nil {
+		return err
+	}
+
+	if index < 0 {
+		delete(s.objects, key)
+
+		return nil
+	}
+
+	previous := s.noncurrent[key]
+	s.noncurrent[key] = append(previous[:index:index], previous[index+1:]...)
+
+	if len(s.noncurrent[key]) == 0 {
+		delete(s.noncurrent, key)
+	}
+
+	return nil
+}
+
+func (s *Storage) List(
+	ctx context.Context,
+	prefix string,
+) *commonblobgo.ListIterator {
+	return s.ListWithOptions(ctx, &commonblobgo.ListOptions{Prefix: prefix})
+}
+
+// ListWithOptions lists the objects at the time of the call, ordered by key.
+func (s *Storage) ListWithOptions(
+	ctx context.Context,
+	options *commonblobgo.ListOptions,
+) *commonblobgo.ListIterator {
+	if options == nil {
+		options = &commonblobgo.ListOptions{}
+	}
+
+	var objects []*commonblobgo.ListObject
+
+	err := s.lock(ctx)
+	if err == nil {
+		objects = s.list(options)
+		s.mu.Unlock()
+	}
+
+	return commonblobgo.NewListIterator(func(ctx context.Context) (*commonblobgo.ListObject, error) {
+		if err != nil {
+			return nil, err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if len(objects) == 0 {
+			return nil, io.EOF
+		}
+
+		object := objects[0]
+		objects = objects[1:]
+
+		return object, nil
+	})
+}
+
+func (s *Storage) list(options *commonblobgo.ListOptions) []*commonblobgo.ListObject {
+	keys := make(map[string]bool, len(s.objects))
+	for key := range s.objects {
+		keys[key] = true
+	}
+
+	var (
+		objects  []*commonblobgo.ListObject
+		lastDir  string
+		hasLimit = options.MaxResults > 0
+	)
+
+	for _, key := range sortedKeys(keys, options.Prefix) {
+		object := s.listObject(key, options)
+
+		if object.IsDir {
+			if object.Key == lastDir {
+				continue
+			}
+
+			lastDir = object.Key
+		}
+
+		if options.StartAfter != "" && object.Key <= options.StartAfter {
+			continue
+		}
+
+		if hasLimit && len(objects) >= options.MaxResults {
+			break
+		}
+
+		objects = append(objects, object)
+	}
+
+	return objects
+}
+
+// listObject returns the result of the key, which is a directory when the delimiter follows the prefix.
+func (s *Storage) listObject(key string, options *commonblobgo.ListOptions) *commonblobgo.ListObject {
+	if options.Delimiter != "" {
+		rest := strings.TrimPrefix(key, options.Prefix)
+		if i := strings.Index(rest, options.Delimiter); i >= 0 {
+			return &commonblobgo.ListObject{
+				Key:   options.Prefix + rest[:i+len(options.Delimiter)],
+				IsDir: true,
+			}
+		}
+	}
+
+	attrs := s.objects[key].attributes()
+	object := &commonblobgo.ListObject{
+		Key:     key,
+		ModTime: attrs.ModTime,
+		Size:    attrs.Size,
+		MD5:     attrs.MD5,
+	}
+
+	if options.IncludeAttributes {
+		object.ContentType = attrs.ContentType
+		object.Metadata = attrs.Metadata
+	}
+
+	return object
+}
+
+func (s *Storage) Ping(ctx context.Context) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Close makes the next operations fail with ErrClosed. The next calls do nothing.
+func (s *Storage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+
+	return nil
+}
+
+// As has no client of a provider SDK to reach.
+func (s *Storage) As(i interface{}) bool {
+	return false
+}
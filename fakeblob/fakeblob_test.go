@@ -0,0 +1,284 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package fakeblob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	commonblobgo "github.com/AccelByte/common-blob-go"
+	"github.com/AccelByte/common-blob-go/conformance"
+	"github.com/stretchr/testify/require"
+)
+
+func listAll(t *testing.T, iter *commonblobgo.ListIterator) []string {
+	var keys []string
+
+	for {
+		object, err := iter.Next(context.Background())
+		if err == io.EOF {
+			return keys
+		}
+
+		require.NoError(t, err)
+
+		keys = append(keys, object.Key)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	conformance.RunSuite(t, func(t *testing.T) commonblobgo.CloudStorage {
+		return New()
+	})
+}
+
+func TestReadWrite(t *testing.T) {
+	storage := New()
+	ctx := context.Background()
+
+	require.NoError(t, storage.Write(ctx, "dir/file.json", []byte(`{"a":1}`), nil))
+
+	body, err := storage.Get(ctx, "dir/file.json")
+	require.NoError(t, err)
+	require.Equal(t, `{"a":1}`, string(body))
+
+	attrs, err := storage.Attributes(ctx, "dir/file.json")
+	require.NoError(t, err)
+	require.Equal(t, int64(7), attrs.Size)
+	require.Equal(t, "text/plain; charset=utf-8", attrs.ContentType)
+	require.Len(t, attrs.MD5, 16)
+	require.Equal(t, time.UTC, attrs.ModTime.Location())
+
+	// the zero-byte objects have the MD5 of the empty content
+	require.NoError(t, storage.WriteWithOptions(ctx, "empty", nil, &commonblobgo.WriteOptions{
+		Metadata: map[string]string{"Owner": "me"},
+	}))
+
+	attrs, err = storage.Attributes(ctx, "empty")
+	require.NoError(t, err)
+	require.Equal(t, int64(0), attrs.Size)
+	require.Equal(t, "d41d8cd98f00b204e9800998ecf8427e", fmt.Sprintf("%x", attrs.MD5))
+	require.Equal(t, map[string]string{"owner": "me"}, attrs.Metadata)
+
+	_, err = storage.Get(ctx, "missing")
+	require.True(t, errors.Is(err, commonblobgo.ErrNotFound))
+	require.Equal(t, commonblobgo.ErrorKindNotFound, commonblobgo.ErrorCode(err))
+
+	err = storage.WriteWithOptions(ctx, "empty", nil, &commonblobgo.WriteOptions{IfNotExists: true})
+	require.True(t, errors.Is(err, commonblobgo.ErrPreconditionFailed))
+
+	err = storage.WriteWithOptions(ctx, "empty", nil, &commonblobgo.WriteOptions{IfNotExists: true, IfMatchETag: "etag"})
+	require.True(t, errors.Is(err, commonblobgo.ErrInvalidArgument))
+
+	// the streamed writes are written on Close
+	writer, err := storage.GetWriter(ctx, "streamed")
+	require.NoError(t, err)
+
+	_, err = writer.Write([]byte("content"))
+	require.NoError(t, err)
+
+	exists, err := storage.Exists(ctx, "streamed")
+	require.NoError(t, err)
+	require.False(t, exists)
+	require.NoError(t, writer.Close())
+
+	reader, err := storage.GetReader(ctx, "streamed")
+	require.NoError(t, err)
+
+	body, err = ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, "content", string(body))
+	require.NoError(t, reader.Close())
+
+	// the compressed objects are read decompressed
+	require.NoError(t, storage.WriteWithOptions(ctx, "compressed", []byte("content"),
+		&commonblobgo.WriteOptions{Compress: true}))
+
+	body, err = storage.Get(ctx, "compressed")
+	require.NoError(t, err)
+	require.Equal(t, "content", string(body))
+
+	require.NoError(t, storage.Close())
+	require.True(t, errors.Is(storage.Ping(ctx), commonblobgo.ErrClosed))
+}
+
+func TestRangeReader(t *testing.T) {
+	storage := New()
+	ctx := context.Background()
+
+	require.NoError(t, storage.Write(ctx, "file", []byte("0123456789"), nil))
+
+	for _, test := range []struct {
+		offset, length int64
+		expected       string
+	}{
+		{2, 3, "234"},
+		{2, -1, "23456789"},
+		{8, 10, "89"},
+		{10, 5, ""},
+	} {
+		reader, err := storage.GetRangeReader(ctx, "file", test.offset, test.length)
+		require.NoError(t, err)
+
+		body, err := ioutil.ReadAll(reader)
+		require.NoError(t, err)
+		require.Equal(t, test.expected, string(body))
+	}
+
+	_, err := storage.GetRangeReader(ctx, "file", 11, 1)
+	require.True(t, errors.Is(err, commonblobgo.ErrOutOfRange))
+
+	_, err = storage.GetRangeReader(ctx, "file", -1, 1)
+	require.True(t, errors.Is(err, commonblobgo.ErrOutOfRange))
+}
+
+func TestList(t *testing.T) {
+	storage := New()
+	ctx := context.Background()
+
+	for _, key := range []string{"a/1", "a/2", "a/b/3", "a-c", "b/4"} {
+		require.NoError(t, storage.Write(ctx, key, []byte(key), nil))
+	}
+
+	require.Equal(t, []string{"a-c", "a/1", "a/2", "a/b/3"}, listAll(t, storage.List(ctx, "a")))
+	require.Equal(t, []string{"a-c", "a/", "b/"},
+		listAll(t, storage.ListWithOptions(ctx, &commonblobgo.ListOptions{Delimiter: "/"})))
+	require.Equal(t, []string{"a/1", "a/2", "a/b/"},
+		listAll(t, storage.ListWithOptions(ctx, &commonblobgo.ListOptions{Prefix: "a/", Delimiter: "/"})))
+	require.Equal(t, []string{"a/2"}, listAll(t, storage.ListWithOptions(ctx, &commonblobgo.ListOptions{
+		Prefix:     "a/",
+		StartAfter: "a/1",
+		MaxResults: 1,
+	})))
+
+	// the iterator keeps returning io.EOF at the end
+	iter := storage.List(ctx, "b/")
+	_, err := iter.Next(ctx)
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		_, err = iter.Next(ctx)
+		require.Equal(t, io.EOF, err)
+	}
+}
+
+func TestVersions(t *testing.T) {
+	storage := New()
+	ctx := context.Background()
+
+	require.NoError(t, storage.SetVersioning(ctx, true))
+	require.NoError(t, storage.Write(ctx, "file", []byte("v1"), nil))
+	require.NoError(t, storage.Write(ctx, "file", []byte("v2"), nil))
+	require.NoError(t, storage.Delete(ctx, "file"))
+
+	var versions []*commonblobgo.ObjectVersion
+
+	iter := storage.ListVersions(ctx, "")
+
+	for {
+		version, err := iter.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+
+		require.NoError(t, err)
+
+		versions = append(versions, version)
+	}
+
+	require.Len(t, versions, 2)
+
+	body, err := storage.GetVersion(ctx, "file", versions[1].Version)
+	require.NoError(t, err)
+	require.Equal(t, "v1", string(body))
+
+	require.NoError(t, storage.SetVersioning(ctx, false))
+
+	state, err := storage.GetVersioningState(ctx)
+	require.NoError(t, err)
+	require.Equal(t, commonblobgo.VersioningSuspended, state)
+}
+
+func TestRetention(t *testing.T) {
+	storage := New()
+	ctx := context.Background()
+
+	require.NoError(t, storage.Write(ctx, "file", []byte("content"), nil))
+	require.NoError(t, storage.SetObjectRetention(ctx, "file", time.Now().Add(time.Hour),
+		commonblobgo.RetentionModeCompliance))
+
+	require.True(t, errors.Is(storage.Delete(ctx, "file"), commonblobgo.ErrObjectLocked))
+	require.True(t, errors.Is(storage.Write(ctx, "file", nil, nil), commonblobgo.ErrObjectLocked))
+
+	err := storage.SetObjectRetention(ctx, "file", time.Now(), commonblobgo.RetentionModeCompliance)
+	require.True(t, errors.Is(err, commonblobgo.ErrObjectLocked))
+}
+
+func TestMultipartUpload(t *testing.T) {
+	storage := New()
+	ctx := context.Background()
+
+	uploadID, err := storage.StartMultipartUpload(ctx, "file", nil)
+	require.NoError(t, err)
+
+	partURL, err := storage.SignUploadPartURL(ctx, "file", uploadID, 1, time.Hour)
+	require.NoError(t, err)
+	require.Contains(t, partURL, "partNumber=1")
+
+	first, err := storage.UploadPart(ctx, "file", uploadID, 1, []byte("hello "))
+	require.NoError(t, err)
+
+	second, err := storage.UploadPart(ctx, "file", uploadID, 2, []byte("world"))
+	require.NoError(t, err)
+
+	require.NoError(t, storage.CompleteMultipartUpload(ctx, "file", uploadID, []commonblobgo.CompletedPart{
+		{PartNumber: 1, ETag: first},
+		{PartNumber: 2, ETag: second},
+	}))
+
+	body, err := storage.Get(ctx, "file")
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(body))
+
+	err = storage.AbortMultipartUpload(ctx, "file", uploadID)
+	require.True(t, errors.Is(err, commonblobgo.ErrNotFound))
+}
+
+func TestSignedURL(t *testing.T) {
+	storage := New()
+	ctx := context.Background()
+
+	signedURL, err := storage.GetSignedURL(ctx, "dir/file.json", &commonblobgo.SignedURLOption{
+		Method:                     "GET",
+		Expiry:                     time.Minute,
+		ResponseContentDisposition: "attachment",
+	})
+	require.NoError(t, err)
+	require.Regexp(t, `^https://fakeblob.invalid/fakeblob/dir/file.json\?.*X-Fake-Signature=`, signedURL)
+	require.Contains(t, signedURL, "response-content-disposition=attachment")
+
+	_, err = storage.GetSignedURL(ctx, "dir/file.json", &commonblobgo.SignedURLOption{
+		Method:                     "PUT",
+		ResponseContentDisposition: "attachment",
+	})
+	require.True(t, errors.Is(err, commonblobgo.ErrInvalidArgument))
+}
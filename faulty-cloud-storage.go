@@ -0,0 +1,234 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// faultAnyOperation configures the operations without an entry of their own in FaultConfig.
+const faultAnyOperation = "*"
+
+// FaultConfig sets the failures injected by NewFaultyStorage. The operations are named like OpInfo.Name,
+// e.g. "Write" or "GetWriter.Close", and the "*" entries apply to the operations without an entry of their own.
+type FaultConfig struct {
+	// ErrorRates are the probabilities, from 0 to 1, that the operations fail with Err instead of being called.
+	ErrorRates map[string]float64
+	// Err is the error of the failures of ErrorRates, a 503 FaultError by default.
+	Err error
+	// Latencies delay the operations, the delay ends early with the error of the context when it's done.
+	Latencies map[string]time.Duration
+	// TruncateReadRate is the probability that a reader of GetReader or GetRangeReader fails with
+	// io.ErrUnexpectedEOF after TruncateAfter bytes, like a connection reset in the middle of the body.
+	TruncateReadRate float64
+	TruncateAfter    int64
+	// Sequences script the outcomes of the first calls of the operations, before ErrorRates applies,
+	// e.g. {"Write": {NewFaultError(503), NewFaultError(503)}} fails the first two writes. A nil error lets
+	// the call through.
+	Sequences map[string][]error
+	// Seed seeds the random failures, so that a test injects the same failures on every run.
+	Seed int64
+}
+
+// FaultError is a failure of the provider with an HTTP status, injected by NewFaultyStorage. It's classified
+// by ErrorCode like the provider errors, e.g. the 503 is ErrorKindUnavailable and retried.
+type FaultError struct {
+	StatusCode int
+}
+
+// NewFaultError returns a FaultError of the HTTP status.
+func NewFaultError(statusCode int) error {
+	return &FaultError{StatusCode: statusCode}
+}
+
+func (e *FaultError) Error() string {
+	return fmt.Sprintf("injected fault: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// NewFaultyStorage returns a storage injecting the failures of the config into the operations of inner,
+// to check that a service survives the brownouts of the storage. It's meant for the tests, around any
+// CloudStorage, e.g. the one of fakeblob.New.
+func NewFaultyStorage(inner CloudStorage, cfg FaultConfig) CloudStorage {
+	injector := &faultInjector{
+		config: cfg,
+		random: rand.New(rand.NewSource(cfg.Seed)), //nolint:gosec
+		calls:  make(map[string]int),
+	}
+
+	if injector.config.Err == nil {
+		injector.config.Err = NewFaultError(http.StatusServiceUnavailable)
+	}
+
+	return &faultyCloudStorage{
+		CloudStorage: newInstrumentedCloudStorage(inner, storageOptions{
+			interceptors: []Interceptor{injector.intercept},
+		}, ""),
+		inner:    inner,
+		injector: injector,
+	}
+}
+
+// faultInjector decides the failures of the operations, with the random source of the seed.
+type faultInjector struct {
+	config FaultConfig
+
+	mu     sync.Mutex
+	random *rand.Rand
+	// calls are the number of calls of the operations with a sequence
+	calls map[string]int
+}
+
+// faultSetting returns the setting of the operation, or the one of any operation.
+func faultSetting(settings map[string]float64, name string) float64 {
+	if value, ok := settings[name]; ok {
+		return value
+	}
+
+	return settings[faultAnyOperation]
+}
+
+// fault returns the error injected into the call of the operation, nil when it goes through.
+func (f *faultInjector) fault(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	sequence, ok := f.config.Sequences[name]
+	if !ok {
+		sequence = f.config.Sequences[faultAnyOperation]
+	}
+
+	if call := f.calls[name]; call < len(sequence) {
+		f.calls[name]++
+
+		return sequence[call]
+	}
+
+	if rate := faultSetting(f.config.ErrorRates, name); rate > 0 && f.random.Float64() < rate {
+		return f.config.Err
+	}
+
+	return nil
+}
+
+// truncates reports whether a reader is truncated.
+func (f *faultInjector) truncates() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.config.TruncateReadRate > 0 && f.random.Float64() < f.config.TruncateReadRate
+}
+
+func (f *faultInjector) intercept(ctx context.Context, op OpInfo, next func(ctx context.Context) error) error {
+	latency, ok := f.config.Latencies[op.Name]
+	if !ok {
+		latency = f.config.Latencies[faultAnyOperation]
+	}
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+
+			return ctx.Err()
+		}
+	}
+
+	if err := f.fault(op.Name); err != nil {
+		return err
+	}
+
+	return next(ctx)
+}
+
+// faultyCloudStorage runs the operations through the interceptor of the injector, and truncates the readers.
+type faultyCloudStorage struct {
+	CloudStorage
+
+	inner    CloudStorage
+	injector *faultInjector
+}
+
+var _ CloudStorage = (*faultyCloudStorage)(nil)
+
+// options returns the settings of the wrapped storage.
+func (ts *faultyCloudStorage) options() storageOptions {
+	return storageOptionsOf(ts.inner)
+}
+
+// bucketLocation is the one of the wrapped storage, so that CopyObjectBetween still copies by the provider.
+func (ts *faultyCloudStorage) bucketLocation() string {
+	locator, ok := ts.inner.(bucketLocator)
+	if !ok {
+		return ""
+	}
+
+	return locator.bucketLocation()
+}
+
+func (ts *faultyCloudStorage) GetReader(
+	ctx context.Context,
+	key string,
+) (io.ReadCloser, error) {
+	return ts.truncate(ts.CloudStorage.GetReader(ctx, key))
+}
+
+func (ts *faultyCloudStorage) GetRangeReader(
+	ctx context.Context,
+	key string,
+	offset int64,
+	length int64,
+) (io.ReadCloser, error) {
+	return ts.truncate(ts.CloudStorage.GetRangeReader(ctx, key, offset, length))
+}
+
+func (ts *faultyCloudStorage) truncate(reader io.ReadCloser, err error) (io.ReadCloser, error) {
+	if err != nil || !ts.injector.truncates() {
+		return reader, err
+	}
+
+	return &truncatedReader{ReadCloser: reader, remaining: ts.injector.config.TruncateAfter}, nil
+}
+
+// truncatedReader fails with io.ErrUnexpectedEOF once the remaining bytes are read.
+type truncatedReader struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (r *truncatedReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+
+	n, err := r.ReadCloser.Read(p)
+	r.remaining -= int64(n)
+
+	return n, err
+}
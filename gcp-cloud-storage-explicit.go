@@ -24,34 +24,53 @@ import (
 	"time"
 
 	"cloud.google.com/go/storage"
-	"github.com/sirupsen/logrus"
 	"gocloud.dev/blob"
 	"gocloud.dev/blob/gcsblob"
 	"gocloud.dev/gcp"
 	"golang.org/x/oauth2/google"
-	"google.golang.org/api/option"
+	"google.golang.org/api/iterator"
 )
 
 type ExplicitGCPCloudStorage struct {
+	storageOptions
+	closeState
+
 	client          *storage.Client
 	bucket          *blob.Bucket
 	bucketName      string
 	privateKey      []byte
 	googleAccessID  string
-	bucketCloseFunc func()
+	projectID       string
+	bucketCloseFunc func() error
 }
 
+var _ CloudStorage = (*ExplicitGCPCloudStorage)(nil)
+
+// signature holds the service account key of the credentials JSON, which signs the URLs and the POST policies.
+// The other kinds of credentials, e.g. the workload identity federation ones, have none.
 type signature struct {
 	PrivateKey     string `json:"private_key"`
 	GoogleAccessID string `json:"client_email"`
 }
 
-// nolint:funlen
-func newExplicitGCPCloudStorage(
+// errGCPNoSigningKey is returned when signing with credentials which are not a service account key.
+var errGCPNoSigningKey = newTypedError(ErrInvalidArgument,
+	fmt.Errorf("credentials JSON has no private_key or client_email; signed URLs require a service account key or IAM signBlob"))
+
+// explicitGCPClients holds the clients shared by every bucket opened with the same JSON credentials.
+type explicitGCPClients struct {
+	client           *storage.Client
+	bucketHTTPClient *gcp.HTTPClient
+	privateKey       []byte
+	googleAccessID   string
+	projectID        string
+}
+
+func newExplicitGCPClients(
 	ctx context.Context,
 	gcpCredentialJSON string,
-	bucketName string,
-) (*ExplicitGCPCloudStorage, error) {
+	debugger *httpDebugger,
+) (*explicitGCPClients, error) {
 	gcpCredentialJSONBytes := []byte(gcpCredentialJSON)
 
 	creds, err := google.CredentialsFromJSON(ctx, gcpCredentialJSONBytes, storage.ScopeFullControl)
@@ -59,29 +78,52 @@ func newExplicitGCPCloudStorage(
 		return nil, fmt.Errorf("unable to initialize GCP creds from JSON: %v", err)
 	}
 
-	var sign *signature
+	var sign signature
 
 	err = json.Unmarshal(gcpCredentialJSONBytes, &sign)
 	if err != nil {
 		return nil, fmt.Errorf("unable to unmarshal credentials: %v", err)
 	}
 
-	client, err := storage.NewClient(ctx, option.WithCredentials(creds))
+	client, err := newGCPClient(ctx, creds, debugger)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create GCP client: %v", err)
 	}
 
 	bucketHTTPClient, err := gcp.NewHTTPClient(
-		gcp.DefaultTransport(),
+		newProviderTransport(gcp.DefaultTransport(), debugger),
 		gcp.CredentialsTokenSource(creds),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create GCP HTTP Client: %v", err)
 	}
 
+	return &explicitGCPClients{
+		client:           client,
+		bucketHTTPClient: bucketHTTPClient,
+		googleAccessID:   sign.GoogleAccessID,
+		privateKey:       []byte(sign.PrivateKey),
+		projectID:        creds.ProjectID,
+	}, nil
+}
+
+func (c *explicitGCPClients) Close() error {
+	if err := c.client.Close(); err != nil {
+		return fmt.Errorf("unable to close GCP client: %w", err)
+	}
+
+	return nil
+}
+
+func newExplicitGCPCloudStorage(
+	ctx context.Context,
+	clients *explicitGCPClients,
+	bucketName string,
+	storageOpts storageOptions,
+) (*ExplicitGCPCloudStorage, error) {
 	bucket, err := gcsblob.OpenBucket(
 		ctx,
-		bucketHTTPClient,
+		clients.bucketHTTPClient,
 		bucketName,
 		nil,
 	)
@@ -89,17 +131,19 @@ func newExplicitGCPCloudStorage(
 		return nil, err
 	}
 
-	logrus.Infof("explicit GCP CloudStorage created")
+	disableGCPBucketRetries(bucket, storageOpts.maxRetries)
+
+	storageOpts.logger.Infof("explicit GCP CloudStorage created")
 
 	return &ExplicitGCPCloudStorage{
-		client:         client,
-		bucketName:     bucketName,
-		bucket:         bucket,
-		googleAccessID: sign.GoogleAccessID,
-		privateKey:     []byte(sign.PrivateKey),
-		bucketCloseFunc: func() {
-			bucket.Close()
-		},
+		client:          clients.client,
+		bucketName:      bucketName,
+		bucket:          bucket,
+		googleAccessID:  clients.googleAccessID,
+		privateKey:      clients.privateKey,
+		projectID:       clients.projectID,
+		storageOptions:  storageOpts,
+		bucketCloseFunc: bucket.Close,
 	}, nil
 }
 
@@ -111,7 +155,7 @@ func (ts *ExplicitGCPCloudStorage) List(
 		Prefix: prefix,
 	})
 
-	return newListIterator(func() (*ListObject, error) {
+	return newReplayableListIterator(func(ctx context.Context) (*ListObject, error) {
 		attrs, err := iter.Next(ctx)
 		if err != nil {
 			return nil, err
@@ -119,7 +163,7 @@ func (ts *ExplicitGCPCloudStorage) List(
 
 		return &ListObject{
 			Key:     attrs.Key,
-			ModTime: attrs.ModTime,
+			ModTime: attrs.ModTime.UTC(),
 			Size:    attrs.Size,
 			MD5:     attrs.MD5,
 		}, nil
@@ -130,41 +174,65 @@ func (ts *ExplicitGCPCloudStorage) ListWithOptions(
 	ctx context.Context,
 	listOptions *ListOptions,
 ) *ListIterator {
-	iter := ts.bucket.List(&blob.ListOptions{
-		Prefix:    listOptions.Prefix,
-		Delimiter: listOptions.Delimiter,
-	})
+	iter := ts.bucket.List(newBlobListOptions(listOptions))
 
-	return newListIterator(func() (*ListObject, error) {
+	return applyListOptions(newReplayableListIterator(func(ctx context.Context) (*ListObject, error) {
 		attrs, err := iter.Next(ctx)
 		if err != nil {
 			return nil, err
 		}
 
-		return &ListObject{
+		object := &ListObject{
 			Key:     attrs.Key,
-			ModTime: attrs.ModTime,
+			ModTime: attrs.ModTime.UTC(),
 			Size:    attrs.Size,
 			MD5:     attrs.MD5,
 			IsDir:   attrs.IsDir,
-		}, nil
-	})
+		}
+
+		// GCS returns the attributes in the listing
+		var gcsAttrs storage.ObjectAttrs
+		if listOptions.IncludeAttributes && attrs.As(&gcsAttrs) {
+			object.ContentType = gcsAttrs.ContentType
+			object.Metadata = gcsAttrs.Metadata
+		}
+
+		return object, nil
+	}), listOptions)
 }
 
 func (ts *ExplicitGCPCloudStorage) Get(
 	ctx context.Context,
 	key string,
 ) ([]byte, error) {
-	body, err := ts.bucket.ReadAll(ctx, key)
+	return readAllAndClose(ts.GetReader(ctx, key))
+}
 
-	return body, err
+func (ts *ExplicitGCPCloudStorage) GetIfModified(
+	ctx context.Context,
+	key string,
+	etag string,
+	modSince time.Time,
+) ([]byte, *Attributes, bool, error) {
+	return getGCPObjectIfModified(ctx, ts.client, ts.bucketName, key, etag, modSince, !ts.disableDecompression)
+}
+
+// GetWithAttributes reads the attributes first, since the GCS reader doesn't expose the metadata.
+// The content is read from the same generation as the attributes.
+func (ts *ExplicitGCPCloudStorage) GetWithAttributes(
+	ctx context.Context,
+	key string,
+) ([]byte, *Attributes, error) {
+	body, attrs, _, err := getGCPObjectIfModified(ctx, ts.client, ts.bucketName, key, "", time.Time{}, !ts.disableDecompression)
+
+	return body, attrs, err
 }
 
 func (ts *ExplicitGCPCloudStorage) GetReader(
 	ctx context.Context,
 	key string,
 ) (io.ReadCloser, error) {
-	return ts.bucket.NewReader(ctx, key, nil)
+	return newGCPReader(ctx, ts.client, ts.bucket, ts.bucketName, key, !ts.disableDecompression)
 }
 
 func (ts *ExplicitGCPCloudStorage) GetRangeReader(
@@ -173,14 +241,26 @@ func (ts *ExplicitGCPCloudStorage) GetRangeReader(
 	offset,
 	length int64,
 ) (io.ReadCloser, error) {
-	return ts.bucket.NewRangeReader(ctx, key, offset, length, nil)
+	return newRangeReader(ctx, ts.bucket, key, offset, length)
 }
 
 func (ts *ExplicitGCPCloudStorage) GetWriter(
 	ctx context.Context,
 	key string,
 ) (io.WriteCloser, error) {
-	return ts.bucket.NewWriter(ctx, key, nil)
+	return ts.GetWriterWithOptions(ctx, key, nil)
+}
+
+func (ts *ExplicitGCPCloudStorage) GetWriterWithOptions(
+	ctx context.Context,
+	key string,
+	opts *WriteOptions,
+) (io.WriteCloser, error) {
+	opts = ts.uploadOptions(opts)
+
+	return newUploadWriter(ctx, opts, func(ctx context.Context) (io.WriteCloser, error) {
+		return newGCPWriter(ctx, ts, ts.client, ts.bucket, ts.bucketName, key, opts, ts.verifiesChecksum(opts))
+	})
 }
 
 func (ts *ExplicitGCPCloudStorage) CreateBucket(
@@ -188,12 +268,100 @@ func (ts *ExplicitGCPCloudStorage) CreateBucket(
 	bucketPrefix string,
 	expirationTimeDays int64,
 ) error {
-	// not supported for prod
-	return nil
+	return ts.CreateBucketWithOptions(ctx, &CreateBucketOptions{Prefix: bucketPrefix, ExpirationDays: expirationTimeDays})
 }
 
-func (ts *ExplicitGCPCloudStorage) Close() {
-	ts.bucketCloseFunc()
+func (ts *ExplicitGCPCloudStorage) CreateBucketWithOptions(
+	ctx context.Context,
+	opts *CreateBucketOptions,
+) error {
+	if !ts.allowBucketCreation {
+		ts.log().Warnf("CreateBucket of '%s' is ignored, the bucket creation isn't allowed", ts.bucketName)
+
+		return nil
+	}
+
+	return createGCPBucket(ctx, ts.client, ts.bucketName, ts.projectID, opts, ts.log())
+}
+
+func (ts *ExplicitGCPCloudStorage) SetLifecycle(
+	ctx context.Context,
+	rules []LifecycleRule,
+	opts *LifecycleOptions,
+) error {
+	return setGCPLifecycle(ctx, ts.client, ts.bucketName, rules, opts)
+}
+
+func (ts *ExplicitGCPCloudStorage) GetLifecycle(
+	ctx context.Context,
+) ([]LifecycleRule, error) {
+	return getGCPLifecycle(ctx, ts.client, ts.bucketName)
+}
+
+func (ts *ExplicitGCPCloudStorage) SetVersioning(
+	ctx context.Context,
+	enabled bool,
+) error {
+	return setGCPVersioning(ctx, ts.client, ts.bucketName, enabled)
+}
+
+func (ts *ExplicitGCPCloudStorage) GetVersioning(
+	ctx context.Context,
+) (bool, error) {
+	state, err := ts.GetVersioningState(ctx)
+
+	return state == VersioningEnabled, err
+}
+
+func (ts *ExplicitGCPCloudStorage) GetVersioningState(
+	ctx context.Context,
+) (VersioningState, error) {
+	return getGCPVersioningState(ctx, ts.client, ts.bucketName)
+}
+
+func (ts *ExplicitGCPCloudStorage) SetCORS(
+	ctx context.Context,
+	rules []CORSRule,
+) error {
+	return setGCPCORS(ctx, ts.client, ts.bucketName, rules)
+}
+
+func (ts *ExplicitGCPCloudStorage) GetCORS(
+	ctx context.Context,
+) ([]CORSRule, error) {
+	return getGCPCORS(ctx, ts.client, ts.bucketName)
+}
+
+func (ts *ExplicitGCPCloudStorage) SetPublicAccessBlock(
+	ctx context.Context,
+	blocked bool,
+) error {
+	return setGCPPublicAccessBlock(ctx, ts.client, ts.bucketName, blocked)
+}
+
+func (ts *ExplicitGCPCloudStorage) GetPublicAccessBlock(
+	ctx context.Context,
+) (bool, error) {
+	block, err := ts.GetPublicAccessBlockDetails(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return block.Blocked(), nil
+}
+
+func (ts *ExplicitGCPCloudStorage) GetPublicAccessBlockDetails(
+	ctx context.Context,
+) (*PublicAccessBlock, error) {
+	return getGCPPublicAccessBlock(ctx, ts.client, ts.bucketName)
+}
+
+func (ts *ExplicitGCPCloudStorage) Close() error {
+	if !ts.markClosed() {
+		return nil
+	}
+
+	return ts.bucketCloseFunc()
 }
 
 func (ts *ExplicitGCPCloudStorage) GetSignedURL(
@@ -201,12 +369,93 @@ func (ts *ExplicitGCPCloudStorage) GetSignedURL(
 	key string,
 	opts *SignedURLOption,
 ) (string, error) {
-	return storage.SignedURL(ts.bucketName, key, &storage.SignedURLOptions{
-		GoogleAccessID: ts.googleAccessID,
-		PrivateKey:     ts.privateKey,
-		Method:         opts.Method,
-		Expires:        time.Now().Add(opts.Expiry).UTC(),
-	})
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	options, err := newGCPSignedURLOptions(opts, ts.storageOptions)
+	if err != nil {
+		return "", err
+	}
+
+	if err := ts.checkSigningKey(); err != nil {
+		return "", err
+	}
+
+	options.GoogleAccessID = ts.googleAccessID
+	options.PrivateKey = ts.privateKey
+
+	return storage.SignedURL(ts.bucketName, key, options)
+}
+
+func (ts *ExplicitGCPCloudStorage) GetSignedPostPolicy(
+	ctx context.Context,
+	keyPrefix string,
+	opts *PostPolicyOptions,
+) (*PostPolicy, error) {
+	if err := ts.checkSigningKey(); err != nil {
+		return nil, err
+	}
+
+	return newGCPPostPolicy(ts.bucketName, keyPrefix, opts, ts.googleAccessID, newGCPPrivateKeySigner(ts.privateKey))
+}
+
+// checkSigningKey rejects the signing when the credentials JSON isn't a service account key,
+// the other operations still work with these credentials.
+func (ts *ExplicitGCPCloudStorage) checkSigningKey() error {
+	if len(ts.privateKey) == 0 || ts.googleAccessID == "" {
+		return errGCPNoSigningKey
+	}
+
+	return nil
+}
+
+func (ts *ExplicitGCPCloudStorage) GetPublicURL(
+	key string,
+) (string, error) {
+	return gcpPublicURL("https", "storage.googleapis.com", ts.bucketName, key)
+}
+
+// As sets i, a **storage.Client or a **storage.BucketHandle of cloud.google.com/go/storage, to the GCS client
+// of the storage, shared with the other buckets of the factory, or to the handle of its bucket. The other types
+// aren't supported.
+func (ts *ExplicitGCPCloudStorage) As(i interface{}) bool {
+	return asGCPClients(i, ts.client, ts.bucketName)
+}
+
+func (ts *ExplicitGCPCloudStorage) StartMultipartUpload(
+	ctx context.Context,
+	key string,
+	opts *WriteOptions,
+) (string, error) {
+	return "", errGCPMultipartUpload
+}
+
+func (ts *ExplicitGCPCloudStorage) SignUploadPartURL(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	partNumber int,
+	expiry time.Duration,
+) (string, error) {
+	return "", errGCPMultipartUpload
+}
+
+func (ts *ExplicitGCPCloudStorage) CompleteMultipartUpload(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	parts []CompletedPart,
+) error {
+	return errGCPMultipartUpload
+}
+
+func (ts *ExplicitGCPCloudStorage) AbortMultipartUpload(
+	ctx context.Context,
+	key string,
+	uploadID string,
+) error {
+	return errGCPMultipartUpload
 }
 
 func (ts *ExplicitGCPCloudStorage) Write(
@@ -215,50 +464,196 @@ func (ts *ExplicitGCPCloudStorage) Write(
 	body []byte,
 	contentType *string,
 ) error {
-	options := &blob.WriterOptions{}
+	options := &WriteOptions{}
 	if contentType != nil {
 		options.ContentType = *contentType
 	}
 
-	return ts.bucket.WriteAll(ctx, key, body, options)
+	return ts.WriteWithOptions(ctx, key, body, options)
+}
+
+func (ts *ExplicitGCPCloudStorage) WriteWithOptions(
+	ctx context.Context,
+	key string,
+	body []byte,
+	opts *WriteOptions,
+) error {
+	return writeGCPObject(ctx, ts.client, ts.bucket, ts.bucketName, key, body, opts, ts.verifiesChecksum(opts))
 }
 
 func (ts *ExplicitGCPCloudStorage) Delete(
 	ctx context.Context,
 	key string,
 ) error {
-	return ts.client.Bucket(ts.bucketName).Object(key).Delete(ctx)
+	return objectError(ts.bucket.Delete(ctx, key))
+}
+
+func (ts *ExplicitGCPCloudStorage) DeleteBatch(
+	ctx context.Context,
+	keys []string,
+) error {
+	return deleteObjects(ctx, ts.bucket, keys)
 }
 
 func (ts *ExplicitGCPCloudStorage) Attributes(
 	ctx context.Context,
 	key string,
 ) (*Attributes, error) {
-	attrs, err := ts.bucket.Attributes(ctx, key)
+	return getBlobAttributes(ctx, ts.bucket, key)
+}
+
+// GetSize shares the HEAD request of Attributes.
+func (ts *ExplicitGCPCloudStorage) GetSize(
+	ctx context.Context,
+	key string,
+) (int64, error) {
+	attrs, err := getBlobAttributes(ctx, ts.bucket, key)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	return &Attributes{
-		CacheControl:       attrs.CacheControl,
-		ContentDisposition: attrs.ContentDisposition,
-		ContentEncoding:    attrs.ContentEncoding,
-		ContentLanguage:    attrs.ContentLanguage,
-		ContentType:        attrs.ContentType,
-		Metadata:           attrs.Metadata,
-		ModTime:            attrs.ModTime,
-		Size:               attrs.Size,
-		MD5:                attrs.MD5,
-	}, nil
+	return attrs.Size, nil
+}
+
+func (ts *ExplicitGCPCloudStorage) VerifyDownload(
+	ctx context.Context,
+	key string,
+) error {
+	return verifyDownload(ctx, ts, key, func() (io.ReadCloser, error) {
+		return newGCPReader(ctx, ts.client, ts.bucket, ts.bucketName, key, false)
+	})
+}
+
+func (ts *ExplicitGCPCloudStorage) SetTags(
+	ctx context.Context,
+	key string,
+	tags map[string]string,
+) error {
+	return newTypedError(ErrNotSupported, fmt.Errorf("GCS doesn't have object tags"))
+}
+
+func (ts *ExplicitGCPCloudStorage) GetTags(
+	ctx context.Context,
+	key string,
+) (map[string]string, error) {
+	return nil, newTypedError(ErrNotSupported, fmt.Errorf("GCS doesn't have object tags"))
+}
+
+func (ts *ExplicitGCPCloudStorage) SetStorageClass(
+	ctx context.Context,
+	key string,
+	class string,
+) error {
+	return setGCPStorageClass(ctx, ts.client, ts.bucketName, key, class)
 }
 
 func (ts *ExplicitGCPCloudStorage) Exists(
 	ctx context.Context,
 	key string,
 ) (bool, error) {
-	return ts.bucket.Exists(ctx, key)
+	return existsGCPObject(ctx, ts.client, ts.bucketName, key)
+}
+
+func (ts *ExplicitGCPCloudStorage) bucketLocation() string {
+	return "gcp/" + ts.bucketName
 }
 
 func (ts *ExplicitGCPCloudStorage) Copy(ctx context.Context, dstKey, srcKey string) error {
-	return ts.bucket.Copy(ctx, dstKey, srcKey, nil)
-}
\ No newline at end of file
+	return copyObject(ctx, ts.bucket, dstKey, srcKey)
+}
+
+func (ts *ExplicitGCPCloudStorage) Move(ctx context.Context, dstKey, srcKey string) error {
+	// the source is kept when the copy failed
+	if err := ts.Copy(ctx, dstKey, srcKey); err != nil {
+		return err
+	}
+
+	if dstKey == srcKey {
+		return nil
+	}
+
+	return ts.Delete(ctx, srcKey)
+}
+
+func (ts *ExplicitGCPCloudStorage) Ping(ctx context.Context) error {
+	// a zero-result list is allowed even for service accounts without bucket-level permissions
+	iter := ts.client.Bucket(ts.bucketName).Objects(ctx, nil)
+	iter.PageInfo().MaxSize = 1
+
+	if _, err := iter.Next(); err != nil && err != iterator.Done {
+		return gcpBucketError(err)
+	}
+
+	return nil
+}
+
+func (ts *ExplicitGCPCloudStorage) ListVersions(
+	ctx context.Context,
+	prefix string,
+) *VersionIterator {
+	return listGCPVersions(ctx, ts.client, ts.bucketName, prefix)
+}
+
+func (ts *ExplicitGCPCloudStorage) GetVersion(
+	ctx context.Context,
+	key string,
+	version string,
+) ([]byte, error) {
+	return getGCPVersion(ctx, ts.client, ts.bucketName, key, version)
+}
+
+func (ts *ExplicitGCPCloudStorage) DeleteVersion(
+	ctx context.Context,
+	key string,
+	version string,
+) error {
+	return deleteGCPVersion(ctx, ts.client, ts.bucketName, key, version)
+}
+
+func (ts *ExplicitGCPCloudStorage) SetObjectRetention(
+	ctx context.Context,
+	key string,
+	until time.Time,
+	mode string,
+) error {
+	return setGCPObjectRetention()
+}
+
+func (ts *ExplicitGCPCloudStorage) GetObjectRetention(
+	ctx context.Context,
+	key string,
+) (*ObjectRetention, error) {
+	return getGCPObjectRetention(ctx, ts.client, ts.bucketName, key)
+}
+
+func (ts *ExplicitGCPCloudStorage) Restore(
+	ctx context.Context,
+	key string,
+	days int,
+	tier string,
+) error {
+	return restoreGCPObject(ctx, ts.client, ts.bucketName, key)
+}
+
+func (ts *ExplicitGCPCloudStorage) RestoreStatus(
+	ctx context.Context,
+	key string,
+) (RestoreState, error) {
+	return getGCPRestoreState(ctx, ts.client, ts.bucketName, key)
+}
+
+func (ts *ExplicitGCPCloudStorage) Append(
+	ctx context.Context,
+	key string,
+	data []byte,
+) error {
+	return appendGCPObject(ctx, ts.client, ts.bucketName, key, data, ts.log())
+}
+
+func (ts *ExplicitGCPCloudStorage) UpdateAttributes(
+	ctx context.Context,
+	key string,
+	update AttributeUpdate,
+) (*Attributes, error) {
+	return updateGCPAttributes(ctx, ts.client, ts.bucketName, key, update)
+}
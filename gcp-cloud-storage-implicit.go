@@ -25,41 +25,56 @@ import (
 	compMeta "cloud.google.com/go/compute/metadata"
 	credentials "cloud.google.com/go/iam/credentials/apiv1"
 	"cloud.google.com/go/storage"
-	"github.com/sirupsen/logrus"
 	"gocloud.dev/blob"
 	"gocloud.dev/blob/gcsblob"
 	"gocloud.dev/gcp"
+	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 	credentialspb "google.golang.org/genproto/googleapis/iam/credentials/v1"
 )
 
 type ImplicitGCPCloudStorage struct {
+	storageOptions
+	closeState
+
 	client               *storage.Client
 	bucket               *blob.Bucket
 	bucketName           string
 	serviceAccountEmail  string
 	iamCredentialsClient *credentials.IamCredentialsClient
-	bucketCloseFunc      func()
+	projectID            string
+	bucketCloseFunc      func() error
 }
 
-// nolint:funlen
-func newImplicitGCPCloudStorage(
+var _ CloudStorage = (*ImplicitGCPCloudStorage)(nil)
+
+// implicitGCPClients holds the clients shared by every bucket opened with the default credentials.
+type implicitGCPClients struct {
+	client               *storage.Client
+	bucketHTTPClient     *gcp.HTTPClient
+	serviceAccountEmail  string
+	iamCredentialsClient *credentials.IamCredentialsClient
+	projectID            string
+}
+
+func newImplicitGCPClients(
 	ctx context.Context,
-	bucketName string,
-) (*ImplicitGCPCloudStorage, error) {
+	debugger *httpDebugger,
+) (*implicitGCPClients, error) {
 	creds, err := gcp.DefaultCredentials(ctx)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("unable to find the GCP default credentials: %w", err)
 	}
 
 	if creds == nil {
-		return nil, fmt.Errorf("unable to initialize GCP creds from default credentials: %v", err)
+		return nil, fmt.Errorf("unable to initialize GCP creds from default credentials: no credentials found")
 	}
 
-	iamCredentialsClient, err := credentials.NewIamCredentialsClient(ctx)
+	iamCredentialsClient, err := credentials.NewIamCredentialsClient(ctx, option.WithCredentials(creds))
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("unable to create GCP IAM credentials client: %w", err)
 	}
 
 	serviceAccountID, err := getDefaultServiceAccountEmail(ctx, creds)
@@ -67,22 +82,51 @@ func newImplicitGCPCloudStorage(
 		return nil, err
 	}
 
-	client, err := storage.NewClient(ctx, option.WithCredentials(creds))
+	client, err := newGCPClient(ctx, creds, debugger)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create GCP client: %v", err)
 	}
 
 	bucketHTTPClient, err := gcp.NewHTTPClient(
-		gcp.DefaultTransport(),
+		newProviderTransport(gcp.DefaultTransport(), debugger),
 		gcp.CredentialsTokenSource(creds),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create GCP HTTP Client: %v", err)
 	}
 
+	return &implicitGCPClients{
+		client:               client,
+		bucketHTTPClient:     bucketHTTPClient,
+		serviceAccountEmail:  serviceAccountID,
+		iamCredentialsClient: iamCredentialsClient,
+		projectID:            creds.ProjectID,
+	}, nil
+}
+
+// Close closes both clients, and returns the first failure.
+func (c *implicitGCPClients) Close() error {
+	err := c.client.Close()
+	if err != nil {
+		err = fmt.Errorf("unable to close GCP client: %w", err)
+	}
+
+	if iamErr := c.iamCredentialsClient.Close(); iamErr != nil && err == nil {
+		err = fmt.Errorf("unable to close GCP IAM credentials client: %w", iamErr)
+	}
+
+	return err
+}
+
+func newImplicitGCPCloudStorage(
+	ctx context.Context,
+	clients *implicitGCPClients,
+	bucketName string,
+	storageOpts storageOptions,
+) (*ImplicitGCPCloudStorage, error) {
 	bucket, err := gcsblob.OpenBucket(
 		ctx,
-		bucketHTTPClient,
+		clients.bucketHTTPClient,
 		bucketName,
 		nil,
 	)
@@ -90,17 +134,20 @@ func newImplicitGCPCloudStorage(
 		return nil, err
 	}
 
-	logrus.Infof("implicit GCP CloudStorage created")
+	disableGCPBucketRetries(bucket, storageOpts.maxRetries)
+
+	storageOpts.logger.Infof("implicit GCP CloudStorage created")
+	storageOpts.logger.Debugf("implicit GCP CloudStorage signs with the service account %s", clients.serviceAccountEmail)
 
 	return &ImplicitGCPCloudStorage{
-		client:              client,
-		bucketName:          bucketName,
-		bucket:              bucket,
-		serviceAccountEmail: serviceAccountID,
-		bucketCloseFunc: func() {
-			bucket.Close()
-		},
-		iamCredentialsClient: iamCredentialsClient,
+		client:               clients.client,
+		bucketName:           bucketName,
+		bucket:               bucket,
+		serviceAccountEmail:  clients.serviceAccountEmail,
+		storageOptions:       storageOpts,
+		bucketCloseFunc:      bucket.Close,
+		iamCredentialsClient: clients.iamCredentialsClient,
+		projectID:            clients.projectID,
 	}, nil
 }
 
@@ -112,7 +159,7 @@ func (ts *ImplicitGCPCloudStorage) List(
 		Prefix: prefix,
 	})
 
-	return newListIterator(func() (*ListObject, error) {
+	return newReplayableListIterator(func(ctx context.Context) (*ListObject, error) {
 		attrs, err := iter.Next(ctx)
 		if err != nil {
 			return nil, err
@@ -120,7 +167,7 @@ func (ts *ImplicitGCPCloudStorage) List(
 
 		return &ListObject{
 			Key:     attrs.Key,
-			ModTime: attrs.ModTime,
+			ModTime: attrs.ModTime.UTC(),
 			Size:    attrs.Size,
 			MD5:     attrs.MD5,
 		}, nil
@@ -131,41 +178,65 @@ func (ts *ImplicitGCPCloudStorage) ListWithOptions(
 	ctx context.Context,
 	listOptions *ListOptions,
 ) *ListIterator {
-	iter := ts.bucket.List(&blob.ListOptions{
-		Prefix:    listOptions.Prefix,
-		Delimiter: listOptions.Delimiter,
-	})
+	iter := ts.bucket.List(newBlobListOptions(listOptions))
 
-	return newListIterator(func() (*ListObject, error) {
+	return applyListOptions(newReplayableListIterator(func(ctx context.Context) (*ListObject, error) {
 		attrs, err := iter.Next(ctx)
 		if err != nil {
 			return nil, err
 		}
 
-		return &ListObject{
+		object := &ListObject{
 			Key:     attrs.Key,
-			ModTime: attrs.ModTime,
+			ModTime: attrs.ModTime.UTC(),
 			Size:    attrs.Size,
 			MD5:     attrs.MD5,
 			IsDir:   attrs.IsDir,
-		}, nil
-	})
+		}
+
+		// GCS returns the attributes in the listing
+		var gcsAttrs storage.ObjectAttrs
+		if listOptions.IncludeAttributes && attrs.As(&gcsAttrs) {
+			object.ContentType = gcsAttrs.ContentType
+			object.Metadata = gcsAttrs.Metadata
+		}
+
+		return object, nil
+	}), listOptions)
 }
 
 func (ts *ImplicitGCPCloudStorage) Get(
 	ctx context.Context,
 	key string,
 ) ([]byte, error) {
-	body, err := ts.bucket.ReadAll(ctx, key)
+	return readAllAndClose(ts.GetReader(ctx, key))
+}
+
+func (ts *ImplicitGCPCloudStorage) GetIfModified(
+	ctx context.Context,
+	key string,
+	etag string,
+	modSince time.Time,
+) ([]byte, *Attributes, bool, error) {
+	return getGCPObjectIfModified(ctx, ts.client, ts.bucketName, key, etag, modSince, !ts.disableDecompression)
+}
+
+// GetWithAttributes reads the attributes first, since the GCS reader doesn't expose the metadata.
+// The content is read from the same generation as the attributes.
+func (ts *ImplicitGCPCloudStorage) GetWithAttributes(
+	ctx context.Context,
+	key string,
+) ([]byte, *Attributes, error) {
+	body, attrs, _, err := getGCPObjectIfModified(ctx, ts.client, ts.bucketName, key, "", time.Time{}, !ts.disableDecompression)
 
-	return body, err
+	return body, attrs, err
 }
 
 func (ts *ImplicitGCPCloudStorage) GetReader(
 	ctx context.Context,
 	key string,
 ) (io.ReadCloser, error) {
-	return ts.bucket.NewReader(ctx, key, nil)
+	return newGCPReader(ctx, ts.client, ts.bucket, ts.bucketName, key, !ts.disableDecompression)
 }
 
 func (ts *ImplicitGCPCloudStorage) GetRangeReader(
@@ -174,14 +245,26 @@ func (ts *ImplicitGCPCloudStorage) GetRangeReader(
 	offset,
 	length int64,
 ) (io.ReadCloser, error) {
-	return ts.bucket.NewRangeReader(ctx, key, offset, length, nil)
+	return newRangeReader(ctx, ts.bucket, key, offset, length)
 }
 
 func (ts *ImplicitGCPCloudStorage) GetWriter(
 	ctx context.Context,
 	key string,
 ) (io.WriteCloser, error) {
-	return ts.bucket.NewWriter(ctx, key, nil)
+	return ts.GetWriterWithOptions(ctx, key, nil)
+}
+
+func (ts *ImplicitGCPCloudStorage) GetWriterWithOptions(
+	ctx context.Context,
+	key string,
+	opts *WriteOptions,
+) (io.WriteCloser, error) {
+	opts = ts.uploadOptions(opts)
+
+	return newUploadWriter(ctx, opts, func(ctx context.Context) (io.WriteCloser, error) {
+		return newGCPWriter(ctx, ts, ts.client, ts.bucket, ts.bucketName, key, opts, ts.verifiesChecksum(opts))
+	})
 }
 
 func (ts *ImplicitGCPCloudStorage) CreateBucket(
@@ -189,12 +272,100 @@ func (ts *ImplicitGCPCloudStorage) CreateBucket(
 	bucketPrefix string,
 	expirationTimeDays int64,
 ) error {
-	// not supported for prod
-	return nil
+	return ts.CreateBucketWithOptions(ctx, &CreateBucketOptions{Prefix: bucketPrefix, ExpirationDays: expirationTimeDays})
 }
 
-func (ts *ImplicitGCPCloudStorage) Close() {
-	ts.bucketCloseFunc()
+func (ts *ImplicitGCPCloudStorage) CreateBucketWithOptions(
+	ctx context.Context,
+	opts *CreateBucketOptions,
+) error {
+	if !ts.allowBucketCreation {
+		ts.log().Warnf("CreateBucket of '%s' is ignored, the bucket creation isn't allowed", ts.bucketName)
+
+		return nil
+	}
+
+	return createGCPBucket(ctx, ts.client, ts.bucketName, ts.projectID, opts, ts.log())
+}
+
+func (ts *ImplicitGCPCloudStorage) SetLifecycle(
+	ctx context.Context,
+	rules []LifecycleRule,
+	opts *LifecycleOptions,
+) error {
+	return setGCPLifecycle(ctx, ts.client, ts.bucketName, rules, opts)
+}
+
+func (ts *ImplicitGCPCloudStorage) GetLifecycle(
+	ctx context.Context,
+) ([]LifecycleRule, error) {
+	return getGCPLifecycle(ctx, ts.client, ts.bucketName)
+}
+
+func (ts *ImplicitGCPCloudStorage) SetVersioning(
+	ctx context.Context,
+	enabled bool,
+) error {
+	return setGCPVersioning(ctx, ts.client, ts.bucketName, enabled)
+}
+
+func (ts *ImplicitGCPCloudStorage) GetVersioning(
+	ctx context.Context,
+) (bool, error) {
+	state, err := ts.GetVersioningState(ctx)
+
+	return state == VersioningEnabled, err
+}
+
+func (ts *ImplicitGCPCloudStorage) GetVersioningState(
+	ctx context.Context,
+) (VersioningState, error) {
+	return getGCPVersioningState(ctx, ts.client, ts.bucketName)
+}
+
+func (ts *ImplicitGCPCloudStorage) SetCORS(
+	ctx context.Context,
+	rules []CORSRule,
+) error {
+	return setGCPCORS(ctx, ts.client, ts.bucketName, rules)
+}
+
+func (ts *ImplicitGCPCloudStorage) GetCORS(
+	ctx context.Context,
+) ([]CORSRule, error) {
+	return getGCPCORS(ctx, ts.client, ts.bucketName)
+}
+
+func (ts *ImplicitGCPCloudStorage) SetPublicAccessBlock(
+	ctx context.Context,
+	blocked bool,
+) error {
+	return setGCPPublicAccessBlock(ctx, ts.client, ts.bucketName, blocked)
+}
+
+func (ts *ImplicitGCPCloudStorage) GetPublicAccessBlock(
+	ctx context.Context,
+) (bool, error) {
+	block, err := ts.GetPublicAccessBlockDetails(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return block.Blocked(), nil
+}
+
+func (ts *ImplicitGCPCloudStorage) GetPublicAccessBlockDetails(
+	ctx context.Context,
+) (*PublicAccessBlock, error) {
+	return getGCPPublicAccessBlock(ctx, ts.client, ts.bucketName)
+}
+
+func (ts *ImplicitGCPCloudStorage) Close() error {
+	if !ts.markClosed() {
+		return nil
+	}
+
+	return ts.bucketCloseFunc()
 }
 
 func (ts *ImplicitGCPCloudStorage) GetSignedURL(
@@ -202,30 +373,96 @@ func (ts *ImplicitGCPCloudStorage) GetSignedURL(
 	key string,
 	opts *SignedURLOption,
 ) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	options, err := newGCPSignedURLOptions(opts, ts.storageOptions)
+	if err != nil {
+		return "", err
+	}
+
+	options.GoogleAccessID = ts.serviceAccountEmail
+	options.SignBytes = ts.signBytes(ctx)
+
+	return storage.SignedURL(ts.bucketName, key, options)
+}
+
+// signBytes signs with the key of the service account through the IAM credentials API, since there's no private key.
+func (ts *ImplicitGCPCloudStorage) signBytes(ctx context.Context) func([]byte) ([]byte, error) {
 	// we use GCP IAM client to sign bytes body(url)
 	// for details read https://github.com/googleapis/google-cloud-go/issues/1130#issuecomment-484236791
 	name := fmt.Sprintf("projects/-/serviceAccounts/%s", ts.serviceAccountEmail)
 
-	options := &storage.SignedURLOptions{
-		GoogleAccessID: ts.serviceAccountEmail,
-		Method:         opts.Method,
-		Expires:        time.Now().Add(opts.Expiry).UTC(),
-		SignBytes: func(b []byte) ([]byte, error) {
-			req := &credentialspb.SignBlobRequest{
-				Payload: b,
-				Name:    name,
-			}
-
-			resp, err := ts.iamCredentialsClient.SignBlob(ctx, req)
-			if err != nil {
-				return nil, err
-			}
-
-			return resp.SignedBlob, err
-		},
+	return func(b []byte) ([]byte, error) {
+		req := &credentialspb.SignBlobRequest{
+			Payload: b,
+			Name:    name,
+		}
+
+		resp, err := ts.iamCredentialsClient.SignBlob(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		return resp.SignedBlob, err
 	}
+}
 
-	return storage.SignedURL(ts.bucketName, key, options)
+func (ts *ImplicitGCPCloudStorage) GetSignedPostPolicy(
+	ctx context.Context,
+	keyPrefix string,
+	opts *PostPolicyOptions,
+) (*PostPolicy, error) {
+	return newGCPPostPolicy(ts.bucketName, keyPrefix, opts, ts.serviceAccountEmail, ts.signBytes(ctx))
+}
+
+func (ts *ImplicitGCPCloudStorage) GetPublicURL(
+	key string,
+) (string, error) {
+	return gcpPublicURL("https", "storage.googleapis.com", ts.bucketName, key)
+}
+
+// As sets i, a **storage.Client or a **storage.BucketHandle of cloud.google.com/go/storage, to the GCS client
+// of the storage, shared with the other buckets of the factory, or to the handle of its bucket. The other types
+// aren't supported.
+func (ts *ImplicitGCPCloudStorage) As(i interface{}) bool {
+	return asGCPClients(i, ts.client, ts.bucketName)
+}
+
+func (ts *ImplicitGCPCloudStorage) StartMultipartUpload(
+	ctx context.Context,
+	key string,
+	opts *WriteOptions,
+) (string, error) {
+	return "", errGCPMultipartUpload
+}
+
+func (ts *ImplicitGCPCloudStorage) SignUploadPartURL(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	partNumber int,
+	expiry time.Duration,
+) (string, error) {
+	return "", errGCPMultipartUpload
+}
+
+func (ts *ImplicitGCPCloudStorage) CompleteMultipartUpload(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	parts []CompletedPart,
+) error {
+	return errGCPMultipartUpload
+}
+
+func (ts *ImplicitGCPCloudStorage) AbortMultipartUpload(
+	ctx context.Context,
+	key string,
+	uploadID string,
+) error {
+	return errGCPMultipartUpload
 }
 
 func (ts *ImplicitGCPCloudStorage) Write(
@@ -234,62 +471,212 @@ func (ts *ImplicitGCPCloudStorage) Write(
 	body []byte,
 	contentType *string,
 ) error {
-	options := &blob.WriterOptions{}
+	options := &WriteOptions{}
 	if contentType != nil {
 		options.ContentType = *contentType
 	}
 
-	return ts.bucket.WriteAll(ctx, key, body, options)
+	return ts.WriteWithOptions(ctx, key, body, options)
+}
+
+func (ts *ImplicitGCPCloudStorage) WriteWithOptions(
+	ctx context.Context,
+	key string,
+	body []byte,
+	opts *WriteOptions,
+) error {
+	return writeGCPObject(ctx, ts.client, ts.bucket, ts.bucketName, key, body, opts, ts.verifiesChecksum(opts))
 }
 
 func (ts *ImplicitGCPCloudStorage) Delete(
 	ctx context.Context,
 	key string,
 ) error {
-	return ts.client.Bucket(ts.bucketName).Object(key).Delete(ctx)
+	return objectError(ts.bucket.Delete(ctx, key))
+}
+
+func (ts *ImplicitGCPCloudStorage) DeleteBatch(
+	ctx context.Context,
+	keys []string,
+) error {
+	return deleteObjects(ctx, ts.bucket, keys)
 }
 
 func (ts *ImplicitGCPCloudStorage) Attributes(
 	ctx context.Context,
 	key string,
 ) (*Attributes, error) {
-	attrs, err := ts.bucket.Attributes(ctx, key)
+	return getBlobAttributes(ctx, ts.bucket, key)
+}
+
+// GetSize shares the HEAD request of Attributes.
+func (ts *ImplicitGCPCloudStorage) GetSize(
+	ctx context.Context,
+	key string,
+) (int64, error) {
+	attrs, err := getBlobAttributes(ctx, ts.bucket, key)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	return &Attributes{
-		CacheControl:       attrs.CacheControl,
-		ContentDisposition: attrs.ContentDisposition,
-		ContentEncoding:    attrs.ContentEncoding,
-		ContentLanguage:    attrs.ContentLanguage,
-		ContentType:        attrs.ContentType,
-		Metadata:           attrs.Metadata,
-		ModTime:            attrs.ModTime,
-		Size:               attrs.Size,
-		MD5:                attrs.MD5,
-	}, nil
+	return attrs.Size, nil
+}
+
+func (ts *ImplicitGCPCloudStorage) VerifyDownload(
+	ctx context.Context,
+	key string,
+) error {
+	return verifyDownload(ctx, ts, key, func() (io.ReadCloser, error) {
+		return newGCPReader(ctx, ts.client, ts.bucket, ts.bucketName, key, false)
+	})
+}
+
+func (ts *ImplicitGCPCloudStorage) SetTags(
+	ctx context.Context,
+	key string,
+	tags map[string]string,
+) error {
+	return newTypedError(ErrNotSupported, fmt.Errorf("GCS doesn't have object tags"))
+}
+
+func (ts *ImplicitGCPCloudStorage) GetTags(
+	ctx context.Context,
+	key string,
+) (map[string]string, error) {
+	return nil, newTypedError(ErrNotSupported, fmt.Errorf("GCS doesn't have object tags"))
+}
+
+func (ts *ImplicitGCPCloudStorage) SetStorageClass(
+	ctx context.Context,
+	key string,
+	class string,
+) error {
+	return setGCPStorageClass(ctx, ts.client, ts.bucketName, key, class)
 }
 
 func (ts *ImplicitGCPCloudStorage) Exists(
 	ctx context.Context,
 	key string,
 ) (bool, error) {
-	return ts.bucket.Exists(ctx, key)
+	return existsGCPObject(ctx, ts.client, ts.bucketName, key)
+}
+
+func (ts *ImplicitGCPCloudStorage) bucketLocation() string {
+	return "gcp/" + ts.bucketName
 }
 
 func (ts *ImplicitGCPCloudStorage) Copy(ctx context.Context, dstKey, srcKey string) error {
-	return ts.bucket.Copy(ctx, dstKey, srcKey, nil)
+	return copyObject(ctx, ts.bucket, dstKey, srcKey)
+}
+
+func (ts *ImplicitGCPCloudStorage) Move(ctx context.Context, dstKey, srcKey string) error {
+	// the source is kept when the copy failed
+	if err := ts.Copy(ctx, dstKey, srcKey); err != nil {
+		return err
+	}
+
+	if dstKey == srcKey {
+		return nil
+	}
+
+	return ts.Delete(ctx, srcKey)
+}
+
+func (ts *ImplicitGCPCloudStorage) Ping(ctx context.Context) error {
+	// a zero-result list is allowed even for service accounts without bucket-level permissions
+	iter := ts.client.Bucket(ts.bucketName).Objects(ctx, nil)
+	iter.PageInfo().MaxSize = 1
+
+	if _, err := iter.Next(); err != nil && err != iterator.Done {
+		return gcpBucketError(err)
+	}
+
+	return nil
+}
+
+func (ts *ImplicitGCPCloudStorage) ListVersions(
+	ctx context.Context,
+	prefix string,
+) *VersionIterator {
+	return listGCPVersions(ctx, ts.client, ts.bucketName, prefix)
+}
+
+func (ts *ImplicitGCPCloudStorage) GetVersion(
+	ctx context.Context,
+	key string,
+	version string,
+) ([]byte, error) {
+	return getGCPVersion(ctx, ts.client, ts.bucketName, key, version)
+}
+
+func (ts *ImplicitGCPCloudStorage) DeleteVersion(
+	ctx context.Context,
+	key string,
+	version string,
+) error {
+	return deleteGCPVersion(ctx, ts.client, ts.bucketName, key, version)
+}
+
+func (ts *ImplicitGCPCloudStorage) SetObjectRetention(
+	ctx context.Context,
+	key string,
+	until time.Time,
+	mode string,
+) error {
+	return setGCPObjectRetention()
+}
+
+func (ts *ImplicitGCPCloudStorage) GetObjectRetention(
+	ctx context.Context,
+	key string,
+) (*ObjectRetention, error) {
+	return getGCPObjectRetention(ctx, ts.client, ts.bucketName, key)
+}
+
+func (ts *ImplicitGCPCloudStorage) Restore(
+	ctx context.Context,
+	key string,
+	days int,
+	tier string,
+) error {
+	return restoreGCPObject(ctx, ts.client, ts.bucketName, key)
+}
+
+func (ts *ImplicitGCPCloudStorage) RestoreStatus(
+	ctx context.Context,
+	key string,
+) (RestoreState, error) {
+	return getGCPRestoreState(ctx, ts.client, ts.bucketName, key)
+}
+
+func (ts *ImplicitGCPCloudStorage) Append(
+	ctx context.Context,
+	key string,
+	data []byte,
+) error {
+	return appendGCPObject(ctx, ts.client, ts.bucketName, key, data, ts.log())
+}
+
+func (ts *ImplicitGCPCloudStorage) UpdateAttributes(
+	ctx context.Context,
+	key string,
+	update AttributeUpdate,
+) (*Attributes, error) {
+	return updateGCPAttributes(ctx, ts.client, ts.bucketName, key, update)
 }
 
 func getDefaultServiceAccountEmail(
 	ctx context.Context,
 	creds *google.Credentials,
 ) (string, error) {
+	if creds == nil || creds.TokenSource == nil {
+		return "", fmt.Errorf("unable to get the default service account: no credentials")
+	}
+
 	// for details read https://github.com/googleapis/google-cloud-go/issues/1130#issuecomment-564301710
 	token, err := creds.TokenSource.Token()
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("unable to get the token of the default credentials: %w", err)
 	}
 
 	accountIDRaw := token.Extra("oauth2.google.serviceAccount")
@@ -299,16 +686,12 @@ func getDefaultServiceAccountEmail(
 		return "", fmt.Errorf("error validating accountID")
 	}
 
-	client, err := google.DefaultClient(ctx)
-	if err != nil {
-		return "", err
-	}
-
-	computeClient := compMeta.NewClient(client)
+	// the credentials found by the caller are reused instead of being looked up again
+	computeClient := compMeta.NewClient(oauth2.NewClient(ctx, creds.TokenSource))
 
 	email, err := computeClient.Email(accountID)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("unable to get the email of service account '%s' from the metadata server: %w", accountID, err)
 	}
 
 	return email, nil
@@ -0,0 +1,1280 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"gocloud.dev/blob"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+)
+
+const (
+	gcpArchiveStorageClass  = "ARCHIVE"
+	gcpStandardStorageClass = "STANDARD"
+	// gcpMaxV4SignedURLExpiry is the longest validity of the V4 signed URLs
+	gcpMaxV4SignedURLExpiry = 7 * 24 * time.Hour
+)
+
+// errGCPMultipartUpload is returned by the multipart upload methods, GCS has resumable uploads instead of parts.
+var errGCPMultipartUpload = newTypedError(ErrNotSupported, fmt.Errorf("multipart uploads with presigned part URLs on GCS"))
+
+// newGCPClient creates the GCS client of the credentials, with the authorized HTTP client created here to record
+// its responses and log its exchanges with DebugHTTP.
+func newGCPClient(ctx context.Context, creds *google.Credentials, debugger *httpDebugger) (*storage.Client, error) {
+	httpClient, _, err := htransport.NewClient(ctx,
+		option.WithCredentials(creds),
+		option.WithScopes(storage.ScopeFullControl),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient.Transport = newProviderTransport(httpClient.Transport, debugger)
+
+	return storage.NewClient(ctx, option.WithHTTPClient(httpClient))
+}
+
+// disableGCPRetries turns off the retries of the GCS client when the storages retry the transient errors themselves,
+// with positive maxRetries, so that the retries don't multiply.
+func disableGCPRetries(client *storage.Client, maxRetries int) {
+	if maxRetries > 0 {
+		client.SetRetry(storage.WithPolicy(storage.RetryNever))
+	}
+}
+
+// disableGCPBucketRetries turns off the retries of the GCS client of the bucket, see disableGCPRetries.
+func disableGCPBucketRetries(bucket *blob.Bucket, maxRetries int) {
+	var client *storage.Client
+	if bucket.As(&client) {
+		disableGCPRetries(client, maxRetries)
+	}
+}
+
+// createGCPBucket creates the bucket in the project, with the settings of the options.
+// The bucket already owned by the project counts as created, unless it's in another location, and the expiration
+// rule is merged into its lifecycle; GCS answers with a conflict for the buckets of any project.
+func createGCPBucket(
+	ctx context.Context,
+	client *storage.Client,
+	bucketName, projectID string,
+	opts *CreateBucketOptions,
+	logger Logger,
+) error {
+	if opts == nil {
+		opts = &CreateBucketOptions{}
+	}
+
+	if projectID == "" {
+		return newTypedError(ErrInvalidArgument,
+			fmt.Errorf("the project of the credentials is required to create bucket '%s'", bucketName))
+	}
+
+	if opts.ObjectLock && opts.RetentionPeriod <= 0 {
+		return newTypedError(ErrNotSupported, fmt.Errorf("object lock of GCS buckets without a retention period"))
+	}
+
+	if opts.RetentionPeriod < 0 {
+		return newTypedError(ErrInvalidArgument, fmt.Errorf("negative retention period %v", opts.RetentionPeriod))
+	}
+
+	attrs := &storage.BucketAttrs{
+		Location:                 opts.Region,
+		StorageClass:             opts.StorageClass,
+		UniformBucketLevelAccess: storage.UniformBucketLevelAccess{Enabled: opts.UniformAccess},
+	}
+
+	if opts.BlockPublicAccess {
+		attrs.PublicAccessPrevention = storage.PublicAccessPreventionEnforced
+	}
+
+	if opts.RetentionPeriod > 0 {
+		attrs.RetentionPolicy = &storage.RetentionPolicy{RetentionPeriod: opts.RetentionPeriod}
+	}
+
+	expirationRule := newGCPExpirationRule(opts.Prefix, opts.ExpirationDays)
+	if opts.ExpirationDays > 0 {
+		attrs.Lifecycle = storage.Lifecycle{Rules: newGCPLifecycleRules(expirationRule)}
+	}
+
+	bucket := client.Bucket(bucketName)
+
+	err := bucket.Create(ctx, projectID, attrs)
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusConflict {
+		// the bucket of another project isn't readable
+		existing, attrsErr := bucket.Attrs(ctx)
+		if attrsErr == nil {
+			if opts.Region != "" && !strings.EqualFold(existing.Location, opts.Region) {
+				return newTypedError(ErrBucketRegionMismatch,
+					fmt.Errorf("bucket '%s' exists in %s instead of %s: %w", bucketName, existing.Location, opts.Region, err))
+			}
+
+			if opts.BlockPublicAccess {
+				if err := setGCPPublicAccessBlock(ctx, client, bucketName, true); err != nil {
+					return fmt.Errorf("unable to block the public access of bucket '%s': %w", bucketName, err)
+				}
+			}
+
+			if opts.RetentionPeriod > 0 {
+				_, err := bucket.Update(ctx, storage.BucketAttrsToUpdate{
+					RetentionPolicy: &storage.RetentionPolicy{RetentionPeriod: opts.RetentionPeriod},
+				})
+				if err != nil {
+					return fmt.Errorf("unable to set the retention policy of bucket '%s': %w", bucketName, gcpBucketError(err))
+				}
+			}
+
+			if opts.ExpirationDays <= 0 {
+				return nil
+			}
+
+			return setGCPLifecycle(ctx, client, bucketName, []LifecycleRule{expirationRule}, nil)
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to create bucket '%s': %w", bucketName, gcpBucketError(err))
+	}
+
+	logger.Infof("bucket '%s' created", bucketName)
+
+	return nil
+}
+
+// newGCPExpirationRule deletes the objects under the prefix after the days, the prefix is trimmed
+// of its trailing "/" like the one of the S3 rule.
+func newGCPExpirationRule(bucketPrefix string, expirationTimeDays int64) LifecycleRule {
+	return LifecycleRule{
+		Prefix:         strings.TrimSuffix(bucketPrefix, "/"),
+		ExpirationDays: expirationTimeDays,
+	}
+}
+
+// setGCPLifecycle updates the lifecycle of the bucket, each action of a rule is a GCS rule matching the prefix.
+// The existing rules of other prefixes are kept unless ReplaceAll is set.
+func setGCPLifecycle(
+	ctx context.Context,
+	client *storage.Client,
+	bucketName string,
+	rules []LifecycleRule,
+	opts *LifecycleOptions,
+) error {
+	if err := validateLifecycleRules(rules); err != nil {
+		return err
+	}
+
+	bucket := client.Bucket(bucketName)
+	lifecycle := storage.Lifecycle{}
+
+	if opts == nil || !opts.ReplaceAll {
+		attrs, err := bucket.Attrs(ctx)
+		if err != nil {
+			return gcpBucketError(err)
+		}
+
+		replaced := replacedLifecyclePrefixes(rules)
+
+		for _, rule := range attrs.Lifecycle.Rules {
+			if prefix, ok := gcpLifecycleRulePrefix(rule); !ok || !replaced[prefix] {
+				lifecycle.Rules = append(lifecycle.Rules, rule)
+			}
+		}
+	}
+
+	for _, rule := range rules {
+		lifecycle.Rules = append(lifecycle.Rules, newGCPLifecycleRules(rule)...)
+	}
+
+	_, err := bucket.Update(ctx, storage.BucketAttrsToUpdate{Lifecycle: &lifecycle})
+
+	return gcpBucketError(err)
+}
+
+// getGCPLifecycle returns the rules of the bucket, the GCS rules of the same prefix are merged into one rule.
+// The rules with other actions or conditions than the ones of LifecycleRule are ignored.
+func getGCPLifecycle(ctx context.Context, client *storage.Client, bucketName string) ([]LifecycleRule, error) {
+	attrs, err := client.Bucket(bucketName).Attrs(ctx)
+	if err != nil {
+		return nil, gcpBucketError(err)
+	}
+
+	rules := []LifecycleRule{}
+	indexes := make(map[string]int)
+
+	for _, gcsRule := range attrs.Lifecycle.Rules {
+		prefixes := gcsRule.Condition.MatchesPrefix
+		if len(prefixes) == 0 {
+			prefixes = []string{""}
+		}
+
+		for _, prefix := range prefixes {
+			index, ok := indexes[prefix]
+			if !ok {
+				index = len(rules)
+				indexes[prefix] = index
+				rules = append(rules, LifecycleRule{Prefix: prefix})
+			}
+
+			setGCPLifecycleAction(&rules[index], gcsRule)
+		}
+	}
+
+	// the prefixes of the ignored rules have no action
+	actionRules := rules[:0]
+
+	for _, rule := range rules {
+		if rule.ExpirationDays > 0 || rule.NoncurrentVersionExpirationDays > 0 || rule.TransitionStorageClass != "" {
+			actionRules = append(actionRules, rule)
+		}
+	}
+
+	return actionRules, nil
+}
+
+func setGCPLifecycleAction(rule *LifecycleRule, gcsRule storage.LifecycleRule) {
+	condition := gcsRule.Condition
+
+	switch gcsRule.Action.Type {
+	case storage.DeleteAction:
+		switch {
+		case condition.DaysSinceNoncurrentTime > 0:
+			rule.NoncurrentVersionExpirationDays = condition.DaysSinceNoncurrentTime
+		case condition.Liveness == storage.Archived && condition.AgeInDays > 0:
+			rule.NoncurrentVersionExpirationDays = condition.AgeInDays
+		case condition.AgeInDays > 0:
+			rule.ExpirationDays = condition.AgeInDays
+		}
+	case storage.SetStorageClassAction:
+		rule.TransitionDays = condition.AgeInDays
+		rule.TransitionStorageClass = gcsRule.Action.StorageClass
+	}
+}
+
+func newGCPLifecycleRules(rule LifecycleRule) []storage.LifecycleRule {
+	var (
+		rules         []storage.LifecycleRule
+		matchesPrefix []string
+	)
+
+	if rule.Prefix != "" {
+		matchesPrefix = []string{rule.Prefix}
+	}
+
+	if rule.ExpirationDays > 0 {
+		rules = append(rules, storage.LifecycleRule{
+			Action:    storage.LifecycleAction{Type: storage.DeleteAction},
+			Condition: storage.LifecycleCondition{AgeInDays: rule.ExpirationDays, MatchesPrefix: matchesPrefix},
+		})
+	}
+
+	if rule.NoncurrentVersionExpirationDays > 0 {
+		rules = append(rules, storage.LifecycleRule{
+			Action: storage.LifecycleAction{Type: storage.DeleteAction},
+			Condition: storage.LifecycleCondition{
+				DaysSinceNoncurrentTime: rule.NoncurrentVersionExpirationDays,
+				MatchesPrefix:           matchesPrefix,
+			},
+		})
+	}
+
+	if rule.TransitionStorageClass != "" {
+		rules = append(rules, storage.LifecycleRule{
+			Action:    storage.LifecycleAction{Type: storage.SetStorageClassAction, StorageClass: rule.TransitionStorageClass},
+			Condition: storage.LifecycleCondition{AgeInDays: rule.TransitionDays, MatchesPrefix: matchesPrefix},
+		})
+	}
+
+	return rules
+}
+
+// gcpLifecycleRulePrefix returns the prefix of the rule, the rules matching several prefixes have none.
+func gcpLifecycleRulePrefix(rule storage.LifecycleRule) (string, bool) {
+	switch len(rule.Condition.MatchesPrefix) {
+	case 0:
+		return "", true
+	case 1:
+		return rule.Condition.MatchesPrefix[0], true
+	default:
+		return "", false
+	}
+}
+
+func setGCPVersioning(ctx context.Context, client *storage.Client, bucketName string, enabled bool) error {
+	_, err := client.Bucket(bucketName).Update(ctx, storage.BucketAttrsToUpdate{VersioningEnabled: enabled})
+
+	return gcpBucketError(err)
+}
+
+// getGCPVersioningState returns the state of the bucket, GCS doesn't tell the suspended versioning apart.
+func getGCPVersioningState(ctx context.Context, client *storage.Client, bucketName string) (VersioningState, error) {
+	attrs, err := client.Bucket(bucketName).Attrs(ctx)
+	if err != nil {
+		return "", gcpBucketError(err)
+	}
+
+	if attrs.VersioningEnabled {
+		return VersioningEnabled, nil
+	}
+
+	return VersioningUnversioned, nil
+}
+
+// setGCPCORS replaces the CORS configuration of the bucket, which is cleared when there is no rule.
+func setGCPCORS(ctx context.Context, client *storage.Client, bucketName string, rules []CORSRule) error {
+	if err := validateCORSRules(rules); err != nil {
+		return err
+	}
+
+	// the empty slice is sent, unlike nil which keeps the configuration
+	cors := make([]storage.CORS, 0, len(rules))
+
+	for _, rule := range rules {
+		cors = append(cors, storage.CORS{
+			Origins:         rule.Origins,
+			Methods:         rule.Methods,
+			ResponseHeaders: rule.ResponseHeaders,
+			MaxAge:          rule.MaxAge.Truncate(time.Second),
+		})
+	}
+
+	_, err := client.Bucket(bucketName).Update(ctx, storage.BucketAttrsToUpdate{CORS: cors})
+
+	return gcpBucketError(err)
+}
+
+func getGCPCORS(ctx context.Context, client *storage.Client, bucketName string) ([]CORSRule, error) {
+	attrs, err := client.Bucket(bucketName).Attrs(ctx)
+	if err != nil {
+		return nil, gcpBucketError(err)
+	}
+
+	rules := make([]CORSRule, 0, len(attrs.CORS))
+
+	for _, cors := range attrs.CORS {
+		rules = append(rules, CORSRule{
+			Origins:         cors.Origins,
+			Methods:         cors.Methods,
+			ResponseHeaders: cors.ResponseHeaders,
+			MaxAge:          cors.MaxAge,
+		})
+	}
+
+	return rules, nil
+}
+
+// setGCPPublicAccessBlock enforces the public access prevention of the bucket, or makes it inherit
+// the one of the organization.
+func setGCPPublicAccessBlock(ctx context.Context, client *storage.Client, bucketName string, blocked bool) error {
+	prevention := storage.PublicAccessPreventionInherited
+	if blocked {
+		prevention = storage.PublicAccessPreventionEnforced
+	}
+
+	_, err := client.Bucket(bucketName).Update(ctx, storage.BucketAttrsToUpdate{PublicAccessPrevention: prevention})
+
+	return gcpBucketError(err)
+}
+
+// getGCPPublicAccessBlock returns the settings of the enforced public access prevention, the inherited one
+// may still allow the public access.
+func getGCPPublicAccessBlock(ctx context.Context, client *storage.Client, bucketName string) (*PublicAccessBlock, error) {
+	attrs, err := client.Bucket(bucketName).Attrs(ctx)
+	if err != nil {
+		return nil, gcpBucketError(err)
+	}
+
+	enforced := attrs.PublicAccessPrevention == storage.PublicAccessPreventionEnforced
+
+	return &PublicAccessBlock{
+		BlockPublicACLs:       enforced,
+		IgnorePublicACLs:      enforced,
+		BlockPublicPolicy:     enforced,
+		RestrictPublicBuckets: enforced,
+	}, nil
+}
+
+// setGCPObjectRetention rejects the per-object retention, GCS objects are only retained by the retention policy
+// of the bucket.
+func setGCPObjectRetention() error {
+	return newTypedError(ErrNotSupported, fmt.Errorf("per-object retention of GCS objects"))
+}
+
+// getGCPObjectRetention returns the expiration of the object under the retention policy of the bucket, the mode
+// isn't set since the policy applies to all the objects.
+func getGCPObjectRetention(ctx context.Context, client *storage.Client, bucketName, key string) (*ObjectRetention, error) {
+	attrs, err := client.Bucket(bucketName).Object(key).Attrs(ctx)
+	if err != nil {
+		return nil, objectError(err)
+	}
+
+	return &ObjectRetention{RetainUntil: attrs.RetentionExpirationTime}, nil
+}
+
+// existsGCPObject checks the object attributes, only the missing object means that the object doesn't exist.
+// The other failures, such as a 403 or a timeout, are returned instead of being taken as a missing object.
+func existsGCPObject(ctx context.Context, client *storage.Client, bucketName, key string) (bool, error) {
+	_, err := client.Bucket(bucketName).Object(key).Attrs(ctx)
+	if err == nil {
+		return true, nil
+	}
+
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return false, nil
+	}
+
+	return false, objectError(err)
+}
+
+// gcpStartOffset returns the smallest key after startAfter, since the StartOffset of the GCS queries is inclusive.
+func gcpStartOffset(startAfter string) string {
+	if startAfter == "" {
+		return ""
+	}
+
+	return startAfter + "\x00"
+}
+
+// setGCPStorageClass rewrites the object in place with the new storage class, keeping its content and metadata.
+func setGCPStorageClass(ctx context.Context, client *storage.Client, bucketName, key, class string) error {
+	object := client.Bucket(bucketName).Object(key)
+
+	attrs, err := object.Attrs(ctx)
+	if err != nil {
+		return objectError(err)
+	}
+
+	if attrs.StorageClass == class {
+		return nil
+	}
+
+	// don't overwrite the object if it has been replaced in the meantime
+	copier := object.If(storage.Conditions{GenerationMatch: attrs.Generation}).CopierFrom(object)
+	copier.StorageClass = class
+	copier.CacheControl = attrs.CacheControl
+	copier.ContentDisposition = attrs.ContentDisposition
+	copier.ContentEncoding = attrs.ContentEncoding
+	copier.ContentLanguage = attrs.ContentLanguage
+	copier.ContentType = attrs.ContentType
+	copier.Metadata = attrs.Metadata
+
+	_, err = copier.Run(ctx)
+
+	return objectError(err)
+}
+
+// gcpChecksums are the checksums of the body sent with a write, which GCS checks.
+type gcpChecksums struct {
+	// md5 is nil when it's not sent
+	md5        []byte
+	crc32c     uint32
+	sendCRC32C bool
+}
+
+// gcpSendsCRC32C checks the ChecksumAlgorithm of the write, GCS only supports CRC32C.
+func gcpSendsCRC32C(opts *WriteOptions) (bool, error) {
+	if opts == nil {
+		return false, nil
+	}
+
+	switch opts.ChecksumAlgorithm {
+	case "":
+		return false, nil
+	case ChecksumCRC32C:
+		return true, nil
+	case ChecksumSHA256:
+		return false, newTypedError(ErrNotSupported, fmt.Errorf("SHA256 checksums on GCS"))
+	default:
+		return false, newTypedError(ErrInvalidArgument, fmt.Errorf("unknown checksum algorithm '%s'", opts.ChecksumAlgorithm))
+	}
+}
+
+// newGCPWriter opens a writer of the gocloud bucket, or of the GCS client for the conditional writes.
+// The checksums of the streamed content can't be sent upfront, they are compared with the written object on Close.
+func newGCPWriter(
+	ctx context.Context,
+	cloudStorage CloudStorage,
+	client *storage.Client,
+	bucket *blob.Bucket,
+	bucketName string,
+	key string,
+	opts *WriteOptions,
+	verifyMD5 bool,
+) (io.WriteCloser, error) {
+	verifyCRC32C, err := gcpSendsCRC32C(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	compress := opts != nil && opts.Compress
+	if compress {
+		opts = compressedOptions(opts)
+	}
+
+	var writer io.WriteCloser
+
+	if opts.hasConditions() {
+		writer, err = newGCPConditionalWriter(ctx, client, bucketName, key, opts, gcpChecksums{})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		blobWriter, err := bucket.NewWriter(ctx, key, newWriterOptions(opts))
+		if err != nil {
+			return nil, err
+		}
+
+		writer = &typedErrorWriter{blobWriter}
+	}
+
+	// the checksums are the ones of the compressed content, which is stored
+	if verifyMD5 || verifyCRC32C {
+		writer = newChecksumWriter(ctx, cloudStorage, key, writer, verifyMD5, verifyCRC32C)
+	}
+
+	if compress {
+		return newGzipWriteCloser(writer), nil
+	}
+
+	return writer, nil
+}
+
+// writeGCPObject writes the object with the gocloud bucket, or with the GCS client for the conditional writes.
+// With verifyMD5 the MD5 of the body is sent, and the CRC32C with the ChecksumAlgorithm of the write,
+// so that GCS rejects a corrupted upload.
+func writeGCPObject(
+	ctx context.Context,
+	client *storage.Client,
+	bucket *blob.Bucket,
+	bucketName string,
+	key string,
+	body []byte,
+	opts *WriteOptions,
+	verifyMD5 bool,
+) error {
+	sendCRC32C, err := gcpSendsCRC32C(opts)
+	if err != nil {
+		return err
+	}
+
+	body, opts, err = compressBody(body, opts)
+	if err != nil {
+		return err
+	}
+
+	var checksums gcpChecksums
+
+	if verifyMD5 {
+		checksums.md5 = md5Sum(body)
+	}
+
+	if sendCRC32C {
+		checksums.crc32c = crc32.Checksum(body, crc32cTable)
+		checksums.sendCRC32C = true
+	}
+
+	if opts.hasConditions() {
+		return writeGCPObjectConditionally(ctx, client, bucketName, key, body, opts, checksums)
+	}
+
+	options := newWriterOptions(opts)
+	options.ContentMD5 = checksums.md5
+
+	if checksums.sendCRC32C {
+		options.BeforeWrite = func(asFunc func(interface{}) bool) error {
+			var writer *storage.Writer
+			if asFunc(&writer) {
+				writer.CRC32C = checksums.crc32c
+				writer.SendCRC32C = true
+			}
+
+			return nil
+		}
+	}
+
+	return objectError(bucket.WriteAll(ctx, key, body, options))
+}
+
+// newGCPConditionalWriter uses the GCS client directly, since the preconditions are set on the object handle.
+// The checksums are checked by GCS when they are set.
+func newGCPConditionalWriter(
+	ctx context.Context,
+	client *storage.Client,
+	bucketName string,
+	key string,
+	opts *WriteOptions,
+	checksums gcpChecksums,
+) (io.WriteCloser, error) {
+	if err := opts.validateConditions(); err != nil {
+		return nil, err
+	}
+
+	var conditions storage.Conditions
+
+	if opts.IfNotExists {
+		conditions.DoesNotExist = true
+	}
+
+	if opts.IfMatchETag != "" {
+		generation, err := strconv.ParseInt(opts.IfMatchETag, 10, 64)
+		if err != nil {
+			return nil, newTypedError(ErrInvalidArgument,
+				fmt.Errorf("IfMatchETag must be the object generation on GCP, got '%s'", opts.IfMatchETag))
+		}
+
+		conditions.GenerationMatch = generation
+	}
+
+	writerOptions := newWriterOptions(opts)
+
+	writer := client.Bucket(bucketName).Object(key).If(conditions).NewWriter(ctx)
+	writer.CacheControl = writerOptions.CacheControl
+	writer.ContentDisposition = writerOptions.ContentDisposition
+	writer.ContentEncoding = writerOptions.ContentEncoding
+	writer.ContentLanguage = writerOptions.ContentLanguage
+	writer.ContentType = writerOptions.ContentType
+	writer.Metadata = writerOptions.Metadata
+	writer.MD5 = checksums.md5
+	writer.CRC32C = checksums.crc32c
+	writer.SendCRC32C = checksums.sendCRC32C
+
+	if writerOptions.BufferSize > 0 {
+		writer.ChunkSize = writerOptions.BufferSize
+	}
+
+	return &typedErrorWriter{writer}, nil
+}
+
+func writeGCPObjectConditionally(
+	ctx context.Context,
+	client *storage.Client,
+	bucketName string,
+	key string,
+	body []byte,
+	opts *WriteOptions,
+	checksums gcpChecksums,
+) error {
+	writer, err := newGCPConditionalWriter(ctx, client, bucketName, key, opts, checksums)
+	if err != nil {
+		return err
+	}
+
+	if _, err := writer.Write(body); err != nil {
+		_ = writer.Close()
+
+		return err
+	}
+
+	return writer.Close()
+}
+
+// newGCPSignedURLOptions translates the signed URL options, the signing credentials are set by the caller.
+// The content type is part of the signature, so GCS rejects the uploads sending a different one.
+// The expiry is checked against the maximum of the scheme, instead of getting URLs that GCS rejects.
+// With a host override, e.g. a Cloud CDN domain, the V4 signature is computed for that host.
+// The signed headers must be sent by the client with the same values.
+func newGCPSignedURLOptions(opts *SignedURLOption, defaults storageOptions) (*storage.SignedURLOptions, error) {
+	method := opts.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	switch method {
+	case http.MethodGet, http.MethodPut, http.MethodDelete:
+	default:
+		return nil, newTypedError(ErrInvalidArgument, fmt.Errorf("unsupported signed URL method '%s'", opts.Method))
+	}
+
+	if err := opts.validateResponseOverrides(); err != nil {
+		return nil, err
+	}
+
+	if opts.Expiry <= 0 {
+		return nil, newTypedError(ErrInvalidArgument, fmt.Errorf("the expiry of the signed URL must be positive"))
+	}
+
+	// GCS signed URLs have no condition on the address of the client
+	if opts.AllowedSourceIP != "" {
+		return nil, newTypedError(ErrNotSupported, fmt.Errorf("source IP restrictions of GCS signed URLs"))
+	}
+
+	// the signing truncates the seconds left from its own clock, the half second keeps the whole expiry
+	options := &storage.SignedURLOptions{
+		Method:      method,
+		Expires:     time.Now().Add(opts.Expiry + time.Second/2).UTC(),
+		ContentType: opts.ContentType,
+		Scheme:      storage.SigningSchemeV4,
+	}
+
+	host := signedURLHost(opts, defaults)
+
+	switch defaults.signedURLScheme {
+	case SignedURLSchemeV2:
+		if host != "" {
+			return nil, newTypedError(ErrInvalidArgument,
+				fmt.Errorf("signed URL host overrides require the %s signed URL scheme", SignedURLSchemeV4))
+		}
+
+		// only the V4 signature covers the query parameters
+		if opts.hasResponseOverrides() {
+			return nil, newTypedError(ErrInvalidArgument,
+				fmt.Errorf("response header overrides require the %s signed URL scheme", SignedURLSchemeV4))
+		}
+
+		if len(opts.SignedHeaders) > 0 {
+			return nil, newTypedError(ErrInvalidArgument,
+				fmt.Errorf("signed headers require the %s signed URL scheme", SignedURLSchemeV4))
+		}
+
+		options.Scheme = storage.SigningSchemeV2
+	default:
+		if opts.Expiry > gcpMaxV4SignedURLExpiry {
+			return nil, newTypedError(ErrInvalidArgument,
+				fmt.Errorf("the expiry of the V4 signed URLs is at most %s, got %s", gcpMaxV4SignedURLExpiry, opts.Expiry))
+		}
+	}
+
+	if host != "" {
+		options.Style = storage.BucketBoundHostname(host)
+	}
+
+	if opts.hasResponseOverrides() {
+		options.QueryParameters = url.Values{}
+		setOptionalQueryParameter(options.QueryParameters, "response-content-disposition", opts.ResponseContentDisposition)
+		setOptionalQueryParameter(options.QueryParameters, "response-content-type", opts.ResponseContentType)
+		setOptionalQueryParameter(options.QueryParameters, "response-cache-control", opts.ResponseCacheControl)
+	}
+
+	for name, value := range opts.SignedHeaders {
+		options.Headers = append(options.Headers, name+":"+value)
+	}
+
+	return options, nil
+}
+
+func setOptionalQueryParameter(query url.Values, name, value string) {
+	if value != "" {
+		query.Set(name, value)
+	}
+}
+
+// gcpPublicURL builds the path-style URL of the object, the key is escaped.
+func gcpPublicURL(scheme, host, bucketName, key string) (string, error) {
+	if key == "" {
+		return "", newTypedError(ErrInvalidArgument, fmt.Errorf("empty key"))
+	}
+
+	objectURL := url.URL{Scheme: scheme, Host: host, Path: "/" + bucketName + "/" + key}
+
+	return objectURL.String(), nil
+}
+
+// newGCPPostPolicy signs the policy with the V4 signature of the service account, signBytes signs with its key.
+func newGCPPostPolicy(
+	bucketName string,
+	keyPrefix string,
+	opts *PostPolicyOptions,
+	googleAccessID string,
+	signBytes func([]byte) ([]byte, error),
+) (*PostPolicy, error) {
+	if err := validatePostPolicyOptions(opts); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+
+	fields, conditions := newPostPolicyConditions(bucketName, keyPrefix, opts)
+	conditions = addPostPolicyFields(fields, conditions, map[string]string{
+		"x-goog-algorithm":  "GOOG4-RSA-SHA256",
+		"x-goog-credential": fmt.Sprintf("%s/%s/auto/storage/goog4_request", googleAccessID, now.Format("20060102")),
+		"x-goog-date":       now.Format("20060102T150405Z"),
+	})
+
+	policy, err := encodePostPolicy(now.Add(opts.Expiry), conditions)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := signBytes([]byte(policy))
+	if err != nil {
+		return nil, err
+	}
+
+	fields["policy"] = policy
+	fields["x-goog-signature"] = hex.EncodeToString(signature)
+
+	return &PostPolicy{URL: "https://storage.googleapis.com/" + bucketName, Fields: fields}, nil
+}
+
+// newGCPPrivateKeySigner signs with the PEM encoded private key of the service account, like storage.SignedURL.
+func newGCPPrivateKeySigner(privateKey []byte) func([]byte) ([]byte, error) {
+	return func(content []byte) ([]byte, error) {
+		block, _ := pem.Decode(privateKey)
+		if block == nil {
+			return nil, fmt.Errorf("the private key is not PEM encoded")
+		}
+
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse the private key: %w", err)
+			}
+		}
+
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("the private key is not an RSA key")
+		}
+
+		sum := sha256.Sum256(content)
+
+		return rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, sum[:])
+	}
+}
+
+// newGCPReader reads the object, which is decompressed when it's gzip encoded unless decompress is false.
+// The raw content is requested explicitly, since GCS transcodes the gzip encoded objects by default.
+func newGCPReader(
+	ctx context.Context,
+	client *storage.Client,
+	bucket *blob.Bucket,
+	bucketName string,
+	key string,
+	decompress bool,
+) (io.ReadCloser, error) {
+	if decompress {
+		return newBlobReader(ctx, bucket, key, true)
+	}
+
+	reader, err := client.Bucket(bucketName).Object(key).ReadCompressed(true).NewReader(ctx)
+	if err != nil {
+		return nil, objectError(err)
+	}
+
+	return reader, nil
+}
+
+// getGCPObjectIfModified reads the attributes first, and then the body of the same generation when it changed.
+// The JSON API has no If-Modified-Since, so the modification time is compared here.
+// The gzip encoded body is decompressed unless decompress is false.
+func getGCPObjectIfModified(
+	ctx context.Context,
+	client *storage.Client,
+	bucketName string,
+	key string,
+	etag string,
+	modSince time.Time,
+	decompress bool,
+) ([]byte, *Attributes, bool, error) {
+	object := client.Bucket(bucketName).Object(key)
+
+	attrs, err := object.Attrs(ctx)
+	if err != nil {
+		return nil, nil, false, objectError(err)
+	}
+
+	if etag != "" && etag == strconv.FormatInt(attrs.Generation, 10) {
+		return nil, newGCPAttributes(attrs), true, nil
+	}
+
+	if etag == "" && !modSince.IsZero() && !attrs.Updated.After(modSince) {
+		return nil, newGCPAttributes(attrs), true, nil
+	}
+
+	// the object could be replaced since the attributes were read
+	object = object.If(storage.Conditions{GenerationMatch: attrs.Generation}).ReadCompressed(!decompress)
+
+	reader, err := object.NewReader(ctx)
+	if err != nil {
+		return nil, nil, false, objectError(err)
+	}
+
+	defer reader.Close()
+
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	if decompress {
+		if body, err = decompressBody(body, attrs.ContentEncoding); err != nil {
+			return nil, nil, false, err
+		}
+	}
+
+	return body, newGCPAttributes(attrs), false, nil
+}
+
+// getGCPAttributes reads the object metadata, it's the code path of Attributes and GetSize.
+func getGCPAttributes(ctx context.Context, client *storage.Client, bucketName, key string) (*Attributes, error) {
+	attrs, err := client.Bucket(bucketName).Object(key).Attrs(ctx)
+	if err != nil {
+		return nil, objectError(err)
+	}
+
+	return newGCPAttributes(attrs), nil
+}
+
+func newGCPAttributes(attrs *storage.ObjectAttrs) *Attributes {
+	return normalizeAttributes(&Attributes{
+		CacheControl:       attrs.CacheControl,
+		ContentDisposition: attrs.ContentDisposition,
+		ContentEncoding:    attrs.ContentEncoding,
+		ContentLanguage:    attrs.ContentLanguage,
+		ContentType:        attrs.ContentType,
+		Metadata:           attrs.Metadata,
+		ModTime:            attrs.Updated,
+		Size:               attrs.Size,
+		MD5:                attrs.MD5,
+		ETag:               strconv.FormatInt(attrs.Generation, 10),
+		CreateTime:         attrs.Created,
+		StorageClass:       attrs.StorageClass,
+		CRC32C:             attrs.CRC32C,
+		HasCRC32C:          true,
+	})
+}
+
+// gcpObjectIterator reads the GCS listing with the context of each call, whereas the GCS iterator keeps the context
+// of its creation. The page fetch in flight is canceled along with the context of the call, which ends the listing.
+// The responses of the page fetches are recorded for the operation of the call, for the request ID of its error.
+type gcpObjectIterator struct {
+	iter     *storage.ObjectIterator
+	cancel   context.CancelFunc
+	recorder *opStatsRecorder
+	page     []*storage.ObjectAttrs
+	err      error
+}
+
+func newGCPObjectIterator(ctx context.Context, bucket *storage.BucketHandle, query *storage.Query) *gcpObjectIterator {
+	ctx, cancel := context.WithCancel(ctx)
+	recorder := &opStatsRecorder{}
+
+	return &gcpObjectIterator{
+		iter:     bucket.Objects(withOpStatsRecorder(ctx, recorder), query),
+		cancel:   cancel,
+		recorder: recorder,
+	}
+}
+
+func (it *gcpObjectIterator) next(ctx context.Context) (*storage.ObjectAttrs, error) {
+	if it.err != nil {
+		return nil, it.err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// the objects of the current page are returned without fetching
+	if len(it.page) == 0 {
+		if err := it.fetchPage(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	attrs := it.page[0]
+	it.page = it.page[1:]
+
+	return attrs, nil
+}
+
+func (it *gcpObjectIterator) fetchPage(ctx context.Context) error {
+	type result struct {
+		page []*storage.ObjectAttrs
+		err  error
+	}
+
+	results := make(chan result, 1)
+
+	go func() {
+		page, err := it.readPage()
+		results <- result{page: page, err: err}
+	}()
+
+	select {
+	case r := <-results:
+		it.recorder.forwardResponse(opStatsRecorderFrom(ctx))
+
+		if r.err != nil {
+			it.cancel()
+
+			return r.err
+		}
+
+		it.page = r.page
+
+		return nil
+	case <-ctx.Done():
+		// the iterator can't be read again while the fetch goroutine may still use it
+		it.cancel()
+		it.err = ctx.Err()
+
+		return it.err
+	}
+}
+
+// readPage reads the objects of the next page in order, GCS returning the prefixes after the objects of the page.
+func (it *gcpObjectIterator) readPage() ([]*storage.ObjectAttrs, error) {
+	attrs, err := it.iter.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	page := []*storage.ObjectAttrs{attrs}
+
+	for it.iter.PageInfo().Remaining() > 0 {
+		attrs, err := it.iter.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		page = append(page, attrs)
+	}
+
+	// the generations of an object keep their order
+	sort.SliceStable(page, func(i, j int) bool {
+		return gcpListedName(page[i]) < gcpListedName(page[j])
+	})
+
+	return page, nil
+}
+
+func gcpListedName(attrs *storage.ObjectAttrs) string {
+	if attrs.Prefix != "" {
+		return attrs.Prefix
+	}
+
+	return attrs.Name
+}
+
+// listGCPVersions lists the generations, the noncurrent ones are only kept by the buckets with versioning.
+func listGCPVersions(ctx context.Context, client *storage.Client, bucketName, prefix string) *VersionIterator {
+	iter := newGCPObjectIterator(ctx, client.Bucket(bucketName), &storage.Query{
+		Prefix:   prefix,
+		Versions: true,
+	})
+
+	return newVersionIterator(func(ctx context.Context) (*ObjectVersion, error) {
+		attrs, err := iter.next(ctx)
+		if err == iterator.Done {
+			return nil, io.EOF
+		}
+
+		if err != nil {
+			return nil, objectError(err)
+		}
+
+		return &ObjectVersion{
+			Key:      attrs.Name,
+			Version:  strconv.FormatInt(attrs.Generation, 10),
+			ModTime:  attrs.Updated.UTC(),
+			Size:     attrs.Size,
+			IsLatest: attrs.Deleted.IsZero(),
+		}, nil
+	})
+}
+
+func getGCPVersion(ctx context.Context, client *storage.Client, bucketName, key, version string) ([]byte, error) {
+	generation, err := parseGCPGeneration(version)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := client.Bucket(bucketName).Object(key).Generation(generation).NewReader(ctx)
+	if err != nil {
+		return nil, objectError(err)
+	}
+
+	defer reader.Close()
+
+	return ioutil.ReadAll(reader)
+}
+
+func deleteGCPVersion(ctx context.Context, client *storage.Client, bucketName, key, version string) error {
+	generation, err := parseGCPGeneration(version)
+	if err != nil {
+		return err
+	}
+
+	return objectError(client.Bucket(bucketName).Object(key).Generation(generation).Delete(ctx))
+}
+
+func parseGCPGeneration(version string) (int64, error) {
+	generation, err := strconv.ParseInt(version, 10, 64)
+	if err != nil {
+		return 0, newTypedError(ErrInvalidArgument, fmt.Errorf("version must be the object generation on GCP, got '%s'", version))
+	}
+
+	return generation, nil
+}
+
+// restoreGCPObject moves an archived object back to STANDARD. GCS serves the archived objects directly,
+// so the days and the tier don't apply, it only avoids the retrieval fees of the subsequent reads.
+func restoreGCPObject(ctx context.Context, client *storage.Client, bucketName, key string) error {
+	state, err := getGCPRestoreState(ctx, client, bucketName, key)
+	if err != nil {
+		return err
+	}
+
+	if !state.Archived {
+		return nil
+	}
+
+	return setGCPStorageClass(ctx, client, bucketName, key, gcpStandardStorageClass)
+}
+
+func getGCPRestoreState(ctx context.Context, client *storage.Client, bucketName, key string) (RestoreState, error) {
+	attrs, err := client.Bucket(bucketName).Object(key).Attrs(ctx)
+	if err != nil {
+		return RestoreState{}, objectError(err)
+	}
+
+	return RestoreState{
+		Archived: attrs.StorageClass == gcpArchiveStorageClass,
+		Readable: true,
+	}, nil
+}
+
+// appendGCPObject writes the data to a temporary object and composes the object with it.
+// The object mustn't be written concurrently, and GCS limits a composite object to 1024 components,
+// so an object can be appended to 1023 times.
+func appendGCPObject(
+	ctx context.Context,
+	client *storage.Client,
+	bucketName, key string,
+	data []byte,
+	logger Logger,
+) error {
+	bucket := client.Bucket(bucketName)
+	object := bucket.Object(key)
+
+	attrs, err := object.Attrs(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return writeGCPObjectConditionally(ctx, client, bucketName, key, data, &WriteOptions{IfNotExists: true}, gcpChecksums{})
+	}
+
+	if err != nil {
+		return objectError(err)
+	}
+
+	chunkKey := fmt.Sprintf("%s.append-%d", key, time.Now().UnixNano())
+	chunk := bucket.Object(chunkKey)
+
+	writer := chunk.NewWriter(ctx)
+	if _, err := writer.Write(data); err != nil {
+		_ = writer.Close()
+
+		return objectError(err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return objectError(err)
+	}
+
+	defer func() {
+		if deleteErr := chunk.Delete(ctx); deleteErr != nil {
+			logger.Errorf("unable to delete temporary object '%s': %v", chunkKey, deleteErr)
+		}
+	}()
+
+	// the composed object takes the attributes of the composer, not the ones of the sources
+	composer := object.If(storage.Conditions{GenerationMatch: attrs.Generation}).ComposerFrom(object, chunk)
+	composer.CacheControl = attrs.CacheControl
+	composer.ContentDisposition = attrs.ContentDisposition
+	composer.ContentEncoding = attrs.ContentEncoding
+	composer.ContentLanguage = attrs.ContentLanguage
+	composer.ContentType = attrs.ContentType
+	composer.Metadata = attrs.Metadata
+
+	_, err = composer.Run(ctx)
+
+	return objectError(err)
+}
+
+// updateGCPAttributes patches the object attributes, the content isn't rewritten.
+func updateGCPAttributes(
+	ctx context.Context,
+	client *storage.Client,
+	bucketName string,
+	key string,
+	update AttributeUpdate,
+) (*Attributes, error) {
+	object := client.Bucket(bucketName).Object(key)
+
+	current, err := object.Attrs(ctx)
+	if err != nil {
+		return nil, objectError(err)
+	}
+
+	attrs := update.apply(newGCPAttributes(current))
+
+	// the metadata is replaced as a whole, it mustn't have been changed in the meantime
+	updated, err := object.If(storage.Conditions{MetagenerationMatch: current.Metageneration}).Update(ctx,
+		storage.ObjectAttrsToUpdate{
+			CacheControl:       attrs.CacheControl,
+			ContentDisposition: attrs.ContentDisposition,
+			ContentEncoding:    attrs.ContentEncoding,
+			ContentLanguage:    attrs.ContentLanguage,
+			ContentType:        attrs.ContentType,
+			Metadata:           attrs.Metadata,
+		})
+	if err != nil {
+		return nil, objectError(err)
+	}
+
+	return newGCPAttributes(updated), nil
+}
+
+// asGCPClients sets i, a **storage.Client or a **storage.BucketHandle, to the client of a storage or to
+// the handle of its bucket.
+func asGCPClients(i interface{}, client *storage.Client, bucketName string) bool {
+	switch target := i.(type) {
+	case **storage.Client:
+		*target = client
+	case **storage.BucketHandle:
+		*target = client.Bucket(bucketName)
+	default:
+		return false
+	}
+
+	return true
+}
@@ -18,15 +18,18 @@ package commonblobgo
 
 import (
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/storage"
-	"github.com/sirupsen/logrus"
 	"gocloud.dev/blob"
 	"gocloud.dev/blob/gcsblob"
 	"gocloud.dev/gcp"
@@ -36,36 +39,150 @@ import (
 )
 
 type GCPTestCloudStorage struct {
+	storageOptions
+	closeState
+
 	client          *storage.Client
 	bucket          *blob.Bucket
 	bucketName      string
+	scheme          string
 	host            string
-	bucketCloseFunc func()
+	projectID       string
+	bucketCloseFunc func() error
 }
 
-// nolint:funlen
-func newGCPTestCloudStorage(
+var _ CloudStorage = (*GCPTestCloudStorage)(nil)
+
+// gcpTestGoogleAccessID is the service account of the URLs signed by signGCPTestBytes.
+const gcpTestGoogleAccessID = "test@localhost.iam.gserviceaccount.com"
+
+// signGCPTestBytes is the test signer of the signed URLs of the emulator, which doesn't verify the signatures.
+// The URLs are built by the same code path as the production ones, but the signature is only the SHA-256 digest.
+func signGCPTestBytes(content []byte) ([]byte, error) {
+	sum := sha256.Sum256(content)
+
+	return sum[:], nil
+}
+
+// gcpTestClients holds the emulator clients shared by every bucket opened in tests.
+type gcpTestClients struct {
+	client           *storage.Client
+	bucketHTTPClient *gcp.HTTPClient
+	scheme           string
+	host             string
+	projectID        string
+}
+
+// gcpEmulator is the endpoint of the GCS emulator and the trust of its certificate when it's served over HTTPS.
+type gcpEmulator struct {
+	scheme             string
+	host               string
+	caCert             []byte
+	insecureSkipVerify bool
+}
+
+func gcpEmulatorOf(opts CloudStorageOption) gcpEmulator {
+	return gcpEmulator{
+		scheme:             opts.GCPStorageEmulatorScheme,
+		host:               opts.GCPStorageEmulatorHost,
+		caCert:             opts.GCPStorageEmulatorCACert,
+		insecureSkipVerify: opts.GCPStorageEmulatorInsecureSkipVerify,
+	}
+}
+
+// endpoint returns the scheme and the host of the emulator. The host falls back to the STORAGE_EMULATOR_HOST
+// environment variable, and may be prefixed by the scheme like in the variable, e.g. "https://localhost:4443".
+func (e gcpEmulator) endpoint() (string, string, error) {
+	host := e.host
+	if host == "" {
+		host = os.Getenv("STORAGE_EMULATOR_HOST")
+	}
+
+	scheme := e.scheme
+
+	if i := strings.Index(host, "://"); i >= 0 {
+		if scheme == "" {
+			scheme = host[:i]
+		}
+
+		host = host[i+len("://"):]
+	}
+
+	if host == "" {
+		return "", "", fmt.Errorf("can't create GCP bucket for tests, required GCPStorageEmulatorHost option")
+	}
+
+	switch scheme {
+	case "":
+		scheme = "http"
+	case "http", "https":
+	default:
+		return "", "", newTypedError(ErrInvalidArgument,
+			fmt.Errorf("unsupported GCS emulator scheme %s, expected http or https", scheme))
+	}
+
+	return scheme, host, nil
+}
+
+// tlsConfig trusts the CA certificate of the emulator, or any certificate when the verification is skipped.
+func (e gcpEmulator) tlsConfig() (*tls.Config, error) {
+	// nolint:gosec
+	tlsConfig := &tls.Config{InsecureSkipVerify: e.insecureSkipVerify}
+
+	if len(e.caCert) > 0 {
+		tlsConfig.RootCAs = x509.NewCertPool()
+
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(e.caCert) {
+			return nil, newTypedError(ErrInvalidArgument, fmt.Errorf("no PEM certificate in GCPStorageEmulatorCACert"))
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// emulatorTransport sends the requests of gocloud to the emulator of the storage instead of the GCS endpoint,
+// so that the emulator host doesn't have to be set in the STORAGE_EMULATOR_HOST environment variable
+// shared by the whole process.
+type emulatorTransport struct {
+	scheme string
+	host   string
+	base   http.RoundTripper
+}
+
+func (t *emulatorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// the request mustn't be modified by the transports
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.scheme
+	req.URL.Host = t.host
+	req.Host = t.host
+
+	return t.base.RoundTrip(req)
+}
+
+func newGCPTestClients(
 	ctx context.Context,
 	gcpCredentialJSON string,
-	bucketName string,
-) (*GCPTestCloudStorage, error) {
+	emulator gcpEmulator,
+	debugger *httpDebugger,
+) (*gcpTestClients, error) {
 	// validation
-	host := os.Getenv("STORAGE_EMULATOR_HOST")
-	if host == "" {
-		// 3-rd party library expect to have the variable STORAGE_EMULATOR_HOST to switch into test mode
-		return nil, fmt.Errorf("can't create GCP bucket for tests, required ENV variable STORAGE_EMULATOR_HOST")
+	scheme, host, err := emulator.endpoint()
+	if err != nil {
+		return nil, err
 	}
 
-	// create vanilla GCP client
-	// nolint:gosec
-	transCfg := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // ignore expired SSL certificates
+	tlsConfig, err := emulator.tlsConfig()
+	if err != nil {
+		return nil, err
 	}
-	httpClient := &http.Client{Transport: transCfg}
+
+	// create vanilla GCP client
+	transCfg := &http.Transport{TLSClientConfig: tlsConfig}
+	httpClient := &http.Client{Transport: newProviderTransport(transCfg, debugger)}
 
 	client, err := storage.NewClient(
 		context.TODO(),
-		option.WithEndpoint(fmt.Sprintf("http://%s/storage/v1/", host)),
+		option.WithEndpoint(fmt.Sprintf("%s://%s/storage/v1/", scheme, host)),
 		option.WithHTTPClient(httpClient),
 	)
 	if err != nil {
@@ -80,17 +197,37 @@ func newGCPTestCloudStorage(
 		return nil, fmt.Errorf("unable to initialize GCP creds: %v", err)
 	}
 
-	bucketHTTPClient, err := gcp.NewHTTPClient(
-		gcp.DefaultTransport(),
-		gcp.CredentialsTokenSource(gcpCreds),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("unable to create GCP HTTP Client: %v", err)
+	// the emulator doesn't check the credentials
+	bucketHTTPClient := &gcp.HTTPClient{Client: http.Client{
+		Transport: &emulatorTransport{scheme: scheme, host: host, base: newProviderTransport(transCfg, debugger)},
+	}}
+
+	return &gcpTestClients{
+		client:           client,
+		bucketHTTPClient: bucketHTTPClient,
+		scheme:           scheme,
+		host:             host,
+		projectID:        gcpCreds.ProjectID,
+	}, nil
+}
+
+func (c *gcpTestClients) Close() error {
+	if err := c.client.Close(); err != nil {
+		return fmt.Errorf("unable to close GCP client: %w", err)
 	}
 
+	return nil
+}
+
+func newGCPTestCloudStorage(
+	ctx context.Context,
+	clients *gcpTestClients,
+	bucketName string,
+	storageOpts storageOptions,
+) (*GCPTestCloudStorage, error) {
 	bucket, err := gcsblob.OpenBucket(
 		ctx,
-		bucketHTTPClient,
+		clients.bucketHTTPClient,
 		bucketName,
 		nil,
 	)
@@ -98,16 +235,19 @@ func newGCPTestCloudStorage(
 		return nil, err
 	}
 
-	logrus.Infof("GCPTestCloudStorage created")
+	disableGCPBucketRetries(bucket, storageOpts.maxRetries)
+
+	storageOpts.logger.Infof("GCPTestCloudStorage created")
 
 	return &GCPTestCloudStorage{
-		client:     client,
-		host:       host,
-		bucketName: bucketName,
-		bucket:     bucket,
-		bucketCloseFunc: func() {
-			bucket.Close()
-		},
+		client:          clients.client,
+		scheme:          clients.scheme,
+		host:            clients.host,
+		projectID:       clients.projectID,
+		bucketName:      bucketName,
+		bucket:          bucket,
+		storageOptions:  storageOpts,
+		bucketCloseFunc: bucket.Close,
 	}, nil
 }
 
@@ -115,12 +255,12 @@ func (ts *GCPTestCloudStorage) List(
 	ctx context.Context,
 	prefix string,
 ) *ListIterator {
-	iter := ts.client.Bucket(ts.bucketName).Objects(ctx, &storage.Query{
+	iter := newGCPObjectIterator(ctx, ts.client.Bucket(ts.bucketName), &storage.Query{
 		Prefix: prefix,
 	})
 
-	return newListIterator(func() (*ListObject, error) {
-		attrs, err := iter.Next()
+	return newListIterator(func(ctx context.Context) (*ListObject, error) {
+		attrs, err := iter.next(ctx)
 		if err == iterator.Done {
 			return nil, io.EOF
 		}
@@ -131,7 +271,7 @@ func (ts *GCPTestCloudStorage) List(
 
 		return &ListObject{
 			Key:     attrs.Name,
-			ModTime: attrs.Updated,
+			ModTime: attrs.Updated.UTC(),
 			Size:    attrs.Size,
 			MD5:     attrs.MD5,
 		}, nil
@@ -142,45 +282,78 @@ func (ts *GCPTestCloudStorage) ListWithOptions(
 	ctx context.Context,
 	listOptions *ListOptions,
 ) *ListIterator {
-	iter := ts.client.Bucket(ts.bucketName).Objects(ctx, &storage.Query{
-		Prefix:    listOptions.Prefix,
-		Delimiter: listOptions.Delimiter,
+	iter := newGCPObjectIterator(ctx, ts.client.Bucket(ts.bucketName), &storage.Query{
+		Prefix:      listOptions.Prefix,
+		Delimiter:   listOptions.Delimiter,
+		StartOffset: gcpStartOffset(listOptions.StartAfter),
 	})
 
-	return newListIterator(func() (*ListObject, error) {
-		attrs, err := iter.Next()
+	return applyListOptions(newListIterator(func(ctx context.Context) (*ListObject, error) {
+		attrs, err := iter.next(ctx)
 		if err == iterator.Done {
 			return nil, io.EOF
 		}
 
+		if err != nil {
+			return nil, err
+		}
+
 		name := attrs.Name
 		isDir := false
 		if attrs.Prefix != "" {
 			name = attrs.Prefix
 			isDir = true
 		}
-		return &ListObject{
+
+		object := &ListObject{
 			Key:     name,
-			ModTime: attrs.Updated,
+			ModTime: attrs.Updated.UTC(),
 			Size:    attrs.Size,
 			MD5:     attrs.MD5,
 			IsDir:   isDir,
-		}, nil
-	})
+		}
+
+		if listOptions.IncludeAttributes {
+			object.ContentType = attrs.ContentType
+			object.Metadata = attrs.Metadata
+		}
+
+		return object, nil
+	}), listOptions)
 }
 
 func (ts *GCPTestCloudStorage) Get(
 	ctx context.Context,
 	key string,
 ) ([]byte, error) {
-	return ts.bucket.ReadAll(ctx, key)
+	return readAllAndClose(ts.GetReader(ctx, key))
+}
+
+func (ts *GCPTestCloudStorage) GetIfModified(
+	ctx context.Context,
+	key string,
+	etag string,
+	modSince time.Time,
+) ([]byte, *Attributes, bool, error) {
+	return getGCPObjectIfModified(ctx, ts.client, ts.bucketName, key, etag, modSince, !ts.disableDecompression)
+}
+
+// GetWithAttributes reads the attributes first, since the GCS reader doesn't expose the metadata.
+// The content is read from the same generation as the attributes.
+func (ts *GCPTestCloudStorage) GetWithAttributes(
+	ctx context.Context,
+	key string,
+) ([]byte, *Attributes, error) {
+	body, attrs, _, err := getGCPObjectIfModified(ctx, ts.client, ts.bucketName, key, "", time.Time{}, !ts.disableDecompression)
+
+	return body, attrs, err
 }
 
 func (ts *GCPTestCloudStorage) GetReader(
 	ctx context.Context,
 	key string,
 ) (io.ReadCloser, error) {
-	return ts.bucket.NewReader(ctx, key, nil)
+	return newGCPReader(ctx, ts.client, ts.bucket, ts.bucketName, key, !ts.disableDecompression)
 }
 
 func (ts *GCPTestCloudStorage) GetRangeReader(
@@ -189,14 +362,26 @@ func (ts *GCPTestCloudStorage) GetRangeReader(
 	offset,
 	length int64,
 ) (io.ReadCloser, error) {
-	return ts.bucket.NewRangeReader(ctx, key, offset, length, nil)
+	return newRangeReader(ctx, ts.bucket, key, offset, length)
 }
 
 func (ts *GCPTestCloudStorage) GetWriter(
 	ctx context.Context,
 	key string,
 ) (io.WriteCloser, error) {
-	return ts.bucket.NewWriter(ctx, key, nil)
+	return ts.GetWriterWithOptions(ctx, key, nil)
+}
+
+func (ts *GCPTestCloudStorage) GetWriterWithOptions(
+	ctx context.Context,
+	key string,
+	opts *WriteOptions,
+) (io.WriteCloser, error) {
+	opts = ts.uploadOptions(opts)
+
+	return newUploadWriter(ctx, opts, func(ctx context.Context) (io.WriteCloser, error) {
+		return newGCPWriter(ctx, ts, ts.client, ts.bucket, ts.bucketName, key, opts, ts.verifiesChecksum(opts))
+	})
 }
 
 func (ts *GCPTestCloudStorage) CreateBucket(
@@ -204,33 +389,107 @@ func (ts *GCPTestCloudStorage) CreateBucket(
 	bucketPrefix string,
 	expirationTimeDays int64,
 ) error {
-	logrus.Printf("CreateBucket. Name: %s, Prefix: %s, Exp Time: %v", ts.bucketName, bucketPrefix, expirationTimeDays)
+	return ts.CreateBucketWithOptions(ctx, &CreateBucketOptions{Prefix: bucketPrefix, ExpirationDays: expirationTimeDays})
+}
+
+func (ts *GCPTestCloudStorage) CreateBucketWithOptions(
+	ctx context.Context,
+	opts *CreateBucketOptions,
+) error {
+	if opts == nil {
+		opts = &CreateBucketOptions{}
+	}
+
+	ts.logger.Debugf("CreateBucket. Name: %s, Prefix: %s, Exp Time: %v", ts.bucketName, opts.Prefix, opts.ExpirationDays)
 
 	ctx, cancel := context.WithTimeout(ctx, time.Second*10) //nolint:gomnd
 	defer cancel()
 
-	if err := ts.client.Bucket(ts.bucketName).Create(ctx, "", &storage.BucketAttrs{
-		Lifecycle: storage.Lifecycle{
-			Rules: []storage.LifecycleRule{
-				{
-					Action: storage.LifecycleAction{
-						Type: "Delete",
-					},
-					Condition: storage.LifecycleCondition{
-						AgeInDays: expirationTimeDays,
-					},
-				},
-			},
-		},
-	}); err != nil {
-		return fmt.Errorf("failed to create bucket: %v", err)
+	if err := createGCPBucket(ctx, ts.client, ts.bucketName, ts.projectID, opts, ts.logger); err != nil {
+		return fmt.Errorf("failed to create bucket: %w", err)
 	}
 
 	return nil
 }
 
-func (ts *GCPTestCloudStorage) Close() {
-	ts.bucketCloseFunc()
+func (ts *GCPTestCloudStorage) SetLifecycle(
+	ctx context.Context,
+	rules []LifecycleRule,
+	opts *LifecycleOptions,
+) error {
+	return setGCPLifecycle(ctx, ts.client, ts.bucketName, rules, opts)
+}
+
+func (ts *GCPTestCloudStorage) GetLifecycle(
+	ctx context.Context,
+) ([]LifecycleRule, error) {
+	return getGCPLifecycle(ctx, ts.client, ts.bucketName)
+}
+
+func (ts *GCPTestCloudStorage) SetVersioning(
+	ctx context.Context,
+	enabled bool,
+) error {
+	return setGCPVersioning(ctx, ts.client, ts.bucketName, enabled)
+}
+
+func (ts *GCPTestCloudStorage) GetVersioning(
+	ctx context.Context,
+) (bool, error) {
+	state, err := ts.GetVersioningState(ctx)
+
+	return state == VersioningEnabled, err
+}
+
+func (ts *GCPTestCloudStorage) GetVersioningState(
+	ctx context.Context,
+) (VersioningState, error) {
+	return getGCPVersioningState(ctx, ts.client, ts.bucketName)
+}
+
+func (ts *GCPTestCloudStorage) SetCORS(
+	ctx context.Context,
+	rules []CORSRule,
+) error {
+	return setGCPCORS(ctx, ts.client, ts.bucketName, rules)
+}
+
+func (ts *GCPTestCloudStorage) GetCORS(
+	ctx context.Context,
+) ([]CORSRule, error) {
+	return getGCPCORS(ctx, ts.client, ts.bucketName)
+}
+
+func (ts *GCPTestCloudStorage) SetPublicAccessBlock(
+	ctx context.Context,
+	blocked bool,
+) error {
+	return setGCPPublicAccessBlock(ctx, ts.client, ts.bucketName, blocked)
+}
+
+func (ts *GCPTestCloudStorage) GetPublicAccessBlock(
+	ctx context.Context,
+) (bool, error) {
+	block, err := ts.GetPublicAccessBlockDetails(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return block.Blocked(), nil
+}
+
+func (ts *GCPTestCloudStorage) GetPublicAccessBlockDetails(
+	ctx context.Context,
+) (*PublicAccessBlock, error) {
+	return getGCPPublicAccessBlock(ctx, ts.client, ts.bucketName)
+}
+
+func (ts *GCPTestCloudStorage) Close() error {
+	if !ts.markClosed() {
+		return nil
+	}
+
+	return ts.bucketCloseFunc()
 }
 
 func (ts *GCPTestCloudStorage) GetSignedURL(
@@ -238,7 +497,106 @@ func (ts *GCPTestCloudStorage) GetSignedURL(
 	key string,
 	opts *SignedURLOption,
 ) (string, error) {
-	return fmt.Sprintf("http://%s/%s/%s", ts.host, ts.bucketName, key), nil
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	options, err := newGCPSignedURLOptions(opts, ts.storageOptions)
+	if err != nil {
+		return "", err
+	}
+
+	options.GoogleAccessID = gcpTestGoogleAccessID
+	options.SignBytes = signGCPTestBytes
+
+	signedURL, err := storage.SignedURL(ts.bucketName, key, options)
+	if err != nil {
+		return "", err
+	}
+
+	if signedURLHost(opts, ts.storageOptions) != "" {
+		return signedURL, nil
+	}
+
+	// the download URLs of the missing objects are rejected, so that the tests can assert the missing keys
+	if opts.Method == "" || opts.Method == http.MethodGet {
+		exists, err := existsGCPObject(ctx, ts.client, ts.bucketName, key)
+		if err != nil {
+			return "", err
+		}
+
+		if !exists {
+			return "", newTypedError(ErrNotFound, fmt.Errorf("object '%s' doesn't exist", key))
+		}
+	}
+
+	// the emulator serves the objects on the same paths
+	emulatorURL, err := url.Parse(signedURL)
+	if err != nil {
+		return "", err
+	}
+
+	emulatorURL.Scheme = ts.scheme
+	emulatorURL.Host = ts.host
+
+	return emulatorURL.String(), nil
+}
+
+func (ts *GCPTestCloudStorage) GetSignedPostPolicy(
+	ctx context.Context,
+	keyPrefix string,
+	opts *PostPolicyOptions,
+) (*PostPolicy, error) {
+	// the emulator doesn't support the uploads with HTML forms
+	return nil, newTypedError(ErrNotSupported, fmt.Errorf("signed POST policies on the GCS emulator"))
+}
+
+func (ts *GCPTestCloudStorage) GetPublicURL(
+	key string,
+) (string, error) {
+	return gcpPublicURL(ts.scheme, ts.host, ts.bucketName, key)
+}
+
+// As sets i, a **storage.Client or a **storage.BucketHandle of cloud.google.com/go/storage, to the GCS client
+// of the storage, shared with the other buckets of the factory, or to the handle of its bucket. The other types
+// aren't supported.
+func (ts *GCPTestCloudStorage) As(i interface{}) bool {
+	return asGCPClients(i, ts.client, ts.bucketName)
+}
+
+func (ts *GCPTestCloudStorage) StartMultipartUpload(
+	ctx context.Context,
+	key string,
+	opts *WriteOptions,
+) (string, error) {
+	return "", errGCPMultipartUpload
+}
+
+func (ts *GCPTestCloudStorage) SignUploadPartURL(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	partNumber int,
+	expiry time.Duration,
+) (string, error) {
+	return "", errGCPMultipartUpload
+}
+
+func (ts *GCPTestCloudStorage) CompleteMultipartUpload(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	parts []CompletedPart,
+) error {
+	return errGCPMultipartUpload
+}
+
+func (ts *GCPTestCloudStorage) AbortMultipartUpload(
+	ctx context.Context,
+	key string,
+	uploadID string,
+) error {
+	return errGCPMultipartUpload
 }
 
 func (ts *GCPTestCloudStorage) Write(
@@ -247,50 +605,196 @@ func (ts *GCPTestCloudStorage) Write(
 	body []byte,
 	contentType *string,
 ) error {
-	options := &blob.WriterOptions{}
+	options := &WriteOptions{}
 	if contentType != nil {
 		options.ContentType = *contentType
 	}
 
-	return ts.bucket.WriteAll(ctx, key, body, options)
+	return ts.WriteWithOptions(ctx, key, body, options)
+}
+
+func (ts *GCPTestCloudStorage) WriteWithOptions(
+	ctx context.Context,
+	key string,
+	body []byte,
+	opts *WriteOptions,
+) error {
+	return writeGCPObject(ctx, ts.client, ts.bucket, ts.bucketName, key, body, opts, ts.verifiesChecksum(opts))
 }
 
 func (ts *GCPTestCloudStorage) Delete(
 	ctx context.Context,
 	key string,
 ) error {
-	return ts.client.Bucket(ts.bucketName).Object(key).Delete(ctx)
+	return objectError(ts.bucket.Delete(ctx, key))
+}
+
+func (ts *GCPTestCloudStorage) DeleteBatch(
+	ctx context.Context,
+	keys []string,
+) error {
+	return deleteObjects(ctx, ts.bucket, keys)
 }
 
 func (ts *GCPTestCloudStorage) Attributes(
 	ctx context.Context,
 	key string,
 ) (*Attributes, error) {
-	attrs, err := ts.client.Bucket(ts.bucketName).Object(key).Attrs(ctx)
+	return getGCPAttributes(ctx, ts.client, ts.bucketName, key)
+}
+
+// GetSize shares the HEAD request of Attributes.
+func (ts *GCPTestCloudStorage) GetSize(
+	ctx context.Context,
+	key string,
+) (int64, error) {
+	attrs, err := getGCPAttributes(ctx, ts.client, ts.bucketName, key)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	return &Attributes{
-		CacheControl:       attrs.CacheControl,
-		ContentDisposition: attrs.ContentDisposition,
-		ContentEncoding:    attrs.ContentEncoding,
-		ContentLanguage:    attrs.ContentLanguage,
-		ContentType:        attrs.ContentType,
-		Metadata:           attrs.Metadata,
-		ModTime:            attrs.Updated,
-		Size:               attrs.Size,
-		MD5:                attrs.MD5,
-	}, nil
+	return attrs.Size, nil
+}
+
+func (ts *GCPTestCloudStorage) VerifyDownload(
+	ctx context.Context,
+	key string,
+) error {
+	return verifyDownload(ctx, ts, key, func() (io.ReadCloser, error) {
+		return newGCPReader(ctx, ts.client, ts.bucket, ts.bucketName, key, false)
+	})
+}
+
+func (ts *GCPTestCloudStorage) SetTags(
+	ctx context.Context,
+	key string,
+	tags map[string]string,
+) error {
+	return newTypedError(ErrNotSupported, fmt.Errorf("GCS doesn't have object tags"))
+}
+
+func (ts *GCPTestCloudStorage) GetTags(
+	ctx context.Context,
+	key string,
+) (map[string]string, error) {
+	return nil, newTypedError(ErrNotSupported, fmt.Errorf("GCS doesn't have object tags"))
+}
+
+func (ts *GCPTestCloudStorage) SetStorageClass(
+	ctx context.Context,
+	key string,
+	class string,
+) error {
+	return setGCPStorageClass(ctx, ts.client, ts.bucketName, key, class)
 }
 
 func (ts *GCPTestCloudStorage) Exists(
 	ctx context.Context,
 	key string,
 ) (bool, error) {
-	return ts.bucket.Exists(ctx, key)
+	return existsGCPObject(ctx, ts.client, ts.bucketName, key)
+}
+
+func (ts *GCPTestCloudStorage) bucketLocation() string {
+	return "gcp/" + ts.bucketName
 }
 
 func (ts *GCPTestCloudStorage) Copy(ctx context.Context, dstKey, srcKey string) error {
-	return ts.bucket.Copy(ctx, dstKey, srcKey, nil)
+	return copyObject(ctx, ts.bucket, dstKey, srcKey)
+}
+
+func (ts *GCPTestCloudStorage) Move(ctx context.Context, dstKey, srcKey string) error {
+	// the source is kept when the copy failed
+	if err := ts.Copy(ctx, dstKey, srcKey); err != nil {
+		return err
+	}
+
+	if dstKey == srcKey {
+		return nil
+	}
+
+	return ts.Delete(ctx, srcKey)
+}
+
+func (ts *GCPTestCloudStorage) Ping(ctx context.Context) error {
+	// a zero-result list is allowed even for service accounts without bucket-level permissions
+	iter := ts.client.Bucket(ts.bucketName).Objects(ctx, nil)
+	iter.PageInfo().MaxSize = 1
+
+	if _, err := iter.Next(); err != nil && err != iterator.Done {
+		return gcpBucketError(err)
+	}
+
+	return nil
+}
+
+func (ts *GCPTestCloudStorage) ListVersions(
+	ctx context.Context,
+	prefix string,
+) *VersionIterator {
+	return listGCPVersions(ctx, ts.client, ts.bucketName, prefix)
+}
+
+func (ts *GCPTestCloudStorage) GetVersion(
+	ctx context.Context,
+	key string,
+	version string,
+) ([]byte, error) {
+	return getGCPVersion(ctx, ts.client, ts.bucketName, key, version)
+}
+
+func (ts *GCPTestCloudStorage) DeleteVersion(
+	ctx context.Context,
+	key string,
+	version string,
+) error {
+	return deleteGCPVersion(ctx, ts.client, ts.bucketName, key, version)
+}
+
+func (ts *GCPTestCloudStorage) SetObjectRetention(
+	ctx context.Context,
+	key string,
+	until time.Time,
+	mode string,
+) error {
+	return setGCPObjectRetention()
+}
+
+func (ts *GCPTestCloudStorage) GetObjectRetention(
+	ctx context.Context,
+	key string,
+) (*ObjectRetention, error) {
+	return getGCPObjectRetention(ctx, ts.client, ts.bucketName, key)
+}
+
+func (ts *GCPTestCloudStorage) Restore(
+	ctx context.Context,
+	key string,
+	days int,
+	tier string,
+) error {
+	return restoreGCPObject(ctx, ts.client, ts.bucketName, key)
+}
+
+func (ts *GCPTestCloudStorage) RestoreStatus(
+	ctx context.Context,
+	key string,
+) (RestoreState, error) {
+	return getGCPRestoreState(ctx, ts.client, ts.bucketName, key)
+}
+
+func (ts *GCPTestCloudStorage) Append(
+	ctx context.Context,
+	key string,
+	data []byte,
+) error {
+	return appendGCPObject(ctx, ts.client, ts.bucketName, key, data, ts.logger)
+}
+
+func (ts *GCPTestCloudStorage) UpdateAttributes(
+	ctx context.Context,
+	key string,
+	update AttributeUpdate,
+) (*Attributes, error) {
+	return updateGCPAttributes(ctx, ts.client, ts.bucketName, key, update)
 }
@@ -3,13 +3,13 @@ module github.com/AccelByte/common-blob-go
 go 1.13
 
 require (
-	cloud.google.com/go v0.110.2
 	cloud.google.com/go/compute/metadata v0.2.3
 	cloud.google.com/go/iam v0.13.0
 	cloud.google.com/go/storage v1.29.0
 	github.com/aws/aws-sdk-go v1.48.7
+	github.com/golang/mock v1.6.0
 	github.com/google/uuid v1.3.0
-	github.com/sirupsen/logrus v1.6.0
+	github.com/prometheus/client_golang v1.11.1
 	github.com/stretchr/testify v1.8.1
 	gocloud.dev v0.20.0
 	golang.org/x/oauth2 v0.15.0
@@ -0,0 +1,1233 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"time"
+)
+
+// instrumentedCloudStorage runs every operation of the wrapped CloudStorage through the interceptors, traces and
+// records the metrics of it, fills its OpStats and the request ID of its error, and reports it when it's slow. The
+// span is named after the operation, e.g. "blob.Get". The listings get a single span, every call of their Next goes
+// through the interceptors, and the calls fetching a page from the provider, or failing, are recorded one by one. The
+// readers and the writers are measured until they are closed. The
+// helpers fanning out over several objects are traced and recorded as a whole, and for each object.
+type instrumentedCloudStorage struct {
+	inner        CloudStorage
+	tracer       Tracer
+	metrics      MetricsRecorder
+	interceptors []Interceptor
+	slow         *slowOperationReporter
+	provider     string
+	bucketName   string
+	hashKeys     bool
+}
+
+var _ CloudStorage = (*instrumentedCloudStorage)(nil)
+
+// newInstrumentedCloudStorage instruments the storage with the tracer, the metrics recorder and the interceptors
+// of the options, which may be missing.
+func newInstrumentedCloudStorage(inner CloudStorage, options storageOptions, bucketName string) CloudStorage {
+	storage := &instrumentedCloudStorage{
+		inner:        inner,
+		tracer:       options.tracer,
+		provider:     options.provider,
+		bucketName:   bucketName,
+		hashKeys:     options.traceHashKeys,
+		interceptors: options.interceptors,
+	}
+
+	if storage.tracer == nil {
+		storage.tracer = noopTracer{}
+	}
+
+	if options.metrics != nil {
+		storage.metrics = metricsRecorderFor(options.metrics, options.provider, bucketName)
+	}
+
+	storage.slow = newSlowOperationReporter(options, storage.metrics, bucketName)
+
+	return storage
+}
+
+// options returns the settings of the wrapped storage.
+func (ts *instrumentedCloudStorage) options() storageOptions {
+	return storageOptionsOf(ts.inner)
+}
+
+// bucketLocation is the one of the wrapped storage, so that CopyObjectBetween still copies by the provider.
+func (ts *instrumentedCloudStorage) bucketLocation() string {
+	locator, ok := ts.inner.(bucketLocator)
+	if !ok {
+		return ""
+	}
+
+	return locator.bucketLocation()
+}
+
+// operation is an operation of the storage being measured.
+type operation struct {
+	info         OpInfo
+	span         Span
+	started      time.Time
+	metrics      MetricsRecorder
+	interceptors []Interceptor
+	// stats are the stats requested by WithStats, they may be nil
+	stats *OpStats
+	// recorder records the attempts and the responses of the operation
+	recorder *opStatsRecorder
+	slow     *slowOperationReporter
+}
+
+// call runs f through the interceptors.
+func (op *operation) call(ctx context.Context, f func(ctx context.Context) error) error {
+	return intercept(ctx, op.info, op.interceptors, f)
+}
+
+// close runs the Close of the reader or the writer opened by the operation through the interceptors.
+func (op *operation) close(ctx context.Context, bytes int64, f func() error) error {
+	info := op.info
+	info.Name += ".Close"
+	info.Bytes = bytes
+
+	return intercept(ctx, info, op.interceptors, func(context.Context) error {
+		return f()
+	})
+}
+
+// end ends the span with the number of bytes when it's not negative, records the operation, and reports it
+// when it's slow. It returns the error with the request ID of the last response of the provider.
+func (op *operation) end(bytes int64, err error) error {
+	duration := time.Since(op.started)
+
+	if op.stats != nil {
+		op.recorder.fill(op.stats, bytes, duration)
+	}
+
+	if op.metrics != nil {
+		recorded := bytes
+		if recorded < 0 {
+			recorded = 0
+		}
+
+		if err == io.EOF {
+			op.metrics.Record(op.info.Name, duration, recorded, nil)
+		} else {
+			op.metrics.Record(op.info.Name, duration, recorded, err)
+		}
+	}
+
+	op.slow.report(op.info, duration, bytes)
+	endSpan(op.span, bytes, err)
+
+	return op.recorder.withRequestID(err)
+}
+
+// start starts the span of the operation, with the key when it's not empty, and binds the recorder of
+// the responses, and the stats requested by WithStats, to the operation.
+func (ts *instrumentedCloudStorage) start(ctx context.Context, name, key string) (context.Context, *operation) {
+	ctx, span := ts.startSpan(ctx, "blob."+name, key)
+	op := ts.newOperation(span, name, key)
+	op.stats, op.recorder = opStatsFrom(ctx), &opStatsRecorder{}
+	// the stats are removed, so that the operations called by the operation, e.g. by the batch helpers,
+	// don't fill them
+	if op.stats != nil {
+		ctx = context.WithValue(ctx, opStatsKey{}, (*OpStats)(nil))
+	}
+
+	ctx = withOpStatsRecorder(ctx, op.recorder)
+
+	return ctx, op
+}
+
+func (ts *instrumentedCloudStorage) newOperation(span Span, name, key string) *operation {
+	return &operation{
+		info:         OpInfo{Name: name, Key: key, Bytes: -1},
+		span:         span,
+		started:      time.Now(),
+		metrics:      ts.metrics,
+		interceptors: ts.interceptors,
+		slow:         ts.slow,
+	}
+}
+
+func (ts *instrumentedCloudStorage) startSpan(ctx context.Context, name, key string) (context.Context, Span) {
+	ctx, span := ts.tracer.Start(ctx, name)
+	span.SetAttribute(TraceAttributeProvider, ts.provider)
+	span.SetAttribute(TraceAttributeBucket, ts.bucketName)
+
+	if key != "" {
+		if ts.hashKeys {
+			sum := sha256.Sum256([]byte(key))
+			key = hex.EncodeToString(sum[:])
+		}
+
+		span.SetAttribute(TraceAttributeKey, key)
+	}
+
+	return ctx, span
+}
+
+// instrumentedIterator measures the page fetches of a listing, and ends the span of the listing with its
+// first error, io.EOF included.
+type instrumentedIterator struct {
+	storage *instrumentedCloudStorage
+	name    string
+	prefix  string
+	ctx     context.Context
+	span    Span
+	count   int64
+	ended   bool
+	// recorder records the responses of the page fetches, for the request ID of the errors
+	recorder *opStatsRecorder
+}
+
+func (ts *instrumentedCloudStorage) instrumentIterator(ctx context.Context, name, prefix string) *instrumentedIterator {
+	ctx, span := ts.startSpan(ctx, "blob."+name, prefix)
+
+	return &instrumentedIterator{
+		storage:  ts,
+		name:     name,
+		prefix:   prefix,
+		ctx:      ctx,
+		span:     span,
+		recorder: &opStatsRecorder{},
+	}
+}
+
+// next calls f for the Next of the listing. The calls fetching a page can't be told from the others beforehand, so
+// every call goes through the interceptors, and the calls are recorded once they got a response of the provider.
+func (i *instrumentedIterator) next(ctx context.Context, f func(ctx context.Context) error) error {
+	ctx = withOpStatsRecorder(ctx, i.recorder)
+
+	if i.ended {
+		return i.recorder.withRequestID(f(ctx))
+	}
+
+	responses := i.recorder.responseCount()
+
+	call := i.storage.newOperation(noopSpan{}, i.name, i.prefix)
+	call.recorder = i.recorder
+
+	// the operations of the call are children of the listing span, while they're canceled with the context of Next
+	err := call.call(withSpanContext(ctx, i.ctx), f)
+
+	if i.recorder.responseCount() > responses || (err != nil && err != io.EOF) {
+		err = call.end(-1, err)
+	} else {
+		err = i.recorder.withRequestID(err)
+	}
+
+	i.end(err)
+
+	return err
+}
+
+func (i *instrumentedIterator) end(err error) {
+	if err == nil {
+		i.count++
+
+		return
+	}
+
+	if !i.ended {
+		i.ended = true
+		i.span.SetAttribute(TraceAttributeObjects, i.count)
+		endSpan(i.span, -1, err)
+	}
+}
+
+// spanContext carries the values of the page context, the spans included, with the deadline and the
+// cancellation of the context of Next.
+type spanContext struct {
+	context.Context
+	values context.Context
+}
+
+func withSpanContext(ctx, values context.Context) context.Context {
+	return spanContext{Context: ctx, values: values}
+}
+
+func (c spanContext) Value(key interface{}) interface{} {
+	if value := c.values.Value(key); value != nil {
+		return value
+	}
+
+	return c.Context.Value(key)
+}
+
+func (ts *instrumentedCloudStorage) List(
+	ctx context.Context,
+	prefix string,
+) *ListIterator {
+	return ts.instrumentList(ctx, prefix, ts.inner.List(ctx, prefix))
+}
+
+func (ts *instrumentedCloudStorage) ListWithOptions(
+	ctx context.Context,
+	options *ListOptions,
+) *ListIterator {
+	return ts.instrumentList(ctx, listOptionsPrefix(options), ts.inner.ListWithOptions(ctx, options))
+}
+
+func (ts *instrumentedCloudStorage) instrumentList(
+	ctx context.Context,
+	prefix string,
+	iter *ListIterator,
+) *ListIterator {
+	instrumented := ts.instrumentIterator(ctx, "List", prefix)
+
+	return newListIterator(func(ctx context.Context) (*ListObject, error) {
+		var object *ListObject
+
+		err := instrumented.next(ctx, func(ctx context.Context) error {
+			var err error
+			object, err = iter.Next(ctx)
+
+			return err
+		})
+
+		return object, err
+	})
+}
+
+func (ts *instrumentedCloudStorage) ListVersions(
+	ctx context.Context,
+	prefix string,
+) *VersionIterator {
+	instrumented := ts.instrumentIterator(ctx, "ListVersions", prefix)
+	iter := ts.inner.ListVersions(instrumented.ctx, prefix)
+
+	return newVersionIterator(func(ctx context.Context) (*ObjectVersion, error) {
+		var version *ObjectVersion
+
+		err := instrumented.next(ctx, func(ctx context.Context) error {
+			var err error
+			version, err = iter.Next(ctx)
+
+			return err
+		})
+
+		return version, err
+	})
+}
+
+func (ts *instrumentedCloudStorage) Close() error {
+	return ts.inner.Close()
+}
+
+func (ts *instrumentedCloudStorage) GetPublicURL(key string) (string, error) {
+	return ts.inner.GetPublicURL(key)
+}
+
+func (ts *instrumentedCloudStorage) As(i interface{}) bool {
+	return ts.inner.As(i)
+}
+
+// instrumentedReader ends the operation of the reader when it's closed, with the number of bytes read.
+// The Close runs through the interceptors, with the context of the opening.
+type instrumentedReader struct {
+	io.ReadCloser
+	ctx    context.Context
+	op     *operation
+	bytes  int64
+	err    error
+	closed bool
+}
+
+func (r *instrumentedReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.bytes += int64(n)
+
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+
+	return n, err
+}
+
+func (r *instrumentedReader) Close() error {
+	if r.closed {
+		return r.ReadCloser.Close()
+	}
+
+	r.closed = true
+
+	err := r.op.close(r.ctx, r.bytes, r.ReadCloser.Close)
+	if r.err == nil {
+		r.err = err
+	}
+
+	_ = r.op.end(r.bytes, r.err)
+
+	return r.op.recorder.withRequestID(err)
+}
+
+// instrumentedWriter ends the operation of the writer when it's closed, with the number of bytes written.
+// The Close runs through the interceptors, with the context of the opening.
+type instrumentedWriter struct {
+	io.WriteCloser
+	ctx    context.Context
+	op     *operation
+	bytes  int64
+	err    error
+	closed bool
+}
+
+func (w *instrumentedWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	w.bytes += int64(n)
+
+	if err != nil {
+		w.err = err
+	}
+
+	return n, err
+}
+
+func (w *instrumentedWriter) Close() error {
+	if w.closed {
+		return w.WriteCloser.Close()
+	}
+
+	w.closed = true
+
+	err := w.op.close(w.ctx, w.bytes, w.WriteCloser.Close)
+	if w.err == nil {
+		w.err = err
+	}
+
+	_ = w.op.end(w.bytes, w.err)
+
+	return w.op.recorder.withRequestID(err)
+}
+
+func instrumentReader(ctx context.Context, op *operation, reader io.ReadCloser, err error) (io.ReadCloser, error) {
+	if err != nil {
+		err = op.end(-1, err)
+
+		return nil, err
+	}
+
+	return &instrumentedReader{ReadCloser: reader, ctx: ctx, op: op}, nil
+}
+
+func instrumentWriter(ctx context.Context, op *operation, writer io.WriteCloser, err error) (io.WriteCloser, error) {
+	if err != nil {
+		err = op.end(-1, err)
+
+		return nil, err
+	}
+
+	return &instrumentedWriter{WriteCloser: writer, ctx: ctx, op: op}, nil
+}
+
+func (ts *instrumentedCloudStorage) GetReader(
+	ctx context.Context,
+	key string,
+) (io.ReadCloser, error) {
+	ctx, op := ts.start(ctx, "GetReader", key)
+	var reader io.ReadCloser
+	err := op.call(ctx, func(ctx context.Context) error {
+		var err error
+		reader, err = ts.inner.GetReader(ctx, key)
+
+		return err
+	})
+
+	return instrumentReader(ctx, op, reader, err)
+}
+
+func (ts *instrumentedCloudStorage) GetRangeReader(
+	ctx context.Context,
+	key string,
+	offset int64,
+	length int64,
+) (io.ReadCloser, error) {
+	ctx, op := ts.start(ctx, "GetRangeReader", key)
+	var reader io.ReadCloser
+	err := op.call(ctx, func(ctx context.Context) error {
+		var err error
+		reader, err = ts.inner.GetRangeReader(ctx, key, offset, length)
+
+		return err
+	})
+
+	return instrumentReader(ctx, op, reader, err)
+}
+
+func (ts *instrumentedCloudStorage) GetWriter(
+	ctx context.Context,
+	key string,
+) (io.WriteCloser, error) {
+	ctx, op := ts.start(ctx, "GetWriter", key)
+	var writer io.WriteCloser
+	err := op.call(ctx, func(ctx context.Context) error {
+		var err error
+		writer, err = ts.inner.GetWriter(ctx, key)
+
+		return err
+	})
+
+	return instrumentWriter(ctx, op, writer, err)
+}
+
+func (ts *instrumentedCloudStorage) GetWriterWithOptions(
+	ctx context.Context,
+	key string,
+	opts *WriteOptions,
+) (io.WriteCloser, error) {
+	ctx, op := ts.start(ctx, "GetWriterWithOptions", key)
+	var writer io.WriteCloser
+	err := op.call(ctx, func(ctx context.Context) error {
+		var err error
+		writer, err = ts.inner.GetWriterWithOptions(ctx, key, opts)
+
+		return err
+	})
+
+	return instrumentWriter(ctx, op, writer, err)
+}
+
+func (ts *instrumentedCloudStorage) Get(
+	ctx context.Context,
+	key string,
+) ([]byte, error) {
+	ctx, op := ts.start(ctx, "Get", key)
+
+	var body []byte
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		var err error
+		body, err = ts.inner.Get(ctx, key)
+
+		return err
+	})
+	err = op.end(int64(len(body)), err)
+
+	return body, err
+}
+
+func (ts *instrumentedCloudStorage) GetIfModified(
+	ctx context.Context,
+	key string,
+	etag string,
+	modSince time.Time,
+) ([]byte, *Attributes, bool, error) {
+	ctx, op := ts.start(ctx, "GetIfModified", key)
+
+	var (
+		body        []byte
+		attrs       *Attributes
+		notModified bool
+	)
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		var err error
+		body, attrs, notModified, err = ts.inner.GetIfModified(ctx, key, etag, modSince)
+
+		return err
+	})
+	err = op.end(int64(len(body)), err)
+
+	return body, attrs, notModified, err
+}
+
+func (ts *instrumentedCloudStorage) GetWithAttributes(
+	ctx context.Context,
+	key string,
+) ([]byte, *Attributes, error) {
+	ctx, op := ts.start(ctx, "GetWithAttributes", key)
+
+	var (
+		body  []byte
+		attrs *Attributes
+	)
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		var err error
+		body, attrs, err = ts.inner.GetWithAttributes(ctx, key)
+
+		return err
+	})
+	err = op.end(int64(len(body)), err)
+
+	return body, attrs, err
+}
+
+func (ts *instrumentedCloudStorage) Delete(
+	ctx context.Context,
+	key string,
+) error {
+	ctx, op := ts.start(ctx, "Delete", key)
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		return ts.inner.Delete(ctx, key)
+	})
+	err = op.end(-1, err)
+
+	return err
+}
+
+func (ts *instrumentedCloudStorage) DeleteBatch(
+	ctx context.Context,
+	keys []string,
+) error {
+	ctx, op := ts.start(ctx, "DeleteBatch", "")
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		return ts.inner.DeleteBatch(ctx, keys)
+	})
+	err = op.end(-1, err)
+
+	return err
+}
+
+func (ts *instrumentedCloudStorage) CreateBucket(
+	ctx context.Context,
+	bucketPrefix string,
+	expirationTimeDays int64,
+) error {
+	ctx, op := ts.start(ctx, "CreateBucket", "")
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		return ts.inner.CreateBucket(ctx, bucketPrefix, expirationTimeDays)
+	})
+	err = op.end(-1, err)
+
+	return err
+}
+
+func (ts *instrumentedCloudStorage) CreateBucketWithOptions(
+	ctx context.Context,
+	opts *CreateBucketOptions,
+) error {
+	ctx, op := ts.start(ctx, "CreateBucketWithOptions", "")
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		return ts.inner.CreateBucketWithOptions(ctx, opts)
+	})
+	err = op.end(-1, err)
+
+	return err
+}
+
+func (ts *instrumentedCloudStorage) GetSignedURL(
+	ctx context.Context,
+	key string,
+	opts *SignedURLOption,
+) (string, error) {
+	ctx, op := ts.start(ctx, "GetSignedURL", key)
+
+	var signedURL string
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		var err error
+		signedURL, err = ts.inner.GetSignedURL(ctx, key, opts)
+
+		return err
+	})
+	err = op.end(-1, err)
+
+	return signedURL, err
+}
+
+func (ts *instrumentedCloudStorage) GetSignedPostPolicy(
+	ctx context.Context,
+	keyPrefix string,
+	opts *PostPolicyOptions,
+) (*PostPolicy, error) {
+	ctx, op := ts.start(ctx, "GetSignedPostPolicy", keyPrefix)
+
+	var policy *PostPolicy
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		var err error
+		policy, err = ts.inner.GetSignedPostPolicy(ctx, keyPrefix, opts)
+
+		return err
+	})
+	err = op.end(-1, err)
+
+	return policy, err
+}
+
+func (ts *instrumentedCloudStorage) Write(
+	ctx context.Context,
+	key string,
+	body []byte,
+	contentType *string,
+) error {
+	ctx, op := ts.start(ctx, "Write", key)
+	op.info.Bytes = int64(len(body))
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		return ts.inner.Write(ctx, key, body, contentType)
+	})
+	err = op.end(int64(len(body)), err)
+
+	return err
+}
+
+func (ts *instrumentedCloudStorage) WriteWithOptions(
+	ctx context.Context,
+	key string,
+	body []byte,
+	opts *WriteOptions,
+) error {
+	ctx, op := ts.start(ctx, "WriteWithOptions", key)
+	op.info.Bytes = int64(len(body))
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		return ts.inner.WriteWithOptions(ctx, key, body, opts)
+	})
+	err = op.end(int64(len(body)), err)
+
+	return err
+}
+
+func (ts *instrumentedCloudStorage) Attributes(
+	ctx context.Context,
+	key string,
+) (*Attributes, error) {
+	ctx, op := ts.start(ctx, "Attributes", key)
+
+	var attrs *Attributes
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		var err error
+		attrs, err = ts.inner.Attributes(ctx, key)
+
+		return err
+	})
+	err = op.end(-1, err)
+
+	return attrs, err
+}
+
+func (ts *instrumentedCloudStorage) UpdateAttributes(
+	ctx context.Context,
+	key string,
+	update AttributeUpdate,
+) (*Attributes, error) {
+	ctx, op := ts.start(ctx, "UpdateAttributes", key)
+
+	var attrs *Attributes
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		var err error
+		attrs, err = ts.inner.UpdateAttributes(ctx, key, update)
+
+		return err
+	})
+	err = op.end(-1, err)
+
+	return attrs, err
+}
+
+func (ts *instrumentedCloudStorage) SetTags(
+	ctx context.Context,
+	key string,
+	tags map[string]string,
+) error {
+	ctx, op := ts.start(ctx, "SetTags", key)
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		return ts.inner.SetTags(ctx, key, tags)
+	})
+	err = op.end(-1, err)
+
+	return err
+}
+
+func (ts *instrumentedCloudStorage) GetTags(
+	ctx context.Context,
+	key string,
+) (map[string]string, error) {
+	ctx, op := ts.start(ctx, "GetTags", key)
+
+	var tags map[string]string
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		var err error
+		tags, err = ts.inner.GetTags(ctx, key)
+
+		return err
+	})
+	err = op.end(-1, err)
+
+	return tags, err
+}
+
+func (ts *instrumentedCloudStorage) SetStorageClass(
+	ctx context.Context,
+	key string,
+	class string,
+) error {
+	ctx, op := ts.start(ctx, "SetStorageClass", key)
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		return ts.inner.SetStorageClass(ctx, key, class)
+	})
+	err = op.end(-1, err)
+
+	return err
+}
+
+func (ts *instrumentedCloudStorage) Exists(
+	ctx context.Context,
+	key string,
+) (bool, error) {
+	ctx, op := ts.start(ctx, "Exists", key)
+
+	var exists bool
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		var err error
+		exists, err = ts.inner.Exists(ctx, key)
+
+		return err
+	})
+	err = op.end(-1, err)
+
+	return exists, err
+}
+
+func (ts *instrumentedCloudStorage) Copy(
+	ctx context.Context,
+	dstKey string,
+	srcKey string,
+) error {
+	ctx, op := ts.start(ctx, "Copy", dstKey)
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		return ts.inner.Copy(ctx, dstKey, srcKey)
+	})
+	err = op.end(-1, err)
+
+	return err
+}
+
+func (ts *instrumentedCloudStorage) Move(
+	ctx context.Context,
+	dstKey string,
+	srcKey string,
+) error {
+	ctx, op := ts.start(ctx, "Move", dstKey)
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		return ts.inner.Move(ctx, dstKey, srcKey)
+	})
+	err = op.end(-1, err)
+
+	return err
+}
+
+func (ts *instrumentedCloudStorage) Ping(ctx context.Context) error {
+	ctx, op := ts.start(ctx, "Ping", "")
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		return ts.inner.Ping(ctx)
+	})
+	err = op.end(-1, err)
+
+	return err
+}
+
+func (ts *instrumentedCloudStorage) GetVersion(
+	ctx context.Context,
+	key string,
+	version string,
+) ([]byte, error) {
+	ctx, op := ts.start(ctx, "GetVersion", key)
+
+	var body []byte
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		var err error
+		body, err = ts.inner.GetVersion(ctx, key, version)
+
+		return err
+	})
+	err = op.end(int64(len(body)), err)
+
+	return body, err
+}
+
+func (ts *instrumentedCloudStorage) DeleteVersion(
+	ctx context.Context,
+	key string,
+	version string,
+) error {
+	ctx, op := ts.start(ctx, "DeleteVersion", key)
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		return ts.inner.DeleteVersion(ctx, key, version)
+	})
+	err = op.end(-1, err)
+
+	return err
+}
+
+func (ts *instrumentedCloudStorage) SetObjectRetention(
+	ctx context.Context,
+	key string,
+	until time.Time,
+	mode string,
+) error {
+	ctx, op := ts.start(ctx, "SetObjectRetention", key)
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		return ts.inner.SetObjectRetention(ctx, key, until, mode)
+	})
+	err = op.end(-1, err)
+
+	return err
+}
+
+func (ts *instrumentedCloudStorage) GetObjectRetention(
+	ctx context.Context,
+	key string,
+) (*ObjectRetention, error) {
+	ctx, op := ts.start(ctx, "GetObjectRetention", key)
+
+	var retention *ObjectRetention
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		var err error
+		retention, err = ts.inner.GetObjectRetention(ctx, key)
+
+		return err
+	})
+	err = op.end(-1, err)
+
+	return retention, err
+}
+
+func (ts *instrumentedCloudStorage) Restore(
+	ctx context.Context,
+	key string,
+	days int,
+	tier string,
+) error {
+	ctx, op := ts.start(ctx, "Restore", key)
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		return ts.inner.Restore(ctx, key, days, tier)
+	})
+	err = op.end(-1, err)
+
+	return err
+}
+
+func (ts *instrumentedCloudStorage) RestoreStatus(
+	ctx context.Context,
+	key string,
+) (RestoreState, error) {
+	ctx, op := ts.start(ctx, "RestoreStatus", key)
+
+	var state RestoreState
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		var err error
+		state, err = ts.inner.RestoreStatus(ctx, key)
+
+		return err
+	})
+	err = op.end(-1, err)
+
+	return state, err
+}
+
+func (ts *instrumentedCloudStorage) Append(
+	ctx context.Context,
+	key string,
+	data []byte,
+) error {
+	ctx, op := ts.start(ctx, "Append", key)
+	op.info.Bytes = int64(len(data))
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		return ts.inner.Append(ctx, key, data)
+	})
+	err = op.end(int64(len(data)), err)
+
+	return err
+}
+
+func (ts *instrumentedCloudStorage) GetSize(
+	ctx context.Context,
+	key string,
+) (int64, error) {
+	ctx, op := ts.start(ctx, "GetSize", key)
+
+	var size int64
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		var err error
+		size, err = ts.inner.GetSize(ctx, key)
+
+		return err
+	})
+	err = op.end(-1, err)
+
+	return size, err
+}
+
+func (ts *instrumentedCloudStorage) VerifyDownload(
+	ctx context.Context,
+	key string,
+) error {
+	ctx, op := ts.start(ctx, "VerifyDownload", key)
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		return ts.inner.VerifyDownload(ctx, key)
+	})
+	err = op.end(-1, err)
+
+	return err
+}
+
+func (ts *instrumentedCloudStorage) StartMultipartUpload(
+	ctx context.Context,
+	key string,
+	opts *WriteOptions,
+) (string, error) {
+	ctx, op := ts.start(ctx, "StartMultipartUpload", key)
+
+	var uploadID string
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		var err error
+		uploadID, err = ts.inner.StartMultipartUpload(ctx, key, opts)
+
+		return err
+	})
+	err = op.end(-1, err)
+
+	return uploadID, err
+}
+
+func (ts *instrumentedCloudStorage) SignUploadPartURL(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	partNumber int,
+	expiry time.Duration,
+) (string, error) {
+	ctx, op := ts.start(ctx, "SignUploadPartURL", key)
+
+	var partURL string
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		var err error
+		partURL, err = ts.inner.SignUploadPartURL(ctx, key, uploadID, partNumber, expiry)
+
+		return err
+	})
+	err = op.end(-1, err)
+
+	return partURL, err
+}
+
+func (ts *instrumentedCloudStorage) CompleteMultipartUpload(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	parts []CompletedPart,
+) error {
+	ctx, op := ts.start(ctx, "CompleteMultipartUpload", key)
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		return ts.inner.CompleteMultipartUpload(ctx, key, uploadID, parts)
+	})
+	err = op.end(-1, err)
+
+	return err
+}
+
+func (ts *instrumentedCloudStorage) AbortMultipartUpload(
+	ctx context.Context,
+	key string,
+	uploadID string,
+) error {
+	ctx, op := ts.start(ctx, "AbortMultipartUpload", key)
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		return ts.inner.AbortMultipartUpload(ctx, key, uploadID)
+	})
+	err = op.end(-1, err)
+
+	return err
+}
+
+func (ts *instrumentedCloudStorage) SetLifecycle(
+	ctx context.Context,
+	rules []LifecycleRule,
+	opts *LifecycleOptions,
+) error {
+	ctx, op := ts.start(ctx, "SetLifecycle", "")
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		return ts.inner.SetLifecycle(ctx, rules, opts)
+	})
+	err = op.end(-1, err)
+
+	return err
+}
+
+func (ts *instrumentedCloudStorage) GetLifecycle(ctx context.Context) ([]LifecycleRule, error) {
+	ctx, op := ts.start(ctx, "GetLifecycle", "")
+
+	var rules []LifecycleRule
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		var err error
+		rules, err = ts.inner.GetLifecycle(ctx)
+
+		return err
+	})
+	err = op.end(-1, err)
+
+	return rules, err
+}
+
+func (ts *instrumentedCloudStorage) SetVersioning(
+	ctx context.Context,
+	enabled bool,
+) error {
+	ctx, op := ts.start(ctx, "SetVersioning", "")
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		return ts.inner.SetVersioning(ctx, enabled)
+	})
+	err = op.end(-1, err)
+
+	return err
+}
+
+func (ts *instrumentedCloudStorage) GetVersioning(ctx context.Context) (bool, error) {
+	ctx, op := ts.start(ctx, "GetVersioning", "")
+
+	var enabled bool
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		var err error
+		enabled, err = ts.inner.GetVersioning(ctx)
+
+		return err
+	})
+	err = op.end(-1, err)
+
+	return enabled, err
+}
+
+func (ts *instrumentedCloudStorage) GetVersioningState(ctx context.Context) (VersioningState, error) {
+	ctx, op := ts.start(ctx, "GetVersioningState", "")
+
+	var state VersioningState
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		var err error
+		state, err = ts.inner.GetVersioningState(ctx)
+
+		return err
+	})
+	err = op.end(-1, err)
+
+	return state, err
+}
+
+func (ts *instrumentedCloudStorage) SetCORS(
+	ctx context.Context,
+	rules []CORSRule,
+) error {
+	ctx, op := ts.start(ctx, "SetCORS", "")
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		return ts.inner.SetCORS(ctx, rules)
+	})
+	err = op.end(-1, err)
+
+	return err
+}
+
+func (ts *instrumentedCloudStorage) GetCORS(ctx context.Context) ([]CORSRule, error) {
+	ctx, op := ts.start(ctx, "GetCORS", "")
+
+	var rules []CORSRule
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		var err error
+		rules, err = ts.inner.GetCORS(ctx)
+
+		return err
+	})
+	err = op.end(-1, err)
+
+	return rules, err
+}
+
+func (ts *instrumentedCloudStorage) SetPublicAccessBlock(
+	ctx context.Context,
+	blocked bool,
+) error {
+	ctx, op := ts.start(ctx, "SetPublicAccessBlock", "")
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		return ts.inner.SetPublicAccessBlock(ctx, blocked)
+	})
+	err = op.end(-1, err)
+
+	return err
+}
+
+func (ts *instrumentedCloudStorage) GetPublicAccessBlock(ctx context.Context) (bool, error) {
+	ctx, op := ts.start(ctx, "GetPublicAccessBlock", "")
+
+	var blocked bool
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		var err error
+		blocked, err = ts.inner.GetPublicAccessBlock(ctx)
+
+		return err
+	})
+	err = op.end(-1, err)
+
+	return blocked, err
+}
+
+func (ts *instrumentedCloudStorage) GetPublicAccessBlockDetails(ctx context.Context) (*PublicAccessBlock, error) {
+	ctx, op := ts.start(ctx, "GetPublicAccessBlockDetails", "")
+
+	var details *PublicAccessBlock
+
+	err := op.call(ctx, func(ctx context.Context) error {
+		var err error
+		details, err = ts.inner.GetPublicAccessBlockDetails(ctx)
+
+		return err
+	})
+	err = op.end(-1, err)
+
+	return details, err
+}
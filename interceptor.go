@@ -0,0 +1,50 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"context"
+)
+
+// OpInfo describes the operation passed to the interceptors.
+type OpInfo struct {
+	// Name is the name of the CloudStorage method, e.g. "Get". The page fetches of the listings are named after
+	// the listing, and the Close of the readers and writers after the method opening them followed by ".Close",
+	// e.g. "GetReader.Close".
+	Name string
+	// Key is the key or the key prefix of the operation, empty for the bucket operations.
+	Key string
+	// Bytes is the number of bytes written by Write, WriteWithOptions and Append, or read or written by
+	// the closed readers and writers, -1 when it's not known before the operation.
+	Bytes int64
+}
+
+// Interceptor is called around the operations of the storages, e.g. to tag them with a tenant ID, audit them
+// or inject failures. It must call next, with ctx or a context derived from it, to run the operation unless it
+// fails it, and return the error of next or its own.
+type Interceptor func(ctx context.Context, op OpInfo, next func(ctx context.Context) error) error
+
+// intercept runs f through the interceptors, the first one being the outermost.
+func intercept(ctx context.Context, op OpInfo, interceptors []Interceptor, f func(ctx context.Context) error) error {
+	if len(interceptors) == 0 {
+		return f(ctx)
+	}
+
+	return interceptors[0](ctx, op, func(ctx context.Context) error {
+		return intercept(ctx, op, interceptors[1:], f)
+	})
+}
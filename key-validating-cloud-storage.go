@@ -0,0 +1,544 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// maxKeyLength is the longest key in bytes, the limit of both S3 and GCS.
+const maxKeyLength = 1024
+
+// validateKey checks the key against the rules shared by the providers, and returns it normalized.
+// The leading slashes are removed, or rejected along with the empty segments when strict is set.
+func validateKey(key string, strict bool) (string, error) {
+	if strict {
+		if strings.HasPrefix(key, "/") {
+			return "", newTypedError(ErrInvalidArgument, fmt.Errorf("key '%s' starts with a slash", key))
+		}
+
+		if strings.Contains(key, "//") {
+			return "", newTypedError(ErrInvalidArgument, fmt.Errorf("key '%s' contains an empty segment", key))
+		}
+	} else {
+		key = strings.TrimLeft(key, "/")
+	}
+
+	if key == "" {
+		return "", newTypedError(ErrInvalidArgument, fmt.Errorf("key is empty"))
+	}
+
+	if len(key) > maxKeyLength {
+		return "", newTypedError(ErrInvalidArgument,
+			fmt.Errorf("key '%.32s...' is longer than %d bytes", key, maxKeyLength))
+	}
+
+	if strings.ContainsAny(key, "\r\n") {
+		return "", newTypedError(ErrInvalidArgument, fmt.Errorf("key %q contains a line break", key))
+	}
+
+	return key, nil
+}
+
+// keyValidatingCloudStorage validates the keys before they reach the wrapped CloudStorage, so that the
+// five storages reject the same keys with the same errors. The listing prefixes aren't keys and are passed
+// through unchanged, like the other operations.
+type keyValidatingCloudStorage struct {
+	CloudStorage
+}
+
+var _ CloudStorage = (*keyValidatingCloudStorage)(nil)
+
+func newKeyValidatingCloudStorage(inner CloudStorage) CloudStorage {
+	return &keyValidatingCloudStorage{
+		CloudStorage: inner,
+	}
+}
+
+// options returns the settings of the wrapped storage.
+func (ts *keyValidatingCloudStorage) options() storageOptions {
+	return storageOptionsOf(ts.CloudStorage)
+}
+
+// bucketLocation is the one of the wrapped storage, so that CopyObjectBetween still copies by the provider.
+func (ts *keyValidatingCloudStorage) bucketLocation() string {
+	locator, ok := ts.CloudStorage.(bucketLocator)
+	if !ok {
+		return ""
+	}
+
+	return locator.bucketLocation()
+}
+
+func (ts *keyValidatingCloudStorage) validateKey(key string) (string, error) {
+	return validateKey(key, ts.options().strictKeyValidation)
+}
+
+// DeleteBatch deletes nothing when one of the keys is invalid.
+func (ts *keyValidatingCloudStorage) DeleteBatch(
+	ctx context.Context,
+	keys []string,
+) error {
+	validKeys := make([]string, len(keys))
+
+	for i, key := range keys {
+		validKey, err := ts.validateKey(key)
+		if err != nil {
+			return err
+		}
+
+		validKeys[i] = validKey
+	}
+
+	return ts.CloudStorage.DeleteBatch(ctx, validKeys)
+}
+
+func (ts *keyValidatingCloudStorage) Get(
+	ctx context.Context,
+	key string,
+) ([]byte, error) {
+	key, err := ts.validateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return ts.CloudStorage.Get(ctx, key)
+}
+
+func (ts *keyValidatingCloudStorage) GetIfModified(
+	ctx context.Context,
+	key string,
+	etag string,
+	modSince time.Time,
+) ([]byte, *Attributes, bool, error) {
+	key, err := ts.validateKey(key)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	return ts.CloudStorage.GetIfModified(ctx, key, etag, modSince)
+}
+
+func (ts *keyValidatingCloudStorage) GetWithAttributes(
+	ctx context.Context,
+	key string,
+) ([]byte, *Attributes, error) {
+	key, err := ts.validateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ts.CloudStorage.GetWithAttributes(ctx, key)
+}
+
+func (ts *keyValidatingCloudStorage) Delete(
+	ctx context.Context,
+	key string,
+) error {
+	key, err := ts.validateKey(key)
+	if err != nil {
+		return err
+	}
+
+	return ts.CloudStorage.Delete(ctx, key)
+}
+
+func (ts *keyValidatingCloudStorage) GetSignedURL(
+	ctx context.Context,
+	key string,
+	opts *SignedURLOption,
+) (string, error) {
+	key, err := ts.validateKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	return ts.CloudStorage.GetSignedURL(ctx, key, opts)
+}
+
+func (ts *keyValidatingCloudStorage) GetPublicURL(key string) (string, error) {
+	key, err := ts.validateKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	return ts.CloudStorage.GetPublicURL(key)
+}
+
+func (ts *keyValidatingCloudStorage) Write(
+	ctx context.Context,
+	key string,
+	body []byte,
+	contentType *string,
+) error {
+	key, err := ts.validateKey(key)
+	if err != nil {
+		return err
+	}
+
+	return ts.CloudStorage.Write(ctx, key, body, contentType)
+}
+
+func (ts *keyValidatingCloudStorage) WriteWithOptions(
+	ctx context.Context,
+	key string,
+	body []byte,
+	opts *WriteOptions,
+) error {
+	key, err := ts.validateKey(key)
+	if err != nil {
+		return err
+	}
+
+	return ts.CloudStorage.WriteWithOptions(ctx, key, body, opts)
+}
+
+func (ts *keyValidatingCloudStorage) Attributes(
+	ctx context.Context,
+	key string,
+) (*Attributes, error) {
+	key, err := ts.validateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return ts.CloudStorage.Attributes(ctx, key)
+}
+
+func (ts *keyValidatingCloudStorage) UpdateAttributes(
+	ctx context.Context,
+	key string,
+	update AttributeUpdate,
+) (*Attributes, error) {
+	key, err := ts.validateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return ts.CloudStorage.UpdateAttributes(ctx, key, update)
+}
+
+func (ts *keyValidatingCloudStorage) SetTags(
+	ctx context.Context,
+	key string,
+	tags map[string]string,
+) error {
+	key, err := ts.validateKey(key)
+	if err != nil {
+		return err
+	}
+
+	return ts.CloudStorage.SetTags(ctx, key, tags)
+}
+
+func (ts *keyValidatingCloudStorage) GetTags(
+	ctx context.Context,
+	key string,
+) (map[string]string, error) {
+	key, err := ts.validateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return ts.CloudStorage.GetTags(ctx, key)
+}
+
+func (ts *keyValidatingCloudStorage) SetStorageClass(
+	ctx context.Context,
+	key string,
+	class string,
+) error {
+	key, err := ts.validateKey(key)
+	if err != nil {
+		return err
+	}
+
+	return ts.CloudStorage.SetStorageClass(ctx, key, class)
+}
+
+func (ts *keyValidatingCloudStorage) GetReader(
+	ctx context.Context,
+	key string,
+) (io.ReadCloser, error) {
+	key, err := ts.validateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return ts.CloudStorage.GetReader(ctx, key)
+}
+
+func (ts *keyValidatingCloudStorage) GetRangeReader(
+	ctx context.Context,
+	key string,
+	offset int64,
+	length int64,
+) (io.ReadCloser, error) {
+	key, err := ts.validateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return ts.CloudStorage.GetRangeReader(ctx, key, offset, length)
+}
+
+func (ts *keyValidatingCloudStorage) GetWriter(
+	ctx context.Context,
+	key string,
+) (io.WriteCloser, error) {
+	key, err := ts.validateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return ts.CloudStorage.GetWriter(ctx, key)
+}
+
+func (ts *keyValidatingCloudStorage) GetWriterWithOptions(
+	ctx context.Context,
+	key string,
+	opts *WriteOptions,
+) (io.WriteCloser, error) {
+	key, err := ts.validateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return ts.CloudStorage.GetWriterWithOptions(ctx, key, opts)
+}
+
+func (ts *keyValidatingCloudStorage) Exists(
+	ctx context.Context,
+	key string,
+) (bool, error) {
+	key, err := ts.validateKey(key)
+	if err != nil {
+		return false, err
+	}
+
+	return ts.CloudStorage.Exists(ctx, key)
+}
+
+func (ts *keyValidatingCloudStorage) Copy(
+	ctx context.Context,
+	dstKey string,
+	srcKey string,
+) error {
+	dstKey, err := ts.validateKey(dstKey)
+	if err != nil {
+		return err
+	}
+
+	srcKey, err = ts.validateKey(srcKey)
+	if err != nil {
+		return err
+	}
+
+	return ts.CloudStorage.Copy(ctx, dstKey, srcKey)
+}
+
+func (ts *keyValidatingCloudStorage) Move(
+	ctx context.Context,
+	dstKey string,
+	srcKey string,
+) error {
+	dstKey, err := ts.validateKey(dstKey)
+	if err != nil {
+		return err
+	}
+
+	srcKey, err = ts.validateKey(srcKey)
+	if err != nil {
+		return err
+	}
+
+	return ts.CloudStorage.Move(ctx, dstKey, srcKey)
+}
+
+func (ts *keyValidatingCloudStorage) GetVersion(
+	ctx context.Context,
+	key string,
+	version string,
+) ([]byte, error) {
+	key, err := ts.validateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return ts.CloudStorage.GetVersion(ctx, key, version)
+}
+
+func (ts *keyValidatingCloudStorage) DeleteVersion(
+	ctx context.Context,
+	key string,
+	version string,
+) error {
+	key, err := ts.validateKey(key)
+	if err != nil {
+		return err
+	}
+
+	return ts.CloudStorage.DeleteVersion(ctx, key, version)
+}
+
+func (ts *keyValidatingCloudStorage) SetObjectRetention(
+	ctx context.Context,
+	key string,
+	until time.Time,
+	mode string,
+) error {
+	key, err := ts.validateKey(key)
+	if err != nil {
+		return err
+	}
+
+	return ts.CloudStorage.SetObjectRetention(ctx, key, until, mode)
+}
+
+func (ts *keyValidatingCloudStorage) GetObjectRetention(
+	ctx context.Context,
+	key string,
+) (*ObjectRetention, error) {
+	key, err := ts.validateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return ts.CloudStorage.GetObjectRetention(ctx, key)
+}
+
+func (ts *keyValidatingCloudStorage) Restore(
+	ctx context.Context,
+	key string,
+	days int,
+	tier string,
+) error {
+	key, err := ts.validateKey(key)
+	if err != nil {
+		return err
+	}
+
+	return ts.CloudStorage.Restore(ctx, key, days, tier)
+}
+
+func (ts *keyValidatingCloudStorage) RestoreStatus(
+	ctx context.Context,
+	key string,
+) (RestoreState, error) {
+	key, err := ts.validateKey(key)
+	if err != nil {
+		return RestoreState{}, err
+	}
+
+	return ts.CloudStorage.RestoreStatus(ctx, key)
+}
+
+func (ts *keyValidatingCloudStorage) Append(
+	ctx context.Context,
+	key string,
+	data []byte,
+) error {
+	key, err := ts.validateKey(key)
+	if err != nil {
+		return err
+	}
+
+	return ts.CloudStorage.Append(ctx, key, data)
+}
+
+func (ts *keyValidatingCloudStorage) GetSize(
+	ctx context.Context,
+	key string,
+) (int64, error) {
+	key, err := ts.validateKey(key)
+	if err != nil {
+		return 0, err
+	}
+
+	return ts.CloudStorage.GetSize(ctx, key)
+}
+
+func (ts *keyValidatingCloudStorage) VerifyDownload(
+	ctx context.Context,
+	key string,
+) error {
+	key, err := ts.validateKey(key)
+	if err != nil {
+		return err
+	}
+
+	return ts.CloudStorage.VerifyDownload(ctx, key)
+}
+
+func (ts *keyValidatingCloudStorage) StartMultipartUpload(
+	ctx context.Context,
+	key string,
+	opts *WriteOptions,
+) (string, error) {
+	key, err := ts.validateKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	return ts.CloudStorage.StartMultipartUpload(ctx, key, opts)
+}
+
+func (ts *keyValidatingCloudStorage) SignUploadPartURL(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	partNumber int,
+	expiry time.Duration,
+) (string, error) {
+	key, err := ts.validateKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	return ts.CloudStorage.SignUploadPartURL(ctx, key, uploadID, partNumber, expiry)
+}
+
+func (ts *keyValidatingCloudStorage) CompleteMultipartUpload(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	parts []CompletedPart,
+) error {
+	key, err := ts.validateKey(key)
+	if err != nil {
+		return err
+	}
+
+	return ts.CloudStorage.CompleteMultipartUpload(ctx, key, uploadID, parts)
+}
+
+func (ts *keyValidatingCloudStorage) AbortMultipartUpload(
+	ctx context.Context,
+	key string,
+	uploadID string,
+) error {
+	key, err := ts.validateKey(key)
+	if err != nil {
+		return err
+	}
+
+	return ts.CloudStorage.AbortMultipartUpload(ctx, key, uploadID)
+}
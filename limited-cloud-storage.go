@@ -0,0 +1,731 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// limitedCloudStorage bounds the number of the provider requests of the wrapped CloudStorage which are in
+// flight at once. Every request takes a slot for its duration, the page fetches of the listings included,
+// and the helpers fanning out over several objects take one slot per object. The readers and the writers
+// only take a slot while they are opened.
+type limitedCloudStorage struct {
+	inner     CloudStorage
+	semaphore chan struct{}
+	inFlight  int32
+	gauge     func(inFlight int)
+}
+
+var _ CloudStorage = (*limitedCloudStorage)(nil)
+
+// newLimitedCloudStorage limits the storage to maxRequests requests in flight, zero meaning no limit,
+// and reports the number of the requests in flight to gauge when it isn't nil.
+func newLimitedCloudStorage(inner CloudStorage, maxRequests int, gauge func(inFlight int)) CloudStorage {
+	storage := &limitedCloudStorage{
+		inner: inner,
+		gauge: gauge,
+	}
+
+	if maxRequests > 0 {
+		storage.semaphore = make(chan struct{}, maxRequests)
+	}
+
+	return storage
+}
+
+// acquire waits for a free slot, the context error is returned when it's done first.
+func (ts *limitedCloudStorage) acquire(ctx context.Context) error {
+	if ts.semaphore != nil {
+		select {
+		case ts.semaphore <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	inFlight := atomic.AddInt32(&ts.inFlight, 1)
+	if ts.gauge != nil {
+		ts.gauge(int(inFlight))
+	}
+
+	return nil
+}
+
+func (ts *limitedCloudStorage) release() {
+	inFlight := atomic.AddInt32(&ts.inFlight, -1)
+	if ts.gauge != nil {
+		ts.gauge(int(inFlight))
+	}
+
+	if ts.semaphore != nil {
+		<-ts.semaphore
+	}
+}
+
+// options returns the settings of the wrapped storage.
+func (ts *limitedCloudStorage) options() storageOptions {
+	return storageOptionsOf(ts.inner)
+}
+
+// bucketLocation is the one of the wrapped storage, so that CopyObjectBetween still copies by the provider.
+func (ts *limitedCloudStorage) bucketLocation() string {
+	locator, ok := ts.inner.(bucketLocator)
+	if !ok {
+		return ""
+	}
+
+	return locator.bucketLocation()
+}
+
+func (ts *limitedCloudStorage) List(
+	ctx context.Context,
+	prefix string,
+) *ListIterator {
+	iter := ts.inner.List(ctx, prefix)
+
+	return wrapListIterator(iter, func(ctx context.Context) (*ListObject, error) {
+		if err := ts.acquire(ctx); err != nil {
+			return nil, err
+		}
+		defer ts.release()
+
+		return iter.Next(ctx)
+	})
+}
+
+func (ts *limitedCloudStorage) ListWithOptions(
+	ctx context.Context,
+	options *ListOptions,
+) *ListIterator {
+	iter := ts.inner.ListWithOptions(ctx, options)
+
+	return wrapListIterator(iter, func(ctx context.Context) (*ListObject, error) {
+		if err := ts.acquire(ctx); err != nil {
+			return nil, err
+		}
+		defer ts.release()
+
+		return iter.Next(ctx)
+	})
+}
+
+func (ts *limitedCloudStorage) ListVersions(
+	ctx context.Context,
+	prefix string,
+) *VersionIterator {
+	iter := ts.inner.ListVersions(ctx, prefix)
+
+	return newVersionIterator(func(ctx context.Context) (*ObjectVersion, error) {
+		if err := ts.acquire(ctx); err != nil {
+			return nil, err
+		}
+		defer ts.release()
+
+		return iter.Next(ctx)
+	})
+}
+
+func (ts *limitedCloudStorage) Close() error {
+	return ts.inner.Close()
+}
+
+func (ts *limitedCloudStorage) GetPublicURL(key string) (string, error) {
+	return ts.inner.GetPublicURL(key)
+}
+
+func (ts *limitedCloudStorage) As(i interface{}) bool {
+	return ts.inner.As(i)
+}
+
+func (ts *limitedCloudStorage) Get(
+	ctx context.Context,
+	key string,
+) ([]byte, error) {
+	if err := ts.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer ts.release()
+
+	return ts.inner.Get(ctx, key)
+}
+
+func (ts *limitedCloudStorage) GetIfModified(
+	ctx context.Context,
+	key string,
+	etag string,
+	modSince time.Time,
+) ([]byte, *Attributes, bool, error) {
+	if err := ts.acquire(ctx); err != nil {
+		return nil, nil, false, err
+	}
+	defer ts.release()
+
+	return ts.inner.GetIfModified(ctx, key, etag, modSince)
+}
+
+func (ts *limitedCloudStorage) GetWithAttributes(
+	ctx context.Context,
+	key string,
+) ([]byte, *Attributes, error) {
+	if err := ts.acquire(ctx); err != nil {
+		return nil, nil, err
+	}
+	defer ts.release()
+
+	return ts.inner.GetWithAttributes(ctx, key)
+}
+
+func (ts *limitedCloudStorage) Delete(
+	ctx context.Context,
+	key string,
+) error {
+	if err := ts.acquire(ctx); err != nil {
+		return err
+	}
+	defer ts.release()
+
+	return ts.inner.Delete(ctx, key)
+}
+
+func (ts *limitedCloudStorage) DeleteBatch(
+	ctx context.Context,
+	keys []string,
+) error {
+	if err := ts.acquire(ctx); err != nil {
+		return err
+	}
+	defer ts.release()
+
+	return ts.inner.DeleteBatch(ctx, keys)
+}
+
+func (ts *limitedCloudStorage) CreateBucket(
+	ctx context.Context,
+	bucketPrefix string,
+	expirationTimeDays int64,
+) error {
+	if err := ts.acquire(ctx); err != nil {
+		return err
+	}
+	defer ts.release()
+
+	return ts.inner.CreateBucket(ctx, bucketPrefix, expirationTimeDays)
+}
+
+func (ts *limitedCloudStorage) CreateBucketWithOptions(
+	ctx context.Context,
+	opts *CreateBucketOptions,
+) error {
+	if err := ts.acquire(ctx); err != nil {
+		return err
+	}
+	defer ts.release()
+
+	return ts.inner.CreateBucketWithOptions(ctx, opts)
+}
+
+func (ts *limitedCloudStorage) GetSignedURL(
+	ctx context.Context,
+	key string,
+	opts *SignedURLOption,
+) (string, error) {
+	if err := ts.acquire(ctx); err != nil {
+		return "", err
+	}
+	defer ts.release()
+
+	return ts.inner.GetSignedURL(ctx, key, opts)
+}
+
+func (ts *limitedCloudStorage) GetSignedPostPolicy(
+	ctx context.Context,
+	keyPrefix string,
+	opts *PostPolicyOptions,
+) (*PostPolicy, error) {
+	if err := ts.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer ts.release()
+
+	return ts.inner.GetSignedPostPolicy(ctx, keyPrefix, opts)
+}
+
+func (ts *limitedCloudStorage) Write(
+	ctx context.Context,
+	key string,
+	body []byte,
+	contentType *string,
+) error {
+	if err := ts.acquire(ctx); err != nil {
+		return err
+	}
+	defer ts.release()
+
+	return ts.inner.Write(ctx, key, body, contentType)
+}
+
+func (ts *limitedCloudStorage) WriteWithOptions(
+	ctx context.Context,
+	key string,
+	body []byte,
+	opts *WriteOptions,
+) error {
+	if err := ts.acquire(ctx); err != nil {
+		return err
+	}
+	defer ts.release()
+
+	return ts.inner.WriteWithOptions(ctx, key, body, opts)
+}
+
+func (ts *limitedCloudStorage) Attributes(
+	ctx context.Context,
+	key string,
+) (*Attributes, error) {
+	if err := ts.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer ts.release()
+
+	return ts.inner.Attributes(ctx, key)
+}
+
+func (ts *limitedCloudStorage) UpdateAttributes(
+	ctx context.Context,
+	key string,
+	update AttributeUpdate,
+) (*Attributes, error) {
+	if err := ts.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer ts.release()
+
+	return ts.inner.UpdateAttributes(ctx, key, update)
+}
+
+func (ts *limitedCloudStorage) SetTags(
+	ctx context.Context,
+	key string,
+	tags map[string]string,
+) error {
+	if err := ts.acquire(ctx); err != nil {
+		return err
+	}
+	defer ts.release()
+
+	return ts.inner.SetTags(ctx, key, tags)
+}
+
+func (ts *limitedCloudStorage) GetTags(
+	ctx context.Context,
+	key string,
+) (map[string]string, error) {
+	if err := ts.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer ts.release()
+
+	return ts.inner.GetTags(ctx, key)
+}
+
+func (ts *limitedCloudStorage) SetStorageClass(
+	ctx context.Context,
+	key string,
+	class string,
+) error {
+	if err := ts.acquire(ctx); err != nil {
+		return err
+	}
+	defer ts.release()
+
+	return ts.inner.SetStorageClass(ctx, key, class)
+}
+
+func (ts *limitedCloudStorage) GetReader(
+	ctx context.Context,
+	key string,
+) (io.ReadCloser, error) {
+	if err := ts.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer ts.release()
+
+	return ts.inner.GetReader(ctx, key)
+}
+
+func (ts *limitedCloudStorage) GetRangeReader(
+	ctx context.Context,
+	key string,
+	offset int64,
+	length int64,
+) (io.ReadCloser, error) {
+	if err := ts.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer ts.release()
+
+	return ts.inner.GetRangeReader(ctx, key, offset, length)
+}
+
+func (ts *limitedCloudStorage) GetWriter(
+	ctx context.Context,
+	key string,
+) (io.WriteCloser, error) {
+	if err := ts.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer ts.release()
+
+	return ts.inner.GetWriter(ctx, key)
+}
+
+func (ts *limitedCloudStorage) GetWriterWithOptions(
+	ctx context.Context,
+	key string,
+	opts *WriteOptions,
+) (io.WriteCloser, error) {
+	if err := ts.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer ts.release()
+
+	return ts.inner.GetWriterWithOptions(ctx, key, opts)
+}
+
+func (ts *limitedCloudStorage) Exists(
+	ctx context.Context,
+	key string,
+) (bool, error) {
+	if err := ts.acquire(ctx); err != nil {
+		return false, err
+	}
+	defer ts.release()
+
+	return ts.inner.Exists(ctx, key)
+}
+
+func (ts *limitedCloudStorage) Copy(
+	ctx context.Context,
+	dstKey string,
+	srcKey string,
+) error {
+	if err := ts.acquire(ctx); err != nil {
+		return err
+	}
+	defer ts.release()
+
+	return ts.inner.Copy(ctx, dstKey, srcKey)
+}
+
+func (ts *limitedCloudStorage) Move(
+	ctx context.Context,
+	dstKey string,
+	srcKey string,
+) error {
+	if err := ts.acquire(ctx); err != nil {
+		return err
+	}
+	defer ts.release()
+
+	return ts.inner.Move(ctx, dstKey, srcKey)
+}
+
+func (ts *limitedCloudStorage) Ping(ctx context.Context) error {
+	if err := ts.acquire(ctx); err != nil {
+		return err
+	}
+	defer ts.release()
+
+	return ts.inner.Ping(ctx)
+}
+
+func (ts *limitedCloudStorage) GetVersion(
+	ctx context.Context,
+	key string,
+	version string,
+) ([]byte, error) {
+	if err := ts.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer ts.release()
+
+	return ts.inner.GetVersion(ctx, key, version)
+}
+
+func (ts *limitedCloudStorage) DeleteVersion(
+	ctx context.Context,
+	key string,
+	version string,
+) error {
+	if err := ts.acquire(ctx); err != nil {
+		return err
+	}
+	defer ts.release()
+
+	return ts.inner.DeleteVersion(ctx, key, version)
+}
+
+func (ts *limitedCloudStorage) SetObjectRetention(
+	ctx context.Context,
+	key string,
+	until time.Time,
+	mode string,
+) error {
+	if err := ts.acquire(ctx); err != nil {
+		return err
+	}
+	defer ts.release()
+
+	return ts.inner.SetObjectRetention(ctx, key, until, mode)
+}
+
+func (ts *limitedCloudStorage) GetObjectRetention(
+	ctx context.Context,
+	key string,
+) (*ObjectRetention, error) {
+	if err := ts.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer ts.release()
+
+	return ts.inner.GetObjectRetention(ctx, key)
+}
+
+func (ts *limitedCloudStorage) Restore(
+	ctx context.Context,
+	key string,
+	days int,
+	tier string,
+) error {
+	if err := ts.acquire(ctx); err != nil {
+		return err
+	}
+	defer ts.release()
+
+	return ts.inner.Restore(ctx, key, days, tier)
+}
+
+func (ts *limitedCloudStorage) RestoreStatus(
+	ctx context.Context,
+	key string,
+) (RestoreState, error) {
+	if err := ts.acquire(ctx); err != nil {
+		return RestoreState{}, err
+	}
+	defer ts.release()
+
+	return ts.inner.RestoreStatus(ctx, key)
+}
+
+func (ts *limitedCloudStorage) Append(
+	ctx context.Context,
+	key string,
+	data []byte,
+) error {
+	if err := ts.acquire(ctx); err != nil {
+		return err
+	}
+	defer ts.release()
+
+	return ts.inner.Append(ctx, key, data)
+}
+
+func (ts *limitedCloudStorage) GetSize(
+	ctx context.Context,
+	key string,
+) (int64, error) {
+	if err := ts.acquire(ctx); err != nil {
+		return 0, err
+	}
+	defer ts.release()
+
+	return ts.inner.GetSize(ctx, key)
+}
+
+func (ts *limitedCloudStorage) VerifyDownload(
+	ctx context.Context,
+	key string,
+) error {
+	if err := ts.acquire(ctx); err != nil {
+		return err
+	}
+	defer ts.release()
+
+	return ts.inner.VerifyDownload(ctx, key)
+}
+
+func (ts *limitedCloudStorage) StartMultipartUpload(
+	ctx context.Context,
+	key string,
+	opts *WriteOptions,
+) (string, error) {
+	if err := ts.acquire(ctx); err != nil {
+		return "", err
+	}
+	defer ts.release()
+
+	return ts.inner.StartMultipartUpload(ctx, key, opts)
+}
+
+func (ts *limitedCloudStorage) SignUploadPartURL(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	partNumber int,
+	expiry time.Duration,
+) (string, error) {
+	if err := ts.acquire(ctx); err != nil {
+		return "", err
+	}
+	defer ts.release()
+
+	return ts.inner.SignUploadPartURL(ctx, key, uploadID, partNumber, expiry)
+}
+
+func (ts *limitedCloudStorage) CompleteMultipartUpload(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	parts []CompletedPart,
+) error {
+	if err := ts.acquire(ctx); err != nil {
+		return err
+	}
+	defer ts.release()
+
+	return ts.inner.CompleteMultipartUpload(ctx, key, uploadID, parts)
+}
+
+func (ts *limitedCloudStorage) AbortMultipartUpload(
+	ctx context.Context,
+	key string,
+	uploadID string,
+) error {
+	if err := ts.acquire(ctx); err != nil {
+		return err
+	}
+	defer ts.release()
+
+	return ts.inner.AbortMultipartUpload(ctx, key, uploadID)
+}
+
+func (ts *limitedCloudStorage) SetLifecycle(
+	ctx context.Context,
+	rules []LifecycleRule,
+	opts *LifecycleOptions,
+) error {
+	if err := ts.acquire(ctx); err != nil {
+		return err
+	}
+	defer ts.release()
+
+	return ts.inner.SetLifecycle(ctx, rules, opts)
+}
+
+func (ts *limitedCloudStorage) GetLifecycle(ctx context.Context) ([]LifecycleRule, error) {
+	if err := ts.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer ts.release()
+
+	return ts.inner.GetLifecycle(ctx)
+}
+
+func (ts *limitedCloudStorage) SetVersioning(
+	ctx context.Context,
+	enabled bool,
+) error {
+	if err := ts.acquire(ctx); err != nil {
+		return err
+	}
+	defer ts.release()
+
+	return ts.inner.SetVersioning(ctx, enabled)
+}
+
+func (ts *limitedCloudStorage) GetVersioning(ctx context.Context) (bool, error) {
+	if err := ts.acquire(ctx); err != nil {
+		return false, err
+	}
+	defer ts.release()
+
+	return ts.inner.GetVersioning(ctx)
+}
+
+func (ts *limitedCloudStorage) GetVersioningState(ctx context.Context) (VersioningState, error) {
+	if err := ts.acquire(ctx); err != nil {
+		return "", err
+	}
+	defer ts.release()
+
+	return ts.inner.GetVersioningState(ctx)
+}
+
+func (ts *limitedCloudStorage) SetCORS(
+	ctx context.Context,
+	rules []CORSRule,
+) error {
+	if err := ts.acquire(ctx); err != nil {
+		return err
+	}
+	defer ts.release()
+
+	return ts.inner.SetCORS(ctx, rules)
+}
+
+func (ts *limitedCloudStorage) GetCORS(ctx context.Context) ([]CORSRule, error) {
+	if err := ts.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer ts.release()
+
+	return ts.inner.GetCORS(ctx)
+}
+
+func (ts *limitedCloudStorage) SetPublicAccessBlock(
+	ctx context.Context,
+	blocked bool,
+) error {
+	if err := ts.acquire(ctx); err != nil {
+		return err
+	}
+	defer ts.release()
+
+	return ts.inner.SetPublicAccessBlock(ctx, blocked)
+}
+
+func (ts *limitedCloudStorage) GetPublicAccessBlock(ctx context.Context) (bool, error) {
+	if err := ts.acquire(ctx); err != nil {
+		return false, err
+	}
+	defer ts.release()
+
+	return ts.inner.GetPublicAccessBlock(ctx)
+}
+
+func (ts *limitedCloudStorage) GetPublicAccessBlockDetails(ctx context.Context) (*PublicAccessBlock, error) {
+	if err := ts.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer ts.release()
+
+	return ts.inner.GetPublicAccessBlockDetails(ctx)
+}
@@ -0,0 +1,39 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+// Logger receives the logs of the storages. *logrus.Logger and *logrus.Entry implement it, and the other
+// loggers, e.g. zap or slog, need a small adapter.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// noopLogger discards the logs, it's the Logger of the storages by default.
+type noopLogger struct{}
+
+var _ Logger = noopLogger{}
+
+func (noopLogger) Debugf(string, ...interface{}) {}
+
+func (noopLogger) Infof(string, ...interface{}) {}
+
+func (noopLogger) Warnf(string, ...interface{}) {}
+
+func (noopLogger) Errorf(string, ...interface{}) {}
@@ -0,0 +1,153 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"context"
+	"crypto/md5" //nolint:gosec
+	"encoding/hex"
+	"io"
+)
+
+// md5MetadataKey is the metadata caching the MD5 computed for ComputeMissingMD5, in hexadecimal.
+const md5MetadataKey = "md5"
+
+// md5ComputingCloudStorage fills the MD5 of Attributes which the provider doesn't return.
+type md5ComputingCloudStorage struct {
+	CloudStorage
+}
+
+var _ CloudStorage = (*md5ComputingCloudStorage)(nil)
+
+func newMD5ComputingCloudStorage(inner CloudStorage) CloudStorage {
+	return &md5ComputingCloudStorage{
+		CloudStorage: inner,
+	}
+}
+
+// options returns the settings of the wrapped storage.
+func (ts *md5ComputingCloudStorage) options() storageOptions {
+	return storageOptionsOf(ts.CloudStorage)
+}
+
+// bucketLocation is the one of the wrapped storage, so that CopyObjectBetween still copies by the provider.
+func (ts *md5ComputingCloudStorage) bucketLocation() string {
+	locator, ok := ts.CloudStorage.(bucketLocator)
+	if !ok {
+		return ""
+	}
+
+	return locator.bucketLocation()
+}
+
+func (ts *md5ComputingCloudStorage) Attributes(
+	ctx context.Context,
+	key string,
+) (*Attributes, error) {
+	attrs, err := ts.CloudStorage.Attributes(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return fillMissingMD5(ctx, ts.CloudStorage, key, attrs, ts.options().computeMD5MaxSize)
+}
+
+// cachedMD5 returns the MD5 cached in the metadata, or nil when there is none or it's malformed.
+func cachedMD5(metadata map[string]string) []byte {
+	sum, err := hex.DecodeString(metadata[md5MetadataKey])
+	if err != nil || len(sum) != md5.Size {
+		return nil
+	}
+
+	return sum
+}
+
+// fillMissingMD5 sets the MD5 of the attributes when the provider didn't return it, from the metadata cache
+// or by reading the object as stored when it isn't larger than maxSize, in which case the MD5 is cached.
+// The objects of EncryptedCloudStorage are left alone, their MD5 doesn't describe the decrypted content.
+func fillMissingMD5(
+	ctx context.Context,
+	storage CloudStorage,
+	key string,
+	attrs *Attributes,
+	maxSize int64,
+) (*Attributes, error) {
+	if len(attrs.MD5) > 0 {
+		return attrs, nil
+	}
+
+	if _, ok := attrs.Metadata[plaintextSizeMetadataKey]; ok {
+		return attrs, nil
+	}
+
+	if sum := cachedMD5(attrs.Metadata); sum != nil {
+		attrs.MD5 = sum
+
+		return attrs, nil
+	}
+
+	if attrs.Size > maxSize {
+		return attrs, nil
+	}
+
+	sum, err := computeMD5(ctx, storage, key)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs.MD5 = sum
+
+	cacheMD5(ctx, storage, key, attrs)
+
+	return attrs, nil
+}
+
+// computeMD5 hashes the object as stored, so that the MD5 matches the one the provider would return.
+func computeMD5(ctx context.Context, storage CloudStorage, key string) ([]byte, error) {
+	reader, err := storage.GetRangeReader(ctx, key, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	defer reader.Close()
+
+	hash := md5.New() //nolint:gosec
+	if _, err := io.Copy(hash, reader); err != nil {
+		return nil, err
+	}
+
+	return hash.Sum(nil), nil
+}
+
+// cacheMD5 stores the computed MD5 in the metadata of the object, unless the object was replaced while
+// it was read. The failures are only logged, the MD5 is computed again by the next call.
+func cacheMD5(ctx context.Context, storage CloudStorage, key string, attrs *Attributes) {
+	current, err := storage.Attributes(ctx, key)
+	if err == nil && (current.ETag != attrs.ETag || !current.ModTime.Equal(attrs.ModTime)) {
+		return
+	}
+
+	if err == nil {
+		_, err = storage.UpdateAttributes(ctx, key, AttributeUpdate{
+			Metadata: map[string]string{md5MetadataKey: hex.EncodeToString(attrs.MD5)},
+		})
+	}
+
+	if err != nil {
+		storageOptionsOf(storage).logger.Warnf("unable to cache the MD5 of '%s': %v", key, err)
+	}
+}
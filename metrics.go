@@ -0,0 +1,52 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"time"
+)
+
+// MetricsRecorder records the outcome of the storage operations, e.g. in Prometheus with the promblob package.
+// Record is called once for every operation and for every page fetch and failure of the listings, a page fetch
+// being a call of Next which got a response of the provider. It gets the number of bytes read or written, zero
+// when it's unknown, and nil or the error of the operation. The readers and the writers are recorded when they are
+// closed. The calls may be concurrent.
+type MetricsRecorder interface {
+	Record(op string, dur time.Duration, bytes int64, err error)
+}
+
+// BucketMetricsRecorder is implemented by the MetricsRecorder labeling the operations by bucket, the storage
+// records its operations with the MetricsRecorder returned for its provider and bucket.
+type BucketMetricsRecorder interface {
+	MetricsRecorder
+	ForBucket(provider, bucketName string) MetricsRecorder
+}
+
+// SlowOperationRecorder is implemented by the MetricsRecorder counting the operations slower than
+// SlowOperationThreshold, RecordSlow is called for each of them after Record.
+type SlowOperationRecorder interface {
+	RecordSlow(op string, dur time.Duration, bytes int64)
+}
+
+// metricsRecorderFor returns the recorder of the bucket.
+func metricsRecorderFor(recorder MetricsRecorder, provider, bucketName string) MetricsRecorder {
+	if bucketRecorder, ok := recorder.(BucketMetricsRecorder); ok {
+		return bucketRecorder.ForBucket(provider, bucketName)
+	}
+
+	return recorder
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package mock
+
+//go:generate mockgen -destination=mock_cloud_storage.go -package=mock github.com/AccelByte/common-blob-go CloudStorage
+
+import (
+	"context"
+	"io"
+
+	commonblobgo "github.com/AccelByte/common-blob-go"
+)
+
+// NewListIterator returns an iterator over the objects, which returns io.EOF after the last one,
+// to be returned by the expectations of List and ListWithOptions:
+//
+//	storage.EXPECT().List(gomock.Any(), "exports/").Return(mock.NewListIterator(
+//		&commonblobgo.ListObject{Key: "exports/a.json", Size: 42},
+//	))
+func NewListIterator(objects ...*commonblobgo.ListObject) *commonblobgo.ListIterator {
+	return NewFailingListIterator(io.EOF, objects...)
+}
+
+// NewFailingListIterator returns an iterator over the objects, which fails with err after the last one,
+// e.g. a listing interrupted by a network failure.
+func NewFailingListIterator(err error, objects ...*commonblobgo.ListObject) *commonblobgo.ListIterator {
+	return commonblobgo.NewListIterator(func(ctx context.Context) (*commonblobgo.ListObject, error) {
+		if len(objects) == 0 {
+			return nil, err
+		}
+
+		object := objects[0]
+		objects = objects[1:]
+
+		return object, nil
+	})
+}
+
+// NewVersionIterator returns an iterator over the versions, which returns io.EOF after the last one,
+// to be returned by the expectations of ListVersions.
+func NewVersionIterator(versions ...*commonblobgo.ObjectVersion) *commonblobgo.VersionIterator {
+	return commonblobgo.NewVersionIterator(func(ctx context.Context) (*commonblobgo.ObjectVersion, error) {
+		if len(versions) == 0 {
+			return nil, io.EOF
+		}
+
+		version := versions[0]
+		versions = versions[1:]
+
+		return version, nil
+	})
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package mock
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	commonblobgo "github.com/AccelByte/common-blob-go"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+var _ commonblobgo.CloudStorage = (*MockCloudStorage)(nil)
+
+func TestListIterator(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	storage := NewMockCloudStorage(ctrl)
+	storage.EXPECT().ListWithOptions(gomock.Any(), &commonblobgo.ListOptions{Prefix: "exports/"}).Return(NewListIterator(
+		&commonblobgo.ListObject{Key: "exports/a.json"},
+		&commonblobgo.ListObject{Key: "exports/b.json"},
+	))
+
+	var keys []string
+
+	err := commonblobgo.WalkPrefix(context.Background(), storage, "exports/", func(object *commonblobgo.ListObject) error {
+		keys = append(keys, object.Key)
+
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"exports/a.json", "exports/b.json"}, keys)
+
+	failure := errors.New("connection reset")
+	iter := NewFailingListIterator(failure, &commonblobgo.ListObject{Key: "a.json"})
+
+	_, err = iter.Next(context.Background())
+	require.NoError(t, err)
+
+	_, err = iter.Next(context.Background())
+	require.Equal(t, failure, err)
+
+	versions := NewVersionIterator(&commonblobgo.ObjectVersion{Key: "a.json", Version: "1"})
+
+	_, err = versions.Next(context.Background())
+	require.NoError(t, err)
+
+	_, err = versions.Next(context.Background())
+	require.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,782 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// PrefixedCloudStorage scopes the wrapped CloudStorage to a prefix: the prefix is prepended to the keys
+// of every call and stripped from the listed keys. The keys which could escape the prefix are rejected.
+// Unlike the other wrappers, it doesn't embed the wrapped CloudStorage, so that no call can skip the prefix.
+type PrefixedCloudStorage struct {
+	inner  CloudStorage
+	prefix string
+}
+
+var _ CloudStorage = (*PrefixedCloudStorage)(nil)
+
+// NewPrefixedStorage returns a view of inner scoped to the prefix, a "/" is appended to the prefix if missing.
+func NewPrefixedStorage(inner CloudStorage, prefix string) CloudStorage {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	return &PrefixedCloudStorage{
+		inner:  inner,
+		prefix: prefix,
+	}
+}
+
+// key returns the key with the prefix, the empty keys and the keys with "." or ".." segments are rejected.
+func (ts *PrefixedCloudStorage) key(key string) (string, error) {
+	if key == "" {
+		return "", newTypedError(ErrInvalidArgument, fmt.Errorf("empty key"))
+	}
+
+	if err := validatePrefixedPath(key); err != nil {
+		return "", err
+	}
+
+	return ts.prefix + key, nil
+}
+
+// listPrefix returns the listing prefix with the prefix, the empty one lists the whole prefix.
+func (ts *PrefixedCloudStorage) listPrefix(prefix string) (string, error) {
+	if err := validatePrefixedPath(prefix); err != nil {
+		return "", err
+	}
+
+	return ts.prefix + prefix, nil
+}
+
+func validatePrefixedPath(path string) error {
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "." || segment == ".." {
+			return newTypedError(ErrInvalidArgument, fmt.Errorf("key '%s' could escape the prefix", path))
+		}
+	}
+
+	return nil
+}
+
+func (ts *PrefixedCloudStorage) stripPrefix(key string) string {
+	return strings.TrimPrefix(key, ts.prefix)
+}
+
+func (ts *PrefixedCloudStorage) List(
+	ctx context.Context,
+	prefix string,
+) *ListIterator {
+	return ts.ListWithOptions(ctx, &ListOptions{
+		Prefix: prefix,
+	})
+}
+
+func (ts *PrefixedCloudStorage) ListWithOptions(
+	ctx context.Context,
+	listOptions *ListOptions,
+) *ListIterator {
+	options := *listOptions
+
+	prefix, err := ts.listPrefix(listOptions.Prefix)
+	if err != nil {
+		return newListIterator(func(ctx context.Context) (*ListObject, error) {
+			return nil, err
+		})
+	}
+
+	options.Prefix = prefix
+
+	if options.StartAfter != "" {
+		options.StartAfter = ts.prefix + options.StartAfter
+	}
+
+	iter := ts.inner.ListWithOptions(ctx, &options)
+
+	return newListIterator(func(ctx context.Context) (*ListObject, error) {
+		object, err := iter.Next(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		object.Key = ts.stripPrefix(object.Key)
+
+		return object, nil
+	})
+}
+
+func (ts *PrefixedCloudStorage) ListVersions(
+	ctx context.Context,
+	prefix string,
+) *VersionIterator {
+	prefix, err := ts.listPrefix(prefix)
+	if err != nil {
+		return newVersionIterator(func(ctx context.Context) (*ObjectVersion, error) {
+			return nil, err
+		})
+	}
+
+	iter := ts.inner.ListVersions(ctx, prefix)
+
+	return newVersionIterator(func(ctx context.Context) (*ObjectVersion, error) {
+		version, err := iter.Next(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		version.Key = ts.stripPrefix(version.Key)
+
+		return version, nil
+	})
+}
+
+func (ts *PrefixedCloudStorage) Get(
+	ctx context.Context,
+	key string,
+) ([]byte, error) {
+	key, err := ts.key(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return ts.inner.Get(ctx, key)
+}
+
+func (ts *PrefixedCloudStorage) GetIfModified(
+	ctx context.Context,
+	key string,
+	etag string,
+	modSince time.Time,
+) ([]byte, *Attributes, bool, error) {
+	key, err := ts.key(key)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	return ts.inner.GetIfModified(ctx, key, etag, modSince)
+}
+
+func (ts *PrefixedCloudStorage) GetWithAttributes(
+	ctx context.Context,
+	key string,
+) ([]byte, *Attributes, error) {
+	key, err := ts.key(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ts.inner.GetWithAttributes(ctx, key)
+}
+
+func (ts *PrefixedCloudStorage) GetReader(
+	ctx context.Context,
+	key string,
+) (io.ReadCloser, error) {
+	key, err := ts.key(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return ts.inner.GetReader(ctx, key)
+}
+
+func (ts *PrefixedCloudStorage) GetRangeReader(
+	ctx context.Context,
+	key string,
+	offset,
+	length int64,
+) (io.ReadCloser, error) {
+	key, err := ts.key(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return ts.inner.GetRangeReader(ctx, key, offset, length)
+}
+
+func (ts *PrefixedCloudStorage) GetVersion(
+	ctx context.Context,
+	key string,
+	version string,
+) ([]byte, error) {
+	key, err := ts.key(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return ts.inner.GetVersion(ctx, key, version)
+}
+
+func (ts *PrefixedCloudStorage) GetWriter(
+	ctx context.Context,
+	key string,
+) (io.WriteCloser, error) {
+	key, err := ts.key(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return ts.inner.GetWriter(ctx, key)
+}
+
+func (ts *PrefixedCloudStorage) GetWriterWithOptions(
+	ctx context.Context,
+	key string,
+	opts *WriteOptions,
+) (io.WriteCloser, error) {
+	key, err := ts.key(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return ts.inner.GetWriterWithOptions(ctx, key, opts)
+}
+
+func (ts *PrefixedCloudStorage) CreateBucket(
+	ctx context.Context,
+	bucketPrefix string,
+	expirationTimeDays int64,
+) error {
+	return ts.inner.CreateBucket(ctx, bucketPrefix, expirationTimeDays)
+}
+
+func (ts *PrefixedCloudStorage) CreateBucketWithOptions(
+	ctx context.Context,
+	opts *CreateBucketOptions,
+) error {
+	return ts.inner.CreateBucketWithOptions(ctx, opts)
+}
+
+// SetLifecycle sets the rules of the prefixes under the prefix of the storage.
+func (ts *PrefixedCloudStorage) SetLifecycle(
+	ctx context.Context,
+	rules []LifecycleRule,
+	opts *LifecycleOptions,
+) error {
+	if opts != nil && opts.ReplaceAll {
+		return newTypedError(ErrInvalidArgument, fmt.Errorf("the lifecycle rules of the whole bucket can't be replaced under a prefix"))
+	}
+
+	prefixedRules := make([]LifecycleRule, len(rules))
+
+	for i, rule := range rules {
+		prefix, err := ts.listPrefix(rule.Prefix)
+		if err != nil {
+			return err
+		}
+
+		prefixedRules[i] = rule
+		prefixedRules[i].Prefix = prefix
+	}
+
+	return ts.inner.SetLifecycle(ctx, prefixedRules, opts)
+}
+
+// GetLifecycle returns the rules of the prefixes under the prefix of the storage, relative to it.
+func (ts *PrefixedCloudStorage) GetLifecycle(
+	ctx context.Context,
+) ([]LifecycleRule, error) {
+	rules, err := ts.inner.GetLifecycle(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	prefixedRules := []LifecycleRule{}
+
+	for _, rule := range rules {
+		if strings.HasPrefix(rule.Prefix, ts.prefix) {
+			rule.Prefix = strings.TrimPrefix(rule.Prefix, ts.prefix)
+			prefixedRules = append(prefixedRules, rule)
+		}
+	}
+
+	return prefixedRules, nil
+}
+
+func (ts *PrefixedCloudStorage) SetVersioning(
+	ctx context.Context,
+	enabled bool,
+) error {
+	return ts.inner.SetVersioning(ctx, enabled)
+}
+
+func (ts *PrefixedCloudStorage) GetVersioning(
+	ctx context.Context,
+) (bool, error) {
+	return ts.inner.GetVersioning(ctx)
+}
+
+func (ts *PrefixedCloudStorage) GetVersioningState(
+	ctx context.Context,
+) (VersioningState, error) {
+	return ts.inner.GetVersioningState(ctx)
+}
+
+func (ts *PrefixedCloudStorage) SetCORS(
+	ctx context.Context,
+	rules []CORSRule,
+) error {
+	return ts.inner.SetCORS(ctx, rules)
+}
+
+func (ts *PrefixedCloudStorage) GetCORS(
+	ctx context.Context,
+) ([]CORSRule, error) {
+	return ts.inner.GetCORS(ctx)
+}
+
+func (ts *PrefixedCloudStorage) SetPublicAccessBlock(
+	ctx context.Context,
+	blocked bool,
+) error {
+	return ts.inner.SetPublicAccessBlock(ctx, blocked)
+}
+
+func (ts *PrefixedCloudStorage) GetPublicAccessBlock(
+	ctx context.Context,
+) (bool, error) {
+	return ts.inner.GetPublicAccessBlock(ctx)
+}
+
+func (ts *PrefixedCloudStorage) GetPublicAccessBlockDetails(
+	ctx context.Context,
+) (*PublicAccessBlock, error) {
+	return ts.inner.GetPublicAccessBlockDetails(ctx)
+}
+
+func (ts *PrefixedCloudStorage) Close() error {
+	return ts.inner.Close()
+}
+
+func (ts *PrefixedCloudStorage) GetSignedURL(
+	ctx context.Context,
+	key string,
+	opts *SignedURLOption,
+) (string, error) {
+	key, err := ts.key(key)
+	if err != nil {
+		return "", err
+	}
+
+	return ts.inner.GetSignedURL(ctx, key, opts)
+}
+
+func (ts *PrefixedCloudStorage) GetSignedPostPolicy(
+	ctx context.Context,
+	keyPrefix string,
+	opts *PostPolicyOptions,
+) (*PostPolicy, error) {
+	var err error
+	if opts != nil && opts.ExactKey {
+		keyPrefix, err = ts.key(keyPrefix)
+	} else {
+		keyPrefix, err = ts.listPrefix(keyPrefix)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ts.inner.GetSignedPostPolicy(ctx, keyPrefix, opts)
+}
+
+func (ts *PrefixedCloudStorage) GetPublicURL(
+	key string,
+) (string, error) {
+	key, err := ts.key(key)
+	if err != nil {
+		return "", err
+	}
+
+	return ts.inner.GetPublicURL(key)
+}
+
+// As is the one of the wrapped storage.
+func (ts *PrefixedCloudStorage) As(i interface{}) bool {
+	return ts.inner.As(i)
+}
+
+func (ts *PrefixedCloudStorage) StartMultipartUpload(
+	ctx context.Context,
+	key string,
+	opts *WriteOptions,
+) (string, error) {
+	key, err := ts.key(key)
+	if err != nil {
+		return "", err
+	}
+
+	return ts.inner.StartMultipartUpload(ctx, key, opts)
+}
+
+func (ts *PrefixedCloudStorage) SignUploadPartURL(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	partNumber int,
+	expiry time.Duration,
+) (string, error) {
+	key, err := ts.key(key)
+	if err != nil {
+		return "", err
+	}
+
+	return ts.inner.SignUploadPartURL(ctx, key, uploadID, partNumber, expiry)
+}
+
+func (ts *PrefixedCloudStorage) CompleteMultipartUpload(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	parts []CompletedPart,
+) error {
+	key, err := ts.key(key)
+	if err != nil {
+		return err
+	}
+
+	return ts.inner.CompleteMultipartUpload(ctx, key, uploadID, parts)
+}
+
+func (ts *PrefixedCloudStorage) AbortMultipartUpload(
+	ctx context.Context,
+	key string,
+	uploadID string,
+) error {
+	key, err := ts.key(key)
+	if err != nil {
+		return err
+	}
+
+	return ts.inner.AbortMultipartUpload(ctx, key, uploadID)
+}
+
+func (ts *PrefixedCloudStorage) Write(
+	ctx context.Context,
+	key string,
+	body []byte,
+	contentType *string,
+) error {
+	key, err := ts.key(key)
+	if err != nil {
+		return err
+	}
+
+	return ts.inner.Write(ctx, key, body, contentType)
+}
+
+func (ts *PrefixedCloudStorage) WriteWithOptions(
+	ctx context.Context,
+	key string,
+	body []byte,
+	opts *WriteOptions,
+) error {
+	key, err := ts.key(key)
+	if err != nil {
+		return err
+	}
+
+	return ts.inner.WriteWithOptions(ctx, key, body, opts)
+}
+
+func (ts *PrefixedCloudStorage) Append(
+	ctx context.Context,
+	key string,
+	data []byte,
+) error {
+	key, err := ts.key(key)
+	if err != nil {
+		return err
+	}
+
+	return ts.inner.Append(ctx, key, data)
+}
+
+func (ts *PrefixedCloudStorage) Delete(
+	ctx context.Context,
+	key string,
+) error {
+	key, err := ts.key(key)
+	if err != nil {
+		return err
+	}
+
+	return ts.inner.Delete(ctx, key)
+}
+
+func (ts *PrefixedCloudStorage) DeleteBatch(
+	ctx context.Context,
+	keys []string,
+) error {
+	prefixedKeys, err := ts.batchKeys(keys)
+	if err != nil {
+		return err
+	}
+
+	return ts.stripBatchError(ts.inner.DeleteBatch(ctx, prefixedKeys))
+}
+
+func (ts *PrefixedCloudStorage) batchKeys(keys []string) ([]string, error) {
+	prefixedKeys := make([]string, 0, len(keys))
+
+	for _, key := range keys {
+		prefixedKey, err := ts.key(key)
+		if err != nil {
+			return nil, err
+		}
+
+		prefixedKeys = append(prefixedKeys, prefixedKey)
+	}
+
+	return prefixedKeys, nil
+}
+
+// stripBatchError reports the failures of a batch operation with the keys of the caller.
+func (ts *PrefixedCloudStorage) stripBatchError(err error) error {
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		return err
+	}
+
+	failures := make(map[string]error, len(batchErr.Errors))
+	for key, keyErr := range batchErr.Errors {
+		failures[ts.stripPrefix(key)] = keyErr
+	}
+
+	return &BatchError{Errors: failures}
+}
+
+func (ts *PrefixedCloudStorage) DeleteVersion(
+	ctx context.Context,
+	key string,
+	version string,
+) error {
+	key, err := ts.key(key)
+	if err != nil {
+		return err
+	}
+
+	return ts.inner.DeleteVersion(ctx, key, version)
+}
+
+func (ts *PrefixedCloudStorage) SetObjectRetention(
+	ctx context.Context,
+	key string,
+	until time.Time,
+	mode string,
+) error {
+	key, err := ts.key(key)
+	if err != nil {
+		return err
+	}
+
+	return ts.inner.SetObjectRetention(ctx, key, until, mode)
+}
+
+func (ts *PrefixedCloudStorage) GetObjectRetention(
+	ctx context.Context,
+	key string,
+) (*ObjectRetention, error) {
+	key, err := ts.key(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return ts.inner.GetObjectRetention(ctx, key)
+}
+
+func (ts *PrefixedCloudStorage) Attributes(
+	ctx context.Context,
+	key string,
+) (*Attributes, error) {
+	key, err := ts.key(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return ts.inner.Attributes(ctx, key)
+}
+
+func (ts *PrefixedCloudStorage) GetSize(
+	ctx context.Context,
+	key string,
+) (int64, error) {
+	key, err := ts.key(key)
+	if err != nil {
+		return 0, err
+	}
+
+	return ts.inner.GetSize(ctx, key)
+}
+
+func (ts *PrefixedCloudStorage) VerifyDownload(
+	ctx context.Context,
+	key string,
+) error {
+	key, err := ts.key(key)
+	if err != nil {
+		return err
+	}
+
+	return ts.inner.VerifyDownload(ctx, key)
+}
+
+func (ts *PrefixedCloudStorage) UpdateAttributes(
+	ctx context.Context,
+	key string,
+	update AttributeUpdate,
+) (*Attributes, error) {
+	key, err := ts.key(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return ts.inner.UpdateAttributes(ctx, key, update)
+}
+
+func (ts *PrefixedCloudStorage) SetTags(
+	ctx context.Context,
+	key string,
+	tags map[string]string,
+) error {
+	key, err := ts.key(key)
+	if err != nil {
+		return err
+	}
+
+	return ts.inner.SetTags(ctx, key, tags)
+}
+
+func (ts *PrefixedCloudStorage) GetTags(
+	ctx context.Context,
+	key string,
+) (map[string]string, error) {
+	key, err := ts.key(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return ts.inner.GetTags(ctx, key)
+}
+
+func (ts *PrefixedCloudStorage) SetStorageClass(
+	ctx context.Context,
+	key string,
+	class string,
+) error {
+	key, err := ts.key(key)
+	if err != nil {
+		return err
+	}
+
+	return ts.inner.SetStorageClass(ctx, key, class)
+}
+
+func (ts *PrefixedCloudStorage) Restore(
+	ctx context.Context,
+	key string,
+	days int,
+	tier string,
+) error {
+	key, err := ts.key(key)
+	if err != nil {
+		return err
+	}
+
+	return ts.inner.Restore(ctx, key, days, tier)
+}
+
+func (ts *PrefixedCloudStorage) RestoreStatus(
+	ctx context.Context,
+	key string,
+) (RestoreState, error) {
+	key, err := ts.key(key)
+	if err != nil {
+		return RestoreState{}, err
+	}
+
+	return ts.inner.RestoreStatus(ctx, key)
+}
+
+func (ts *PrefixedCloudStorage) Exists(
+	ctx context.Context,
+	key string,
+) (bool, error) {
+	key, err := ts.key(key)
+	if err != nil {
+		return false, err
+	}
+
+	return ts.inner.Exists(ctx, key)
+}
+
+// options returns the settings of the wrapped storage.
+func (ts *PrefixedCloudStorage) options() storageOptions {
+	return storageOptionsOf(ts.inner)
+}
+
+// bucketLocation includes the prefix, so that CopyObjectBetween copies by the provider only within the same prefix.
+func (ts *PrefixedCloudStorage) bucketLocation() string {
+	locator, ok := ts.inner.(bucketLocator)
+	if !ok {
+		return ""
+	}
+
+	return locator.bucketLocation() + "/" + ts.prefix
+}
+
+func (ts *PrefixedCloudStorage) Copy(ctx context.Context, dstKey, srcKey string) error {
+	dstKey, srcKey, err := ts.keys(dstKey, srcKey)
+	if err != nil {
+		return err
+	}
+
+	return ts.inner.Copy(ctx, dstKey, srcKey)
+}
+
+func (ts *PrefixedCloudStorage) Move(ctx context.Context, dstKey, srcKey string) error {
+	dstKey, srcKey, err := ts.keys(dstKey, srcKey)
+	if err != nil {
+		return err
+	}
+
+	return ts.inner.Move(ctx, dstKey, srcKey)
+}
+
+func (ts *PrefixedCloudStorage) keys(dstKey, srcKey string) (string, string, error) {
+	dstKey, err := ts.key(dstKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	srcKey, err = ts.key(srcKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	return dstKey, srcKey, nil
+}
+
+func (ts *PrefixedCloudStorage) Ping(ctx context.Context) error {
+	return ts.inner.Ping(ctx)
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+// Package promblob records the operations of the commonblobgo storages in Prometheus.
+//
+//	recorder, err := promblob.New(prometheus.DefaultRegisterer)
+//	...
+//	opts.Metrics = recorder
+package promblob
+
+import (
+	"time"
+
+	commonblobgo "github.com/AccelByte/common-blob-go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Recorder is a commonblobgo.MetricsRecorder counting the operations, the slow operations and the transferred
+// bytes, and observing the latency of the operations, labeled by provider, bucket and operation. The failures are
+// labeled by their commonblobgo.ErrorKind, so that the error messages don't blow up the cardinality.
+type Recorder struct {
+	operations *prometheus.CounterVec
+	duration   *prometheus.HistogramVec
+	bytes      *prometheus.CounterVec
+	slow       *prometheus.CounterVec
+
+	provider   string
+	bucketName string
+}
+
+var (
+	_ commonblobgo.BucketMetricsRecorder = (*Recorder)(nil)
+	_ commonblobgo.SlowOperationRecorder = (*Recorder)(nil)
+)
+
+// New registers the collectors of the recorder on the registerer.
+func New(registerer prometheus.Registerer) (*Recorder, error) {
+	recorder := &Recorder{
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "blob_operations_total",
+			Help: "Number of the storage operations, by outcome.",
+		}, []string{"provider", "bucket", "operation", "error_kind"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "blob_operation_duration_seconds",
+			Help:    "Latency of the storage operations.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"provider", "bucket", "operation"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "blob_transferred_bytes_total",
+			Help: "Number of the bytes read or written by the storage operations.",
+		}, []string{"provider", "bucket", "operation"}),
+		slow: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "blob_slow_operations_total",
+			Help: "Number of the storage operations slower than the SlowOperationThreshold.",
+		}, []string{"provider", "bucket", "operation"}),
+	}
+
+	collectors := []prometheus.Collector{recorder.operations, recorder.duration, recorder.bytes, recorder.slow}
+	for _, collector := range collectors {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+
+	return recorder, nil
+}
+
+// ForBucket returns the recorder labeling the operations with the provider and the bucket.
+func (r *Recorder) ForBucket(provider, bucketName string) commonblobgo.MetricsRecorder {
+	bucketRecorder := *r
+	bucketRecorder.provider = provider
+	bucketRecorder.bucketName = bucketName
+
+	return &bucketRecorder
+}
+
+// Record records an operation, the provider and the bucket are empty unless it's recorded through ForBucket.
+func (r *Recorder) Record(op string, dur time.Duration, bytes int64, err error) {
+	r.operations.WithLabelValues(r.provider, r.bucketName, op, commonblobgo.ErrorCode(err).String()).Inc()
+	r.duration.WithLabelValues(r.provider, r.bucketName, op).Observe(dur.Seconds())
+
+	if bytes > 0 {
+		r.bytes.WithLabelValues(r.provider, r.bucketName, op).Add(float64(bytes))
+	}
+}
+
+// RecordSlow counts an operation slower than the SlowOperationThreshold.
+func (r *Recorder) RecordSlow(op string, dur time.Duration, bytes int64) {
+	r.slow.WithLabelValues(r.provider, r.bucketName, op).Inc()
+}
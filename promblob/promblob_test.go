@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package promblob
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	commonblobgo "github.com/AccelByte/common-blob-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorder(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	recorder, err := New(registry)
+	require.NoError(t, err)
+
+	bucketRecorder := recorder.ForBucket("aws", "my-bucket")
+	bucketRecorder.Record("Get", 20*time.Millisecond, 42, nil)
+	bucketRecorder.Record("Get", 10*time.Millisecond, 0, fmt.Errorf("get: %w", commonblobgo.ErrNotFound))
+	bucketRecorder.Record("Get", 10*time.Millisecond, 0, errors.New("connection reset"))
+
+	require.Equal(t, float64(1), testutil.ToFloat64(recorder.operations.WithLabelValues("aws", "my-bucket", "Get", "OK")))
+	require.Equal(t, float64(1),
+		testutil.ToFloat64(recorder.operations.WithLabelValues("aws", "my-bucket", "Get", "NotFound")))
+	require.Equal(t, float64(1),
+		testutil.ToFloat64(recorder.operations.WithLabelValues("aws", "my-bucket", "Get", "Unknown")))
+	require.Equal(t, float64(42), testutil.ToFloat64(recorder.bytes.WithLabelValues("aws", "my-bucket", "Get")))
+	require.Equal(t, 1, testutil.CollectAndCount(recorder.duration))
+
+	bucketRecorder.(commonblobgo.SlowOperationRecorder).RecordSlow("Write", time.Minute, 42)
+	require.Equal(t, float64(1), testutil.ToFloat64(recorder.slow.WithLabelValues("aws", "my-bucket", "Write")))
+
+	// the collectors can't be registered twice
+	_, err = New(registry)
+	require.Error(t, err)
+}
@@ -0,0 +1,256 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// retryMaxDelay caps the backoff between two retries.
+const retryMaxDelay = 5 * time.Second
+
+// retryingCloudStorage retries the idempotent operations of the wrapped CloudStorage which fail with
+// a transient error. The other operations, the streamed writes included, are passed through unchanged.
+type retryingCloudStorage struct {
+	CloudStorage
+}
+
+var _ CloudStorage = (*retryingCloudStorage)(nil)
+
+func newRetryingCloudStorage(inner CloudStorage) CloudStorage {
+	return &retryingCloudStorage{
+		CloudStorage: inner,
+	}
+}
+
+// options returns the settings of the wrapped storage.
+func (ts *retryingCloudStorage) options() storageOptions {
+	return storageOptionsOf(ts.CloudStorage)
+}
+
+// bucketLocation is the one of the wrapped storage, so that CopyObjectBetween still copies by the provider.
+func (ts *retryingCloudStorage) bucketLocation() string {
+	locator, ok := ts.CloudStorage.(bucketLocator)
+	if !ok {
+		return ""
+	}
+
+	return locator.bucketLocation()
+}
+
+// isRetryableError reports whether the error is transient, the limits of this package are not.
+func isRetryableError(err error) bool {
+	if errors.Is(err, ErrLimitExceeded) {
+		return false
+	}
+
+	switch ErrorCode(err) {
+	case ErrorKindResourceExhausted, ErrorKindUnavailable:
+		return true
+	}
+
+	return false
+}
+
+// retry calls f until it succeeds, fails with an error which isn't transient, or runs out of retries.
+// The backoff is exponential with full jitter, and the last error is returned when the context deadline
+// would pass before the next retry.
+func (ts *retryingCloudStorage) retry(ctx context.Context, op, key string, f func(retry int) error) error {
+	options := ts.options()
+
+	for retry := 0; ; retry++ {
+		err := ts.attempt(ctx, op, retry, f)
+		if err == nil || retry >= options.maxRetries || !isRetryableError(err) {
+			return err
+		}
+
+		delay := options.retryBaseDelay << uint(retry)
+		if delay > retryMaxDelay || delay <= 0 {
+			delay = retryMaxDelay
+		}
+
+		//nolint:gosec // the jitter doesn't need a secure random source
+		delay = time.Duration(rand.Int63n(int64(delay) + 1))
+
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return err
+		}
+
+		if options.onRetry != nil {
+			options.onRetry(op, key, retry+1, err)
+		}
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+
+			return err
+		}
+	}
+}
+
+// attempt calls f, in a child span of the operation for the retries when the storage is traced.
+func (ts *retryingCloudStorage) attempt(ctx context.Context, op string, retry int, f func(retry int) error) error {
+	if recorder := opStatsRecorderFrom(ctx); recorder != nil {
+		recorder.attempt()
+	}
+
+	tracer := ts.options().tracer
+	if retry == 0 || tracer == nil {
+		return f(retry)
+	}
+
+	_, span := tracer.Start(ctx, "blob."+op+".retry")
+	span.SetAttribute(TraceAttributeRetry, retry)
+
+	err := f(retry)
+	endSpan(span, -1, err)
+
+	return err
+}
+
+func (ts *retryingCloudStorage) Get(
+	ctx context.Context,
+	key string,
+) ([]byte, error) {
+	var body []byte
+
+	err := ts.retry(ctx, "Get", key, func(int) error {
+		var err error
+		body, err = ts.CloudStorage.Get(ctx, key)
+
+		return err
+	})
+
+	return body, err
+}
+
+func (ts *retryingCloudStorage) Attributes(
+	ctx context.Context,
+	key string,
+) (*Attributes, error) {
+	var attrs *Attributes
+
+	err := ts.retry(ctx, "Attributes", key, func(int) error {
+		var err error
+		attrs, err = ts.CloudStorage.Attributes(ctx, key)
+
+		return err
+	})
+
+	return attrs, err
+}
+
+func (ts *retryingCloudStorage) Exists(
+	ctx context.Context,
+	key string,
+) (bool, error) {
+	var exists bool
+
+	err := ts.retry(ctx, "Exists", key, func(int) error {
+		var err error
+		exists, err = ts.CloudStorage.Exists(ctx, key)
+
+		return err
+	})
+
+	return exists, err
+}
+
+func (ts *retryingCloudStorage) Delete(
+	ctx context.Context,
+	key string,
+) error {
+	return ts.retry(ctx, "Delete", key, func(retry int) error {
+		err := ts.CloudStorage.Delete(ctx, key)
+
+		// the attempt which timed out may have deleted the object
+		if retry > 0 && errors.Is(err, ErrNotFound) {
+			return nil
+		}
+
+		return err
+	})
+}
+
+func (ts *retryingCloudStorage) Write(
+	ctx context.Context,
+	key string,
+	body []byte,
+	contentType *string,
+) error {
+	return ts.retry(ctx, "Write", key, func(int) error {
+		return ts.CloudStorage.Write(ctx, key, body, contentType)
+	})
+}
+
+func (ts *retryingCloudStorage) WriteWithOptions(
+	ctx context.Context,
+	key string,
+	body []byte,
+	opts *WriteOptions,
+) error {
+	// a conditional write which failed may still have been applied, its retry would then fail the condition
+	if opts.hasConditions() {
+		return ts.CloudStorage.WriteWithOptions(ctx, key, body, opts)
+	}
+
+	return ts.retry(ctx, "Write", key, func(int) error {
+		return ts.CloudStorage.WriteWithOptions(ctx, key, body, opts)
+	})
+}
+
+func (ts *retryingCloudStorage) List(
+	ctx context.Context,
+	prefix string,
+) *ListIterator {
+	return ts.retryList(ts.CloudStorage.List(ctx, prefix), prefix)
+}
+
+func (ts *retryingCloudStorage) ListWithOptions(
+	ctx context.Context,
+	options *ListOptions,
+) *ListIterator {
+	return ts.retryList(ts.CloudStorage.ListWithOptions(ctx, options), listOptionsPrefix(options))
+}
+
+// retryList retries the failed page fetches of the replayable listings, which fetch the same page again.
+// The other listings are not retried, since the page after the failed one would be fetched instead.
+func (ts *retryingCloudStorage) retryList(iter *ListIterator, prefix string) *ListIterator {
+	if !iter.replayable {
+		return iter
+	}
+
+	return wrapListIterator(iter, func(ctx context.Context) (*ListObject, error) {
+		var object *ListObject
+
+		err := ts.retry(ctx, "List", prefix, func(int) error {
+			var err error
+			object, err = iter.Next(ctx)
+
+			return err
+		})
+
+		return object, err
+	})
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"sync"
+	"time"
+)
+
+// slowOperationLogInterval is the shortest interval between two warnings about the slow operations of a storage.
+const slowOperationLogInterval = 10 * time.Second
+
+// slowOperationReporter warns about the operations slower than SlowOperationThreshold. The warnings are
+// rate-limited to one per slowOperationLogInterval, the next warning counting the ones which were dropped,
+// while every slow operation is recorded by a MetricsRecorder implementing SlowOperationRecorder.
+type slowOperationReporter struct {
+	threshold  time.Duration
+	logger     Logger
+	metrics    MetricsRecorder
+	bucketName string
+
+	mu         sync.Mutex
+	lastWarned time.Time
+	dropped    int
+}
+
+// newSlowOperationReporter returns nil when the threshold isn't set.
+func newSlowOperationReporter(
+	options storageOptions,
+	metrics MetricsRecorder,
+	bucketName string,
+) *slowOperationReporter {
+	if options.slowOperationThreshold <= 0 {
+		return nil
+	}
+
+	return &slowOperationReporter{
+		threshold:  options.slowOperationThreshold,
+		logger:     options.logger,
+		metrics:    metrics,
+		bucketName: bucketName,
+	}
+}
+
+func (r *slowOperationReporter) report(op OpInfo, dur time.Duration, bytes int64) {
+	if r == nil || dur <= r.threshold {
+		return
+	}
+
+	if bytes < 0 {
+		bytes = 0
+	}
+
+	if recorder, ok := r.metrics.(SlowOperationRecorder); ok {
+		recorder.RecordSlow(op.Name, dur, bytes)
+	}
+
+	r.mu.Lock()
+
+	now := time.Now()
+	if !r.lastWarned.IsZero() && now.Sub(r.lastWarned) < slowOperationLogInterval {
+		r.dropped++
+		r.mu.Unlock()
+
+		return
+	}
+
+	dropped := r.dropped
+	r.lastWarned = now
+	r.dropped = 0
+
+	r.mu.Unlock()
+
+	r.logger.Warnf("slow %s of '%s' in bucket '%s': %s for %d bytes (%d more slow operations not logged)",
+		op.Name, op.Key, r.bucketName, dur, bytes, dropped)
+}
@@ -0,0 +1,213 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// OpStats describes an operation of a storage, see WithStats.
+type OpStats struct {
+	// Bytes is the number of bytes read or written.
+	Bytes int64
+	// Duration is the duration of the operation, until Close for the readers and the writers.
+	Duration time.Duration
+	// Attempts is the number of attempts of the operation, more than 1 when it was retried.
+	Attempts int
+	// RequestID is the ID of the last request to the provider, x-amz-request-id on S3 and x-guploader-uploadid
+	// on GCS, which the support of the provider asks for.
+	RequestID string
+	// HTTPStatus is the status of the last response of the provider, 0 when no response was received.
+	HTTPStatus int
+}
+
+type opStatsKey struct{}
+
+type opStatsRecorderKey struct{}
+
+// WithStats returns a context filling the returned OpStats when it's passed to an operation of the storages
+// opened by a factory. Each operation using the context replaces the stats of the previous one, the context
+// mustn't be shared by concurrent operations. The readers and the writers fill them when they are closed,
+// and the listings don't fill them.
+func WithStats(ctx context.Context) (context.Context, *OpStats) {
+	stats := &OpStats{}
+
+	return context.WithValue(ctx, opStatsKey{}, stats), stats
+}
+
+func opStatsFrom(ctx context.Context) *OpStats {
+	stats, _ := ctx.Value(opStatsKey{}).(*OpStats)
+
+	return stats
+}
+
+// opStatsRecorder collects the attempts and the responses of an operation, for its stats and for the request ID
+// of its error, from the retries and from the HTTP transport of the providers which may run concurrently.
+type opStatsRecorder struct {
+	mu         sync.Mutex
+	attempts   int
+	requestID  string
+	httpStatus int
+	// responses is the number of the responses, and forwarded the number of them passed on by forwardResponse
+	responses int
+	forwarded int
+}
+
+func withOpStatsRecorder(ctx context.Context, recorder *opStatsRecorder) context.Context {
+	return context.WithValue(ctx, opStatsRecorderKey{}, recorder)
+}
+
+func opStatsRecorderFrom(ctx context.Context) *opStatsRecorder {
+	recorder, _ := ctx.Value(opStatsRecorderKey{}).(*opStatsRecorder)
+
+	return recorder
+}
+
+func (r *opStatsRecorder) attempt() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.attempts++
+}
+
+func (r *opStatsRecorder) response(resp *http.Response) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.httpStatus = resp.StatusCode
+	r.responses++
+
+	if id := providerRequestID(resp.Header); id != "" {
+		r.requestID = id
+	}
+}
+
+// forwardResponse records the last response of r in the recorder of an operation, for the requests sent with
+// another context, e.g. the page fetches of the GCS listings.
+func (r *opStatsRecorder) forwardResponse(to *opStatsRecorder) {
+	if to == nil {
+		return
+	}
+
+	r.mu.Lock()
+	requestID, httpStatus, responses := r.requestID, r.httpStatus, r.responses-r.forwarded
+	r.forwarded = r.responses
+	r.mu.Unlock()
+
+	if responses == 0 {
+		return
+	}
+
+	to.mu.Lock()
+	defer to.mu.Unlock()
+
+	to.httpStatus = httpStatus
+	to.responses += responses
+
+	if requestID != "" {
+		to.requestID = requestID
+	}
+}
+
+// responseCount returns the number of the responses recorded so far.
+func (r *opStatsRecorder) responseCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.responses
+}
+
+// withRequestID returns the error with the request ID of the last response, unless the error of the provider
+// already has one. The end of the listings and of the reads isn't wrapped.
+func (r *opStatsRecorder) withRequestID(err error) error {
+	if r == nil || err == nil || err == io.EOF || RequestID(err) != "" {
+		return err
+	}
+
+	r.mu.Lock()
+	requestID := r.requestID
+	r.mu.Unlock()
+
+	if requestID == "" {
+		return err
+	}
+
+	return &requestIDError{err: err, requestID: requestID}
+}
+
+// fill sets the stats of the ended operation.
+func (r *opStatsRecorder) fill(stats *OpStats, bytes int64, duration time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if bytes < 0 {
+		bytes = 0
+	}
+
+	// the operations which aren't retried are attempted once
+	attempts := r.attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	*stats = OpStats{
+		Bytes:      bytes,
+		Duration:   duration,
+		Attempts:   attempts,
+		RequestID:  r.requestID,
+		HTTPStatus: r.httpStatus,
+	}
+}
+
+// providerRequestID returns the request ID of the response of S3 or GCS.
+func providerRequestID(header http.Header) string {
+	if id := header.Get("X-Amz-Request-Id"); id != "" {
+		return id
+	}
+
+	return header.Get("X-Guploader-Uploadid")
+}
+
+// newProviderTransport returns the transport of the HTTP clients of the providers, recording the responses
+// for WithStats and the request IDs of the errors, and logging the exchanges with DebugHTTP.
+func newProviderTransport(base http.RoundTripper, debugger *httpDebugger) http.RoundTripper {
+	return &statsTransport{base: debugger.transport(base)}
+}
+
+func newProviderHTTPClient(debugger *httpDebugger) *http.Client {
+	return &http.Client{Transport: newProviderTransport(nil, debugger)}
+}
+
+// statsTransport records the responses of the providers for the operations, the requests carry the context of
+// the operation.
+type statsTransport struct {
+	base http.RoundTripper
+}
+
+func (t *statsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+
+	if recorder := opStatsRecorderFrom(req.Context()); recorder != nil && err == nil {
+		recorder.response(resp)
+	}
+
+	return resp, err
+}
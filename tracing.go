@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"context"
+	"io"
+)
+
+// Tracer starts the spans of the storage operations. It's the subset of the OpenTelemetry trace.Tracer used by
+// the storages, so that this package doesn't depend on OpenTelemetry, see the README for the adapter.
+type Tracer interface {
+	// Start starts a span which is a child of the span of ctx, if any, and returns the context holding it.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a span started by Tracer.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	RecordError(err error)
+	End()
+}
+
+// span attributes of the storage operations
+const (
+	// TraceAttributeProvider is the provider of the bucket, "aws" or "gcp".
+	TraceAttributeProvider = "blob.provider"
+	// TraceAttributeBucket is the name of the bucket.
+	TraceAttributeBucket = "blob.bucket"
+	// TraceAttributeKey is the key or the key prefix of the operation, hashed with CloudStorageOption.TraceHashKeys.
+	TraceAttributeKey = "blob.key"
+	// TraceAttributeBytes is the number of bytes read or written, when it's known.
+	TraceAttributeBytes = "blob.bytes"
+	// TraceAttributeErrorKind is the ErrorKind of the failed operations.
+	TraceAttributeErrorKind = "blob.error_kind"
+	// TraceAttributeObjects is the number of objects returned by a listing.
+	TraceAttributeObjects = "blob.objects"
+	// TraceAttributeRetry is the number of the retry, from 1.
+	TraceAttributeRetry = "blob.retry"
+)
+
+// noopTracer starts the spans of the storages without Tracer.
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, interface{}) {}
+
+func (noopSpan) RecordError(error) {}
+
+func (noopSpan) End() {}
+
+// endSpan ends the span with the number of bytes when it's not negative, and the kind of the error.
+func endSpan(span Span, bytes int64, err error) {
+	if bytes >= 0 {
+		span.SetAttribute(TraceAttributeBytes, bytes)
+	}
+
+	if err != nil && err != io.EOF {
+		span.SetAttribute(TraceAttributeErrorKind, ErrorCode(err).String())
+		span.RecordError(err)
+	}
+
+	span.End()
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2020 AccelByte Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and limitations under the License.
+ *
+ */
+
+package commonblobgo
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// SkipAll is returned by a WalkPrefix callback to stop the walk without error.
+var SkipAll = errors.New("skip all objects") //nolint:golint,stylecheck
+
+// WalkPrefix calls fn for each object under the prefix, the nested ones included.
+// The walk stops at the first error returned by fn, which is returned unless it's SkipAll,
+// and when the context is canceled, in which case the context error is returned.
+func WalkPrefix(ctx context.Context, storage CloudStorage, prefix string, fn func(*ListObject) error) error {
+	iter := storage.ListWithOptions(ctx, &ListOptions{
+		Prefix: prefix,
+	})
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		object, err := iter.Next(ctx)
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := fn(object); err != nil {
+			if errors.Is(err, SkipAll) {
+				return nil
+			}
+
+			return err
+		}
+	}
+}